@@ -24,6 +24,17 @@ type cacheRequest struct {
 	key      string
 	duration int
 	files    []string
+	// unverifiedOnly is set when the verified Puts were already made synchronously
+	unverifiedOnly bool
+}
+
+// verifiedPutter is implemented by caches that verify some of their Puts. Those must finish
+// before Put returns, so that the task that produced the artifact sees a failed verification.
+type verifiedPutter interface {
+	// putVerified stores the artifact in the caches that verify it
+	putVerified(target string, key string, duration int, files []string) error
+	// putUnverified stores the artifact in the remaining caches
+	putUnverified(target string, key string, duration int, files []string) error
 }
 
 func newAsyncCache(realCache Cache, opts Opts) Cache {
@@ -39,11 +50,18 @@ func newAsyncCache(realCache Cache, opts Opts) Cache {
 }
 
 func (c *asyncCache) Put(target string, key string, duration int, files []string) error {
+	verified, ok := c.realCache.(verifiedPutter)
+	if ok {
+		if err := verified.putVerified(target, key, duration, files); err != nil {
+			return err
+		}
+	}
 	c.requests <- cacheRequest{
-		target:   target,
-		key:      key,
-		files:    files,
-		duration: duration,
+		target:         target,
+		key:            key,
+		files:          files,
+		duration:       duration,
+		unverifiedOnly: ok,
 	}
 	return nil
 }
@@ -65,12 +83,17 @@ func (c *asyncCache) Shutdown() {
 	close(c.requests)
 	c.wg.Wait()
 	// fmt.Println("Shut down all cache workers")
+	c.realCache.Shutdown()
 }
 
 // run implements the actual async logic.
 func (c *asyncCache) run() {
 	for r := range c.requests {
-		c.realCache.Put(r.target, r.key, r.duration, r.files)
+		if r.unverifiedOnly {
+			c.realCache.(verifiedPutter).putUnverified(r.target, r.key, r.duration, r.files)
+		} else {
+			c.realCache.Put(r.target, r.key, r.duration, r.files)
+		}
 	}
 	c.wg.Done()
 }
@@ -8,13 +8,18 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/vercel/turborepo/cli/internal/analytics"
+	"github.com/vercel/turborepo/cli/internal/doublestar"
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
-	"github.com/vercel/turborepo/cli/internal/ui"
 	"github.com/vercel/turborepo/cli/internal/util"
 	"golang.org/x/sync/errgroup"
 )
@@ -22,7 +27,8 @@ import (
 // Cache is abstracted way to cache/fetch previously run tasks
 type Cache interface {
 	// Fetch returns true if there is a cache it. It is expected to move files
-	// into their correct position as a side effect
+	// into their correct position as a side effect. Files matching the "!"-prefixed
+	// repo-relative globs among files are left as they are rather than restored.
 	Fetch(target string, hash string, files []string) (bool, []string, int, error)
 	// Put caches files for a given hash
 	Put(target string, hash string, duration int, files []string) error
@@ -62,30 +68,460 @@ type Opts struct {
 	SkipFilesystem  bool
 	Workers         int
 	RemoteCacheOpts fs.RemoteCacheOptions
+	// HardlinkOutputs restores outputs from the filesystem cache via hardlinks rather than copies
+	HardlinkOutputs bool
+	// StagedRestore restores outputs into a staging directory before moving them into place
+	StagedRestore bool
+	// OnlyChangedOutputs leaves restored files that are already on disk with the same contents untouched
+	OnlyChangedOutputs bool
+	// SourcePriority controls whether the local or remote cache is checked first on Fetch
+	SourcePriority SourcePriority
+	// Compression is how the filesystem cache stores new artifacts
+	Compression Compression
+	// MaxSize is the size in bytes beyond which the least recently used entries are evicted
+	// from the filesystem cache. Zero means no limit.
+	MaxSize int64
+	// RestoreFilter, if non-empty, lists globs relative to the repository root. Only the files
+	// of a cached artifact matching one of them are restored.
+	RestoreFilter []string
+	// MetadataIndex maintains an index of the filesystem cache's entries, which cache
+	// maintenance reads instead of every metadata file
+	MetadataIndex bool
+	// VerifyOutputs records a keyed hash of the outputs in the filesystem cache's metadata,
+	// and fails restores from artifacts that don't match it. Remote artifacts must be signed.
+	VerifyOutputs bool
+	// VerifyPuts reads back each artifact written to the filesystem cache, and fails the
+	// Put if it doesn't match the outputs it was written from
+	VerifyPuts bool
+	// RemoteTimeout bounds how long each fetch from and upload to the remote cache may spend
+	// connecting and waiting for a response. Transferring the artifact itself isn't bounded.
+	// Zero means no limit.
+	RemoteTimeout time.Duration
+	// NegotiateCompression asks the remote cache for zstd artifacts, and uploads zstd
+	// artifacts once it advertises that it accepts them
+	NegotiateCompression bool
+	// Access, if set, is whether each cache source is read from and written to. SkipFilesystem
+	// and SkipRemote still disable their source entirely.
+	Access *Access
 }
 
+// Actions are what a cache source is used for
+type Actions struct {
+	Read  bool
+	Write bool
+}
+
+// Enabled returns true if the cache source is used at all
+func (a Actions) Enabled() bool {
+	return a.Read || a.Write
+}
+
+func (a Actions) String() string {
+	actions := ""
+	if a.Read {
+		actions += "r"
+	}
+	if a.Write {
+		actions += "w"
+	}
+	return actions
+}
+
+// Access is the Actions of each cache source
+type Access struct {
+	Local  Actions
+	Remote Actions
+}
+
+// _defaultAccess reads from and writes to both cache sources
+var _defaultAccess = Access{
+	Local:  Actions{Read: true, Write: true},
+	Remote: Actions{Read: true, Write: true},
+}
+
+func (a Access) String() string {
+	sources := []string{}
+	if a.Local.Enabled() {
+		sources = append(sources, "local:"+a.Local.String())
+	}
+	if a.Remote.Enabled() {
+		sources = append(sources, "remote:"+a.Remote.String())
+	}
+	return strings.Join(sources, ",")
+}
+
+// ParseAccess parses a comma-separated list of cache sources and their actions, such as
+// "local:r,remote:rw". Sources that aren't listed are disabled.
+func ParseAccess(value string) (Access, error) {
+	access := Access{}
+	seen := make(util.Set)
+	for _, item := range strings.Split(value, ",") {
+		source, actionsString, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return Access{}, fmt.Errorf("%q must be a cache source and its actions, such as \"local:rw\"", item)
+		}
+		var actions Actions
+		switch actionsString {
+		case "r":
+			actions = Actions{Read: true}
+		case "w":
+			actions = Actions{Write: true}
+		case "rw":
+			actions = Actions{Read: true, Write: true}
+		default:
+			return Access{}, fmt.Errorf("invalid actions %q for the %v cache, must be one of \"r|w|rw\"", actionsString, source)
+		}
+		if seen.Includes(source) {
+			return Access{}, fmt.Errorf("the %v cache is listed more than once", source)
+		}
+		seen.Add(source)
+		switch source {
+		case "local":
+			access.Local = actions
+		case "remote":
+			access.Remote = actions
+		default:
+			return Access{}, fmt.Errorf("unknown cache source %q, must be one of \"local|remote\"", source)
+		}
+	}
+	return access, nil
+}
+
+// resolveAccess returns what each cache source is used for
+func (o *Opts) resolveAccess() Access {
+	access := _defaultAccess
+	if o.Access != nil {
+		access = *o.Access
+	}
+	if o.SkipFilesystem {
+		access.Local = Actions{}
+	}
+	if o.SkipRemote {
+		access.Remote = Actions{}
+	}
+	return access
+}
+
+// RemoteEnabled reports whether the remote cache is read from or written to
+func (o *Opts) RemoteEnabled() bool {
+	return o.resolveAccess().Remote.Enabled()
+}
+
+// accessFlag sets Opts.Access from --cache
+type accessFlag struct {
+	opts *Opts
+}
+
+// String implements pflag.Value
+func (f *accessFlag) String() string {
+	if f.opts == nil || f.opts.Access == nil {
+		return _defaultAccess.String()
+	}
+	return f.opts.Access.String()
+}
+
+// Set implements pflag.Value
+func (f *accessFlag) Set(value string) error {
+	access, err := ParseAccess(value)
+	if err != nil {
+		return err
+	}
+	f.opts.Access = &access
+	return nil
+}
+
+// Type implements pflag.Value
+func (f *accessFlag) Type() string {
+	return "source:actions"
+}
+
+var _ pflag.Value = (*accessFlag)(nil)
+
+// RemoteTimeoutEnv overrides the default of --remote-cache-timeout
+const RemoteTimeoutEnv = "TURBO_REMOTE_CACHE_TIMEOUT"
+
+// _defaultRemoteTimeout is long enough for a busy remote cache to respond, while still
+// keeping an unresponsive one from stalling a run indefinitely
+const _defaultRemoteTimeout = 60 * time.Second
+
+// restoreFilterMatcher returns a function reporting whether a repo-relative path matches
+// one of the RestoreFilter globs, or nil if every file should be restored
+func (o *Opts) restoreFilterMatcher() func(repoRelativePath string) bool {
+	if len(o.RestoreFilter) == 0 {
+		return nil
+	}
+	globs := o.RestoreFilter
+	return func(repoRelativePath string) bool {
+		return matchesAnyGlob(globs, repoRelativePath)
+	}
+}
+
+// fetchRestoreFilter returns the restore filter for a Fetch of the given output globs. It is
+// restoreFilter, further limited to skip the files matching the "!"-prefixed repo-relative
+// globs among the outputs, or nil if every file should be restored.
+func fetchRestoreFilter(restoreFilter func(repoRelativePath string) bool, outputGlobs []string) func(repoRelativePath string) bool {
+	_, exclusions := fs.SplitOutputGlobs(outputGlobs)
+	if len(exclusions) == 0 {
+		return restoreFilter
+	}
+	return func(repoRelativePath string) bool {
+		if matchesAnyGlob(exclusions, repoRelativePath) {
+			return false
+		}
+		return restoreFilter == nil || restoreFilter(repoRelativePath)
+	}
+}
+
+// matchesAnyGlob returns whether a repo-relative path matches one of the given globs
+func matchesAnyGlob(globs []string, repoRelativePath string) bool {
+	for _, glob := range globs {
+		if matches, err := doublestar.Match(filepath.ToSlash(glob), filepath.ToSlash(repoRelativePath)); err == nil && matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Compression is the form in which the filesystem cache stores an artifact
+type Compression string
+
+const (
+	// CompressionNone stores an artifact as a directory of loose files
+	CompressionNone Compression = "none"
+	// CompressionGzip stores an artifact as a single gzipped tarball
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd stores an artifact as a single zstd-compressed tarball
+	CompressionZstd Compression = "zstd"
+)
+
+var _compressions = []Compression{CompressionNone, CompressionGzip, CompressionZstd}
+
+// _archiveCompressions are the compressions that store an artifact as a single archive
+var _archiveCompressions = []Compression{CompressionGzip, CompressionZstd}
+
+// String implements pflag.Value
+func (c *Compression) String() string {
+	if *c == "" {
+		return string(CompressionNone)
+	}
+	return string(*c)
+}
+
+// Set implements pflag.Value
+func (c *Compression) Set(value string) error {
+	for _, compression := range _compressions {
+		if value == string(compression) {
+			*c = compression
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of \"%v\"", c.Type())
+}
+
+// Type implements pflag.Value
+func (c *Compression) Type() string {
+	names := make([]string, len(_compressions))
+	for i, compression := range _compressions {
+		names[i] = string(compression)
+	}
+	return strings.Join(names, "|")
+}
+
+var _ pflag.Value = (*Compression)(nil)
+
+// SourcePriority is the order in which cache sources are checked for an artifact
+type SourcePriority string
+
+const (
+	// SourcePriorityLocal checks the filesystem cache before the remote cache
+	SourcePriorityLocal SourcePriority = "local"
+	// SourcePriorityRemote checks the remote cache before the filesystem cache
+	SourcePriorityRemote SourcePriority = "remote"
+	// SourcePriorityAuto checks whichever cache has recently been fastest to respond first
+	SourcePriorityAuto SourcePriority = "auto"
+)
+
+var _sourcePriorities = []SourcePriority{SourcePriorityLocal, SourcePriorityRemote, SourcePriorityAuto}
+
+// String implements pflag.Value
+func (p *SourcePriority) String() string {
+	if *p == "" {
+		return string(SourcePriorityLocal)
+	}
+	return string(*p)
+}
+
+// Set implements pflag.Value
+func (p *SourcePriority) Set(value string) error {
+	for _, priority := range _sourcePriorities {
+		if value == string(priority) {
+			*p = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of \"%v\"", p.Type())
+}
+
+// Type implements pflag.Value
+func (p *SourcePriority) Type() string {
+	names := make([]string, len(_sourcePriorities))
+	for i, priority := range _sourcePriorities {
+		names[i] = string(priority)
+	}
+	return strings.Join(names, "|")
+}
+
+var _ pflag.Value = (*SourcePriority)(nil)
+
 // ResolveCacheDir calculates the location turbo should use to cache artifacts,
 // based on the options supplied by the user.
 func (o *Opts) ResolveCacheDir(repoRoot turbopath.AbsolutePath) turbopath.AbsolutePath {
-	if o.OverrideDir != "" {
-		return fs.ResolveUnknownPath(repoRoot, o.OverrideDir)
+	return o.ResolveCacheDirs(repoRoot)[0]
+}
+
+// ResolveCacheDirs calculates the locations turbo should read cached artifacts from, in
+// priority order. OverrideDir may list several directories separated by the OS path list
+// separator. Artifacts are only written to the first one.
+func (o *Opts) ResolveCacheDirs(repoRoot turbopath.AbsolutePath) []turbopath.AbsolutePath {
+	dirs := []turbopath.AbsolutePath{}
+	for _, dir := range filepath.SplitList(o.OverrideDir) {
+		if dir != "" {
+			dirs = append(dirs, fs.ResolveUnknownPath(repoRoot, dir))
+		}
+	}
+	if len(dirs) == 0 {
+		return []turbopath.AbsolutePath{DefaultLocation(repoRoot)}
 	}
-	return DefaultLocation(repoRoot)
+	return dirs
 }
 
 var _remoteOnlyHelp = `Ignore the local filesystem cache for all tasks. Only
 allow reading and caching artifacts using the remote cache.`
 
+var _cacheDirHelp = `Override the filesystem cache directory. Separate multiple
+directories with ':' (';' on Windows) to also restore from
+fallback directories, in order. Only the first is written to.`
+
+var _hardlinkOutputsHelp = `Restore outputs from the local filesystem cache as hardlinks
+instead of copies when possible. Restored files share their
+contents with the cached artifact, so turbo copies a task's
+outputs before running it. Other tools must not modify them in
+place, which would also modify the cache. Replace them
+instead, e.g. by writing a new file and renaming it.`
+
+var _stagedRestoreHelp = `Restore cached outputs into a staging directory and only
+move them into place once complete, so that an interrupted
+restore doesn't leave partially restored outputs behind. If
+moving them into place is interrupted, the outputs it already
+replaced are put back.`
+
+var _onlyChangedOutputsHelp = `When restoring outputs from the cache, leave files that
+already exist with the same contents untouched, so that their
+modification times are kept and file watchers aren't triggered.
+Comparing each file has a cost, and this has no effect with
+--experimental-partial-restore-on-interrupt.`
+
+var _sourcePriorityHelp = `Set which cache is checked first when both the local and
+remote caches are enabled. "auto" checks whichever has
+recently responded fastest first.`
+
+var _compressionHelp = `Set how the local filesystem cache stores new artifacts.
+"gzip" and "zstd" store a single archive per task rather than
+a copy of each output file. Existing artifacts are restored
+in any of these forms.`
+
+var _maxSizeHelp = `Evict the least recently used artifacts from the local
+filesystem cache whenever it grows beyond this many bytes.
+Defaults to 0, which never evicts.`
+
+var _metadataIndexHelp = `Keep an index of the local filesystem cache's entries,
+rebuilding it if it is missing or corrupt, so that cache
+maintenance doesn't need to read every entry's metadata.`
+
+var _verifyOutputsHelp = `Record a keyed hash of each task's outputs when caching them
+locally, and check artifacts against it before restoring them.
+Artifacts that don't match are removed and the task is executed.
+Artifacts cached without a hash are treated as misses.
+Remote artifacts must be signed instead, which requires
+TURBO_REMOTE_CACHE_SIGNATURE_KEY. That key also keys local
+hashes when set, otherwise a key in the turbo data directory.`
+
+var _verifyPutsHelp = `After writing each task's outputs to the local cache, read the
+artifact back and check that it is complete. Artifacts that
+aren't are removed from the cache and the error is logged.
+Outputs are then written to the local cache before each task
+completes. The remote cache is still written in the background.`
+
+var _remoteTimeoutHelp = `Give up on a fetch from or upload to the remote cache if
+connecting or waiting for a response takes longer than this.
+Transferring the artifact itself isn't limited. A fetch that
+times out is a cache miss, and an upload that times out is
+skipped. Can also be set with ` + RemoteTimeoutEnv + `.
+Set to 0 to never time out.`
+
+// ResolveRemoteTimeout sets RemoteTimeout from RemoteTimeoutEnv, unless the flag was given
+func (o *Opts) ResolveRemoteTimeout(flags *pflag.FlagSet) error {
+	value := os.Getenv(RemoteTimeoutEnv)
+	if value == "" || flags.Changed("remote-cache-timeout") {
+		return nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", RemoteTimeoutEnv, err)
+	}
+	o.RemoteTimeout = timeout
+	return nil
+}
+
+var _negotiateCompressionHelp = `Ask the remote cache for zstd-compressed artifacts, falling
+back to gzip, and upload zstd artifacts once the server has
+advertised that it accepts them with an Accept-Encoding
+response header.`
+
+var _cacheAccessHelp = `Set which caches are read from and written to, as a list of
+"local" or "remote", each followed by ":r", ":w" or ":rw".
+Caches that aren't listed are disabled, so --remote-only is
+the same as "remote:rw". --force still skips reading from,
+and --no-cache still skips writing to, every cache.`
+
 // AddFlags adds cache-related flags to the given FlagSet
 func AddFlags(opts *Opts, flags *pflag.FlagSet) {
 	// skipping remote caching not currently a flag
 	flags.BoolVar(&opts.SkipFilesystem, "remote-only", false, _remoteOnlyHelp)
-	flags.StringVar(&opts.OverrideDir, "cache-dir", "", "Override the filesystem cache directory.")
+	flags.StringVar(&opts.OverrideDir, "cache-dir", "", _cacheDirHelp)
 	flags.IntVar(&opts.Workers, "cache-workers", 10, "Set the number of concurrent cache operations")
+	flags.BoolVar(&opts.HardlinkOutputs, "experimental-task-outputs-hardlink", false, _hardlinkOutputsHelp)
+	flags.BoolVar(&opts.StagedRestore, "experimental-partial-restore-on-interrupt", false, _stagedRestoreHelp)
+	flags.BoolVar(&opts.OnlyChangedOutputs, "only-changed-outputs", false, _onlyChangedOutputsHelp)
+	flags.Var(&opts.SourcePriority, "experimental-cache-source-priority", _sourcePriorityHelp)
+	flags.Var(&opts.Compression, "experimental-cache-compression", _compressionHelp)
+	flags.Int64Var(&opts.MaxSize, "experimental-cache-max-size", 0, _maxSizeHelp)
+	flags.BoolVar(&opts.MetadataIndex, "experimental-cache-metadata-index", false, _metadataIndexHelp)
+	flags.BoolVar(&opts.VerifyOutputs, "experimental-output-verification-hash", false, _verifyOutputsHelp)
+	flags.BoolVar(&opts.VerifyPuts, "experimental-cache-put-verification", false, _verifyPutsHelp)
+	flags.DurationVar(&opts.RemoteTimeout, "remote-cache-timeout", _defaultRemoteTimeout, _remoteTimeoutHelp)
+	flags.Var(&accessFlag{opts: opts}, "cache", _cacheAccessHelp)
+	flags.BoolVar(&opts.NegotiateCompression, "experimental-remote-cache-compression-negotiation", false, _negotiateCompressionHelp)
 }
 
 // New creates a new cache
 func New(opts Opts, repoRoot turbopath.AbsolutePath, client client, recorder analytics.Recorder, onCacheRemoved OnCacheRemoved) (Cache, error) {
+	return newCache(opts, repoRoot, client, recorder, onCacheRemoved)
+}
+
+// NewScoped creates a cache restricted to the given scope, for use by tasks that opt out of
+// either the filesystem or the remote cache. Caches disabled by opts remain disabled.
+func NewScoped(opts Opts, scope fs.CacheScope, repoRoot turbopath.AbsolutePath, client client, recorder analytics.Recorder, onCacheRemoved OnCacheRemoved) (Cache, error) {
+	switch scope {
+	case fs.CacheScopeLocal:
+		opts.SkipRemote = true
+	case fs.CacheScopeRemote:
+		opts.SkipFilesystem = true
+	}
+	return newCache(opts, repoRoot, client, recorder, onCacheRemoved)
+}
+
+func newCache(opts Opts, repoRoot turbopath.AbsolutePath, client client, recorder analytics.Recorder, onCacheRemoved OnCacheRemoved) (Cache, error) {
 	c, err := newSyncCache(opts, repoRoot, client, recorder, onCacheRemoved)
 	if err != nil && !errors.Is(err, ErrNoCachesEnabled) {
 		return nil, err
@@ -99,8 +535,9 @@ func New(opts Opts, repoRoot turbopath.AbsolutePath, client client, recorder ana
 // newSyncCache can return an error with a usable noopCache.
 func newSyncCache(opts Opts, repoRoot turbopath.AbsolutePath, client client, recorder analytics.Recorder, onCacheRemoved OnCacheRemoved) (Cache, error) {
 	// Check to see if the user has turned off particular cache implementations.
-	useFsCache := !opts.SkipFilesystem
-	useHTTPCache := !opts.SkipRemote
+	access := opts.resolveAccess()
+	useFsCache := access.Local.Enabled()
+	useRemoteCache := access.Remote.Enabled()
 
 	// Since the above two flags are not mutually exclusive it is possible to configure
 	// yourself out of having a cache. We should tell you about it but we shouldn't fail
@@ -109,7 +546,7 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsolutePath, client client, rec
 	// Further, since the httpCache can be removed at runtime, we need to insert a noopCache
 	// as a backup if you are configured to have *just* an httpCache.
 	//
-	// This is reduced from (!useFsCache && !useHTTPCache) || (!useFsCache & useHTTPCache)
+	// This is reduced from (!useFsCache && !useRemoteCache) || (!useFsCache & useRemoteCache)
 	useNoopCache := !useFsCache
 
 	// Build up an array of cache implementations, we can only ever have 1 or 2.
@@ -123,10 +560,14 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsolutePath, client client, rec
 		cacheImplementations = append(cacheImplementations, implementation)
 	}
 
-	if useHTTPCache {
-		fmt.Println(ui.Dim("• Remote computation caching enabled"))
-		implementation := newHTTPCache(opts, client, recorder, repoRoot)
-		cacheImplementations = append(cacheImplementations, implementation)
+	if useRemoteCache {
+		// A bucket configured in the environment takes the place of the HTTP cache
+		if s3Opts := s3OptionsFromEnv(); s3Opts != nil {
+			cacheImplementations = append(cacheImplementations, newS3Cache(opts, s3Opts, recorder, repoRoot))
+		} else {
+			implementation := newHTTPCache(opts, client, recorder, repoRoot)
+			cacheImplementations = append(cacheImplementations, implementation)
+		}
 	}
 
 	if useNoopCache {
@@ -165,10 +606,35 @@ type cacheMultiplexer struct {
 	opts           Opts
 	mu             sync.RWMutex
 	onCacheRemoved OnCacheRemoved
+
+	// latencyMu guards latencies, the moving average of how long each cache takes to Fetch
+	latencyMu sync.Mutex
+	latencies map[Cache]time.Duration
 }
 
 func (mplex *cacheMultiplexer) Put(target string, key string, duration int, files []string) error {
-	return mplex.storeUntil(target, key, duration, files, len(mplex.caches))
+	return mplex.storeIn(target, key, duration, files, mplex.putCaches(func(Cache) bool { return true }))
+}
+
+func (mplex *cacheMultiplexer) putVerified(target string, key string, duration int, files []string) error {
+	return mplex.storeIn(target, key, duration, files, mplex.putCaches(verifiesPuts))
+}
+
+func (mplex *cacheMultiplexer) putUnverified(target string, key string, duration int, files []string) error {
+	return mplex.storeIn(target, key, duration, files, mplex.putCaches(func(c Cache) bool { return !verifiesPuts(c) }))
+}
+
+// putCaches returns a copy of the caches that include returns true for
+func (mplex *cacheMultiplexer) putCaches(include func(Cache) bool) []Cache {
+	mplex.mu.RLock()
+	defer mplex.mu.RUnlock()
+	caches := make([]Cache, 0, len(mplex.caches))
+	for _, cache := range mplex.caches {
+		if include(cache) {
+			caches = append(caches, cache)
+		}
+	}
+	return caches
 }
 
 type cacheRemoval struct {
@@ -176,18 +642,13 @@ type cacheRemoval struct {
 	err   *util.CacheDisabledError
 }
 
-// storeUntil stores artifacts into higher priority caches than the given one.
-// Used after artifact retrieval to ensure we have them in eg. the directory cache after
-// downloading from the RPC cache.
-func (mplex *cacheMultiplexer) storeUntil(target string, key string, duration int, files []string, stopAt int) error {
+// storeIn stores artifacts into the given caches. Used after artifact retrieval to ensure
+// we have them in eg. the directory cache after downloading from the RPC cache.
+func (mplex *cacheMultiplexer) storeIn(target string, key string, duration int, files []string, caches []Cache) error {
 	// Attempt to store on all caches simultaneously.
-	toRemove := make([]*cacheRemoval, stopAt)
+	toRemove := make([]*cacheRemoval, len(caches))
 	g := &errgroup.Group{}
-	mplex.mu.RLock()
-	for i, cache := range mplex.caches {
-		if i == stopAt {
-			break
-		}
+	for i, cache := range caches {
 		c := cache
 		i := i
 		g.Go(func() error {
@@ -207,7 +668,6 @@ func (mplex *cacheMultiplexer) storeUntil(target string, key string, duration in
 			return nil
 		})
 	}
-	mplex.mu.RUnlock()
 
 	if err := g.Wait(); err != nil {
 		return err
@@ -236,17 +696,63 @@ func (mplex *cacheMultiplexer) removeCache(removal *cacheRemoval) {
 	}
 }
 
-func (mplex *cacheMultiplexer) Fetch(target string, key string, files []string) (bool, []string, int, error) {
-	// Make a shallow copy of the caches, since storeUntil can call removeCache
+// fetchOrder returns a copy of the caches in the order they should be checked for an
+// artifact, according to the configured SourcePriority.
+func (mplex *cacheMultiplexer) fetchOrder() []Cache {
+	// Make a shallow copy of the caches, since storeIn can call removeCache
 	mplex.mu.RLock()
 	caches := make([]Cache, len(mplex.caches))
 	copy(caches, mplex.caches)
 	mplex.mu.RUnlock()
 
+	switch mplex.opts.SourcePriority {
+	case SourcePriorityRemote:
+		sort.SliceStable(caches, func(i, j int) bool {
+			return isRemoteCache(caches[i]) && !isRemoteCache(caches[j])
+		})
+	case SourcePriorityAuto:
+		mplex.latencyMu.Lock()
+		// Caches that haven't been measured yet sort first, so that each one gets measured
+		sort.SliceStable(caches, func(i, j int) bool {
+			return mplex.latencies[caches[i]] < mplex.latencies[caches[j]]
+		})
+		mplex.latencyMu.Unlock()
+	}
+	return caches
+}
+
+func isRemoteCache(cache Cache) bool {
+	switch cache.(type) {
+	case *httpCache, *s3Cache:
+		return true
+	}
+	return false
+}
+
+// recordLatency folds the time taken by a single Fetch into the moving average for that cache
+func (mplex *cacheMultiplexer) recordLatency(cache Cache, latency time.Duration) {
+	mplex.latencyMu.Lock()
+	defer mplex.latencyMu.Unlock()
+	if mplex.latencies == nil {
+		mplex.latencies = make(map[Cache]time.Duration)
+	}
+	if previous, ok := mplex.latencies[cache]; ok {
+		latency = previous + (latency-previous)/4
+	}
+	mplex.latencies[cache] = latency
+}
+
+func (mplex *cacheMultiplexer) Fetch(target string, key string, files []string) (bool, []string, int, error) {
+	caches := mplex.fetchOrder()
+
 	// Retrieve from caches sequentially; if we did them simultaneously we could
 	// easily write the same file from two goroutines at once.
 	for i, cache := range caches {
+		start := time.Now()
 		ok, actualFiles, duration, err := cache.Fetch(target, key, files)
+		if mplex.opts.SourcePriority == SourcePriorityAuto {
+			mplex.recordLatency(cache, time.Since(start))
+		}
 		if err != nil {
 			cd := &util.CacheDisabledError{}
 			if errors.As(err, &cd) {
@@ -261,10 +767,14 @@ func (mplex *cacheMultiplexer) Fetch(target string, key string, files []string)
 			// should probably log this at least.
 		}
 		if ok {
-			// Store this into other caches. We can ignore errors here because we know
-			// we have previously successfully stored in a higher-priority cache, and so the overall
-			// result is a success at fetching. Storing in lower-priority caches is an optimization.
-			_ = mplex.storeUntil(target, key, duration, actualFiles, i)
+			if _, exclusions := fs.SplitOutputGlobs(files); len(mplex.opts.RestoreFilter) > 0 || len(exclusions) > 0 {
+				// Only part of the artifact was restored, so there is nothing complete to store
+				return ok, actualFiles, duration, err
+			}
+			// Store this into the caches that missed. We can ignore errors here because we know
+			// we have previously successfully stored in another cache, and so the overall
+			// result is a success at fetching. Backfilling the other caches is an optimization.
+			_ = mplex.storeIn(target, key, duration, actualFiles, caches[:i])
 			return ok, actualFiles, duration, err
 		}
 	}
@@ -4,11 +4,16 @@
 package cache
 
 import (
+	"archive/tar"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/analytics"
 	"github.com/vercel/turborepo/cli/internal/fs"
@@ -19,48 +24,251 @@ import (
 // fsCache is a local filesystem cache
 type fsCache struct {
 	cacheDirectory string
-	recorder       analytics.Recorder
-	repoRoot       turbopath.AbsolutePath
+	// fallbackDirectories are read from, in order, if an artifact isn't in cacheDirectory
+	fallbackDirectories []string
+	recorder            analytics.Recorder
+	repoRoot            turbopath.AbsolutePath
+	hardlink            bool
+	stagedRestore       bool
+	// onlyChangedOutputs leaves files that are already restored untouched
+	onlyChangedOutputs bool
+	compression        Compression
+	// evictor is nil unless the cache has a size limit
+	evictor *evictor
+	// restoreFilter, if set, limits which files of an artifact are restored
+	restoreFilter func(repoRelativePath string) bool
+	// verifyOutputs records a keyed hash of each artifact's files, and checks the artifact
+	// against it before restoring from it
+	verifyOutputs bool
+	// verificationKey keys the hashes recorded by verifyOutputs
+	verificationKey []byte
+	// verifyPuts reads back each artifact after writing it, and removes it if it is incomplete
+	verifyPuts bool
+	// readsDisabled and writesDisabled are set by --cache, such as "local:r" for a read-only cache
+	readsDisabled  bool
+	writesDisabled bool
 }
 
+// _gzipArchiveExtension is appended to the hash to name an artifact stored as a gzipped tarball
+const _gzipArchiveExtension = ".tar.gz"
+
+// _zstdArchiveExtension is appended to the hash to name an artifact stored as a zstd-compressed tarball
+const _zstdArchiveExtension = ".tar.zst"
+
+// _metaFileSuffix is appended to the hash to name the metadata file for an artifact
+const _metaFileSuffix = "-meta.json"
+
 // newFsCache creates a new filesystem cache
 func newFsCache(opts Opts, recorder analytics.Recorder, repoRoot turbopath.AbsolutePath) (*fsCache, error) {
-	cacheDir := opts.ResolveCacheDir(repoRoot)
+	cacheDirs := opts.ResolveCacheDirs(repoRoot)
+	cacheDir := cacheDirs[0]
 	if err := cacheDir.MkdirAll(); err != nil {
 		return nil, err
 	}
-	return &fsCache{
-		cacheDirectory: cacheDir.ToStringDuringMigration(),
-		recorder:       recorder,
-		repoRoot:       repoRoot,
-	}, nil
+	fallbackDirectories := make([]string, 0, len(cacheDirs)-1)
+	for _, dir := range cacheDirs[1:] {
+		fallbackDirectories = append(fallbackDirectories, dir.ToStringDuringMigration())
+	}
+	var cacheEvictor *evictor
+	if opts.MaxSize > 0 {
+		cacheEvictor = acquireEvictor(cacheDir.ToStringDuringMigration(), opts.MaxSize)
+	}
+	var verificationKey []byte
+	if opts.VerifyOutputs {
+		key, err := outputVerificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("error loading the output verification key: %w", err)
+		}
+		verificationKey = key
+	}
+	access := opts.resolveAccess()
+	cache := &fsCache{
+		cacheDirectory:      cacheDir.ToStringDuringMigration(),
+		fallbackDirectories: fallbackDirectories,
+		recorder:            recorder,
+		repoRoot:            repoRoot,
+		hardlink:            opts.HardlinkOutputs,
+		stagedRestore:       opts.StagedRestore,
+		onlyChangedOutputs:  opts.OnlyChangedOutputs,
+		compression:         opts.Compression,
+		evictor:             cacheEvictor,
+		restoreFilter:       opts.restoreFilterMatcher(),
+		verifyOutputs:       opts.VerifyOutputs,
+		verificationKey:     verificationKey,
+		verifyPuts:          opts.VerifyPuts,
+		readsDisabled:       !access.Local.Read,
+		writesDisabled:      !access.Local.Write,
+	}
+	if opts.MetadataIndex {
+		if err := cache.ensureMetadataIndex(); err != nil {
+			return nil, fmt.Errorf("error building cache metadata index: %w", err)
+		}
+	}
+	return cache, nil
 }
 
 // Fetch returns true if items are cached. It moves them into position as a side effect.
-func (f *fsCache) Fetch(target, hash string, _unusedOutputGlobs []string) (bool, []string, int, error) {
-	cachedFolder := filepath.Join(f.cacheDirectory, hash)
+func (f *fsCache) Fetch(target, hash string, outputGlobs []string) (bool, []string, int, error) {
+	if f.readsDisabled {
+		f.logFetch(false, hash, 0)
+		return false, nil, 0, nil
+	}
+	cacheDirectory, cachedPath := f.findCacheEntry(hash)
 
 	// If it's not in the cache bail now
-	if !fs.PathExists(cachedFolder) {
+	if cacheDirectory == "" {
 		f.logFetch(false, hash, 0)
 		return false, nil, 0, nil
 	}
 
-	// Otherwise, copy it into position
-	err := fs.RecursiveCopy(cachedFolder, target)
+	meta, err := ReadCacheMetaFile(filepath.Join(cacheDirectory, hash+_metaFileSuffix))
+	if err != nil {
+		return false, nil, 0, fmt.Errorf("error reading cache metadata: %w", err)
+	}
+	if f.verifyOutputs {
+		// Entries cached before verification was enabled have nothing to be checked against.
+		// They aren't suspect, so they're left in place, to be replaced when the task runs.
+		if meta.OutputsHash == "" {
+			f.logFetch(false, hash, 0)
+			return false, nil, 0, nil
+		}
+		if err := f.verifyArtifact(cachedPath, meta.OutputsHash); err != nil {
+			// Don't leave a tampered artifact behind for later runs. Fallback directories
+			// may be shared, so only entries in our own directory are removed.
+			if cacheDirectory == f.cacheDirectory {
+				if _, removeErr := f.removeEntry(hash); removeErr != nil {
+					log.Printf("[ERROR] Error removing %v from the filesystem cache: %v", hash, removeErr)
+				}
+			}
+			f.logFetch(false, hash, 0)
+			return false, nil, 0, fmt.Errorf("error verifying cached outputs for %v: %w", hash, err)
+		}
+	}
+
+	// Copy it into position. A staging directory starts out empty, so there is
+	// nothing there for unchanged files to be compared against.
+	skipUnchanged := f.onlyChangedOutputs && !f.stagedRestore
+	copyFile := fs.CopyFile
+	if f.hardlink {
+		copyFile = fs.LinkFile
+	}
+	if skipUnchanged {
+		copyFile = skipUnchangedFiles(copyFile)
+	}
+	restoreFilter := fetchRestoreFilter(f.restoreFilter, outputGlobs)
+	restore := func(from string, to string) error {
+		return fs.RecursiveCopyWith(from, to, copyFile, restoreFilter)
+	}
+	if compression, ok := archiveCompression(cachedPath); ok {
+		restore = func(from string, to string) error {
+			return restoreArchive(from, to, compression, restoreFilter, skipUnchanged)
+		}
+	}
+	if f.stagedRestore {
+		err = stagedRestore(fs.UnsafeToAbsolutePath(target), func(stagingDir turbopath.AbsolutePath) error {
+			return restore(cachedPath, stagingDir.ToString())
+		})
+	} else {
+		err = restore(cachedPath, target)
+	}
 	if err != nil {
 		// TODO: what event to log here?
 		return false, nil, 0, fmt.Errorf("error moving artifact from cache into %v: %w", target, err)
 	}
 
-	meta, err := ReadCacheMetaFile(filepath.Join(f.cacheDirectory, hash+"-meta.json"))
-	if err != nil {
-		return false, nil, 0, fmt.Errorf("error reading cache metadata: %w", err)
+	if f.evictor != nil && cacheDirectory == f.cacheDirectory {
+		f.evictor.recordAccess(hash)
 	}
 	f.logFetch(true, hash, meta.Duration)
 	return true, nil, meta.Duration, nil
 }
 
+// findCacheEntry returns the first cache directory containing the given hash, along with
+// the path of the artifact within it, which is either a directory of loose files or an
+// archive. Both are the empty string if none of the cache directories contain the hash.
+func (f *fsCache) findCacheEntry(hash string) (string, string) {
+	dirs := append([]string{f.cacheDirectory}, f.fallbackDirectories...)
+	for _, dir := range dirs {
+		for _, name := range artifactNames(hash) {
+			if path := filepath.Join(dir, name); fs.PathExists(path) {
+				return dir, path
+			}
+		}
+	}
+	return "", ""
+}
+
+// artifactNames lists the names an artifact for the given hash can be stored under, in
+// each of the forms the cache can store it in
+func artifactNames(hash string) []string {
+	names := []string{hash}
+	for _, compression := range _archiveCompressions {
+		names = append(names, hash+compression.archiveExtension())
+	}
+	return names
+}
+
+// archiveCompression returns the compression of the archive at cachedPath, or false if it is
+// a directory of loose files
+func archiveCompression(cachedPath string) (Compression, bool) {
+	for _, compression := range _archiveCompressions {
+		if strings.HasSuffix(cachedPath, compression.archiveExtension()) {
+			return compression, true
+		}
+	}
+	return "", false
+}
+
+// skipUnchangedFiles wraps copyFile so that regular files that already exist at their
+// destination with the same mode and contents are left untouched
+func skipUnchangedFiles(copyFile func(from *fs.LstatCachedFile, to string) error) func(from *fs.LstatCachedFile, to string) error {
+	return func(from *fs.LstatCachedFile, to string) error {
+		if unchanged, err := fileUnchanged(from, to); err != nil {
+			return err
+		} else if unchanged {
+			return nil
+		}
+		return copyFile(from, to)
+	}
+}
+
+// fileUnchanged returns true if to is a regular file with the same mode and contents as from
+func fileUnchanged(from *fs.LstatCachedFile, to string) (bool, error) {
+	fromInfo, err := from.GetInfo()
+	if err != nil {
+		return false, err
+	}
+	toInfo, err := os.Lstat(to)
+	if err != nil || !fromInfo.Mode().IsRegular() || !toInfo.Mode().IsRegular() {
+		return false, nil
+	}
+	if fromInfo.Size() != toInfo.Size() || fromInfo.Mode().Perm() != toInfo.Mode().Perm() {
+		return false, nil
+	}
+	fromHash, err := fs.GitLikeHashFile(from.Path.ToString())
+	if err != nil {
+		return false, err
+	}
+	toHash, err := fs.GitLikeHashFile(to)
+	if err != nil {
+		return false, nil
+	}
+	return fromHash == toHash, nil
+}
+
+// restoreArchive extracts a tarball artifact with the given compression into the target directory.
+// If include is non-nil, only the files for which it returns true are extracted. If skipUnchanged
+// is true, files that already exist with the same contents are left untouched.
+func restoreArchive(archivePath string, target string, compression Compression, include func(repoRelativePath string) bool, skipUnchanged bool) error {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = archive.Close() }()
+	_, err = restoreTarMatching(fs.UnsafeToAbsolutePath(target), archive, compression, include, skipUnchanged)
+	return err
+}
+
 func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 	var event string
 	if hit {
@@ -78,6 +286,87 @@ func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 }
 
 func (f *fsCache) Put(target, hash string, duration int, files []string) error {
+	if f.writesDisabled {
+		return nil
+	}
+	if f.compression.isArchive() {
+		if err := f.putArchive(hash, files); err != nil {
+			return err
+		}
+	} else if err := f.putFiles(hash, files); err != nil {
+		return err
+	}
+	if f.verifyPuts {
+		if err := f.verifyStoredArtifact(hash, files); err != nil {
+			// Don't leave a broken artifact behind to be restored by later runs
+			if _, removeErr := f.removeEntry(hash); removeErr != nil {
+				log.Printf("[ERROR] Error removing %v from the filesystem cache: %v", hash, removeErr)
+			}
+			return fmt.Errorf("error verifying artifact for %v: %w", hash, err)
+		}
+	}
+
+	meta := &CacheMetadata{
+		Duration: duration,
+		Hash:     hash,
+	}
+	if f.verifyOutputs {
+		outputsHash, err := hashOutputs(f.repoRoot, files)
+		if err != nil {
+			return fmt.Errorf("error hashing outputs for verification: %w", err)
+		}
+		meta.OutputsHash = f.verificationHash(outputsHash)
+	}
+	WriteCacheMetaFile(filepath.Join(f.cacheDirectory, hash+_metaFileSuffix), meta)
+	if err := f.appendMetadataIndex(&metadataIndexEntry{Hash: hash, Duration: duration, WrittenAt: time.Now()}); err != nil {
+		return fmt.Errorf("error updating cache metadata index: %w", err)
+	}
+
+	if f.evictor != nil {
+		f.evictor.recordAccess(hash)
+		f.evictor.request()
+	}
+	return nil
+}
+
+// putArchive stores the given files as a single tarball, compressed with the cache's compression.
+// The archive is written to a temporary file first so that a concurrent Fetch never sees a
+// partial archive.
+func (f *fsCache) putArchive(hash string, files []string) error {
+	tmp, err := ioutil.TempFile(f.cacheDirectory, hash+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating cache archive: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	cw, err := f.compression.newWriter(tmp)
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error creating cache archive: %w", err)
+	}
+	tw := tar.NewWriter(cw)
+	for _, file := range files {
+		if err := storeTarFile(tw, f.repoRoot.Join(file).ToString(), file); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("error writing %v to cache archive: %w", file, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing cache archive: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing cache archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache archive: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(f.cacheDirectory, hash+f.compression.archiveExtension()))
+}
+
+// putFiles stores a copy of each of the given files under a directory named for the hash
+func (f *fsCache) putFiles(hash string, files []string) error {
 	g := new(errgroup.Group)
 
 	numDigesters := runtime.NumCPU()
@@ -110,33 +399,37 @@ func (f *fsCache) Put(target, hash string, duration int, files []string) error {
 	}
 	close(fileQueue)
 
-	if err := g.Wait(); err != nil {
-		return err
-	}
-
-	WriteCacheMetaFile(filepath.Join(f.cacheDirectory, hash+"-meta.json"), &CacheMetadata{
-		Duration: duration,
-		Hash:     hash,
-	})
-
-	return nil
+	return g.Wait()
 }
 
+// Clean removes the artifact and metadata for the given hash
 func (f *fsCache) Clean(target string) {
-	fmt.Println("Not implemented yet")
+	if _, err := f.removeEntry(target); err != nil {
+		log.Printf("[ERROR] Error removing %v from the filesystem cache: %v", target, err)
+	}
 }
 
+// CleanAll removes the entire cache directory
 func (f *fsCache) CleanAll() {
-	fmt.Println("Not implemented yet")
+	if _, _, err := f.cleanAll(); err != nil {
+		log.Printf("[ERROR] Error removing the filesystem cache: %v", err)
+	}
 }
 
-func (cache *fsCache) Shutdown() {}
+func (cache *fsCache) Shutdown() {
+	if cache.evictor != nil {
+		cache.evictor.release()
+	}
+}
 
 // CacheMetadata stores duration and hash information for a cache entry so that aggregate Time Saved calculations
 // can be made from artifacts from various caches
 type CacheMetadata struct {
 	Hash     string `json:"hash"`
 	Duration int    `json:"duration"`
+	// OutputsHash is the keyed hash of the artifact's files when it was cached, if output
+	// verification was enabled
+	OutputsHash string `json:"outputsHash,omitempty"`
 }
 
 // WriteCacheMetaFile writes cache metadata file at a path
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// _accessLogName is the file in the cache directory recording when each hash was last used
+const _accessLogName = "access.log"
+
+// evictor removes the least recently accessed entries from a filesystem cache once it grows
+// beyond maxSize bytes. Evictions run on a single background goroutine so that they don't
+// block the run, and requests made while a pass is in progress are coalesced into one more pass.
+type evictor struct {
+	cacheDirectory string
+	maxSize        int64
+	requests       chan struct{}
+	done           chan struct{}
+	// logMu guards writes to the access log
+	logMu sync.Mutex
+	// mu guards closed, so that no request is sent once requests is closed
+	mu     sync.Mutex
+	closed bool
+	// refs counts the caches using this evictor, guarded by _evictors.mu
+	refs int
+}
+
+// _evictors holds the evictor of each cache directory. Caches that share a directory, such as
+// the scoped caches of a run, must share one evictor so that they append to the same access
+// log under one lock and don't run concurrent eviction passes.
+var _evictors = struct {
+	mu    sync.Mutex
+	byDir map[string]*evictor
+}{byDir: make(map[string]*evictor)}
+
+// acquireEvictor returns the evictor for cacheDirectory, starting one if there is none yet.
+// Every call must be paired with a call to release.
+func acquireEvictor(cacheDirectory string, maxSize int64) *evictor {
+	_evictors.mu.Lock()
+	defer _evictors.mu.Unlock()
+	e, ok := _evictors.byDir[cacheDirectory]
+	if !ok {
+		e = newEvictor(cacheDirectory, maxSize)
+		_evictors.byDir[cacheDirectory] = e
+	}
+	e.refs++
+	return e
+}
+
+// release drops a reference to the evictor, shutting it down once no cache uses it
+func (e *evictor) release() {
+	_evictors.mu.Lock()
+	e.refs--
+	last := e.refs <= 0
+	if last && _evictors.byDir[e.cacheDirectory] == e {
+		delete(_evictors.byDir, e.cacheDirectory)
+	}
+	_evictors.mu.Unlock()
+	if last {
+		e.shutdown()
+	}
+}
+
+func newEvictor(cacheDirectory string, maxSize int64) *evictor {
+	e := &evictor{
+		cacheDirectory: cacheDirectory,
+		maxSize:        maxSize,
+		requests:       make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// request schedules an eviction pass, unless one is already pending or the evictor is shut down
+func (e *evictor) request() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.requests <- struct{}{}:
+	default:
+	}
+}
+
+// shutdown waits for any pending eviction pass to finish. It is safe to call more than once.
+func (e *evictor) shutdown() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.requests)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+func (e *evictor) run() {
+	defer close(e.done)
+	for range e.requests {
+		if _, err := e.evict(); err != nil {
+			log.Printf("[ERROR] Error evicting entries from the filesystem cache: %v", err)
+		}
+	}
+}
+
+// recordAccess appends the current time for the given hash to the access log
+func (e *evictor) recordAccess(hash string) {
+	e.logMu.Lock()
+	defer e.logMu.Unlock()
+	f, err := os.OpenFile(e.accessLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("[ERROR] Error recording cache access for %v: %v", hash, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := fmt.Fprintf(f, "%d %v\n", time.Now().UnixNano(), hash); err != nil {
+		log.Printf("[ERROR] Error recording cache access for %v: %v", hash, err)
+	}
+}
+
+func (e *evictor) accessLogPath() string {
+	return filepath.Join(e.cacheDirectory, _accessLogName)
+}
+
+// readAccessLog returns the latest recorded access time of each hash in the access log
+func (e *evictor) readAccessLog() (map[string]time.Time, error) {
+	lastAccess := make(map[string]time.Time)
+	f, err := os.Open(e.accessLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return lastAccess, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			// Skip lines truncated by an interrupted write
+			continue
+		}
+		nanos, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if at := time.Unix(0, nanos); at.After(lastAccess[fields[1]]) {
+			lastAccess[fields[1]] = at
+		}
+	}
+	return lastAccess, scanner.Err()
+}
+
+// compactAccessLog rewrites the access log with a single line for each hash still in the cache
+func (e *evictor) compactAccessLog(cached map[string]bool) error {
+	e.logMu.Lock()
+	defer e.logMu.Unlock()
+	lastAccess, err := e.readAccessLog()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for hash, at := range lastAccess {
+		if cached[hash] {
+			fmt.Fprintf(&b, "%d %v\n", at.UnixNano(), hash)
+		}
+	}
+	return ioutil.WriteFile(e.accessLogPath(), []byte(b.String()), 0644)
+}
+
+type evictionCandidate struct {
+	hash       string
+	lastAccess time.Time
+	size       int64
+}
+
+// evict removes the least recently accessed entries until the cache is no larger than maxSize.
+// Entries that were never recorded in the access log are treated as last accessed when their
+// metadata was written. It returns the number of bytes reclaimed.
+func (e *evictor) evict() (int64, error) {
+	f := &fsCache{cacheDirectory: e.cacheDirectory}
+	entries, err := f.listEntries()
+	if err != nil {
+		return 0, err
+	}
+	lastAccess, err := e.readAccessLog()
+	if err != nil {
+		return 0, err
+	}
+	candidates := make([]*evictionCandidate, 0, len(entries))
+	cached := make(map[string]bool, len(entries))
+	var total int64
+	for hash, entry := range entries {
+		candidate := &evictionCandidate{hash: hash, lastAccess: entry.WrittenAt}
+		if at, ok := lastAccess[hash]; ok {
+			candidate.lastAccess = at
+		}
+		for _, name := range append(artifactNames(hash), hash+_metaFileSuffix) {
+			size, err := diskUsage(filepath.Join(e.cacheDirectory, name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return 0, err
+			}
+			candidate.size += size
+		}
+		total += candidate.size
+		cached[hash] = true
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastAccess.Before(candidates[j].lastAccess)
+	})
+
+	var reclaimed int64
+	for _, candidate := range candidates {
+		if total <= e.maxSize {
+			break
+		}
+		size, err := f.removeEntry(candidate.hash)
+		reclaimed += size
+		total -= size
+		if err != nil {
+			return reclaimed, err
+		}
+		delete(cached, candidate.hash)
+	}
+	return reclaimed, e.compactAccessLog(cached)
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeCacheEntry writes a cached artifact of the given size, with metadata written at the given time
+func writeCacheEntry(t *testing.T, cacheDir turbopath.AbsolutePath, hash string, size int, writtenAt time.Time) {
+	t.Helper()
+	file := cacheDir.Join(hash, "some-package", "a")
+	assert.NilError(t, file.EnsureDir(), "EnsureDir")
+	assert.NilError(t, file.WriteFile([]byte(strings.Repeat("a", size)), 0644), "WriteFile")
+	metaFile := cacheDir.Join(hash + _metaFileSuffix)
+	assert.NilError(t, metaFile.WriteFile([]byte(`{}`), 0644), "WriteFile")
+	assert.NilError(t, os.Chtimes(metaFile.ToString(), writtenAt, writtenAt), "Chtimes")
+}
+
+func TestEvict(t *testing.T) {
+	cacheDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	now := time.Now()
+	writeCacheEntry(t, cacheDir, "oldest-write", 100, now.Add(-3*time.Hour))
+	writeCacheEntry(t, cacheDir, "recently-read", 100, now.Add(-2*time.Hour))
+	writeCacheEntry(t, cacheDir, "recent-write", 100, now.Add(-1*time.Hour))
+	accessLog := fmt.Sprintf("%d recently-read\n%d removed-hash\ntruncated", now.UnixNano(), now.UnixNano())
+	assert.NilError(t, cacheDir.Join(_accessLogName).WriteFile([]byte(accessLog), 0644), "WriteFile")
+
+	// Room for two entries of 100 bytes plus their metadata
+	e := &evictor{cacheDirectory: cacheDir.ToString(), maxSize: 250}
+	reclaimed, err := e.evict()
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, reclaimed, int64(100+len(`{}`)))
+
+	assert.Assert(t, !cacheDir.Join("oldest-write").DirExists(), "expected the least recently used entry to be evicted")
+	assert.Assert(t, !cacheDir.Join("oldest-write"+_metaFileSuffix).FileExists(), "expected the evicted metadata to be removed")
+	assert.Assert(t, cacheDir.Join("recently-read").DirExists(), "expected the recently read entry to be kept")
+	assert.Assert(t, cacheDir.Join("recent-write").DirExists(), "expected the recently written entry to be kept")
+
+	lastAccess, err := e.readAccessLog()
+	assert.NilError(t, err, "readAccessLog")
+	assert.Equal(t, len(lastAccess), 1, "expected the access log to only list cached hashes")
+	assert.Assert(t, lastAccess["recently-read"].Equal(time.Unix(0, now.UnixNano())))
+}
+
+func TestPutEvictsInBackground(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("cache")
+	src := repoRoot.Join("some-package", "a")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte(strings.Repeat("a", 100)), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir: cacheDir.ToString(),
+		MaxSize:     150,
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	files := []string{filepath.Join("some-package", "a")}
+	assert.NilError(t, cache.Put("some-package", "first-hash", 0, files), "Put")
+	assert.NilError(t, cache.Put("some-package", "second-hash", 0, files), "Put")
+	// Shutdown waits for any pending eviction
+	cache.Shutdown()
+
+	assert.Assert(t, !cacheDir.Join("first-hash").DirExists(), "expected the first entry to be evicted")
+	assert.Assert(t, cacheDir.Join("second-hash").DirExists(), "expected the most recent entry to be kept")
+}
+
+func TestCachesShareEvictorPerDirectory(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	opts := Opts{
+		OverrideDir: repoRoot.Join("cache").ToString(),
+		MaxSize:     150,
+	}
+	first, err := newFsCache(opts, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	second, err := newFsCache(opts, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.Assert(t, first.evictor == second.evictor, "expected caches in the same directory to share an evictor")
+
+	// The evictor keeps running until the last cache using it is shut down
+	first.Shutdown()
+	second.evictor.request()
+	second.Shutdown()
+	// Requests after shutdown are dropped rather than sent on the closed channel
+	second.evictor.request()
+	second.evictor.shutdown()
+}
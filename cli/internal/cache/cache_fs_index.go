@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// _metadataIndexName is the append-only file in the cache directory recording the metadata
+// of each entry, so that cache maintenance doesn't need to read every metadata file
+const _metadataIndexName = "metadata-index.jsonl"
+
+// errCorruptMetadataIndex is returned when a line of the metadata index can't be parsed
+var errCorruptMetadataIndex = errors.New("corrupt cache metadata index")
+
+// metadataIndexEntry is a line of the metadata index. Later lines for a hash supersede earlier ones.
+type metadataIndexEntry struct {
+	Hash      string    `json:"hash"`
+	Duration  int       `json:"duration"`
+	WrittenAt time.Time `json:"writtenAt"`
+	// Removed records that the entry for Hash was removed from the cache
+	Removed bool `json:"removed,omitempty"`
+}
+
+func (f *fsCache) metadataIndexPath() string {
+	return filepath.Join(f.cacheDirectory, _metadataIndexName)
+}
+
+// appendMetadataIndex adds a line to the metadata index. Nothing is written if the cache has
+// no index, since a new index would be missing the earlier entries.
+func (f *fsCache) appendMetadataIndex(entry *metadataIndexEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.metadataIndexPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// A single write keeps concurrent appends from interleaving
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readMetadataIndex returns the current entries recorded in the metadata index, keyed by hash
+func (f *fsCache) readMetadataIndex() (map[string]*metadataIndexEntry, error) {
+	file, err := os.Open(f.metadataIndexPath())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	entries := make(map[string]*metadataIndexEntry)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &metadataIndexEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil || entry.Hash == "" {
+			return nil, errCorruptMetadataIndex
+		}
+		if entry.Removed {
+			delete(entries, entry.Hash)
+		} else {
+			entries[entry.Hash] = entry
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// scanMetadataFiles builds the entries of the cache from its metadata files, treating the
+// time each one was last modified as the time the entry was written
+func (f *fsCache) scanMetadataFiles() (map[string]*metadataIndexEntry, error) {
+	metaFiles, err := filepath.Glob(filepath.Join(f.cacheDirectory, "*"+_metaFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*metadataIndexEntry, len(metaFiles))
+	for _, metaFile := range metaFiles {
+		info, err := os.Stat(metaFile)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		hash := strings.TrimSuffix(filepath.Base(metaFile), _metaFileSuffix)
+		entry := &metadataIndexEntry{Hash: hash, WrittenAt: info.ModTime()}
+		// An unreadable metadata file still marks an entry that can be cleaned up
+		if meta, err := ReadCacheMetaFile(metaFile); err == nil {
+			entry.Duration = meta.Duration
+		}
+		entries[hash] = entry
+	}
+	return entries, nil
+}
+
+// rebuildMetadataIndex replaces the metadata index with one built from the metadata files
+func (f *fsCache) rebuildMetadataIndex() (map[string]*metadataIndexEntry, error) {
+	entries, err := f.scanMetadataFiles()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	var b strings.Builder
+	for _, hash := range hashes {
+		line, err := json.Marshal(entries[hash])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	// Write to a temporary file first so that readers never see a partial index
+	tmp, err := ioutil.TempFile(f.cacheDirectory, _metadataIndexName+"-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache metadata index: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), f.metadataIndexPath()); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ensureMetadataIndex rebuilds the metadata index if it is missing or corrupt
+func (f *fsCache) ensureMetadataIndex() error {
+	if _, err := f.readMetadataIndex(); err == nil {
+		return nil
+	}
+	_, err := f.rebuildMetadataIndex()
+	return err
+}
+
+// listEntries returns the entries of the cache, keyed by hash. The metadata index is used
+// if the cache has one, and rebuilt if it is corrupt. Otherwise every metadata file is read.
+func (f *fsCache) listEntries() (map[string]*metadataIndexEntry, error) {
+	entries, err := f.readMetadataIndex()
+	if err == nil {
+		return entries, nil
+	} else if errors.Is(err, os.ErrNotExist) {
+		return f.scanMetadataFiles()
+	} else if errors.Is(err, errCorruptMetadataIndex) {
+		return f.rebuildMetadataIndex()
+	}
+	return nil, err
+}
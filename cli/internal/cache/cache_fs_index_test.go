@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"gotest.tools/v3/assert"
+)
+
+func TestMetadataIndexRebuild(t *testing.T) {
+	cacheDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	writtenAt := time.Date(2022, time.August, 1, 12, 30, 0, 0, time.UTC)
+	writeCacheEntry(t, cacheDir, "first-hash", 10, writtenAt)
+	writeCacheEntry(t, cacheDir, "second-hash", 10, writtenAt.Add(time.Hour))
+	cache := &fsCache{cacheDirectory: cacheDir.ToString()}
+
+	// Without an index, entries come from the metadata files
+	entries, err := cache.listEntries()
+	assert.NilError(t, err, "listEntries")
+	assert.Equal(t, len(entries), 2)
+	assert.Assert(t, !cacheDir.Join(_metadataIndexName).FileExists(), "expected listing entries not to create an index")
+
+	assert.NilError(t, cache.ensureMetadataIndex(), "ensureMetadataIndex")
+	entries, err = cache.readMetadataIndex()
+	assert.NilError(t, err, "readMetadataIndex")
+	assert.Equal(t, len(entries), 2)
+	assert.Assert(t, entries["first-hash"].WrittenAt.Equal(writtenAt))
+	assert.Assert(t, entries["second-hash"].WrittenAt.Equal(writtenAt.Add(time.Hour)))
+
+	// A truncated line makes the index corrupt, so it is rebuilt
+	index, err := os.OpenFile(cacheDir.Join(_metadataIndexName).ToString(), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NilError(t, err, "OpenFile")
+	_, err = index.WriteString(`{"hash":"third-h`)
+	assert.NilError(t, err, "WriteString")
+	assert.NilError(t, index.Close(), "Close")
+	_, err = cache.readMetadataIndex()
+	assert.ErrorIs(t, err, errCorruptMetadataIndex)
+
+	entries, err = cache.listEntries()
+	assert.NilError(t, err, "listEntries")
+	assert.Equal(t, len(entries), 2)
+	_, err = cache.readMetadataIndex()
+	assert.NilError(t, err, "expected the index to be rebuilt")
+}
+
+func TestMetadataIndexPutAndRemove(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("cache")
+	src := repoRoot.Join("some-package", "a")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir:   cacheDir.ToString(),
+		MetadataIndex: true,
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.Assert(t, cacheDir.Join(_metadataIndexName).FileExists(), "expected an empty index to be created")
+
+	files := []string{filepath.Join("some-package", "a")}
+	assert.NilError(t, cache.Put("some-package", "first-hash", 42, files), "Put")
+	assert.NilError(t, cache.Put("some-package", "second-hash", 0, files), "Put")
+	entries, err := cache.readMetadataIndex()
+	assert.NilError(t, err, "readMetadataIndex")
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries["first-hash"].Duration, 42)
+
+	// Cleaning stale entries reads the index rather than the metadata files
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NilError(t, os.Chtimes(cacheDir.Join("first-hash"+_metaFileSuffix).ToString(), old, old), "Chtimes")
+	removed, _, err := cache.cleanStale(24*time.Hour, time.Now())
+	assert.NilError(t, err, "cleanStale")
+	assert.Equal(t, removed, 0)
+
+	cache.Clean("first-hash")
+	entries, err = cache.readMetadataIndex()
+	assert.NilError(t, err, "readMetadataIndex")
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries["second-hash"] != nil, "expected the remaining entry to be indexed")
+}
@@ -4,10 +4,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/analytics"
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"gotest.tools/v3/assert"
 )
 
@@ -275,3 +279,288 @@ func TestFetch(t *testing.T) {
 	assert.NilError(t, err, "ReadDir")
 	assert.Equal(t, len(entries), 0)
 }
+
+func TestFetchFallbackDirectory(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	primaryDir := repoRoot.Join("primary")
+	fallbackDir := repoRoot.Join("fallback")
+	cachedFile := fallbackDir.Join("the-hash", "some-package", "a")
+	assert.NilError(t, cachedFile.EnsureDir(), "EnsureDir")
+	assert.NilError(t, cachedFile.WriteFile([]byte("hello"), 0644), "WriteFile")
+	metadataPath := fallbackDir.Join("the-hash-meta.json")
+	assert.NilError(t, metadataPath.WriteFile([]byte(`{"hash":"the-hash","duration":5}`), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir: strings.Join([]string{primaryDir.ToString(), fallbackDir.ToString()}, string(filepath.ListSeparator)),
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+
+	target := repoRoot.Join("target")
+	hit, _, duration, err := cache.Fetch(target.ToString(), "the-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit, "expected a hit from the fallback directory")
+	assert.Equal(t, duration, 5)
+	assertFileMatches(t, cachedFile.ToString(), target.Join("some-package", "a").ToString())
+
+	hit, _, _, err = cache.Fetch(target.ToString(), "missing-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit, "expected a miss for a hash in neither directory")
+
+	// Writes only target the primary directory
+	src := repoRoot.Join("some-package", "b")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("bFile"), 0644), "WriteFile")
+	assert.NilError(t, cache.Put("some-package", "other-hash", 0, []string{filepath.Join("some-package", "b")}), "Put")
+	assert.Assert(t, primaryDir.Join("other-hash", "some-package", "b").FileExists(), "expected the artifact in the primary directory")
+	assert.Assert(t, !fallbackDir.Join("other-hash").DirExists(), "expected nothing written to the fallback directory")
+}
+
+func TestResolveCacheDirs(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	opts := &Opts{}
+	assert.DeepEqual(t, opts.ResolveCacheDirs(repoRoot), []turbopath.AbsolutePath{DefaultLocation(repoRoot)})
+
+	opts.OverrideDir = strings.Join([]string{"a", "", repoRoot.Join("b").ToString()}, string(filepath.ListSeparator))
+	assert.DeepEqual(t, opts.ResolveCacheDirs(repoRoot), []turbopath.AbsolutePath{repoRoot.Join("a"), repoRoot.Join("b")})
+	assert.Equal(t, opts.ResolveCacheDir(repoRoot), repoRoot.Join("a"))
+}
+
+func TestPutFetchArchive(t *testing.T) {
+	for _, compression := range _archiveCompressions {
+		repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+		cacheDir := repoRoot.Join("cache")
+		src := repoRoot.Join("some-package", "child", "a")
+		assert.NilError(t, src.EnsureDir(), "EnsureDir")
+		assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+		assert.NilError(t, os.Symlink("a", repoRoot.Join("some-package", "child", "link").ToString()), "Symlink")
+
+		cache, err := newFsCache(Opts{
+			OverrideDir: cacheDir.ToString(),
+			Compression: compression,
+		}, &dummyRecorder{}, repoRoot)
+		assert.NilError(t, err, "newFsCache")
+
+		files := []string{
+			filepath.Join("some-package", "child", "a"),
+			filepath.Join("some-package", "child", "link"),
+		}
+		assert.NilError(t, cache.Put("some-package", "the-hash", 5, files), "Put")
+		assert.Assert(t, cacheDir.Join("the-hash"+compression.archiveExtension()).FileExists(), "expected a %v archive", compression)
+		assert.Assert(t, !cacheDir.Join("the-hash").DirExists(), "expected no loose files")
+
+		assert.NilError(t, repoRoot.Join("some-package").RemoveAll(), "RemoveAll")
+		hit, _, duration, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, hit, "expected a hit from the %v archive", compression)
+		assert.Equal(t, duration, 5)
+		contents, err := src.ReadFile()
+		assert.NilError(t, err, "ReadFile")
+		assert.Equal(t, string(contents), "hello")
+		target, err := os.Readlink(repoRoot.Join("some-package", "child", "link").ToString())
+		assert.NilError(t, err, "Readlink")
+		assert.Equal(t, target, "a")
+
+		// A cache written with another compression still restores the artifact
+		otherCache, err := newFsCache(Opts{OverrideDir: cacheDir.ToString()}, &dummyRecorder{}, repoRoot)
+		assert.NilError(t, err, "newFsCache")
+		assert.NilError(t, repoRoot.Join("some-package").RemoveAll(), "RemoveAll")
+		hit, _, _, err = otherCache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, hit, "expected a hit from the %v archive without compression configured", compression)
+		assert.Assert(t, src.FileExists(), "expected the file to be restored")
+	}
+}
+
+func benchmarkFetch(b *testing.B, compression Compression) {
+	repoRoot := fs.AbsolutePathFromUpstream(b.TempDir())
+	files := make([]string, 10000)
+	for i := range files {
+		files[i] = filepath.Join("some-package", "dist", strconv.Itoa(i%100), strconv.Itoa(i)+".js")
+		file := repoRoot.Join(files[i])
+		if err := file.EnsureDir(); err != nil {
+			b.Fatalf("EnsureDir: %v", err)
+		}
+		if err := file.WriteFile([]byte("module.exports = {}"), 0644); err != nil {
+			b.Fatalf("WriteFile: %v", err)
+		}
+	}
+	cache, err := newFsCache(Opts{
+		OverrideDir: repoRoot.Join("cache").ToString(),
+		Compression: compression,
+	}, &dummyRecorder{}, repoRoot)
+	if err != nil {
+		b.Fatalf("newFsCache: %v", err)
+	}
+	if err := cache.Put("some-package", "the-hash", 0, files); err != nil {
+		b.Fatalf("Put: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if err := repoRoot.Join("some-package").RemoveAll(); err != nil {
+			b.Fatalf("RemoveAll: %v", err)
+		}
+		b.StartTimer()
+		if hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{}); err != nil || !hit {
+			b.Fatalf("Fetch got (%v, %v), want a hit", hit, err)
+		}
+	}
+}
+
+func BenchmarkFetch10kFilesNone(b *testing.B) {
+	benchmarkFetch(b, CompressionNone)
+}
+
+func BenchmarkFetch10kFilesGzip(b *testing.B) {
+	benchmarkFetch(b, CompressionGzip)
+}
+
+func BenchmarkFetch10kFilesZstd(b *testing.B) {
+	benchmarkFetch(b, CompressionZstd)
+}
+
+func TestFetchRestoreFilter(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("cache")
+	for _, file := range []string{"dist/index.js", "coverage/lcov.info"} {
+		cachedFile := cacheDir.Join("the-hash", "some-package", filepath.FromSlash(file))
+		assert.NilError(t, cachedFile.EnsureDir(), "EnsureDir")
+		assert.NilError(t, cachedFile.WriteFile([]byte(file), 0644), "WriteFile")
+	}
+	assert.NilError(t, cacheDir.Join("the-hash"+_metaFileSuffix).WriteFile([]byte(`{"hash":"the-hash","duration":5}`), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir:   cacheDir.ToString(),
+		RestoreFilter: []string{"some-package/dist/**"},
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+
+	hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit, "expected a hit")
+	assert.Assert(t, repoRoot.Join("some-package", "dist", "index.js").FileExists(), "expected the matching output to be restored")
+	assert.Assert(t, !repoRoot.Join("some-package", "coverage").DirExists(), "expected the other outputs not to be restored")
+}
+
+func TestFsCacheAccess(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	src := repoRoot.Join("some-package", "a")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("aFile"), 0644), "WriteFile")
+	files := []string{filepath.Join("some-package", "a")}
+	cacheDir := repoRoot.Join("cache")
+
+	readOnly, err := newFsCache(Opts{
+		OverrideDir: cacheDir.ToString(),
+		Access:      &Access{Local: Actions{Read: true}},
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.NilError(t, readOnly.Put("some-package", "the-hash", 0, files), "Put")
+	assert.Assert(t, !cacheDir.Join("the-hash").DirExists(), "expected nothing written to a read-only cache")
+
+	writeOnly, err := newFsCache(Opts{
+		OverrideDir: cacheDir.ToString(),
+		Access:      &Access{Local: Actions{Write: true}},
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.NilError(t, writeOnly.Put("some-package", "the-hash", 0, files), "Put")
+	assert.Assert(t, cacheDir.Join("the-hash").DirExists(), "expected the artifact in a write-only cache")
+	hit, _, _, err := writeOnly.Fetch(repoRoot.Join("target").ToString(), "the-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit, "expected a miss from a write-only cache")
+
+	hit, _, _, err = readOnly.Fetch(repoRoot.Join("target").ToString(), "the-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit, "expected a hit from a read-only cache")
+}
+
+func TestFetchOnlyChangedOutputs(t *testing.T) {
+	for _, compression := range _compressions {
+		t.Run(string(compression), func(t *testing.T) {
+			repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+			unchanged := repoRoot.Join("some-package", "unchanged")
+			changed := repoRoot.Join("some-package", "changed")
+			assert.NilError(t, unchanged.EnsureDir(), "EnsureDir")
+			assert.NilError(t, unchanged.WriteFile([]byte("unchanged"), 0644), "WriteFile")
+			assert.NilError(t, changed.WriteFile([]byte("original"), 0644), "WriteFile")
+
+			cache, err := newFsCache(Opts{
+				OverrideDir:        repoRoot.Join("cache").ToString(),
+				Compression:        compression,
+				OnlyChangedOutputs: true,
+			}, &dummyRecorder{}, repoRoot)
+			assert.NilError(t, err, "newFsCache")
+			files := []string{filepath.Join("some-package", "unchanged"), filepath.Join("some-package", "changed")}
+			assert.NilError(t, cache.Put("some-package", "the-hash", 0, files), "Put")
+
+			mtime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			assert.NilError(t, os.Chtimes(unchanged.ToString(), mtime, mtime), "Chtimes")
+			assert.NilError(t, changed.WriteFile([]byte("modified"), 0644), "WriteFile")
+
+			hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+			assert.NilError(t, err, "Fetch")
+			assert.Assert(t, hit, "expected a hit")
+			info, err := unchanged.Lstat()
+			assert.NilError(t, err, "Lstat")
+			assert.Assert(t, info.ModTime().Equal(mtime), "expected an unchanged file to keep its mtime, got %v", info.ModTime())
+			contents, err := changed.ReadFile()
+			assert.NilError(t, err, "ReadFile")
+			assert.Equal(t, string(contents), "original")
+		})
+	}
+}
+
+func TestFetchHardlinkedOutputsKeepCacheContents(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	output := repoRoot.Join("some-package", "a")
+	assert.NilError(t, output.EnsureDir(), "EnsureDir")
+	assert.NilError(t, output.WriteFile([]byte("original"), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir:     repoRoot.Join("cache").ToString(),
+		HardlinkOutputs: true,
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.NilError(t, cache.Put("some-package", "the-hash", 0, []string{filepath.Join("some-package", "a")}), "Put")
+	cachedFile := repoRoot.Join("cache", "the-hash", "some-package", "a")
+
+	assertRestoresOriginal := func() {
+		t.Helper()
+		hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, hit, "expected a hit")
+		outputInfo, err := output.Lstat()
+		assert.NilError(t, err, "Lstat")
+		cachedInfo, err := cachedFile.Lstat()
+		assert.NilError(t, err, "Lstat")
+		assert.Assert(t, os.SameFile(outputInfo, cachedInfo), "expected the output to be a hardlink to the cache")
+		contents, err := output.ReadFile()
+		assert.NilError(t, err, "ReadFile")
+		assert.Equal(t, string(contents), "original")
+	}
+
+	// A task rewriting its output in place, once its links are broken before it runs
+	assertRestoresOriginal()
+	assert.NilError(t, fs.BreakHardlink(output.ToString()), "BreakHardlink")
+	f, err := output.OpenFile(os.O_WRONLY|os.O_TRUNC, 0644)
+	assert.NilError(t, err, "OpenFile")
+	_, err = f.WriteString("rewritten")
+	assert.NilError(t, err, "WriteString")
+	assert.NilError(t, f.Close(), "Close")
+	contents, err := cachedFile.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "original")
+
+	// Restoring a tar entry over the output in place
+	assertRestoresOriginal()
+	assert.NilError(t, writeTarEntry(output, 0644, 2, strings.NewReader("ANGE")), "writeTarEntry")
+	contents, err = output.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "orANGEal")
+	contents, err = cachedFile.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "original")
+
+	assertRestoresOriginal()
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"archive/tar"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// ErrOutputVerificationFailed is returned by Fetch when an artifact doesn't hash to the value
+// recorded when it was cached, e.g. because it was tampered with. Nothing is restored from it.
+var ErrOutputVerificationFailed = errors.New("restored outputs don't match their verification hash")
+
+// ErrPutVerificationFailed is returned by Put when the artifact it wrote doesn't read back
+// with the same files and contents as the outputs being cached, e.g. because of a disk error
+var ErrPutVerificationFailed = errors.New("cached artifact doesn't match the outputs it was written from")
+
+// hashOutputs hashes the paths and contents of the given repo-relative files under root.
+// Directories are skipped, and symlinks contribute their target rather than contents.
+func hashOutputs(root turbopath.AbsolutePath, files []string) (string, error) {
+	entries := make(map[string]string, len(files))
+	for _, file := range files {
+		path := filepath.ToSlash(file)
+		if _, ok := entries[path]; ok {
+			continue
+		}
+		name := root.Join(filepath.FromSlash(path)).ToString()
+		info, err := os.Lstat(name)
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(name)
+			if err != nil {
+				return "", err
+			}
+			entries[path] = linkEntry(target)
+			continue
+		}
+		contentHash, err := fs.GitLikeHashFile(name)
+		if err != nil {
+			return "", err
+		}
+		entries[path] = fileEntry(contentHash)
+	}
+	return combineOutputEntries(entries), nil
+}
+
+// hashArchiveOutputs hashes the files stored in the archive at archivePath the same way
+// hashOutputs hashes them on disk, without extracting them
+func hashArchiveOutputs(archivePath string, compression Compression) (string, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = archive.Close() }()
+	cr, err := compression.newReader(archive)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = cr.Close() }()
+	entries := make(map[string]string)
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return combineOutputEntries(entries), nil
+		} else if err != nil {
+			return "", err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			contentHash, err := fs.GitLikeHash(tr, hdr.Size)
+			if err != nil {
+				return "", err
+			}
+			entries[hdr.Name] = fileEntry(contentHash)
+		case tar.TypeSymlink:
+			entries[hdr.Name] = linkEntry(hdr.Linkname)
+		}
+	}
+}
+
+func fileEntry(contentHash string) string {
+	return "file\x00" + contentHash
+}
+
+func linkEntry(target string) string {
+	return "link\x00" + filepath.ToSlash(target)
+}
+
+// combineOutputEntries hashes the entries, keyed by posix-style path, in path order
+func combineOutputEntries(entries map[string]string) string {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%v\x00%v\x00", path, entries[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashArtifact hashes the files stored in the artifact at cachedPath, which is either a
+// directory of loose files or a compressed tarball
+func hashArtifact(cachedPath string) (string, error) {
+	if compression, ok := archiveCompression(cachedPath); ok {
+		return hashArchiveOutputs(cachedPath, compression)
+	}
+	files, err := artifactFiles(cachedPath)
+	if err != nil {
+		return "", err
+	}
+	return hashOutputs(fs.UnsafeToAbsolutePath(cachedPath), files)
+}
+
+// _outputVerificationKeyFile is the file in the turbo data directory holding the key that
+// verification hashes are keyed with when TURBO_REMOTE_CACHE_SIGNATURE_KEY isn't set
+const _outputVerificationKeyFile = "output-verification.key"
+
+// outputVerificationKey returns the key that verification hashes are keyed with. It is kept
+// out of the cache directory, so that whoever can replace an artifact can't also record a
+// matching hash for it. Machines sharing a cache directory must share the key, by setting
+// TURBO_REMOTE_CACHE_SIGNATURE_KEY.
+func outputVerificationKey() ([]byte, error) {
+	if secret := os.Getenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY"); secret != "" {
+		return []byte(secret), nil
+	}
+	return fs.ReadOrCreateKey(fs.GetTurboDataDir().Join(_outputVerificationKeyFile))
+}
+
+// verificationHash keys the hash of an artifact's files with the cache's verification key
+func (f *fsCache) verificationHash(outputsHash string) string {
+	return fs.HashSecretValue(f.verificationKey, outputsHash)
+}
+
+// artifactFiles lists the repo-relative files stored in a cached artifact, which is either
+// a directory of loose files or a compressed tarball
+func artifactFiles(cachedPath string) ([]string, error) {
+	if compression, ok := archiveCompression(cachedPath); ok {
+		return archiveFiles(cachedPath, compression)
+	}
+	files := []string{}
+	err := filepath.WalkDir(cachedPath, func(name string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(cachedPath, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, relativePath)
+		return nil
+	})
+	return files, err
+}
+
+func archiveFiles(archivePath string, compression Compression) ([]string, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = archive.Close() }()
+	cr, err := compression.newReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cr.Close() }()
+	files := []string{}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			files = append(files, hdr.Name)
+		}
+	}
+}
+
+// verifyStoredArtifact reads back the artifact that was just written for hash and checks that
+// it holds exactly the given repo-relative files, with the same contents as in the repo
+func (f *fsCache) verifyStoredArtifact(hash string, files []string) error {
+	expectedHash, err := hashOutputs(f.repoRoot, files)
+	if err != nil {
+		return fmt.Errorf("error hashing outputs: %w", err)
+	}
+	cachedPath := filepath.Join(f.cacheDirectory, hash)
+	storedRoot := cachedPath
+	if f.compression.isArchive() {
+		cachedPath += f.compression.archiveExtension()
+		// Extracting the archive also checks that it isn't truncated
+		tmpDir, err := ioutil.TempDir(f.cacheDirectory, hash+"-verify-*.tmp")
+		if err != nil {
+			return fmt.Errorf("error creating directory to verify cache archive: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmpDir) }()
+		if err := restoreArchive(cachedPath, tmpDir, f.compression, nil, false); err != nil {
+			return fmt.Errorf("%w: %v", ErrPutVerificationFailed, err)
+		}
+		storedRoot = tmpDir
+	}
+	storedFiles, err := artifactFiles(cachedPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPutVerificationFailed, err)
+	}
+	storedHash, err := hashOutputs(fs.UnsafeToAbsolutePath(storedRoot), storedFiles)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPutVerificationFailed, err)
+	}
+	if storedHash != expectedHash {
+		return fmt.Errorf("%w: expected %v, got %v", ErrPutVerificationFailed, expectedHash, storedHash)
+	}
+	return nil
+}
+
+// verifyArtifact checks, before anything is restored from it, that the artifact at cachedPath
+// hashes to the verificationHash recorded when it was cached
+func (f *fsCache) verifyArtifact(cachedPath string, verificationHash string) error {
+	outputsHash, err := hashArtifact(cachedPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOutputVerificationFailed, err)
+	}
+	if got := f.verificationHash(outputsHash); !hmac.Equal([]byte(got), []byte(verificationHash)) {
+		return fmt.Errorf("%w: expected %v, got %v", ErrOutputVerificationFailed, verificationHash, got)
+	}
+	return nil
+}
+
+// verifiesPuts returns whether the given cache reads back what it stores
+func verifiesPuts(c Cache) bool {
+	f, ok := c.(*fsCache)
+	return ok && f.verifyPuts
+}
+
+func (f *fsCache) putVerified(target string, key string, duration int, files []string) error {
+	if !f.verifyPuts {
+		return nil
+	}
+	return f.Put(target, key, duration, files)
+}
+
+func (f *fsCache) putUnverified(target string, key string, duration int, files []string) error {
+	if f.verifyPuts {
+		return nil
+	}
+	return f.Put(target, key, duration, files)
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"gotest.tools/v3/assert"
+)
+
+func TestVerifyOutputs(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "the-key")
+	for _, compression := range _compressions {
+		repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+		cacheDir := repoRoot.Join("cache")
+		src := repoRoot.Join("some-package", "dist", "index.js")
+		assert.NilError(t, src.EnsureDir(), "EnsureDir")
+		assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+		assert.NilError(t, os.Symlink("index.js", repoRoot.Join("some-package", "dist", "link").ToString()), "Symlink")
+
+		cache, err := newFsCache(Opts{
+			OverrideDir:   cacheDir.ToString(),
+			Compression:   compression,
+			VerifyOutputs: true,
+		}, &dummyRecorder{}, repoRoot)
+		assert.NilError(t, err, "newFsCache")
+
+		files := []string{
+			filepath.Join("some-package", "dist"),
+			filepath.Join("some-package", "dist", "index.js"),
+			filepath.Join("some-package", "dist", "link"),
+		}
+		assert.NilError(t, cache.Put("some-package", "the-hash", 5, files), "Put")
+		metaPath := cacheDir.Join("the-hash" + _metaFileSuffix).ToString()
+		meta, err := ReadCacheMetaFile(metaPath)
+		assert.NilError(t, err, "ReadCacheMetaFile")
+		outputsHash, err := hashOutputs(repoRoot, files)
+		assert.NilError(t, err, "hashOutputs")
+		assert.Assert(t, meta.OutputsHash != "" && meta.OutputsHash != outputsHash, "expected a keyed outputs hash for %v", compression)
+
+		assert.NilError(t, repoRoot.Join("some-package").RemoveAll(), "RemoveAll")
+		hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, hit, "expected a verified hit for %v", compression)
+
+		// Record the unkeyed hash, as someone replacing the artifact without the key would
+		meta.OutputsHash = outputsHash
+		assert.NilError(t, WriteCacheMetaFile(metaPath, meta), "WriteCacheMetaFile")
+		assert.NilError(t, repoRoot.Join("some-package").RemoveAll(), "RemoveAll")
+		hit, _, _, err = cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+		assert.ErrorIs(t, err, ErrOutputVerificationFailed)
+		assert.Assert(t, !hit, "expected a miss for %v", compression)
+		assert.Assert(t, !repoRoot.Join("some-package").DirExists(), "expected nothing to be restored for %v", compression)
+		_, cachedPath := cache.findCacheEntry("the-hash")
+		assert.Equal(t, cachedPath, "", "expected the artifact to be removed for %v", compression)
+	}
+}
+
+func TestVerifyOutputsTamperedArtifact(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "the-key")
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("cache")
+	src := repoRoot.Join("some-package", "dist", "index.js")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir:   cacheDir.ToString(),
+		VerifyOutputs: true,
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	files := []string{filepath.Join("some-package", "dist", "index.js")}
+	assert.NilError(t, cache.Put("some-package", "the-hash", 5, files), "Put")
+
+	// Replace the cached file, leaving the metadata alone
+	cached := cacheDir.Join("the-hash", "some-package", "dist", "index.js")
+	assert.NilError(t, cached.WriteFile([]byte("poisoned"), 0644), "WriteFile")
+	assert.NilError(t, src.WriteFile([]byte("local"), 0644), "WriteFile")
+	hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+	assert.ErrorIs(t, err, ErrOutputVerificationFailed)
+	assert.Assert(t, !hit, "expected a miss")
+	contents, err := src.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "local", "expected the tampered file not to be restored")
+	assert.Assert(t, !cacheDir.Join("the-hash").DirExists(), "expected the tampered artifact to be removed")
+}
+
+func TestVerifyPuts(t *testing.T) {
+	for _, compression := range _compressions {
+		repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+		cacheDir := repoRoot.Join("cache")
+		src := repoRoot.Join("some-package", "dist", "index.js")
+		assert.NilError(t, src.EnsureDir(), "EnsureDir")
+		assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+		cache, err := newFsCache(Opts{
+			OverrideDir: cacheDir.ToString(),
+			Compression: compression,
+			VerifyPuts:  true,
+		}, &dummyRecorder{}, repoRoot)
+		assert.NilError(t, err, "newFsCache")
+
+		files := []string{
+			filepath.Join("some-package", "dist"),
+			filepath.Join("some-package", "dist", "index.js"),
+		}
+		assert.NilError(t, cache.Put("some-package", "the-hash", 5, files), "Put")
+
+		// Change the source, as if the artifact hadn't been written from it in full
+		assert.NilError(t, src.WriteFile([]byte("hello, world"), 0644), "WriteFile")
+		err = cache.verifyStoredArtifact("the-hash", files)
+		assert.ErrorIs(t, err, ErrPutVerificationFailed)
+	}
+}
+
+func TestAsyncCacheMakesVerifiedPutsBeforeReturning(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	src := repoRoot.Join("some-package", "dist", "index.js")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	opts := Opts{
+		OverrideDir: repoRoot.Join("cache").ToString(),
+		VerifyPuts:  true,
+		Workers:     1,
+	}
+	fsCache, err := newFsCache(opts, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	remote := newEnabledCache()
+	cache := newAsyncCache(&cacheMultiplexer{
+		opts:   opts,
+		caches: []Cache{fsCache, remote},
+	}, opts)
+
+	files := []string{
+		filepath.Join("some-package", "dist"),
+		filepath.Join("some-package", "dist", "index.js"),
+	}
+	assert.NilError(t, cache.Put("some-package", "the-hash", 5, files), "Put")
+	hit, _, _, err := fsCache.Fetch("some-package", "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit, "expected the verified Put to be made before Put returned")
+
+	cache.Shutdown()
+	_, ok := remote.entries["the-hash"]
+	assert.Assert(t, ok, "expected the remaining caches to be stored in the background")
+}
+
+func TestVerifyOutputsEntryWithoutHash(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "the-key")
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("cache")
+	src := repoRoot.Join("some-package", "dist", "index.js")
+	assert.NilError(t, src.EnsureDir(), "EnsureDir")
+	assert.NilError(t, src.WriteFile([]byte("hello"), 0644), "WriteFile")
+	files := []string{filepath.Join("some-package", "dist", "index.js")}
+
+	// An entry cached before verification was enabled
+	unverified, err := newFsCache(Opts{OverrideDir: cacheDir.ToString()}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	assert.NilError(t, unverified.Put("some-package", "the-hash", 5, files), "Put")
+
+	cache, err := newFsCache(Opts{
+		OverrideDir:   cacheDir.ToString(),
+		VerifyOutputs: true,
+	}, &dummyRecorder{}, repoRoot)
+	assert.NilError(t, err, "newFsCache")
+	hit, _, _, err := cache.Fetch(repoRoot.ToString(), "the-hash", []string{})
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit, "expected a miss for an entry without a verification hash")
+	assert.Assert(t, cacheDir.Join("the-hash").DirExists(), "expected the entry to be kept")
+}
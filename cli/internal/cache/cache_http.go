@@ -6,35 +6,175 @@ package cache
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	log "log"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vercel/turborepo/cli/internal/analytics"
+	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 )
 
 type client interface {
-	PutArtifact(hash string, body []byte, duration int, tag string) error
-	FetchArtifact(hash string) (*http.Response, error)
+	// PutArtifact uploads an artifact. encoding is sent as its Content-Encoding, unless it is empty.
+	PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error
+	// FetchArtifact downloads an artifact. acceptEncoding is sent as the Accept-Encoding, unless it is empty.
+	FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error)
 	GetTeamID() string
 }
 
+// _negotiatedAcceptEncoding lists the artifact encodings turbo can restore, most preferred first
+const _negotiatedAcceptEncoding = "zstd, gzip"
+
 type httpCache struct {
-	writable       bool
 	client         client
 	requestLimiter limiter
 	recorder       analytics.Recorder
 	signerVerifier *ArtifactSignatureAuthentication
 	repoRoot       turbopath.AbsolutePath
+	stagedRestore  bool
+	// onlyChangedOutputs leaves files that are already restored untouched
+	onlyChangedOutputs bool
+	// restoreFilter, if set, limits which files of an artifact are restored
+	restoreFilter func(repoRelativePath string) bool
+	// timeout bounds each request to the remote cache, if positive
+	timeout time.Duration
+	// timeoutWarning makes sure that timeouts are only warned about once per run
+	timeoutWarning sync.Once
+	readsDisabled  bool
+	writesDisabled bool
+	// negotiateCompression asks for zstd artifacts, and uploads zstd once the server accepts it
+	negotiateCompression bool
+	// serverAcceptsZstd is set once the server has advertised that it accepts zstd uploads
+	serverAcceptsZstd bool
+	mu                sync.Mutex
+}
+
+// uploadCompression returns the compression to upload artifacts with
+func (cache *httpCache) uploadCompression() Compression {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.negotiateCompression && cache.serverAcceptsZstd {
+		return CompressionZstd
+	}
+	return CompressionGzip
+}
+
+// recordAcceptedEncodings remembers whether the server advertised, via an Accept-Encoding
+// response header as described in RFC 7694, that it accepts zstd uploads
+func (cache *httpCache) recordAcceptedEncodings(header http.Header) {
+	if !cache.negotiateCompression {
+		return
+	}
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			// Drop parameters such as ";q=0.5"
+			encoding = strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0])
+			if strings.EqualFold(encoding, string(CompressionZstd)) {
+				cache.mu.Lock()
+				cache.serverAcceptsZstd = true
+				cache.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// artifactCompression returns the compression of a downloaded artifact given its Content-Encoding.
+// Artifacts without one are gzipped tarballs.
+func artifactCompression(contentEncoding string) (Compression, error) {
+	switch strings.ToLower(contentEncoding) {
+	case "", string(CompressionGzip):
+		return CompressionGzip, nil
+	case string(CompressionZstd):
+		return CompressionZstd, nil
+	}
+	return "", fmt.Errorf("unsupported artifact encoding %q", contentEncoding)
+}
+
+// remoteRequest is a single fetch from or upload to the remote cache. Its timeout covers
+// connecting and waiting for a response, but not sending or receiving an artifact's contents,
+// so that large artifacts on a slow connection aren't cut off part way through.
+type remoteRequest struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired bool
+}
+
+// newRequest starts a fetch or upload, bounded by cache.timeout if it is positive
+func (cache *httpCache) newRequest() *remoteRequest {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &remoteRequest{ctx: ctx, cancel: cancel, timeout: cache.timeout}
+	if r.timeout <= 0 {
+		return r
+	}
+	r.timer = time.AfterFunc(r.timeout, r.expire)
+	// Preflights and retries are each bounded the same way, as they share the context
+	r.ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn:              func(string) { r.resetTimer() },
+		WroteHeaders:         r.stopTimer,
+		WroteRequest:         func(httptrace.WroteRequestInfo) { r.resetTimer() },
+		GotFirstResponseByte: r.stopTimer,
+	})
+	return r
+}
+
+func (r *remoteRequest) expire() {
+	r.mu.Lock()
+	r.expired = true
+	r.mu.Unlock()
+	r.cancel()
+}
+
+func (r *remoteRequest) resetTimer() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.expired {
+		r.timer.Reset(r.timeout)
+	}
+}
+
+func (r *remoteRequest) stopTimer() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer.Stop()
+}
+
+// done releases the resources of the request
+func (r *remoteRequest) done() {
+	if r.timer != nil {
+		r.stopTimer()
+	}
+	r.cancel()
+}
+
+// timedOut reports whether the request failed because it hit cache.timeout, warning about
+// it the first time
+func (cache *httpCache) timedOut(r *remoteRequest) bool {
+	r.mu.Lock()
+	expired := r.expired
+	r.mu.Unlock()
+	if !expired {
+		return false
+	}
+	cache.timeoutWarning.Do(func() {
+		log.Printf("[WARNING] Remote cache requests are taking longer than %v. Requests that time out are treated as cache misses, and their uploads are skipped.", cache.timeout)
+	})
+	return true
 }
 
 type limiter chan struct{}
@@ -54,12 +194,15 @@ var mtime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
 const nobody = 65534
 
 func (cache *httpCache) Put(target, hash string, duration int, files []string) error {
-	// if cache.writable {
+	if cache.writesDisabled {
+		return nil
+	}
 	cache.requestLimiter.acquire()
 	defer cache.requestLimiter.release()
 
+	compression := cache.uploadCompression()
 	r, w := io.Pipe()
-	go cache.write(w, hash, files)
+	go cache.write(w, compression, files)
 
 	// Read the entire artifact tar into memory so we can easily compute the signature.
 	// Note: retryablehttp.NewRequest reads the files into memory anyways so there's no
@@ -75,33 +218,50 @@ func (cache *httpCache) Put(target, hash string, duration int, files []string) e
 			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
 		}
 	}
-	return cache.client.PutArtifact(hash, artifactBody, duration, tag)
+	req := cache.newRequest()
+	defer req.done()
+	// gzip is what the server expects when there is no Content-Encoding
+	encoding := ""
+	if compression != CompressionGzip {
+		encoding = string(compression)
+	}
+	err = cache.client.PutArtifact(req.ctx, hash, artifactBody, duration, tag, encoding)
+	if err != nil && cache.timedOut(req) {
+		// Uploads are best effort, so don't fail the task that produced the artifact
+		return nil
+	}
+	return err
 }
 
-// write writes a series of files into the given Writer.
-func (cache *httpCache) write(w io.WriteCloser, hash string, files []string) {
+// write writes a series of files into the given Writer as a tarball with the given compression.
+func (cache *httpCache) write(w *io.PipeWriter, compression Compression, files []string) {
 	defer w.Close()
-	gzw := gzip.NewWriter(w)
-	defer gzw.Close()
-	tw := tar.NewWriter(gzw)
+	cw, err := compression.newWriter(w)
+	if err != nil {
+		_ = w.CloseWithError(err)
+		return
+	}
+	defer cw.Close()
+	tw := tar.NewWriter(cw)
 	defer tw.Close()
 	for _, file := range files {
 		// log.Printf("caching file %v", file)
-		if err := cache.storeFile(tw, file); err != nil {
+		if err := storeTarFile(tw, file, file); err != nil {
 			log.Printf("[ERROR] Error uploading artifact %s to HTTP cache due to: %s", file, err)
 			// TODO(jaredpalmer): How can we cancel the request at this point?
 		}
 	}
 }
 
-func (cache *httpCache) storeFile(tw *tar.Writer, repoRelativePath string) error {
-	info, err := os.Lstat(repoRelativePath)
+// storeTarFile writes the file at path into the given tar under the repo-relative name
+func storeTarFile(tw *tar.Writer, path string, repoRelativePath string) error {
+	info, err := os.Lstat(path)
 	if err != nil {
 		return err
 	}
 	target := ""
 	if info.Mode()&os.ModeSymlink != 0 {
-		target, err = os.Readlink(repoRelativePath)
+		target, err = os.Readlink(path)
 		if err != nil {
 			return err
 		}
@@ -126,7 +286,7 @@ func (cache *httpCache) storeFile(tw *tar.Writer, repoRelativePath string) error
 	} else if info.IsDir() || target != "" {
 		return nil // nothing to write
 	}
-	f, err := os.Open(repoRelativePath)
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
@@ -138,10 +298,18 @@ func (cache *httpCache) storeFile(tw *tar.Writer, repoRelativePath string) error
 	return err
 }
 
-func (cache *httpCache) Fetch(target, key string, _unusedOutputGlobs []string) (bool, []string, int, error) {
+func (cache *httpCache) Fetch(target, key string, outputGlobs []string) (bool, []string, int, error) {
+	if cache.readsDisabled {
+		return false, nil, 0, nil
+	}
 	cache.requestLimiter.acquire()
 	defer cache.requestLimiter.release()
-	hit, files, duration, err := cache.retrieve(key)
+	req := cache.newRequest()
+	defer req.done()
+	hit, files, duration, err := cache.retrieve(req.ctx, key, fetchRestoreFilter(cache.restoreFilter, outputGlobs))
+	if err != nil && cache.timedOut(req) {
+		hit, files, duration, err = false, nil, 0, nil
+	}
 	if err != nil {
 		// TODO: analytics event?
 		return false, files, duration, fmt.Errorf("failed to retrieve files from HTTP cache: %w", err)
@@ -166,12 +334,17 @@ func (cache *httpCache) logFetch(hit bool, hash string, duration int) {
 	cache.recorder.LogEvent(payload)
 }
 
-func (cache *httpCache) retrieve(hash string) (bool, []string, int, error) {
-	resp, err := cache.client.FetchArtifact(hash)
+func (cache *httpCache) retrieve(ctx context.Context, hash string, restoreFilter func(repoRelativePath string) bool) (bool, []string, int, error) {
+	acceptEncoding := ""
+	if cache.negotiateCompression {
+		acceptEncoding = _negotiatedAcceptEncoding
+	}
+	resp, err := cache.client.FetchArtifact(ctx, hash, acceptEncoding)
 	if err != nil {
 		return false, nil, 0, err
 	}
-	defer resp.Body.Close()
+	defer func() { _ = resp.Body.Close() }()
+	cache.recordAcceptedEncodings(resp.Header)
 	if resp.StatusCode == http.StatusNotFound {
 		return false, nil, 0, nil // doesn't exist - not an error
 	} else if resp.StatusCode != http.StatusOK {
@@ -187,9 +360,12 @@ func (cache *httpCache) retrieve(hash string) (bool, []string, int, error) {
 		}
 		duration = intVar
 	}
+	// Refuse encodings turbo can't restore rather than failing somewhere inside restoreTar
+	compression, err := artifactCompression(resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return false, nil, 0, err
+	}
 	var tarReader io.Reader
-
-	defer func() { _ = resp.Body.Close() }()
 	if cache.signerVerifier.isEnabled() {
 		expectedTag := resp.Header.Get("x-artifact-tag")
 		if expectedTag == "" {
@@ -213,7 +389,15 @@ func (cache *httpCache) retrieve(hash string) (bool, []string, int, error) {
 	} else {
 		tarReader = resp.Body
 	}
-	files, err := restoreTar(cache.repoRoot, tarReader)
+	var files []string
+	if cache.stagedRestore {
+		err = stagedRestore(cache.repoRoot, func(stagingDir turbopath.AbsolutePath) error {
+			files, err = restoreTarMatching(stagingDir, tarReader, compression, restoreFilter, false)
+			return err
+		})
+	} else {
+		files, err = restoreTarMatching(cache.repoRoot, tarReader, compression, restoreFilter, cache.onlyChangedOutputs)
+	}
 	if err != nil {
 		return false, nil, 0, err
 	}
@@ -225,14 +409,23 @@ func (cache *httpCache) retrieve(hash string) (bool, []string, int, error) {
 // so that they are suitable for being fed into cache.Put for other caches.
 // For now, I think this is working because windows also accepts /-delimited paths.
 func restoreTar(root turbopath.AbsolutePath, reader io.Reader) ([]string, error) {
+	return restoreTarMatching(root, reader, CompressionGzip, nil, false)
+}
+
+// restoreTarMatching is like restoreTar, but reads a tarball with the given compression, and if
+// include is non-nil only restores the files for which it returns true, given their posix-style
+// repo-relative path. Directories are only created as needed to hold the restored files. If
+// skipUnchanged is true, regular files that already exist with the same contents and mode are
+// left untouched.
+func restoreTarMatching(root turbopath.AbsolutePath, reader io.Reader, compression Compression, include func(repoRelativePath string) bool, skipUnchanged bool) ([]string, error) {
 	files := []string{}
 	missingLinks := []*tar.Header{}
-	gzr, err := gzip.NewReader(reader)
+	cr, err := compression.newReader(reader)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = gzr.Close() }()
-	tr := tar.NewReader(gzr)
+	defer func() { _ = cr.Close() }()
+	tr := tar.NewReader(cr)
 	for {
 		hdr, err := tr.Next()
 		if err != nil {
@@ -248,6 +441,9 @@ func restoreTar(root turbopath.AbsolutePath, reader io.Reader) ([]string, error)
 			}
 			return nil, err
 		}
+		if include != nil && (hdr.Typeflag == tar.TypeDir || !include(hdr.Name)) {
+			continue
+		}
 		// hdr.Name is always a posix-style path
 		// TODO: files should eventually be repo-relative system paths
 		files = append(files, hdr.Name)
@@ -268,11 +464,18 @@ func restoreTar(root turbopath.AbsolutePath, reader io.Reader) ([]string, error)
 					return nil, err
 				}
 			}
-			if f, err := filename.OpenFile(os.O_WRONLY|os.O_TRUNC|os.O_CREATE, os.FileMode(hdr.Mode)); err != nil {
-				return nil, err
-			} else if _, err := io.Copy(f, tr); err != nil {
-				return nil, err
-			} else if err := f.Close(); err != nil {
+			var contents io.Reader = tr
+			var offset int64
+			if skipUnchanged {
+				unchanged, from, rest, err := tarEntryUnchanged(filename, hdr, tr)
+				if err != nil {
+					return nil, err
+				} else if unchanged {
+					continue
+				}
+				offset, contents = from, rest
+			}
+			if err := writeTarEntry(filename, os.FileMode(hdr.Mode), offset, contents); err != nil {
 				return nil, err
 			}
 		case tar.TypeSymlink:
@@ -287,18 +490,93 @@ func restoreTar(root turbopath.AbsolutePath, reader io.Reader) ([]string, error)
 	}
 }
 
+// _compareChunkSize is how much of a tar entry and the file it would be restored over are
+// compared at a time
+const _compareChunkSize = 32 * 1024
+
+// tarEntryUnchanged returns true if filename is a regular file with the same mode and contents
+// as the tar entry for hdr. The two are compared a chunk at a time, so that large files aren't
+// held in memory. If they differ, it returns the offset up to which filename already has the
+// entry's contents, and a reader for the rest of the entry's contents to be restored from.
+func tarEntryUnchanged(filename turbopath.AbsolutePath, hdr *tar.Header, contents io.Reader) (bool, int64, io.Reader, error) {
+	info, err := filename.Lstat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() != hdr.Size || info.Mode().Perm() != os.FileMode(hdr.Mode).Perm() {
+		return false, 0, contents, nil
+	}
+	existing, err := filename.Open()
+	if err != nil {
+		return false, 0, contents, nil
+	}
+	defer func() { _ = existing.Close() }()
+	entryChunk := make([]byte, _compareChunkSize)
+	existingChunk := make([]byte, _compareChunkSize)
+	var offset int64
+	for offset < hdr.Size {
+		n := _compareChunkSize
+		if remaining := hdr.Size - offset; remaining < int64(n) {
+			n = int(remaining)
+		}
+		if _, err := io.ReadFull(contents, entryChunk[:n]); err != nil {
+			return false, 0, nil, err
+		}
+		if _, err := io.ReadFull(existing, existingChunk[:n]); err != nil || !bytes.Equal(entryChunk[:n], existingChunk[:n]) {
+			return false, offset, io.MultiReader(bytes.NewReader(entryChunk[:n]), contents), nil
+		}
+		offset += int64(n)
+	}
+	return true, 0, nil, nil
+}
+
+// writeTarEntry writes the contents of a tar entry to filename from the given offset onwards,
+// leaving what is before the offset as it is. An offset of 0 replaces the whole file.
+func writeTarEntry(filename turbopath.AbsolutePath, mode os.FileMode, offset int64, contents io.Reader) error {
+	// The file is written in place, so it mustn't share its contents with a cached artifact
+	if err := fs.BreakHardlink(filename.ToString()); err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_TRUNC | os.O_CREATE
+	if offset > 0 {
+		// The file already has the entry's size, so nothing past the offset needs truncating
+		flags = os.O_WRONLY
+	}
+	f, err := filename.OpenFile(flags, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := io.Copy(f, contents); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 var errNonexistentLinkTarget = errors.New("the link target does not exist")
 
+// errLinkEscapesRoot is returned for a symlink whose target is outside of the root it is restored into
+var errLinkEscapesRoot = errors.New("the link target is outside of the root")
+
 func restoreSymlink(root turbopath.AbsolutePath, hdr *tar.Header, allowNonexistentTargets bool) error {
 	// Note that hdr.Linkname is really the link target
 	relativeLinkTarget := filepath.FromSlash(hdr.Linkname)
 	linkFilename := root.Join(hdr.Name)
+	// Check the target before creating anything, so that a rejected artifact leaves no trace
+	if filepath.IsAbs(relativeLinkTarget) {
+		return fmt.Errorf("cannot restore link %v -> %v: %w", hdr.Name, hdr.Linkname, errLinkEscapesRoot)
+	}
+	linkTarget := linkFilename.Dir().Join(relativeLinkTarget)
+	if isChild, err := resolvesWithin(root, linkTarget); err != nil {
+		return err
+	} else if !isChild {
+		return fmt.Errorf("cannot restore link %v -> %v: %w", hdr.Name, hdr.Linkname, errLinkEscapesRoot)
+	}
 	if err := linkFilename.EnsureDir(); err != nil {
 		return err
 	}
 
-	// TODO: check if this is an absolute path, or if we even care
-	linkTarget := linkFilename.Dir().Join(relativeLinkTarget)
 	if _, err := linkTarget.Lstat(); err != nil {
 		if os.IsNotExist(err) {
 			if !allowNonexistentTargets {
@@ -319,6 +597,65 @@ func restoreSymlink(root turbopath.AbsolutePath, hdr *tar.Header, allowNonexiste
 	return nil
 }
 
+// resolvesWithin returns whether path is inside root once the symlinks along both of
+// them are followed, so that a link can't escape the root through a link restored earlier.
+// Only the parts of the paths that already exist can be followed.
+func resolvesWithin(root turbopath.AbsolutePath, path turbopath.AbsolutePath) (bool, error) {
+	if isChild, err := root.ContainsPath(path); err != nil || !isChild {
+		return false, err
+	}
+	resolvedRoot, err := resolveExisting(root)
+	if err != nil {
+		return false, err
+	}
+	resolvedPath, err := resolveExisting(path)
+	if err != nil {
+		return false, err
+	}
+	return resolvedRoot.ContainsPath(resolvedPath)
+}
+
+// _maxDanglingLinks bounds how many links to missing targets resolveExisting follows,
+// to guard against cycles
+const _maxDanglingLinks = 40
+
+// resolveExisting follows the symlinks in the longest prefix of path that exists
+func resolveExisting(path turbopath.AbsolutePath) (turbopath.AbsolutePath, error) {
+	rest := []string{}
+	danglingLinks := 0
+	for {
+		resolved, err := path.EvalSymlinks()
+		if err == nil {
+			return resolved.Join(rest...), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if info, lstatErr := path.Lstat(); lstatErr == nil && info.Mode()&os.ModeSymlink != 0 {
+			// A link to a missing target still points somewhere, so follow it by hand
+			danglingLinks++
+			if danglingLinks > _maxDanglingLinks {
+				return "", fmt.Errorf("too many levels of symbolic links resolving %v", path)
+			}
+			target, err := path.Readlink()
+			if err != nil {
+				return "", err
+			}
+			if filepath.IsAbs(target) {
+				path = turbopath.AbsolutePath(target)
+			} else {
+				path = path.Dir().Join(target)
+			}
+			continue
+		}
+		parent := path.Dir()
+		if parent == path {
+			return "", err
+		}
+		rest = append([]string{path.Base()}, rest...)
+		path = parent
+	}
+}
+
 func (cache *httpCache) Clean(target string) {
 	// Not possible; this implementation can only clean for a hash.
 }
@@ -330,17 +667,26 @@ func (cache *httpCache) CleanAll() {
 func (cache *httpCache) Shutdown() {}
 
 func newHTTPCache(opts Opts, client client, recorder analytics.Recorder, repoRoot turbopath.AbsolutePath) *httpCache {
+	access := opts.resolveAccess()
 	return &httpCache{
-		writable:       true,
 		client:         client,
 		requestLimiter: make(limiter, 20),
 		recorder:       recorder,
 		signerVerifier: &ArtifactSignatureAuthentication{
 			// TODO(Gaspar): this should use RemoteCacheOptions.TeamId once we start
 			// enforcing team restrictions for repositories.
-			teamId:  client.GetTeamID(),
-			enabled: opts.RemoteCacheOpts.Signature,
+			teamId: client.GetTeamID(),
+			// Remote artifacts are verified through their signature, which is checked
+			// before anything is restored from them
+			enabled: opts.RemoteCacheOpts.Signature || opts.VerifyOutputs,
 		},
-		repoRoot: repoRoot,
+		repoRoot:             repoRoot,
+		stagedRestore:        opts.StagedRestore,
+		onlyChangedOutputs:   opts.OnlyChangedOutputs,
+		restoreFilter:        opts.restoreFilterMatcher(),
+		timeout:              opts.RemoteTimeout,
+		readsDisabled:        !access.Remote.Read,
+		writesDisabled:       !access.Remote.Write,
+		negotiateCompression: opts.NegotiateCompression,
 	}
 }
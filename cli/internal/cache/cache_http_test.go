@@ -4,9 +4,16 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/util"
@@ -17,11 +24,11 @@ type errorResp struct {
 	err error
 }
 
-func (sr *errorResp) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (sr *errorResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
 	return sr.err
 }
 
-func (sr *errorResp) FetchArtifact(hash string) (*http.Response, error) {
+func (sr *errorResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
 	return nil, sr.err
 }
 
@@ -49,12 +56,272 @@ func TestRemoteCachingDisabled(t *testing.T) {
 	}
 }
 
+type encodedResp struct {
+	encoding string
+}
+
+func (sr *encodedResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
+	return nil
+}
+
+func (sr *encodedResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Encoding", sr.encoding)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(&bytes.Buffer{}),
+	}, nil
+}
+
+func (sr *encodedResp) GetTeamID() string {
+	return ""
+}
+
+func TestUnsupportedArtifactEncoding(t *testing.T) {
+	cache := &httpCache{
+		client:         &encodedResp{encoding: "br"},
+		requestLimiter: make(limiter, 20),
+		signerVerifier: &ArtifactSignatureAuthentication{},
+	}
+	hit, _, _, err := cache.retrieve(context.Background(), "some-hash", nil)
+	assert.ErrorContains(t, err, "unsupported artifact encoding \"br\"")
+	assert.Assert(t, !hit, "expected a miss for an unsupported encoding")
+}
+
+// negotiatingResp is a client for a remote cache that stores one artifact and advertises
+// that it accepts zstd uploads
+type negotiatingResp struct {
+	body           []byte
+	encoding       string
+	acceptEncoding string
+}
+
+func (sr *negotiatingResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
+	sr.body = body
+	sr.encoding = encoding
+	return nil
+}
+
+func (sr *negotiatingResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
+	sr.acceptEncoding = acceptEncoding
+	header := http.Header{}
+	header.Set("Accept-Encoding", "gzip, zstd;q=0.9")
+	if sr.body == nil {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     header,
+			Body:       ioutil.NopCloser(&bytes.Buffer{}),
+		}, nil
+	}
+	header.Set("Content-Encoding", sr.encoding)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(sr.body)),
+	}, nil
+}
+
+func (sr *negotiatingResp) GetTeamID() string {
+	return ""
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	// Put reads the outputs relative to the working directory, which is the repo root in a run
+	cwd, err := os.Getwd()
+	assert.NilError(t, err, "Getwd")
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	for _, negotiate := range []bool{false, true} {
+		repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+		assert.NilError(t, os.Chdir(repoRoot.ToString()), "Chdir")
+		outputPath := filepath.Join("my-pkg", "dist", "index.js")
+		output := repoRoot.Join(outputPath)
+		assert.NilError(t, output.EnsureDir(), "EnsureDir")
+		assert.NilError(t, output.WriteFile([]byte("restored"), 0644), "WriteFile")
+
+		client := &negotiatingResp{}
+		cache := &httpCache{
+			client:               client,
+			requestLimiter:       make(limiter, 20),
+			recorder:             &nullRecorder{},
+			signerVerifier:       &ArtifactSignatureAuthentication{},
+			repoRoot:             repoRoot,
+			negotiateCompression: negotiate,
+		}
+		hit, _, _, err := cache.Fetch("my-pkg", "some-hash", nil)
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, !hit, "expected a miss before anything is stored")
+
+		wantAcceptEncoding, wantEncoding := "", ""
+		if negotiate {
+			wantAcceptEncoding, wantEncoding = _negotiatedAcceptEncoding, "zstd"
+		}
+		assert.Equal(t, client.acceptEncoding, wantAcceptEncoding)
+		assert.NilError(t, cache.Put("my-pkg", "some-hash", 0, []string{outputPath}), "Put")
+		assert.Equal(t, client.encoding, wantEncoding)
+
+		assert.NilError(t, output.Remove(), "Remove")
+		hit, _, _, err = cache.Fetch("my-pkg", "some-hash", nil)
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, hit, "expected a hit once stored")
+		contents, err := output.ReadFile()
+		assert.NilError(t, err, "ReadFile")
+		assert.Equal(t, string(contents), "restored")
+	}
+}
+
+type signedResp struct {
+	body []byte
+	tag  string
+}
+
+func (sr *signedResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
+	return nil
+}
+
+func (sr *signedResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("x-artifact-tag", sr.tag)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(sr.body)),
+	}, nil
+}
+
+func (sr *signedResp) GetTeamID() string {
+	return "some-team"
+}
+
+func TestFetchVerifiesSignature(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "some-secret")
+	signer := &ArtifactSignatureAuthentication{teamId: "some-team", enabled: true}
+	body := makeValidTar(t).Bytes()
+	tag, err := signer.generateTag("some-hash", body)
+	assert.NilError(t, err, "generateTag")
+
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	cache := &httpCache{
+		client:         &signedResp{body: body, tag: tag},
+		requestLimiter: make(limiter, 20),
+		signerVerifier: signer,
+		repoRoot:       root,
+	}
+	hit, files, _, err := cache.retrieve(context.Background(), "some-hash", nil)
+	assert.NilError(t, err, "retrieve")
+	assert.Assert(t, hit, "expected a hit for a correctly signed artifact")
+	assert.Equal(t, len(files), 5)
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-1] ^= 0xff
+	tamperedRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cache.client = &signedResp{body: tampered, tag: tag}
+	cache.repoRoot = tamperedRoot
+	hit, _, _, err = cache.retrieve(context.Background(), "some-hash", nil)
+	assert.ErrorContains(t, err, "artifact verification failed: artifact tag does not match expected tag")
+	assert.Assert(t, !hit, "expected a miss for a tampered artifact")
+	// The artifact is rejected before anything is untarred
+	entries, err := os.ReadDir(tamperedRoot.ToString())
+	assert.NilError(t, err, "ReadDir")
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestVerifyOutputsRequiresSignedRemoteArtifacts(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	unsigned := newHTTPCache(Opts{}, &signedResp{}, &dummyRecorder{}, root)
+	assert.Assert(t, !unsigned.signerVerifier.isEnabled(), "expected signatures to be off by default")
+	verified := newHTTPCache(Opts{VerifyOutputs: true}, &signedResp{}, &dummyRecorder{}, root)
+	assert.Assert(t, verified.signerVerifier.isEnabled(), "expected output verification to require signed artifacts")
+}
+
+// hangingResp is a client for a remote cache that never responds
+type hangingResp struct{}
+
+func (sr *hangingResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
+	<-ctx.Done()
+	return fmt.Errorf("failed to store files in HTTP cache: %w", ctx.Err())
+}
+
+func (sr *hangingResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("failed to fetch artifact: %w", ctx.Err())
+}
+
+func (sr *hangingResp) GetTeamID() string {
+	return ""
+}
+
+func TestRemoteCacheTimeout(t *testing.T) {
+	cache := &httpCache{
+		client:         &hangingResp{},
+		requestLimiter: make(limiter, 20),
+		recorder:       &nullRecorder{},
+		signerVerifier: &ArtifactSignatureAuthentication{},
+		timeout:        10 * time.Millisecond,
+	}
+	hit, files, _, err := cache.Fetch("some-target", "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit, "expected a fetch that timed out to be a miss")
+	assert.Equal(t, len(files), 0)
+
+	err = cache.Put("some-target", "some-hash", 0, nil)
+	assert.NilError(t, err, "Put")
+
+	// Errors other than timeouts are still returned
+	cache.client = &errorResp{err: errors.New("some error")}
+	_, _, _, err = cache.Fetch("some-target", "some-hash", nil)
+	assert.ErrorContains(t, err, "some error")
+	err = cache.Put("some-target", "some-hash", 0, nil)
+	assert.ErrorContains(t, err, "some error")
+}
+
+// slowTransferResp is a client for a remote cache that responds promptly, but takes a while
+// to send an artifact
+type slowTransferResp struct {
+	transfer time.Duration
+	// err is the error of the upload's context once it has been sent
+	err error
+}
+
+func (sr *slowTransferResp) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
+	trace := httptrace.ContextClientTrace(ctx)
+	trace.GetConn("remote-cache:443")
+	trace.WroteHeaders()
+	time.Sleep(sr.transfer)
+	trace.WroteRequest(httptrace.WroteRequestInfo{})
+	trace.GotFirstResponseByte()
+	sr.err = ctx.Err()
+	return sr.err
+}
+
+func (sr *slowTransferResp) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (sr *slowTransferResp) GetTeamID() string {
+	return ""
+}
+
+func TestRemoteCacheTimeoutExcludesTransfer(t *testing.T) {
+	client := &slowTransferResp{transfer: 50 * time.Millisecond}
+	cache := &httpCache{
+		client:         client,
+		requestLimiter: make(limiter, 20),
+		recorder:       &nullRecorder{},
+		signerVerifier: &ArtifactSignatureAuthentication{},
+		timeout:        10 * time.Millisecond,
+	}
+	err := cache.Put("some-target", "some-hash", 0, nil)
+	assert.NilError(t, err, "Put")
+	assert.NilError(t, client.err, "expected an upload that outlasts the timeout to carry on")
+}
+
 func makeValidTar(t *testing.T) *bytes.Buffer {
 	// <repoRoot>
 	//   my-pkg/
 	//     some-file
 	//     link-to-extra-file -> ../extra-file
-	//     broken-link -> ../../global-dep
+	//     broken-link -> ../missing-dep
 	//   extra-file
 
 	t.Helper()
@@ -110,7 +377,7 @@ func makeValidTar(t *testing.T) *bytes.Buffer {
 		Name:     "my-pkg/broken-link",
 		Mode:     int64(0644),
 		Typeflag: tar.TypeSymlink,
-		Linkname: "../../global-dep",
+		Linkname: "../missing-dep",
 	}
 	if err := tw.WriteHeader(h); err != nil {
 		t.Fatalf("failed to write header: %v", err)
@@ -231,3 +498,113 @@ func TestRestoreInvalidTar(t *testing.T) {
 // Note that testing Put will require mocking the filesystem and is not currently the most
 // interesting test. The current implementation directly returns the error from PutArtifact.
 // We should still add the test once feasible to avoid future breakage.
+
+// makeLinkEscapeTar makes a tar with a link to linkTarget, followed by a file
+// written through that link
+func makeLinkEscapeTar(t *testing.T, linkTarget string) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	defer func() {
+		if err := gzw.Close(); err != nil {
+			t.Fatalf("failed to close gzip: %v", err)
+		}
+	}()
+	tw := tar.NewWriter(gzw)
+	defer func() {
+		if err := tw.Close(); err != nil {
+			t.Fatalf("failed to close tar: %v", err)
+		}
+	}()
+
+	// my-pkg/escape -> linkTarget
+	h := &tar.Header{
+		Name:     "my-pkg/escape",
+		Mode:     int64(0644),
+		Typeflag: tar.TypeSymlink,
+		Linkname: linkTarget,
+	}
+	if err := tw.WriteHeader(h); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	// my-pkg/escape, overwriting whatever the link points to
+	contents := []byte("malicious-contents")
+	h = &tar.Header{
+		Name:     "my-pkg/escape",
+		Mode:     int64(0644),
+		Typeflag: tar.TypeReg,
+		Size:     int64(len(contents)),
+	}
+	if err := tw.WriteHeader(h); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return buf
+}
+
+func TestRestoreTarRejectsEscapingLinks(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	expectedContents := []byte("important-data")
+	someFile := root.Join("some-file")
+	assert.NilError(t, someFile.WriteFile(expectedContents, 0644), "WriteFile")
+	repoRoot := root.Join("repo")
+	assert.NilError(t, repoRoot.MkdirAll(), "MkdirAll")
+	// An existing link that points out of the repo, to a file that doesn't exist yet
+	assert.NilError(t, repoRoot.Join("outside").Symlink(root.Join("not-yet").ToString()), "Symlink")
+
+	linkTargets := map[string]string{
+		"absolute":                someFile.ToString(),
+		"climbs above the root":   "../../some-file",
+		"through an escaping dir": "../outside",
+	}
+	for name, linkTarget := range linkTargets {
+		_, err := restoreTar(repoRoot, makeLinkEscapeTar(t, linkTarget))
+		assert.ErrorIs(t, err, errLinkEscapesRoot, name)
+		assert.Assert(t, !repoRoot.Join("my-pkg", "escape").FileExists(), "expected no link for %v", name)
+
+		contents, err := someFile.ReadFile()
+		assert.NilError(t, err, "ReadFile")
+		assert.Equal(t, string(contents), string(expectedContents), "expected to not overwrite file for %v", name)
+		assert.Assert(t, !root.Join("not-yet").FileExists(), "expected to not create file for %v", name)
+	}
+}
+
+func TestRestoreTarMatching(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	opts := &Opts{RestoreFilter: []string{"my-pkg/some-*"}}
+
+	files, err := restoreTarMatching(root, makeValidTar(t), CompressionGzip, opts.restoreFilterMatcher(), false)
+	assert.NilError(t, err, "restoreTarMatching")
+	assert.DeepEqual(t, files, []string{"my-pkg/some-file"})
+
+	contents, err := root.Join("my-pkg", "some-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.DeepEqual(t, contents, []byte("some-file-contents"))
+	assert.Assert(t, !root.Join("extra-file").FileExists(), "expected extra-file not to be restored")
+}
+
+func TestTarEntryUnchangedComparesInChunks(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	filename := root.Join("large-file")
+	original := bytes.Repeat([]byte("a"), 2*_compareChunkSize+10)
+	hdr := &tar.Header{Name: "large-file", Mode: 0644, Size: int64(len(original))}
+
+	assert.NilError(t, filename.WriteFile(original, 0644), "WriteFile")
+	unchanged, _, _, err := tarEntryUnchanged(filename, hdr, bytes.NewReader(original))
+	assert.NilError(t, err, "tarEntryUnchanged")
+	assert.Assert(t, unchanged, "expected identical contents to be unchanged")
+
+	// Only the chunk that differs and the ones after it are rewritten
+	restored := append([]byte{}, original...)
+	restored[_compareChunkSize+1] = 'b'
+	unchanged, offset, rest, err := tarEntryUnchanged(filename, hdr, bytes.NewReader(restored))
+	assert.NilError(t, err, "tarEntryUnchanged")
+	assert.Assert(t, !unchanged, "expected different contents to be changed")
+	assert.Equal(t, offset, int64(_compareChunkSize))
+	assert.NilError(t, writeTarEntry(filename, 0644, offset, rest), "writeTarEntry")
+	contents, err := filename.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Assert(t, bytes.Equal(contents, restored), "expected the file to have the restored contents")
+}
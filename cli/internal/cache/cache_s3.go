@@ -0,0 +1,447 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/analytics"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// The environment variables that configure an S3-compatible bucket as the remote cache
+const (
+	_s3BucketEnv   = "TURBO_S3_BUCKET"
+	_s3EndpointEnv = "TURBO_S3_ENDPOINT"
+	_s3RegionEnv   = "TURBO_S3_REGION"
+	// Credentials are read from the same variables as the AWS CLI
+	_s3AccessKeyIDEnv     = "AWS_ACCESS_KEY_ID"
+	_s3SecretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+	_s3SessionTokenEnv    = "AWS_SESSION_TOKEN"
+)
+
+const _s3DefaultRegion = "us-east-1"
+
+// _s3DurationHeader is the object metadata holding how long the task took to run
+const _s3DurationHeader = "x-amz-meta-turbo-duration"
+
+// _s3TagHeader is the object metadata holding the artifact's signature, when
+// remoteCache.signature is enabled
+const _s3TagHeader = "x-amz-meta-turbo-tag"
+
+// _s3UnsignedPayload is signed in place of the hash of a request's body, so that artifacts
+// can be streamed rather than hashed before they are uploaded
+const _s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Options configures an S3-compatible bucket to store artifacts in
+type s3Options struct {
+	Bucket string
+	// Endpoint is the base URL of the S3 API. Buckets are addressed by path, which
+	// is supported by S3 as well as compatible stores such as MinIO.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Configured returns whether the environment configures an S3 bucket as the remote cache.
+// A bucket doesn't need the repository to be linked to Vercel.
+func S3Configured() bool {
+	return s3OptionsFromEnv() != nil
+}
+
+// s3OptionsFromEnv returns the S3 bucket configured by the environment, or nil if none is
+func s3OptionsFromEnv() *s3Options {
+	bucket := os.Getenv(_s3BucketEnv)
+	if bucket == "" {
+		return nil
+	}
+	region := os.Getenv(_s3RegionEnv)
+	if region == "" {
+		region = _s3DefaultRegion
+	}
+	endpoint := os.Getenv(_s3EndpointEnv)
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", region)
+	}
+	return &s3Options{
+		Bucket:          bucket,
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		Region:          region,
+		AccessKeyID:     os.Getenv(_s3AccessKeyIDEnv),
+		SecretAccessKey: os.Getenv(_s3SecretAccessKeyEnv),
+		SessionToken:    os.Getenv(_s3SessionTokenEnv),
+	}
+}
+
+// s3Cache stores artifacts in an S3-compatible bucket, as the same gzipped tarballs that
+// the HTTP cache uses, keyed by hash
+type s3Cache struct {
+	opts           *s3Options
+	client         *http.Client
+	requestLimiter limiter
+	signerVerifier *ArtifactSignatureAuthentication
+	recorder       analytics.Recorder
+	repoRoot       turbopath.AbsolutePath
+	stagedRestore  bool
+	// onlyChangedOutputs leaves files that are already restored untouched
+	onlyChangedOutputs bool
+	// restoreFilter, if set, limits which files of an artifact are restored
+	restoreFilter func(repoRelativePath string) bool
+	// now is the time requests are signed at
+	now            func() time.Time
+	readsDisabled  bool
+	writesDisabled bool
+}
+
+func newS3Cache(opts Opts, s3Opts *s3Options, recorder analytics.Recorder, repoRoot turbopath.AbsolutePath) *s3Cache {
+	access := opts.resolveAccess()
+	return &s3Cache{
+		opts:           s3Opts,
+		client:         newS3Client(opts.RemoteTimeout),
+		requestLimiter: make(limiter, 20),
+		signerVerifier: &ArtifactSignatureAuthentication{
+			// Unlike the Vercel cache, a bucket doesn't belong to a team
+			enabled: opts.RemoteCacheOpts.Signature || opts.VerifyOutputs,
+		},
+		recorder:           recorder,
+		repoRoot:           repoRoot,
+		stagedRestore:      opts.StagedRestore,
+		onlyChangedOutputs: opts.OnlyChangedOutputs,
+		restoreFilter:      opts.restoreFilterMatcher(),
+		now:                time.Now,
+		readsDisabled:      !access.Remote.Read,
+		writesDisabled:     !access.Remote.Write,
+	}
+}
+
+// newS3Client returns a client that gives up on requests the bucket hasn't started responding
+// to after timeout. Uploads aren't bounded, so that large artifacts aren't cut off on slow
+// connections. Zero means no limit.
+func newS3Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+func (cache *s3Cache) Put(target, hash string, duration int, files []string) error {
+	if cache.writesDisabled {
+		return nil
+	}
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	// The artifact is written to a temporary file rather than held in memory, since S3 needs
+	// to know its length before it is uploaded
+	artifact, err := ioutil.TempFile("", "turbo-s3-artifact-*")
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	defer removeTempFile(artifact)
+	w := io.Writer(artifact)
+	var tag *StreamValidator
+	if cache.signerVerifier.isEnabled() {
+		tagGenerator, err := cache.signerVerifier.getTagGenerator(hash)
+		if err != nil {
+			return fmt.Errorf("failed to store files in S3 cache: %w", err)
+		}
+		tag = &StreamValidator{currentHash: tagGenerator}
+		w = io.MultiWriter(artifact, tagGenerator)
+	}
+	if err := writeArtifact(w, files); err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	size, err := artifact.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	req, err := cache.newRequest(http.MethodPut, hash, ioutil.NopCloser(artifact))
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(_s3DurationHeader, strconv.Itoa(duration))
+	if tag != nil {
+		req.Header.Set(_s3TagHeader, tag.CurrentValue())
+	}
+	resp, err := cache.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to store files in S3 cache: %w", s3ResponseError(resp))
+	}
+	return nil
+}
+
+// writeArtifact writes the given files to w as a gzipped tarball
+func writeArtifact(w io.Writer, files []string) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	for _, file := range files {
+		if err := storeTarFile(tw, file, file); err != nil {
+			log.Printf("[ERROR] Error uploading artifact %s to S3 cache due to: %s", file, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// removeTempFile closes and removes a temporary artifact
+func removeTempFile(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+func (cache *s3Cache) Fetch(target, key string, outputGlobs []string) (bool, []string, int, error) {
+	if cache.readsDisabled {
+		return false, nil, 0, nil
+	}
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	hit, files, duration, err := cache.retrieve(key, fetchRestoreFilter(cache.restoreFilter, outputGlobs))
+	if err != nil {
+		return false, files, duration, fmt.Errorf("failed to retrieve files from S3 cache: %w", err)
+	}
+	event := cacheEventMiss
+	if hit {
+		event = cacheEventHit
+	}
+	cache.recorder.LogEvent(&CacheEvent{
+		Source:   "REMOTE",
+		Event:    event,
+		Hash:     key,
+		Duration: duration,
+	})
+	return hit, files, duration, nil
+}
+
+func (cache *s3Cache) retrieve(hash string, restoreFilter func(repoRelativePath string) bool) (bool, []string, int, error) {
+	req, err := cache.newRequest(http.MethodGet, hash, nil)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	resp, err := cache.do(req)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil, 0, nil // doesn't exist - not an error
+	} else if resp.StatusCode != http.StatusOK {
+		return false, nil, 0, s3ResponseError(resp)
+	}
+	duration := 0
+	if value := resp.Header.Get(_s3DurationHeader); value != "" {
+		duration, err = strconv.Atoi(value)
+		if err != nil {
+			return false, nil, 0, fmt.Errorf("invalid %v header: %w", _s3DurationHeader, err)
+		}
+	}
+	tarReader := io.Reader(resp.Body)
+	if cache.signerVerifier.isEnabled() {
+		artifact, err := cache.downloadVerified(hash, resp)
+		if err != nil {
+			return false, nil, 0, err
+		}
+		defer removeTempFile(artifact)
+		tarReader = artifact
+	}
+	var files []string
+	if cache.stagedRestore {
+		err = stagedRestore(cache.repoRoot, func(stagingDir turbopath.AbsolutePath) error {
+			files, err = restoreTarMatching(stagingDir, tarReader, CompressionGzip, restoreFilter, false)
+			return err
+		})
+	} else {
+		files, err = restoreTarMatching(cache.repoRoot, tarReader, CompressionGzip, restoreFilter, cache.onlyChangedOutputs)
+	}
+	if err != nil {
+		return false, nil, 0, err
+	}
+	return true, files, duration, nil
+}
+
+// downloadVerified saves the artifact in the response to a temporary file, and checks its
+// signature before anything is restored from it. The caller removes the file.
+func (cache *s3Cache) downloadVerified(hash string, resp *http.Response) (*os.File, error) {
+	expectedTag := resp.Header.Get(_s3TagHeader)
+	if expectedTag == "" {
+		// If the verifier is enabled all incoming artifact downloads must have a signature
+		return nil, errors.New("artifact verification failed: Downloaded artifact is missing its signature")
+	}
+	tagGenerator, err := cache.signerVerifier.getTagGenerator(hash)
+	if err != nil {
+		return nil, fmt.Errorf("artifact verification failed: %w", err)
+	}
+	artifact, err := ioutil.TempFile("", "turbo-s3-artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(artifact, tagGenerator), resp.Body); err != nil {
+		removeTempFile(artifact)
+		return nil, fmt.Errorf("artifact verification failed: %w", err)
+	}
+	if !(&StreamValidator{currentHash: tagGenerator}).Validate(expectedTag) {
+		removeTempFile(artifact)
+		return nil, fmt.Errorf("artifact verification failed: artifact tag does not match expected tag %s", expectedTag)
+	}
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		removeTempFile(artifact)
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// newRequest creates a request for the object holding the artifact with the given hash
+func (cache *s3Cache) newRequest(method string, hash string, body io.Reader) (*http.Request, error) {
+	objectURL := fmt.Sprintf("%v/%v/%v", cache.opts.Endpoint, s3Escape(cache.opts.Bucket), s3Escape(hash))
+	return http.NewRequest(method, objectURL, body)
+}
+
+// do signs and sends the request
+func (cache *s3Cache) do(req *http.Request) (*http.Response, error) {
+	signS3Request(req, _s3UnsignedPayload, cache.opts, cache.now())
+	return cache.client.Do(req)
+}
+
+// s3ResponseError describes an unsuccessful response from the S3 API
+func s3ResponseError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(b))
+}
+
+// signS3Request signs the request with AWS Signature Version 4, covering its host and
+// every header already set on it. payloadHash is the hex-encoded SHA-256 of the body, or
+// _s3UnsignedPayload. Requests are sent unsigned without credentials.
+func signS3Request(req *http.Request, payloadHash string, opts *s3Options, now time.Time) {
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if opts.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", opts.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", date, opts.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+opts.SecretAccessKey), date)
+	key = hmacSHA256(key, opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape escapes a bucket name or object key for use as a path segment
+func s3Escape(segment string) string {
+	return strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+}
+
+// S3StatusChecker checks that the bucket configured by the environment can be reached, for
+// the remote cache health check
+type S3StatusChecker struct {
+	cache *s3Cache
+}
+
+// NewS3StatusChecker returns a checker for the bucket configured by the environment, or nil
+// if none is
+func NewS3StatusChecker(opts Opts) *S3StatusChecker {
+	s3Opts := s3OptionsFromEnv()
+	if s3Opts == nil {
+		return nil
+	}
+	return &S3StatusChecker{cache: newS3Cache(opts, s3Opts, nil, "")}
+}
+
+// GetCachingStatus reports caching as enabled if the bucket can be reached with the
+// configured credentials
+func (c *S3StatusChecker) GetCachingStatus() (util.CachingStatus, error) {
+	bucketURL := fmt.Sprintf("%v/%v", c.cache.opts.Endpoint, s3Escape(c.cache.opts.Bucket))
+	req, err := http.NewRequest(http.MethodHead, bucketURL, nil)
+	if err != nil {
+		return util.CachingStatusDisabled, err
+	}
+	resp, err := c.cache.do(req)
+	if err != nil {
+		return util.CachingStatusDisabled, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return util.CachingStatusDisabled, s3ResponseError(resp)
+	}
+	return util.CachingStatusEnabled, nil
+}
+
+func (cache *s3Cache) Clean(target string) {
+	// Not possible; this implementation can only clean for a hash.
+}
+
+func (cache *s3Cache) CleanAll() {
+	// Also not possible.
+}
+
+func (cache *s3Cache) Shutdown() {}
@@ -1,10 +1,12 @@
 package cache
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/analytics"
 	"github.com/vercel/turborepo/cli/internal/fs"
@@ -111,7 +113,7 @@ func TestPutCachingDisabled(t *testing.T) {
 type fakeClient struct{}
 
 // FetchArtifact implements client
-func (*fakeClient) FetchArtifact(hash string) (*http.Response, error) {
+func (*fakeClient) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
 	panic("unimplemented")
 }
 
@@ -121,7 +123,7 @@ func (*fakeClient) GetTeamID() string {
 }
 
 // PutArtifact implements client
-func (*fakeClient) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (*fakeClient) PutArtifact(ctx context.Context, hash string, body []byte, duration int, tag string, encoding string) error {
 	panic("unimplemented")
 }
 
@@ -169,6 +171,82 @@ func TestFetchCachingDisabled(t *testing.T) {
 	mplex.mu.RUnlock()
 }
 
+func TestFetchOrder(t *testing.T) {
+	local := newEnabledCache()
+	remote := &httpCache{}
+
+	mplex := &cacheMultiplexer{
+		caches: []Cache{local, remote},
+	}
+	for _, tc := range []struct {
+		priority SourcePriority
+		want     []Cache
+	}{
+		{"", []Cache{local, remote}},
+		{SourcePriorityLocal, []Cache{local, remote}},
+		{SourcePriorityRemote, []Cache{remote, local}},
+	} {
+		mplex.opts.SourcePriority = tc.priority
+		got := mplex.fetchOrder()
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("fetchOrder() with priority %q = %v, want %v", tc.priority, got, tc.want)
+		}
+	}
+
+	mplex.opts.SourcePriority = SourcePriorityAuto
+	mplex.recordLatency(local, 10*time.Millisecond)
+	if got := mplex.fetchOrder(); got[0] != remote {
+		t.Error("expected the unmeasured remote cache to be checked first")
+	}
+	mplex.recordLatency(remote, 5*time.Millisecond)
+	if got := mplex.fetchOrder(); got[0] != remote {
+		t.Error("expected the faster remote cache to be checked first")
+	}
+	for i := 0; i < 5; i++ {
+		mplex.recordLatency(remote, 100*time.Millisecond)
+	}
+	if got := mplex.fetchOrder(); got[0] != local {
+		t.Error("expected the local cache to be checked first once the remote cache slowed down")
+	}
+}
+
+func TestFetchBackfillsMissedCaches(t *testing.T) {
+	first := newEnabledCache()
+	second := newEnabledCache()
+	second.entries["some-hash"] = []string{"a-file"}
+	third := newEnabledCache()
+
+	mplex := &cacheMultiplexer{
+		caches: []Cache{first, second, third},
+	}
+	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", []string{"unused", "files"})
+	if err != nil {
+		t.Errorf("got error fetching files: %v", err)
+	}
+	if !hit {
+		t.Error("failed to find previously stored files")
+	}
+	if _, ok := first.entries["some-hash"]; !ok {
+		t.Error("expected the artifact to be stored in the cache that missed")
+	}
+	if _, ok := third.entries["some-hash"]; ok {
+		t.Error("expected the artifact not to be stored in a cache that wasn't checked")
+	}
+}
+
+func TestSourcePriorityValue(t *testing.T) {
+	var priority SourcePriority
+	if err := priority.Set("remote"); err != nil {
+		t.Errorf("Set(remote) got error %v", err)
+	}
+	if priority != SourcePriorityRemote {
+		t.Errorf("priority = %v, want %v", priority, SourcePriorityRemote)
+	}
+	if err := priority.Set("fastest"); err == nil {
+		t.Error("Set(fastest) expected an error")
+	}
+}
+
 type nullRecorder struct{}
 
 func (nullRecorder) LogEvent(analytics.EventPayload) {}
@@ -272,3 +350,60 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAccess(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    Access
+		wantErr bool
+	}{
+		{"local:rw,remote:rw", _defaultAccess, false},
+		{"local:r,remote:rw", Access{Local: Actions{Read: true}, Remote: Actions{Read: true, Write: true}}, false},
+		{"remote:w", Access{Remote: Actions{Write: true}}, false},
+		{" local:rw , remote:r ", Access{Local: Actions{Read: true, Write: true}, Remote: Actions{Read: true}}, false},
+		{"local", Access{}, true},
+		{"local:x", Access{}, true},
+		{"local:", Access{}, true},
+		{"disk:rw", Access{}, true},
+		{"local:r,local:w", Access{}, true},
+		{"", Access{}, true},
+	} {
+		got, err := ParseAccess(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseAccess(%q) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseAccess(%q) = %+v, want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestResolveAccess(t *testing.T) {
+	opts := &Opts{}
+	flag := &accessFlag{opts: opts}
+	if got := opts.resolveAccess(); got != _defaultAccess {
+		t.Errorf("resolveAccess() with no --cache = %v, want %v", got, _defaultAccess)
+	}
+	if err := flag.Set("local:r,remote:rw"); err != nil {
+		t.Fatalf("Set got error %v", err)
+	}
+	if got := flag.String(); got != "local:r,remote:rw" {
+		t.Errorf("String() = %v, want local:r,remote:rw", got)
+	}
+	opts.SkipRemote = true
+	want := Access{Local: Actions{Read: true}}
+	if got := opts.resolveAccess(); got != want {
+		t.Errorf("resolveAccess() with SkipRemote = %v, want %v", got, want)
+	}
+	if opts.RemoteEnabled() {
+		t.Errorf("RemoteEnabled() with SkipRemote = true, want false")
+	}
+	opts.SkipRemote = false
+	if err := flag.Set("local:rw"); err != nil {
+		t.Fatalf("Set got error %v", err)
+	}
+	if opts.RemoteEnabled() {
+		t.Errorf("RemoteEnabled() with --cache=local:rw = true, want false")
+	}
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vercel/turborepo/cli/internal/cmdutil"
+)
+
+// errReservedCommand is returned when "cache" is invoked without a subcommand. The name is
+// reserved for this command, so "turbo cache" never falls through to running a task named cache.
+var errReservedCommand = errors.New("\"cache\" is a reserved command name. To run a task named cache, use \"turbo run cache\"")
+
+// GetCmd returns the cobra command for managing the local filesystem cache
+func GetCmd(helper *cmdutil.Helper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local filesystem cache",
+		// Accept whatever a task invocation would have passed so that we can point
+		// the user at "turbo run cache" rather than failing on an unknown flag.
+		Args:               cobra.ArbitraryArgs,
+		FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errReservedCommand
+		},
+	}
+	cmd.AddCommand(cleanCmd(helper))
+	return cmd
+}
+
+func cleanCmd(helper *cmdutil.Helper) *cobra.Command {
+	var stale time.Duration
+	opts := &Opts{}
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove artifacts from the local filesystem cache",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			base, err := helper.GetCmdBase(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			cache := &fsCache{
+				cacheDirectory: opts.ResolveCacheDir(base.RepoRoot).ToString(),
+			}
+			var removed int
+			var reclaimed int64
+			if stale > 0 {
+				removed, reclaimed, err = cache.cleanStale(stale, time.Now())
+			} else {
+				removed, reclaimed, err = cache.cleanAll()
+			}
+			if err != nil {
+				base.LogError("could not clean the cache: %w", err)
+				return err
+			}
+			base.UI.Output(fmt.Sprintf("Removed %v cache entries, reclaiming %v", removed, formatBytes(reclaimed)))
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&stale, "stale", 0, "Only remove cache entries written longer ago than the given duration, e.g. 72h")
+	cmd.Flags().StringVar(&opts.OverrideDir, "cache-dir", "", "Override the filesystem cache directory")
+	return cmd
+}
+
+// cleanStale removes the entries whose metadata was last written more than maxAge before now.
+// It returns the number of entries removed and the number of bytes reclaimed.
+func (f *fsCache) cleanStale(maxAge time.Duration, now time.Time) (int, int64, error) {
+	entries, err := f.listEntries()
+	if err != nil {
+		return 0, 0, err
+	}
+	removed := 0
+	var reclaimed int64
+	for hash, entry := range entries {
+		if now.Sub(entry.WrittenAt) <= maxAge {
+			continue
+		}
+		size, err := f.removeEntry(hash)
+		reclaimed += size
+		if err != nil {
+			return removed, reclaimed, err
+		}
+		removed++
+	}
+	return removed, reclaimed, nil
+}
+
+// cleanAll removes the entire cache directory. It returns the number of entries removed
+// and the number of bytes reclaimed.
+func (f *fsCache) cleanAll() (int, int64, error) {
+	metaFiles, err := filepath.Glob(filepath.Join(f.cacheDirectory, "*"+_metaFileSuffix))
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := diskUsage(f.cacheDirectory)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+	if err := os.RemoveAll(f.cacheDirectory); err != nil {
+		return 0, 0, err
+	}
+	return len(metaFiles), size, nil
+}
+
+// removeEntry removes the artifact, in any form, and the metadata for the given hash.
+// It returns the number of bytes reclaimed.
+func (f *fsCache) removeEntry(hash string) (int64, error) {
+	var reclaimed int64
+	for _, name := range append(artifactNames(hash), hash+_metaFileSuffix) {
+		path := filepath.Join(f.cacheDirectory, name)
+		size, err := diskUsage(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return reclaimed, err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return reclaimed, err
+		}
+		reclaimed += size
+	}
+	if err := f.appendMetadataIndex(&metadataIndexEntry{Hash: hash, WrittenAt: time.Now(), Removed: true}); err != nil {
+		return reclaimed, err
+	}
+	return reclaimed, nil
+}
+
+// diskUsage returns the total size of the files at or under the given path, without
+// following symlinks
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// formatBytes renders a number of bytes in human-readable binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
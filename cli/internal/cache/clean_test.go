@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/cmdutil"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"gotest.tools/v3/assert"
+)
+
+func TestCleanStale(t *testing.T) {
+	cacheDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	now := time.Now()
+	for _, hash := range []string{"old-hash", "new-hash"} {
+		file := cacheDir.Join(hash, "some-package", "a")
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte("hello"), 0644), "WriteFile")
+		assert.NilError(t, cacheDir.Join(hash+_metaFileSuffix).WriteFile([]byte(`{}`), 0644), "WriteFile")
+	}
+	assert.NilError(t, cacheDir.Join("old-archive"+_gzipArchiveExtension).WriteFile([]byte("archive"), 0644), "WriteFile")
+	assert.NilError(t, cacheDir.Join("old-archive"+_metaFileSuffix).WriteFile([]byte(`{}`), 0644), "WriteFile")
+	old := now.Add(-48 * time.Hour)
+	for _, name := range []string{"old-hash" + _metaFileSuffix, "old-archive" + _metaFileSuffix} {
+		assert.NilError(t, os.Chtimes(cacheDir.Join(name).ToString(), old, old), "Chtimes")
+	}
+
+	cache := &fsCache{cacheDirectory: cacheDir.ToString()}
+	removed, reclaimed, err := cache.cleanStale(24*time.Hour, now)
+	assert.NilError(t, err, "cleanStale")
+	assert.Equal(t, removed, 2)
+	assert.Equal(t, reclaimed, int64(len("hello")+len("archive")+2*len(`{}`)))
+
+	assert.Assert(t, !cacheDir.Join("old-hash").DirExists(), "expected the stale artifact to be removed")
+	assert.Assert(t, !cacheDir.Join("old-hash"+_metaFileSuffix).FileExists(), "expected the stale metadata to be removed")
+	assert.Assert(t, !cacheDir.Join("old-archive"+_gzipArchiveExtension).FileExists(), "expected the stale archive to be removed")
+	assert.Assert(t, cacheDir.Join("new-hash", "some-package", "a").FileExists(), "expected the recent artifact to be kept")
+	assert.Assert(t, cacheDir.Join("new-hash"+_metaFileSuffix).FileExists(), "expected the recent metadata to be kept")
+}
+
+func TestCleanAll(t *testing.T) {
+	cacheDir := fs.AbsolutePathFromUpstream(t.TempDir()).Join("cache")
+	file := cacheDir.Join("the-hash", "some-package", "a")
+	assert.NilError(t, file.EnsureDir(), "EnsureDir")
+	assert.NilError(t, file.WriteFile([]byte("hello"), 0644), "WriteFile")
+	assert.NilError(t, cacheDir.Join("the-hash"+_metaFileSuffix).WriteFile([]byte(`{}`), 0644), "WriteFile")
+
+	cache := &fsCache{cacheDirectory: cacheDir.ToString()}
+	removed, reclaimed, err := cache.cleanAll()
+	assert.NilError(t, err, "cleanAll")
+	assert.Equal(t, removed, 1)
+	assert.Equal(t, reclaimed, int64(len("hello")+len(`{}`)))
+	assert.Assert(t, !cacheDir.DirExists(), "expected the cache directory to be removed")
+
+	// Cleaning a cache that doesn't exist is not an error
+	removed, reclaimed, err = cache.cleanAll()
+	assert.NilError(t, err, "cleanAll")
+	assert.Equal(t, removed, 0)
+	assert.Equal(t, reclaimed, int64(0))
+}
+
+func TestClean(t *testing.T) {
+	cacheDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	for _, hash := range []string{"the-hash", "other-hash"} {
+		file := cacheDir.Join(hash, "a")
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte("hello"), 0644), "WriteFile")
+		assert.NilError(t, cacheDir.Join(hash+_metaFileSuffix).WriteFile([]byte(`{}`), 0644), "WriteFile")
+	}
+
+	cache := &fsCache{cacheDirectory: cacheDir.ToString()}
+	cache.Clean("the-hash")
+	assert.Assert(t, !cacheDir.Join("the-hash").DirExists(), "expected the artifact to be removed")
+	assert.Assert(t, !cacheDir.Join("the-hash"+_metaFileSuffix).FileExists(), "expected the metadata to be removed")
+	assert.Assert(t, cacheDir.Join("other-hash", "a").FileExists(), "expected other artifacts to be kept")
+	assert.Assert(t, cacheDir.Join("other-hash"+_metaFileSuffix).FileExists(), "expected other metadata to be kept")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, formatBytes(512), "512 B")
+	assert.Equal(t, formatBytes(1536), "1.5 KiB")
+	assert.Equal(t, formatBytes(3*1024*1024), "3.0 MiB")
+}
+
+func TestCacheCommandIsReserved(t *testing.T) {
+	cmd := GetCmd(cmdutil.NewHelper("test-version"))
+	cmd.SetArgs([]string{"--filter=web"})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	err := cmd.Execute()
+	assert.ErrorIs(t, err, errReservedCommand)
+}
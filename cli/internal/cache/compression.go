@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// newWriter returns a writer that compresses what is written to it into w. Closing it flushes
+// the compressed stream, but doesn't close w.
+func (c Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("cannot compress with %q", c)
+}
+
+// newReader returns a reader that decompresses what is read from r
+func (c Compression) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("cannot decompress %q", c)
+}
+
+// archiveExtension is appended to the hash to name an artifact stored as an archive with
+// this compression
+func (c Compression) archiveExtension() string {
+	switch c {
+	case CompressionGzip:
+		return _gzipArchiveExtension
+	case CompressionZstd:
+		return _zstdArchiveExtension
+	}
+	return ""
+}
+
+// isArchive returns true if artifacts with this compression are stored as a single archive
+func (c Compression) isArchive() bool {
+	return c.archiveExtension() != ""
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	turbofs "github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// errRestoreInterrupted is returned by staged restores that were stopped by InterruptStagedRestores
+var errRestoreInterrupted = errors.New("restore was interrupted")
+
+// _stagingDirs tracks the staging directories of in-progress restores, so that they can be
+// removed if turbo is interrupted before the deferred cleanup runs, and the restores that are
+// moving files into place, so that an interrupt can wait for them to be rolled back
+var _stagingDirs = struct {
+	mu          sync.Mutex
+	dirs        map[string]struct{}
+	moving      sync.WaitGroup
+	interrupted bool
+}{dirs: make(map[string]struct{})}
+
+// InterruptStagedRestores stops in-progress staged restores and removes their staging
+// directories. It is meant to be called when turbo receives a signal. Restores that are
+// already moving files into place are rolled back, and it waits for that to finish.
+func InterruptStagedRestores() {
+	_stagingDirs.mu.Lock()
+	_stagingDirs.interrupted = true
+	for dir := range _stagingDirs.dirs {
+		_ = os.RemoveAll(dir)
+	}
+	_stagingDirs.dirs = make(map[string]struct{})
+	_stagingDirs.mu.Unlock()
+	_stagingDirs.moving.Wait()
+}
+
+// stagedRestore runs restore against a temporary staging directory inside root and only
+// moves the restored files into their final location once restore has completed. If the
+// restore fails or is interrupted, the files already present in root are left untouched.
+//
+// Each file is renamed into place separately, and the files it replaces are kept aside until
+// the move completes. If the move fails or is interrupted, it is rolled back, so that root
+// never ends up with some outputs replaced and others not.
+func stagedRestore(root turbopath.AbsolutePath, restore func(stagingDir turbopath.AbsolutePath) error) error {
+	// Keep the staging directory inside root so that moving files into place is a rename
+	// on the same filesystem rather than a copy.
+	stagingParent := root.Join(".turbo", "restore")
+	if err := stagingParent.MkdirAll(); err != nil {
+		return err
+	}
+	stagingDir, err := registerStagingDir(stagingParent)
+	if err != nil {
+		return err
+	}
+	defer unregisterStagingDir(stagingDir)
+
+	if err := restore(turbofs.UnsafeToAbsolutePath(stagingDir)); err != nil {
+		return err
+	}
+	if err := beginMove(stagingDir); err != nil {
+		return err
+	}
+	defer _stagingDirs.moving.Done()
+	backupDir := stagingDir + "-backup"
+	defer func() { _ = os.RemoveAll(backupDir) }()
+	return moveStagedFiles(stagingDir, backupDir, root, restoreInterrupted)
+}
+
+func restoreInterrupted() bool {
+	_stagingDirs.mu.Lock()
+	defer _stagingDirs.mu.Unlock()
+	return _stagingDirs.interrupted
+}
+
+// registerStagingDir creates a staging directory under parent and tracks it until
+// unregisterStagingDir is called
+func registerStagingDir(parent turbopath.AbsolutePath) (string, error) {
+	_stagingDirs.mu.Lock()
+	defer _stagingDirs.mu.Unlock()
+	if _stagingDirs.interrupted {
+		return "", errRestoreInterrupted
+	}
+	stagingDir, err := os.MkdirTemp(parent.ToString(), "staging-")
+	if err != nil {
+		return "", err
+	}
+	_stagingDirs.dirs[stagingDir] = struct{}{}
+	return stagingDir, nil
+}
+
+// beginMove marks a staging directory as being moved into place, after which an interrupt
+// leaves it to be rolled back rather than removing it. The caller must then call
+// _stagingDirs.moving.Done once it is done.
+func beginMove(stagingDir string) error {
+	_stagingDirs.mu.Lock()
+	defer _stagingDirs.mu.Unlock()
+	if _stagingDirs.interrupted {
+		return errRestoreInterrupted
+	}
+	delete(_stagingDirs.dirs, stagingDir)
+	_stagingDirs.moving.Add(1)
+	return nil
+}
+
+// unregisterStagingDir removes a staging directory created by registerStagingDir
+func unregisterStagingDir(stagingDir string) {
+	_stagingDirs.mu.Lock()
+	defer _stagingDirs.mu.Unlock()
+	delete(_stagingDirs.dirs, stagingDir)
+	_ = os.RemoveAll(stagingDir)
+}
+
+// movedFile records a file that moveStagedFiles moved into place, and where the file it
+// replaced was kept, if there was one
+type movedFile struct {
+	dest   string
+	backup string
+}
+
+// moveStagedFiles renames every file and symlink under stagingDir to the same relative path
+// under root, first moving any file it replaces to the same relative path under backupDir.
+// It checks interrupted before each file. If it is interrupted, or a rename fails, the files
+// moved so far are put back, along with those they replaced.
+func moveStagedFiles(stagingDir string, backupDir string, root turbopath.AbsolutePath, interrupted func() bool) error {
+	var moved []movedFile
+	var createdDirs []string
+	err := filepath.WalkDir(stagingDir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(stagingDir, name)
+		if err != nil {
+			return err
+		}
+		if relativePath == "." {
+			return nil
+		}
+		dest := root.Join(relativePath)
+		if entry.IsDir() {
+			// Directories are walked before their contents, so only this one can be missing
+			if _, err := dest.Lstat(); os.IsNotExist(err) {
+				if err := os.Mkdir(dest.ToString(), turbofs.DirPermissions); err != nil {
+					return err
+				}
+				createdDirs = append(createdDirs, dest.ToString())
+				return nil
+			}
+			return dest.MkdirAll()
+		}
+		if interrupted() {
+			return errRestoreInterrupted
+		}
+		file := movedFile{dest: dest.ToString()}
+		if _, err := dest.Lstat(); err == nil {
+			file.backup = filepath.Join(backupDir, relativePath)
+			if err := os.MkdirAll(filepath.Dir(file.backup), turbofs.DirPermissions); err != nil {
+				return err
+			}
+			if err := os.Rename(file.dest, file.backup); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		moved = append(moved, file)
+		return os.Rename(name, file.dest)
+	})
+	if err != nil {
+		if rollbackErr := rollbackStagedMove(moved, createdDirs); rollbackErr != nil {
+			return fmt.Errorf("%w (rolling back the restore failed: %v)", err, rollbackErr)
+		}
+	}
+	return err
+}
+
+// rollbackStagedMove undoes the changes moveStagedFiles made, in reverse order
+func rollbackStagedMove(moved []movedFile, createdDirs []string) error {
+	for i := len(moved) - 1; i >= 0; i-- {
+		file := moved[i]
+		if err := os.Remove(file.dest); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if file.backup != "" {
+			if err := os.Rename(file.backup, file.dest); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(createdDirs) - 1; i >= 0; i-- {
+		if err := os.Remove(createdDirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestStagedRestore(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	err := stagedRestore(root, func(stagingDir turbopath.AbsolutePath) error {
+		output := stagingDir.Join("dist", "index.js")
+		assert.NilError(t, output.EnsureDir(), "EnsureDir")
+		return output.WriteFile([]byte("restored"), 0644)
+	})
+	assert.NilError(t, err, "stagedRestore")
+
+	contents, err := root.Join("dist", "index.js").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "restored")
+}
+
+func TestStagedRestoreInterrupted(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	existing := root.Join("dist", "index.js")
+	assert.NilError(t, existing.EnsureDir(), "EnsureDir")
+	assert.NilError(t, existing.WriteFile([]byte("existing"), 0644), "WriteFile")
+
+	interrupted := errors.New("interrupted")
+	err := stagedRestore(root, func(stagingDir turbopath.AbsolutePath) error {
+		// Simulate a restore that has written some of its files when it is interrupted
+		partial := stagingDir.Join("dist", "index.js")
+		assert.NilError(t, partial.EnsureDir(), "EnsureDir")
+		assert.NilError(t, partial.WriteFile([]byte("partial"), 0644), "WriteFile")
+		assert.NilError(t, stagingDir.Join("dist", "other.js").WriteFile([]byte("partial"), 0644), "WriteFile")
+		return interrupted
+	})
+	assert.ErrorIs(t, err, interrupted)
+
+	contents, err := existing.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "existing")
+	assert.Assert(t, !root.Join("dist", "other.js").FileExists(), "partially restored file was moved into place")
+}
+
+func TestInterruptStagedRestores(t *testing.T) {
+	t.Cleanup(func() {
+		_stagingDirs.mu.Lock()
+		_stagingDirs.interrupted = false
+		_stagingDirs.mu.Unlock()
+	})
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	var staged turbopath.AbsolutePath
+	err := stagedRestore(root, func(stagingDir turbopath.AbsolutePath) error {
+		staged = stagingDir
+		output := stagingDir.Join("dist", "index.js")
+		assert.NilError(t, output.EnsureDir(), "EnsureDir")
+		assert.NilError(t, output.WriteFile([]byte("restored"), 0644), "WriteFile")
+		// Simulate turbo receiving a signal while the restore is in progress
+		InterruptStagedRestores()
+		assert.Assert(t, !stagingDir.DirExists(), "expected the staging directory to be removed")
+		return nil
+	})
+	assert.ErrorIs(t, err, errRestoreInterrupted)
+	assert.Assert(t, !staged.DirExists(), "expected the staging directory to be removed")
+	assert.Assert(t, !root.Join("dist", "index.js").FileExists(), "interrupted restore was moved into place")
+
+	err = stagedRestore(root, func(stagingDir turbopath.AbsolutePath) error { return nil })
+	assert.ErrorIs(t, err, errRestoreInterrupted)
+}
+
+func TestStagedRestoreInterruptedDuringMove(t *testing.T) {
+	root := fs.AbsolutePathFromUpstream(t.TempDir())
+	for _, name := range []string{"a.js", "b.js"} {
+		existing := root.Join("dist", name)
+		assert.NilError(t, existing.EnsureDir(), "EnsureDir")
+		assert.NilError(t, existing.WriteFile([]byte("existing"), 0644), "WriteFile")
+	}
+	staging := fs.AbsolutePathFromUpstream(t.TempDir())
+	for _, name := range []string{filepath.Join("dist", "a.js"), filepath.Join("dist", "b.js"), filepath.Join("dist", "nested", "c.js")} {
+		staged := staging.Join(name)
+		assert.NilError(t, staged.EnsureDir(), "EnsureDir")
+		assert.NilError(t, staged.WriteFile([]byte("restored"), 0644), "WriteFile")
+	}
+
+	// Interrupt once some of the files have been moved into place
+	checks := 0
+	interrupted := func() bool {
+		checks++
+		return checks > 2
+	}
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	err := moveStagedFiles(staging.ToString(), backupDir, root, interrupted)
+	assert.ErrorIs(t, err, errRestoreInterrupted)
+	assert.Equal(t, checks, 3)
+
+	for _, name := range []string{"a.js", "b.js"} {
+		contents, err := root.Join("dist", name).ReadFile()
+		assert.NilError(t, err, "ReadFile")
+		assert.Equal(t, string(contents), "existing", "expected %v to be rolled back", name)
+	}
+	assert.Assert(t, !root.Join("dist", "nested").DirExists(), "expected the created directory to be removed")
+}
@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -60,11 +61,30 @@ type RemoteConfig struct {
 // Opts holds values for configuring the behavior of the API client
 type Opts struct {
 	UsePreflight bool
+	// RetryMax is the number of times a failed request is retried
+	RetryMax int
+	// RetryWaitMin is the delay before the first retry. It doubles for each retry after that.
+	RetryWaitMin time.Duration
 }
 
+// The defaults for the retry flags
+const (
+	_defaultRetryMax     = 2
+	_defaultRetryWaitMin = 2 * time.Second
+)
+
+var _retryMaxHelp = `Retry requests to the remote cache that fail with a network
+error or a 5xx response this many times. Uploads are only
+retried if the connection was reset. Set to 0 to never retry.`
+
+var _retryWaitMinHelp = `Wait this long before the first retry of a request to the
+remote cache, doubling the wait for each retry after that.`
+
 // AddFlags adds flags specific to the api client to the given flagset
 func AddFlags(opts *Opts, flags *pflag.FlagSet) {
 	flags.BoolVar(&opts.UsePreflight, "preflight", false, "When enabled, turbo will precede HTTP requests with an OPTIONS request for authorization")
+	flags.IntVar(&opts.RetryMax, "experimental-remote-cache-retries", _defaultRetryMax, _retryMaxHelp)
+	flags.DurationVar(&opts.RetryWaitMin, "experimental-remote-cache-retry-delay", _defaultRetryWaitMin, _retryWaitMinHelp)
 }
 
 // New creates a new ApiClient
@@ -76,9 +96,9 @@ func NewClient(remoteConfig RemoteConfig, logger hclog.Logger, turboVersion stri
 			HTTPClient: &http.Client{
 				Timeout: time.Duration(20 * time.Second),
 			},
-			RetryWaitMin: 2 * time.Second,
-			RetryWaitMax: 10 * time.Second,
-			RetryMax:     2,
+			RetryWaitMin: opts.RetryWaitMin,
+			RetryWaitMax: _retryWaitMaxFactor * opts.RetryWaitMin,
+			RetryMax:     opts.RetryMax,
 			Backoff:      retryablehttp.DefaultBackoff,
 			Logger:       logger,
 		},
@@ -111,14 +131,29 @@ func (c *ApiClient) GetTeamID() string {
 	return c.teamID
 }
 
-func (c *ApiClient) retryCachePolicy(resp *http.Response, err error) (bool, error) {
+// _retryWaitMaxFactor caps the backoff between retries at this multiple of the first wait
+const _retryWaitMaxFactor = 5
+
+// retryOnlyOnResetKey marks the context of a request that is only retried after a network
+// error if the connection was reset, such as an upload that may otherwise have completed
+type retryOnlyOnResetKey struct{}
+
+// isConnectionReset returns true if the error means the connection was reset by the peer.
+// Other errors, such as an EOF while reading the response, may follow an upload the server
+// has already handled.
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+func (c *ApiClient) retryCachePolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
 	if err != nil {
 		if errors.As(err, &x509.UnknownAuthorityError{}) {
 			// Don't retry if the error was due to TLS cert verification failure.
-			atomic.AddUint64(&c.currentFailCount, 1)
 			return false, err
 		}
-		atomic.AddUint64(&c.currentFailCount, 1)
+		if ctx.Value(retryOnlyOnResetKey{}) != nil && !isConnectionReset(err) {
+			return false, err
+		}
 		return true, nil
 	}
 
@@ -126,7 +161,6 @@ func (c *ApiClient) retryCachePolicy(resp *http.Response, err error) (bool, erro
 	// a Retry-After response header to indicate when the server is
 	// available to start processing request from client.
 	if resp.StatusCode == http.StatusTooManyRequests {
-		atomic.AddUint64(&c.currentFailCount, 1)
 		return true, nil
 	}
 
@@ -135,7 +169,6 @@ func (c *ApiClient) retryCachePolicy(resp *http.Response, err error) (bool, erro
 	// errors and may relate to outages on the server side. This will catch
 	// invalid response codes as well, like 0 and 999.
 	if resp.StatusCode == 0 || (resp.StatusCode >= 500 && resp.StatusCode != 501) {
-		atomic.AddUint64(&c.currentFailCount, 1)
 		return true, fmt.Errorf("unexpected HTTP status %s", resp.Status)
 	}
 
@@ -146,13 +179,12 @@ func (c *ApiClient) retryCachePolicy(resp *http.Response, err error) (bool, erro
 func (c *ApiClient) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
 	// do not retry on context.Canceled or context.DeadlineExceeded
 	if ctx.Err() != nil {
-		atomic.AddUint64(&c.currentFailCount, 1)
 		return false, ctx.Err()
 	}
 
 	// we're squashing the error from the request and substituting any error that might come
 	// from our retry policy.
-	shouldRetry, err := c.retryCachePolicy(resp, err)
+	shouldRetry, err := c.retryCachePolicy(ctx, resp, err)
 	if shouldRetry {
 		// Our policy says it's ok to retry, but we need to check the failure count
 		if retryErr := c.okToRequest(); retryErr != nil {
@@ -162,6 +194,16 @@ func (c *ApiClient) checkRetry(ctx context.Context, resp *http.Response, err err
 	return shouldRetry, err
 }
 
+// do sends the request, retrying it as configured. A request that still fails once it
+// runs out of retries counts towards _maxRemoteFailCount.
+func (c *ApiClient) do(req *retryablehttp.Request) (*http.Response, error) {
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		atomic.AddUint64(&c.currentFailCount, 1)
+	}
+	return resp, err
+}
+
 // okToRequest returns nil if it's ok to make a request, and returns the error to
 // return to the caller if a request is not allowed
 func (c *ApiClient) okToRequest() error {
@@ -180,15 +222,16 @@ func (c *ApiClient) UserAgent() string {
 }
 
 // doPreflight returns response with closed body, latest request url, and any errors to the caller
-func (c *ApiClient) doPreflight(requestURL string, requestMethod string, requestHeaders string) (*http.Response, string, error) {
+func (c *ApiClient) doPreflight(ctx context.Context, requestURL string, requestMethod string, requestHeaders string) (*http.Response, string, error) {
 	req, err := retryablehttp.NewRequest(http.MethodOptions, requestURL, nil)
+	if err != nil {
+		return nil, requestURL, fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	}
+	req = req.WithContext(ctx)
 	req.Header.Set("User-Agent", c.UserAgent())
 	req.Header.Set("Access-Control-Request-Method", requestMethod)
 	req.Header.Set("Access-Control-Request-Headers", requestHeaders)
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	if err != nil {
-		return nil, requestURL, fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
-	}
 
 	// If resp is not nil, ignore any errors
 	//  because most likely unimportant for preflight to handle.
@@ -250,7 +293,9 @@ func (c *ApiClient) handle403(body io.Reader) error {
 	return disabledErr
 }
 
-func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int, tag string) error {
+// PutArtifact uploads the build artifact with the given hash to the Remote Caching server.
+// The upload is abandoned if ctx is done first.
+func (c *ApiClient) PutArtifact(ctx context.Context, hash string, artifactBody []byte, duration int, tag string, encoding string) error {
 	if err := c.okToRequest(); err != nil {
 		return err
 	}
@@ -265,7 +310,11 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	requestURL := c.makeUrl("/v8/artifacts/" + hash + encoded)
 	allowAuth := true
 	if c.usePreflight {
-		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodPut, "Content-Type, x-artifact-duration, Authorization, User-Agent, x-artifact-tag")
+		requestHeaders := "Content-Type, x-artifact-duration, Authorization, User-Agent, x-artifact-tag"
+		if encoding != "" {
+			requestHeaders += ", Content-Encoding"
+		}
+		resp, latestRequestURL, err := c.doPreflight(ctx, requestURL, http.MethodPut, requestHeaders)
 		if err != nil {
 			return fmt.Errorf("pre-flight request failed before trying to store in HTTP cache: %w", err)
 		}
@@ -275,6 +324,9 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	}
 
 	req, err := retryablehttp.NewRequest(http.MethodPut, requestURL, artifactBody)
+	if err != nil {
+		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	}
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("x-artifact-duration", fmt.Sprintf("%v", duration))
 	if allowAuth {
@@ -284,11 +336,12 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	if tag != "" {
 		req.Header.Set("x-artifact-tag", tag)
 	}
-	if err != nil {
-		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
 	}
+	req = req.WithContext(context.WithValue(ctx, retryOnlyOnResetKey{}, true))
 
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to store files in HTTP cache: %w", err)
 	}
@@ -300,8 +353,9 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 }
 
 // FetchArtifact attempts to retrieve the build artifact with the given hash from the
-// Remote Caching server
-func (c *ApiClient) FetchArtifact(hash string) (*http.Response, error) {
+// Remote Caching server. The request, and reading the returned body, are abandoned if ctx is
+// done first.
+func (c *ApiClient) FetchArtifact(ctx context.Context, hash string, acceptEncoding string) (*http.Response, error) {
 	if err := c.okToRequest(); err != nil {
 		return nil, err
 	}
@@ -316,7 +370,11 @@ func (c *ApiClient) FetchArtifact(hash string) (*http.Response, error) {
 	requestURL := c.makeUrl("/v8/artifacts/" + hash + encoded)
 	allowAuth := true
 	if c.usePreflight {
-		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodGet, "Authorization, User-Agent")
+		requestHeaders := "Authorization, User-Agent"
+		if acceptEncoding != "" {
+			requestHeaders += ", Accept-Encoding"
+		}
+		resp, latestRequestURL, err := c.doPreflight(ctx, requestURL, http.MethodGet, requestHeaders)
 		if err != nil {
 			return nil, fmt.Errorf("pre-flight request failed before trying to fetch files in HTTP cache: %w", err)
 		}
@@ -326,17 +384,23 @@ func (c *ApiClient) FetchArtifact(hash string) (*http.Response, error) {
 	}
 
 	req, err := retryablehttp.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache URL: %w", err)
+	}
+	req = req.WithContext(ctx)
 	if allowAuth {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
 	req.Header.Set("User-Agent", c.UserAgent())
-	if err != nil {
-		return nil, fmt.Errorf("invalid cache URL: %w", err)
+	if acceptEncoding != "" {
+		// Setting this also stops net/http from transparently decompressing the response,
+		// which is what we want since the artifact is restored according to its Content-Encoding
+		req.Header.Set("Accept-Encoding", acceptEncoding)
 	}
 
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch artifact: %v", err)
+		return nil, fmt.Errorf("failed to fetch artifact: %w", err)
 	} else if resp.StatusCode == http.StatusForbidden {
 		err = c.handle403(resp.Body)
 		_ = resp.Body.Close()
@@ -363,7 +427,7 @@ func (c *ApiClient) RecordAnalyticsEvents(events []map[string]interface{}) error
 	requestURL := c.makeUrl("/v8/artifacts/events" + encoded)
 	allowAuth := true
 	if c.usePreflight {
-		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodPost, "Content-Type, Authorization, User-Agent")
+		resp, latestRequestURL, err := c.doPreflight(context.Background(), requestURL, http.MethodPost, "Content-Type, Authorization, User-Agent")
 		if err != nil {
 			return fmt.Errorf("pre-flight request failed before trying to store in HTTP cache: %w", err)
 		}
@@ -381,7 +445,7 @@ func (c *ApiClient) RecordAnalyticsEvents(events []map[string]interface{}) error
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
 	req.Header.Set("User-Agent", c.UserAgent())
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if resp != nil && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		b, _ := ioutil.ReadAll(resp.Body)
 		return fmt.Errorf("%s", string(b))
@@ -442,7 +506,7 @@ func (c *ApiClient) GetTeams() (*TeamsResponse, error) {
 	req.Header.Set("User-Agent", c.UserAgent())
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -475,7 +539,7 @@ func (c *ApiClient) GetTeam(teamID string) (*Team, error) {
 	req.Header.Set("User-Agent", c.UserAgent())
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -527,7 +591,7 @@ func (c *ApiClient) GetUser() (*UserResponse, error) {
 	req.Header.Set("User-Agent", c.UserAgent())
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -555,6 +619,9 @@ type statusResponse struct {
 	Status string `json:"status"`
 }
 
+// ErrUnauthorized is returned when the API rejects the credentials used for a request
+var ErrUnauthorized = errors.New("unauthorized")
+
 // GetCachingStatus returns the server's perspective on whether or not remove caching
 // requests will be allowed.
 func (c *ApiClient) GetCachingStatus() (util.CachingStatus, error) {
@@ -567,7 +634,7 @@ func (c *ApiClient) GetCachingStatus() (util.CachingStatus, error) {
 	req.Header.Set("User-Agent", c.UserAgent())
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return util.CachingStatusDisabled, err
 	}
@@ -582,6 +649,9 @@ func (c *ApiClient) GetCachingStatus() (util.CachingStatus, error) {
 		} else {
 			responseText = string(b)
 		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return util.CachingStatusDisabled, fmt.Errorf("failed to get caching status (%v): %s: %w", resp.StatusCode, responseText, ErrUnauthorized)
+		}
 		return util.CachingStatusDisabled, fmt.Errorf("failed to get caching status (%v): %s", resp.StatusCode, responseText)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
@@ -602,6 +672,10 @@ type verificationResponse struct {
 	TeamID string `json:"teamId,omitempty"`
 }
 
+// ErrInvalidSSOToken is returned when the SSO verification endpoint rejects a token, for instance
+// because it has expired or has already been used. Retrying with the same token will not succeed.
+var ErrInvalidSSOToken = errors.New("SSO verification token is invalid or has expired")
+
 // VerifiedSSOUser contains data returned from the SSO token verification endpoint
 type VerifiedSSOUser struct {
 	Token  string
@@ -617,14 +691,17 @@ func (c *ApiClient) VerifySSOToken(token string, tokenName string) (*VerifiedSSO
 		return nil, err
 	}
 	req.Header.Set("User-Agent", c.UserAgent())
-	resp, err := c.HttpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		io.Copy(ioutil.Discard, resp.Body)
-		return nil, fmt.Errorf("404 - Not found") // doesn't exist - not an error
+		return nil, fmt.Errorf("%w: 404 - Not found", ErrInvalidSSOToken)
+	} else if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSSOToken, string(b))
 	} else if resp.StatusCode != http.StatusOK {
 		b, _ := ioutil.ReadAll(resp.Body)
 		return nil, fmt.Errorf("%s", string(b))
@@ -2,13 +2,19 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
@@ -94,7 +100,7 @@ func Test_PutArtifact(t *testing.T) {
 	expectedArtifactBody := []byte("My string artifact")
 
 	// Test Put Artifact
-	apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	apiClient.PutArtifact(context.Background(), "hash", expectedArtifactBody, 500, "", "")
 	testBody := <-ch
 	if !bytes.Equal(expectedArtifactBody, testBody) {
 		t.Errorf("Handler read '%v', wants '%v'", testBody, expectedArtifactBody)
@@ -119,7 +125,7 @@ func Test_PutWhenCachingDisabled(t *testing.T) {
 	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
 	expectedArtifactBody := []byte("My string artifact")
 	// Test Put Artifact
-	err := apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	err := apiClient.PutArtifact(context.Background(), "hash", expectedArtifactBody, 500, "", "")
 	cd := &util.CacheDisabledError{}
 	if !errors.As(err, &cd) {
 		t.Errorf("expected cache disabled error, got %v", err)
@@ -145,7 +151,7 @@ func Test_FetchWhenCachingDisabled(t *testing.T) {
 	}
 	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
 	// Test Put Artifact
-	resp, err := apiClient.FetchArtifact("hash")
+	resp, err := apiClient.FetchArtifact(context.Background(), "hash", "")
 	cd := &util.CacheDisabledError{}
 	if !errors.As(err, &cd) {
 		t.Errorf("expected cache disabled error, got %v", err)
@@ -157,3 +163,110 @@ func Test_FetchWhenCachingDisabled(t *testing.T) {
 		t.Errorf("response got %v, want <nil>", resp)
 	}
 }
+
+func Test_FetchArtifactRetries(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("artifact"))
+	}))
+	defer ts.Close()
+
+	remoteConfig := RemoteConfig{
+		TeamSlug: "my-team-slug",
+		APIURL:   ts.URL,
+		Token:    "my-token",
+	}
+	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{RetryMax: 2, RetryWaitMin: time.Millisecond})
+	resp, err := apiClient.FetchArtifact(context.Background(), "hash", "")
+	if err != nil {
+		t.Fatalf("FetchArtifact error = %v, want it to succeed after retrying", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "artifact" {
+		t.Errorf("FetchArtifact body = %q, want %q", body, "artifact")
+	}
+	if requests != 3 {
+		t.Errorf("requests = %v, want 3", requests)
+	}
+	// Failed attempts that were retried successfully don't count as failures
+	if err := apiClient.okToRequest(); err != nil {
+		t.Errorf("okToRequest() = %v, want nil", err)
+	}
+}
+
+func Test_retryCachePolicy(t *testing.T) {
+	apiClient := NewClient(RemoteConfig{}, hclog.Default(), "v1", Opts{})
+	upload := context.WithValue(context.Background(), retryOnlyOnResetKey{}, true)
+	reset := &url.Error{Op: "Put", URL: "/v8/artifacts/hash", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+	timeout := &url.Error{Op: "Put", URL: "/v8/artifacts/hash", Err: context.DeadlineExceeded}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		name  string
+		ctx   context.Context
+		resp  *http.Response
+		err   error
+		retry bool
+	}{
+		{name: "download network error", ctx: context.Background(), err: timeout, retry: true},
+		{name: "download server error", ctx: context.Background(), resp: &http.Response{StatusCode: http.StatusBadGateway}, retry: true},
+		{name: "upload server error", ctx: upload, resp: &http.Response{StatusCode: http.StatusInternalServerError}, retry: true},
+		{name: "upload connection reset", ctx: upload, err: reset, retry: true},
+		{name: "upload network error", ctx: upload, err: timeout, retry: false},
+		{name: "upload EOF", ctx: upload, err: &url.Error{Op: "Put", URL: "/v8/artifacts/hash", Err: io.EOF}, retry: false},
+		{name: "client error", ctx: context.Background(), resp: &http.Response{StatusCode: http.StatusBadRequest}, retry: false},
+		{name: "canceled", ctx: canceled, err: timeout, retry: false},
+	}
+	for _, tc := range testCases {
+		retry, _ := apiClient.checkRetry(tc.ctx, tc.resp, tc.err)
+		if retry != tc.retry {
+			t.Errorf("%v: checkRetry() = %v, want %v", tc.name, retry, tc.retry)
+		}
+	}
+}
+
+func Test_NewClientRetryOpts(t *testing.T) {
+	apiClient := NewClient(RemoteConfig{}, hclog.Default(), "v1", Opts{})
+	if apiClient.HttpClient.RetryMax != 0 || apiClient.HttpClient.RetryWaitMin != 0 {
+		t.Errorf("expected zero retry options to be used as given, got %v retries after %v", apiClient.HttpClient.RetryMax, apiClient.HttpClient.RetryWaitMin)
+	}
+	apiClient = NewClient(RemoteConfig{}, hclog.Default(), "v1", Opts{RetryMax: 5, RetryWaitMin: time.Second})
+	if apiClient.HttpClient.RetryMax != 5 || apiClient.HttpClient.RetryWaitMin != time.Second || apiClient.HttpClient.RetryWaitMax != _retryWaitMaxFactor*time.Second {
+		t.Errorf("expected the configured retry options to be used, got %v retries after %v", apiClient.HttpClient.RetryMax, apiClient.HttpClient.RetryWaitMin)
+	}
+}
+
+func Test_FetchArtifactTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	remoteConfig := RemoteConfig{
+		TeamSlug: "my-team-slug",
+		APIURL:   ts.URL,
+		Token:    "my-token",
+	}
+	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{RetryMax: 2, RetryWaitMin: time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := apiClient.FetchArtifact(ctx, "hash", "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FetchArtifact error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if resp != nil {
+		t.Errorf("response got %v, want <nil>", resp)
+	}
+
+	err = apiClient.PutArtifact(ctx, "hash", []byte("artifact"), 500, "", "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PutArtifact error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -9,11 +9,14 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"github.com/vercel/turborepo/cli/internal/cache"
 	"github.com/vercel/turborepo/cli/internal/cmd/auth"
+	"github.com/vercel/turborepo/cli/internal/cmd/completion"
 	"github.com/vercel/turborepo/cli/internal/cmd/info"
 	"github.com/vercel/turborepo/cli/internal/cmdutil"
 	"github.com/vercel/turborepo/cli/internal/daemon"
 	"github.com/vercel/turborepo/cli/internal/login"
+	"github.com/vercel/turborepo/cli/internal/ls"
 	"github.com/vercel/turborepo/cli/internal/process"
 	"github.com/vercel/turborepo/cli/internal/prune"
 	"github.com/vercel/turborepo/cli/internal/run"
@@ -78,6 +81,15 @@ const _defaultCmd string = "run"
 
 // resolveArgs adds a default command to the supplied arguments if none exists.
 func resolveArgs(root *cobra.Command, args []string) []string {
+	if len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd) {
+		// Shell completion requests pass the words typed so far, ending with the one being completed.
+		// While that is the only word it may be a command name, otherwise resolve the default
+		// command for the words being completed.
+		if len(args) > 2 {
+			return append([]string{args[0]}, resolveArgs(root, args[1:])...)
+		}
+		return args
+	}
 	for _, arg := range args {
 		if arg == "--help" || arg == "-h" || arg == "--version" {
 			return args
@@ -132,6 +144,8 @@ func getCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 		},
 	}
 	cmd.SetVersionTemplate("{{.Version}}\n")
+	// Use our own completion command so that resolveArgs can find it before cobra would add its default
+	cmd.CompletionOptions.DisableDefaultCmd = true
 	flags := cmd.PersistentFlags()
 	helper.AddFlags(flags)
 	execOpts.addFlags(flags)
@@ -140,9 +154,12 @@ func getCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 	cmd.AddCommand(auth.LogoutCmd(helper))
 	cmd.AddCommand(auth.UnlinkCmd(helper))
 	cmd.AddCommand(info.BinCmd(helper))
+	cmd.AddCommand(cache.GetCmd(helper))
 	cmd.AddCommand(daemon.GetCmd(helper, signalWatcher))
 	cmd.AddCommand(prune.GetCmd(helper))
+	cmd.AddCommand(ls.GetCmd(helper))
 	cmd.AddCommand(run.GetCmd(helper, signalWatcher))
+	cmd.AddCommand(completion.Cmd())
 	return cmd
 }
 
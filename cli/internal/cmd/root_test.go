@@ -39,6 +39,36 @@ func TestDefaultCmd(t *testing.T) {
 			args:         []string{"--version"},
 			defaultAdded: false,
 		},
+		{
+			name:         "completion script",
+			args:         []string{"completion", "bash"},
+			defaultAdded: false,
+		},
+		{
+			name:         "complete command name",
+			args:         []string{"__complete", "bu"},
+			defaultAdded: false,
+		},
+		{
+			name:         "complete default command flag",
+			args:         []string{"__complete", "build", "--filter="},
+			defaultAdded: true,
+		},
+		{
+			name:         "complete run flag",
+			args:         []string{"__complete", "run", "build", "--filter="},
+			defaultAdded: false,
+		},
+		{
+			name:         "reserved cache command",
+			args:         []string{"cache"},
+			defaultAdded: false,
+		},
+		{
+			name:         "reserved ls command",
+			args:         []string{"ls", "--concurrency=2"},
+			defaultAdded: false,
+		},
 		{
 			name:         "heap",
 			args:         []string{"--heap", "my-heap-profile", "some-task", "--cpuprofile", "my-profile"},
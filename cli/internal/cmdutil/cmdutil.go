@@ -76,6 +76,12 @@ func (h *Helper) Cleanup(flags *pflag.FlagSet) {
 }
 
 func (h *Helper) getUI(flags *pflag.FlagSet) cli.Ui {
+	return h.GetUIWithOutput(flags, os.Stdout)
+}
+
+// GetUIWithOutput returns a UI configured like the one in CmdBase, but that writes
+// its regular output to out rather than stdout
+func (h *Helper) GetUIWithOutput(flags *pflag.FlagSet, out io.Writer) cli.Ui {
 	colorMode := ui.GetColorModeFromEnv()
 	if flags.Changed("no-color") && h.noColor {
 		colorMode = ui.ColorModeSuppressed
@@ -83,7 +89,7 @@ func (h *Helper) getUI(flags *pflag.FlagSet) cli.Ui {
 	if flags.Changed("color") && h.forceColor {
 		colorMode = ui.ColorModeForced
 	}
-	return ui.BuildColoredUi(colorMode)
+	return ui.BuildColoredUiWithOutput(colorMode, out)
 }
 
 func (h *Helper) getLogger() (hclog.Logger, error) {
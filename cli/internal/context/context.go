@@ -28,6 +28,9 @@ type Context struct {
 	TopologicalGraph dag.AcyclicGraph
 	RootNode         string
 	Lockfile         lockfile.Lockfile
+	// LockfileResolved reports whether external dependencies were resolved against a lockfile.
+	// Unlike Lockfile, it is also set for a graph loaded from the graph cache.
+	LockfileResolved bool
 	PackageManager   *packagemanager.PackageManager
 	// Used to arbitrate access to the graph. We parallelise most build operations
 	// and Go maps aren't natively threadsafe so this is needed.
@@ -120,71 +123,87 @@ func isWorkspaceReference(packageVersion string, dependencyVersion string, cwd s
 // constructed.
 func WithGraph(repoRoot turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON, cacheDir turbopath.AbsolutePath) Option {
 	return func(c *Context) error {
-		rootpath := repoRoot.ToStringDuringMigration()
-		c.PackageInfos = make(map[interface{}]*fs.PackageJSON)
-		c.RootNode = core.ROOT_NODE_NAME
-
-		if packageManager, err := packagemanager.GetPackageManager(repoRoot, rootPackageJSON); err != nil {
-			return err
-		} else {
-			c.PackageManager = packageManager
-		}
-
-		lockfile, err := c.PackageManager.ReadLockfile(cacheDir, repoRoot)
+		workspaces, err := c.initWorkspaces(repoRoot, rootPackageJSON)
 		if err != nil {
 			return err
 		}
-		c.Lockfile = lockfile
+		return c.buildGraph(repoRoot, rootPackageJSON, cacheDir, workspaces)
+	}
+}
 
-		if err := c.resolveWorkspaceRootDeps(rootPackageJSON); err != nil {
-			// TODO(Gaspar) was this the intended return error?
-			return fmt.Errorf("could not resolve workspaces: %w", err)
-		}
+// initWorkspaces detects the package manager in use and returns the paths to the
+// package.json files of every workspace it declares.
+func (c *Context) initWorkspaces(repoRoot turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON) ([]string, error) {
+	c.PackageInfos = make(map[interface{}]*fs.PackageJSON)
+	c.RootNode = core.ROOT_NODE_NAME
 
-		// Get the workspaces from the package manager.
-		// workspaces are absolute paths
-		workspaces, err := c.PackageManager.GetWorkspaces(repoRoot)
+	packageManager, err := packagemanager.GetPackageManager(repoRoot, rootPackageJSON)
+	if err != nil {
+		return nil, err
+	}
+	c.PackageManager = packageManager
 
-		if err != nil {
-			return fmt.Errorf("workspace configuration error: %w", err)
-		}
+	// Get the workspaces from the package manager.
+	// workspaces are absolute paths
+	workspaces, err := c.PackageManager.GetWorkspaces(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("workspace configuration error: %w", err)
+	}
+	return workspaces, nil
+}
 
-		// We will parse all package.json's simultaneously. We use a
-		// wait group because we cannot fully populate the graph (the next step)
-		// until all parsing is complete
-		parseJSONWaitGroup := &errgroup.Group{}
-		for _, workspace := range workspaces {
-			pkgJSONPath := fs.UnsafeToAbsolutePath(workspace)
-			parseJSONWaitGroup.Go(func() error {
-				return c.parsePackageJSON(repoRoot, pkgJSONPath)
-			})
-		}
+// buildGraph reads the lockfile and every workspace package.json to populate the package
+// infos and the topological graph of the Context.
+func (c *Context) buildGraph(repoRoot turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON, cacheDir turbopath.AbsolutePath, workspaces []string) error {
+	rootpath := repoRoot.ToStringDuringMigration()
 
-		if err := parseJSONWaitGroup.Wait(); err != nil {
-			return err
-		}
-		populateGraphWaitGroup := &errgroup.Group{}
-		for _, pkg := range c.PackageInfos {
-			pkg := pkg
-			populateGraphWaitGroup.Go(func() error {
-				return c.populateTopologicGraphForPackageJSON(pkg, rootpath, pkg.Name)
-			})
-		}
+	lockfile, err := c.PackageManager.ReadLockfile(cacheDir, repoRoot)
+	if err != nil {
+		return err
+	}
+	c.Lockfile = lockfile
+	c.LockfileResolved = lockfile != nil
 
-		if err := populateGraphWaitGroup.Wait(); err != nil {
-			return err
-		}
-		// Resolve dependencies for the root package. We override the vertexName in the graph
-		// for the root package, since it can have an arbitrary name. We need it to have our
-		// RootPkgName so that we can identify it as the root later on.
-		err = c.populateTopologicGraphForPackageJSON(rootPackageJSON, rootpath, util.RootPkgName)
-		if err != nil {
-			return fmt.Errorf("failed to resolve dependencies for root package: %v", err)
-		}
-		c.PackageInfos[util.RootPkgName] = rootPackageJSON
+	if err := c.resolveWorkspaceRootDeps(rootPackageJSON); err != nil {
+		// TODO(Gaspar) was this the intended return error?
+		return fmt.Errorf("could not resolve workspaces: %w", err)
+	}
+
+	// We will parse all package.json's simultaneously. We use a
+	// wait group because we cannot fully populate the graph (the next step)
+	// until all parsing is complete
+	parseJSONWaitGroup := &errgroup.Group{}
+	for _, workspace := range workspaces {
+		pkgJSONPath := fs.UnsafeToAbsolutePath(workspace)
+		parseJSONWaitGroup.Go(func() error {
+			return c.parsePackageJSON(repoRoot, pkgJSONPath)
+		})
+	}
 
-		return nil
+	if err := parseJSONWaitGroup.Wait(); err != nil {
+		return err
 	}
+	populateGraphWaitGroup := &errgroup.Group{}
+	for _, pkg := range c.PackageInfos {
+		pkg := pkg
+		populateGraphWaitGroup.Go(func() error {
+			return c.populateTopologicGraphForPackageJSON(pkg, rootpath, pkg.Name)
+		})
+	}
+
+	if err := populateGraphWaitGroup.Wait(); err != nil {
+		return err
+	}
+	// Resolve dependencies for the root package. We override the vertexName in the graph
+	// for the root package, since it can have an arbitrary name. We need it to have our
+	// RootPkgName so that we can identify it as the root later on.
+	err = c.populateTopologicGraphForPackageJSON(rootPackageJSON, rootpath, util.RootPkgName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies for root package: %v", err)
+	}
+	c.PackageInfos[util.RootPkgName] = rootPackageJSON
+
+	return nil
 }
 
 func (c *Context) resolveWorkspaceRootDeps(rootPackageJSON *fs.PackageJSON) error {
@@ -233,6 +252,7 @@ func (c *Context) populateTopologicGraphForPackageJSON(pkg *fs.PackageJSON, root
 	defer c.mutex.Unlock()
 	depMap := make(map[string]string)
 	internalDepsSet := make(dag.Set)
+	internalProdDepsSet := make(dag.Set)
 	externalUnresolvedDepsSet := make(dag.Set)
 	externalDepSet := mapset.NewSet()
 	pkg.UnresolvedExternalDeps = make(map[string]string)
@@ -254,6 +274,9 @@ func (c *Context) populateTopologicGraphForPackageJSON(pkg *fs.PackageJSON, root
 		if item, ok := c.PackageInfos[depName]; ok && isWorkspaceReference(item.Version, depVersion, pkg.Dir.ToStringDuringMigration(), rootpath) {
 			internalDepsSet.Add(depName)
 			c.TopologicalGraph.Connect(dag.BasicEdge(vertexName, depName))
+			if isProdDependency(pkg, depName) {
+				internalProdDepsSet.Add(depName)
+			}
 		} else {
 			externalUnresolvedDepsSet.Add(depName)
 		}
@@ -293,6 +316,11 @@ func (c *Context) populateTopologicGraphForPackageJSON(pkg *fs.PackageJSON, root
 		pkg.InternalDeps = append(pkg.InternalDeps, fmt.Sprintf("%v", v))
 	}
 	sort.Strings(pkg.InternalDeps)
+	pkg.InternalProdDeps = make([]string, 0, internalProdDepsSet.Len())
+	for _, v := range internalProdDepsSet.List() {
+		pkg.InternalProdDeps = append(pkg.InternalProdDeps, fmt.Sprintf("%v", v))
+	}
+	sort.Strings(pkg.InternalProdDeps)
 	sort.Strings(pkg.ExternalDeps)
 	hashOfExternalDeps, err := fs.HashObject(pkg.ExternalDeps)
 	if err != nil {
@@ -302,6 +330,31 @@ func (c *Context) populateTopologicGraphForPackageJSON(pkg *fs.PackageJSON, root
 	return nil
 }
 
+// isProdDependency returns true if the package needs the named dependency when installed
+// for production, which leaves out its devDependencies
+func isProdDependency(pkg *fs.PackageJSON, name string) bool {
+	if _, ok := pkg.Dependencies[name]; ok {
+		return true
+	}
+	_, ok := pkg.OptionalDependencies[name]
+	return ok
+}
+
+// ProdTopologicalGraph returns a graph of the same packages as the TopologicalGraph, with
+// only the edges for their production dependencies
+func (c *Context) ProdTopologicalGraph() *dag.AcyclicGraph {
+	graph := &dag.AcyclicGraph{}
+	for _, v := range c.TopologicalGraph.Vertices() {
+		graph.Add(v)
+	}
+	for name, pkg := range c.PackageInfos {
+		for _, dep := range pkg.InternalProdDeps {
+			graph.Connect(dag.BasicEdge(name, dep))
+		}
+	}
+	return graph
+}
+
 func (c *Context) parsePackageJSON(repoRoot turbopath.AbsolutePath, pkgJSONPath turbopath.AbsolutePath) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -316,9 +369,12 @@ func (c *Context) parsePackageJSON(repoRoot turbopath.AbsolutePath, pkgJSONPath
 		if err != nil {
 			return err
 		}
-		c.TopologicalGraph.Add(pkg.Name)
 		pkg.PackageJSONPath = turbopath.AnchoredSystemPathFromUpstream(relativePkgJSONPath)
 		pkg.Dir = turbopath.AnchoredSystemPathFromUpstream(filepath.Dir(relativePkgJSONPath))
+		if existing, ok := c.PackageInfos[pkg.Name]; ok {
+			return fmt.Errorf("failed to add workspace %q from %v, it already exists at %v", pkg.Name, pkg.Dir, existing.Dir)
+		}
+		c.TopologicalGraph.Add(pkg.Name)
 		c.PackageInfos[pkg.Name] = pkg
 		c.PackageNames = append(c.PackageNames, pkg.Name)
 	}
@@ -334,7 +390,7 @@ func (c *Context) resolveDepGraph(wg *sync.WaitGroup, unresolvedDirectDeps map[s
 		go func(directDepName, unresolvedVersion string) {
 			defer wg.Done()
 
-			key, resolvedVersion, ok := c.Lockfile.ResolvePackage(directDepName, unresolvedVersion)
+			key, resolvedVersion, ok := c.Lockfile.ResolvePackage(pkg.Dir.ToUnixPath(), directDepName, unresolvedVersion)
 			if seen.Contains(key) {
 				return
 			}
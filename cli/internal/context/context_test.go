@@ -2,7 +2,13 @@ package context
 
 import (
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/pyr-sh/dag"
+	"github.com/vercel/turborepo/cli/internal/fs"
 )
 
 func Test_isWorkspaceReference(t *testing.T) {
@@ -121,3 +127,59 @@ func Test_isWorkspaceReference(t *testing.T) {
 		})
 	}
 }
+
+func Test_ProdTopologicalGraph(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("node_modules", ".cache", "turbo")
+	writeTestFile(t, repoRoot.Join("package.json"), `{"name": "root", "packageManager": "npm@8.1.0", "workspaces": ["packages/*"]}`)
+	writeTestFile(t, repoRoot.Join("package-lock.json"), `{}`)
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "a", "version": "1.0.0", "dependencies": {"b": "*"}, "optionalDependencies": {"c": "*"}, "devDependencies": {"d": "*"}}`)
+	writeTestFile(t, repoRoot.Join("packages", "b", "package.json"), `{"name": "b", "version": "1.0.0", "devDependencies": {"d": "*"}}`)
+	writeTestFile(t, repoRoot.Join("packages", "c", "package.json"), `{"name": "c", "version": "1.0.0"}`)
+	writeTestFile(t, repoRoot.Join("packages", "d", "package.json"), `{"name": "d", "version": "1.0.0"}`)
+
+	// The graph is built the first time, and loaded from the cache the second
+	for _, c := range []*Context{newCachedGraph(t, repoRoot, cacheDir), newCachedGraph(t, repoRoot, cacheDir)} {
+		if got := c.PackageInfos["a"].InternalProdDeps; !reflect.DeepEqual(got, []string{"b", "c"}) {
+			t.Errorf("a InternalProdDeps = %v, want [b c]", got)
+		}
+		if got := c.PackageInfos["a"].InternalDeps; !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+			t.Errorf("a InternalDeps = %v, want [b c d]", got)
+		}
+
+		graph := c.ProdTopologicalGraph()
+		edges := []string{}
+		for _, edge := range graph.Edges() {
+			edges = append(edges, dag.VertexName(edge.Source())+"->"+dag.VertexName(edge.Target()))
+		}
+		sort.Strings(edges)
+		if want := []string{"a->b", "a->c"}; !reflect.DeepEqual(edges, want) {
+			t.Errorf("prod edges = %v, want %v", edges, want)
+		}
+		if !graph.HasVertex("d") {
+			t.Errorf("expected the prod graph to keep package d")
+		}
+	}
+}
+
+func Test_DuplicatePackageNames(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	writeTestFile(t, repoRoot.Join("package.json"), `{"name": "root", "packageManager": "npm@8.1.0", "workspaces": ["packages/*"]}`)
+	writeTestFile(t, repoRoot.Join("package-lock.json"), `{}`)
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "shared", "version": "1.0.0"}`)
+	writeTestFile(t, repoRoot.Join("packages", "b", "package.json"), `{"name": "shared", "version": "2.0.0"}`)
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.Join("package.json"))
+	if err != nil {
+		t.Fatalf("ReadPackageJSON: %v", err)
+	}
+
+	_, err = New(WithGraph(repoRoot, rootPackageJSON, repoRoot.Join("node_modules", ".cache", "turbo")))
+	if err == nil {
+		t.Fatal("expected an error for two workspaces with the same name")
+	}
+	for _, want := range []string{`"shared"`, filepath.Join("packages", "a"), filepath.Join("packages", "b")} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %v", err, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/pyr-sh/dag"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// _graphCacheVersion is part of the cache key so that changes to the cached format
+// invalidate graphs written by older versions of turbo
+const _graphCacheVersion = "5"
+
+const _graphCacheFilename = "dep-graph.json"
+
+// graphCache is the on-disk representation of a computed package graph
+type graphCache struct {
+	Key              string                        `json:"key"`
+	LockfileResolved bool                          `json:"lockfileResolved"`
+	Vertices         []string                      `json:"vertices"`
+	Edges            [][2]string                   `json:"edges"`
+	Packages         map[string]*graphCachePackage `json:"packages"`
+}
+
+// graphCachePackage holds the fields of a PackageJSON that are computed while building
+// the graph, rather than read from the package.json itself
+type graphCachePackage struct {
+	PackageJSONPath        string            `json:"packageJSONPath"`
+	InternalDeps           []string          `json:"internalDeps"`
+	InternalProdDeps       []string          `json:"internalProdDeps"`
+	UnresolvedExternalDeps map[string]string `json:"unresolvedExternalDeps"`
+	ExternalDeps           []string          `json:"externalDeps"`
+	TransitiveDeps         []string          `json:"transitiveDeps"`
+	ExternalDepsHash       string            `json:"externalDepsHash"`
+}
+
+// WithCachedGraph behaves like WithGraph, but stores the computed graph in cacheDir and
+// reuses it on subsequent runs as long as the lockfile, turbo.json and every package.json are unchanged.
+// A graph loaded from the cache does not have a Lockfile attached, but LockfileResolved is restored.
+func WithCachedGraph(repoRoot turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON, cacheDir turbopath.AbsolutePath) Option {
+	return func(c *Context) error {
+		workspaces, err := c.initWorkspaces(repoRoot, rootPackageJSON)
+		if err != nil {
+			return err
+		}
+		key, err := c.graphCacheKey(repoRoot, workspaces)
+		if err != nil {
+			return err
+		}
+		cachePath := cacheDir.Join(_graphCacheFilename)
+		if ok, err := c.loadGraphCache(repoRoot, rootPackageJSON, cachePath, key); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+		if err := c.buildGraph(repoRoot, rootPackageJSON, cacheDir, workspaces); err != nil {
+			return err
+		}
+		// The cache is only an optimization, failing to write it shouldn't fail the run
+		_ = c.writeGraphCache(cachePath, key)
+		return nil
+	}
+}
+
+// graphCacheKey hashes the package manager, the lockfile, turbo.json and every package.json in the repository
+func (c *Context) graphCacheKey(repoRoot turbopath.AbsolutePath, workspaces []string) (string, error) {
+	files := make([]string, 0, len(workspaces)+3)
+	files = append(files, repoRoot.Join("package.json").ToString(), repoRoot.Join("turbo.json").ToString())
+	if c.PackageManager.Lockfile != "" {
+		files = append(files, repoRoot.Join(c.PackageManager.Lockfile).ToString())
+	}
+	files = append(files, workspaces...)
+	fileHashes := make([]string, 0, len(files))
+	for _, file := range files {
+		path := fs.UnsafeToAbsolutePath(file)
+		hash := "missing"
+		if path.FileExists() {
+			h, err := fs.HashFile(file)
+			if err != nil {
+				return "", fmt.Errorf("hashing %v: %w", file, err)
+			}
+			hash = h
+		}
+		relativePath, err := repoRoot.PathTo(path)
+		if err != nil {
+			return "", err
+		}
+		fileHashes = append(fileHashes, relativePath+"="+hash)
+	}
+	sort.Strings(fileHashes)
+	return fs.HashObject([]interface{}{_graphCacheVersion, c.PackageManager.Name, fileHashes})
+}
+
+// loadGraphCache populates the Context from the cache file if it exists and matches the given key.
+// It returns false if the graph still needs to be built.
+func (c *Context) loadGraphCache(repoRoot turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON, cachePath turbopath.AbsolutePath, key string) (bool, error) {
+	if !cachePath.FileExists() {
+		return false, nil
+	}
+	contents, err := cachePath.ReadFile()
+	if err != nil {
+		return false, nil
+	}
+	cached := &graphCache{}
+	if err := json.Unmarshal(contents, cached); err != nil || cached.Key != key {
+		return false, nil
+	}
+
+	// Read every package.json before touching rootPackageJSON, so that a failed load
+	// leaves it as it was for the regular graph build
+	packageInfos := make(map[interface{}]*fs.PackageJSON, len(cached.Packages))
+	packageNames := make([]string, 0, len(cached.Packages))
+	for name, cachedPkg := range cached.Packages {
+		if name == util.RootPkgName {
+			continue
+		}
+		pkg, err := fs.ReadPackageJSON(repoRoot.Join(cachedPkg.PackageJSONPath))
+		if err != nil {
+			return false, fmt.Errorf("parsing %s: %w", cachedPkg.PackageJSONPath, err)
+		}
+		pkg.PackageJSONPath = turbopath.AnchoredSystemPathFromUpstream(cachedPkg.PackageJSONPath)
+		pkg.Dir = turbopath.AnchoredSystemPathFromUpstream(filepath.Dir(cachedPkg.PackageJSONPath))
+		packageNames = append(packageNames, name)
+		packageInfos[name] = pkg
+	}
+	sort.Strings(packageNames)
+	if _, ok := cached.Packages[util.RootPkgName]; ok {
+		packageInfos[util.RootPkgName] = rootPackageJSON
+	}
+	for name, pkg := range packageInfos {
+		cachedPkg := cached.Packages[name.(string)]
+		pkg.InternalDeps = cachedPkg.InternalDeps
+		pkg.InternalProdDeps = cachedPkg.InternalProdDeps
+		pkg.UnresolvedExternalDeps = cachedPkg.UnresolvedExternalDeps
+		pkg.ExternalDeps = cachedPkg.ExternalDeps
+		pkg.TransitiveDeps = cachedPkg.TransitiveDeps
+		pkg.ExternalDepsHash = cachedPkg.ExternalDepsHash
+	}
+
+	for _, vertex := range cached.Vertices {
+		c.TopologicalGraph.Add(vertex)
+	}
+	for _, edge := range cached.Edges {
+		c.TopologicalGraph.Connect(dag.BasicEdge(edge[0], edge[1]))
+	}
+	c.PackageInfos = packageInfos
+	c.PackageNames = packageNames
+	c.LockfileResolved = cached.LockfileResolved
+	return true, nil
+}
+
+// writeGraphCache serializes the graph computed for this Context under the given key
+func (c *Context) writeGraphCache(cachePath turbopath.AbsolutePath, key string) error {
+	cached := &graphCache{
+		Key:              key,
+		LockfileResolved: c.LockfileResolved,
+		Vertices:         []string{},
+		Edges:            [][2]string{},
+		Packages:         make(map[string]*graphCachePackage, len(c.PackageInfos)),
+	}
+	for _, vertex := range c.TopologicalGraph.Vertices() {
+		cached.Vertices = append(cached.Vertices, dag.VertexName(vertex))
+	}
+	sort.Strings(cached.Vertices)
+	for _, edge := range c.TopologicalGraph.Edges() {
+		cached.Edges = append(cached.Edges, [2]string{dag.VertexName(edge.Source()), dag.VertexName(edge.Target())})
+	}
+	for name, pkg := range c.PackageInfos {
+		cached.Packages[fmt.Sprintf("%v", name)] = &graphCachePackage{
+			PackageJSONPath:        pkg.PackageJSONPath.ToString(),
+			InternalDeps:           pkg.InternalDeps,
+			InternalProdDeps:       pkg.InternalProdDeps,
+			UnresolvedExternalDeps: pkg.UnresolvedExternalDeps,
+			ExternalDeps:           pkg.ExternalDeps,
+			TransitiveDeps:         pkg.TransitiveDeps,
+			ExternalDepsHash:       pkg.ExternalDepsHash,
+		}
+	}
+	contents, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := cachePath.EnsureDir(); err != nil {
+		return err
+	}
+	return cachePath.WriteFile(contents, 0644)
+}
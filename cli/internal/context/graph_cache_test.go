@@ -0,0 +1,174 @@
+package context
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pyr-sh/dag"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+func writeTestFile(t *testing.T, path turbopath.AbsolutePath, contents string) {
+	t.Helper()
+	if err := path.EnsureDir(); err != nil {
+		t.Fatalf("EnsureDir: %v", err)
+	}
+	if err := path.WriteFile([]byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func graphEdges(c *Context) []string {
+	edges := []string{}
+	for _, edge := range c.TopologicalGraph.Edges() {
+		edges = append(edges, dag.VertexName(edge.Source())+"->"+dag.VertexName(edge.Target()))
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+func newCachedGraph(t *testing.T, repoRoot turbopath.AbsolutePath, cacheDir turbopath.AbsolutePath) *Context {
+	t.Helper()
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.Join("package.json"))
+	if err != nil {
+		t.Fatalf("ReadPackageJSON: %v", err)
+	}
+	c, err := New(WithCachedGraph(repoRoot, rootPackageJSON, cacheDir))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func Test_WithCachedGraph(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("node_modules", ".cache", "turbo")
+	writeTestFile(t, repoRoot.Join("package.json"), `{"name": "root", "packageManager": "npm@8.1.0", "workspaces": ["packages/*"]}`)
+	writeTestFile(t, repoRoot.Join("package-lock.json"), `{}`)
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "a", "version": "1.0.0", "dependencies": {"b": "*"}}`)
+	writeTestFile(t, repoRoot.Join("packages", "b", "package.json"), `{"name": "b", "version": "1.0.0"}`)
+
+	built := newCachedGraph(t, repoRoot, cacheDir)
+	if !cacheDir.Join(_graphCacheFilename).FileExists() {
+		t.Fatalf("expected the graph to be written to the cache")
+	}
+	loaded := newCachedGraph(t, repoRoot, cacheDir)
+
+	if got, want := graphEdges(loaded), graphEdges(built); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached edges = %v, want %v", got, want)
+	}
+	sort.Strings(built.PackageNames)
+	if !reflect.DeepEqual(loaded.PackageNames, built.PackageNames) {
+		t.Errorf("cached package names = %v, want %v", loaded.PackageNames, built.PackageNames)
+	}
+	if loaded.LockfileResolved != built.LockfileResolved {
+		t.Errorf("cached LockfileResolved = %v, want %v", loaded.LockfileResolved, built.LockfileResolved)
+	}
+	pkgA := loaded.PackageInfos["a"]
+	if pkgA == nil {
+		t.Fatalf("expected package a to be loaded from the cache")
+	}
+	if !reflect.DeepEqual(pkgA.InternalDeps, []string{"b"}) {
+		t.Errorf("a InternalDeps = %v, want [b]", pkgA.InternalDeps)
+	}
+	if pkgA.Dir.ToString() != built.PackageInfos["a"].Dir.ToString() {
+		t.Errorf("a Dir = %v, want %v", pkgA.Dir, built.PackageInfos["a"].Dir)
+	}
+
+	// Changing a manifest must invalidate the cached graph
+	writeTestFile(t, repoRoot.Join("packages", "b", "package.json"), `{"name": "b", "version": "2.0.0"}`)
+	rebuilt := newCachedGraph(t, repoRoot, cacheDir)
+	if deps := rebuilt.PackageInfos["a"].InternalDeps; len(deps) != 1 || deps[0] != "b" {
+		t.Errorf("a InternalDeps after change = %v, want [b]", deps)
+	}
+	if got := rebuilt.PackageInfos["b"].Version; got != "2.0.0" {
+		t.Errorf("b Version = %v, want 2.0.0", got)
+	}
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "a", "version": "1.0.0", "dependencies": {"b": "^1.0.0"}}`)
+	rebuilt = newCachedGraph(t, repoRoot, cacheDir)
+	if deps := rebuilt.PackageInfos["a"].InternalDeps; len(deps) != 0 {
+		t.Errorf("a InternalDeps after version mismatch = %v, want none", deps)
+	}
+}
+
+func Test_graphCacheKey(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	writeTestFile(t, repoRoot.Join("package.json"), `{"name": "root", "packageManager": "npm@8.1.0", "workspaces": ["packages/*"]}`)
+	writeTestFile(t, repoRoot.Join("package-lock.json"), `{}`)
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "a", "version": "1.0.0"}`)
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.Join("package.json"))
+	if err != nil {
+		t.Fatalf("ReadPackageJSON: %v", err)
+	}
+	c := &Context{}
+	workspaces, err := c.initWorkspaces(repoRoot, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("initWorkspaces: %v", err)
+	}
+	key := func() string {
+		t.Helper()
+		k, err := c.graphCacheKey(repoRoot, workspaces)
+		if err != nil {
+			t.Fatalf("graphCacheKey: %v", err)
+		}
+		return k
+	}
+
+	withoutTurboJSON := key()
+	if got := key(); got != withoutTurboJSON {
+		t.Errorf("key changed without any file changes: %v, want %v", got, withoutTurboJSON)
+	}
+	writeTestFile(t, repoRoot.Join("turbo.json"), `{"pipeline": {"build": {}}}`)
+	withTurboJSON := key()
+	if withTurboJSON == withoutTurboJSON {
+		t.Error("expected adding turbo.json to change the key")
+	}
+	writeTestFile(t, repoRoot.Join("turbo.json"), `{"pipeline": {"build": {"dependsOn": ["^build"]}}}`)
+	if got := key(); got == withTurboJSON {
+		t.Error("expected changing turbo.json to change the key")
+	}
+	changedTurboJSON := key()
+	writeTestFile(t, repoRoot.Join("packages", "a", "package.json"), `{"name": "a", "version": "1.0.0", "dependencies": {"b": "*"}}`)
+	if got := key(); got == changedTurboJSON {
+		t.Error("expected changing a dependency to change the key")
+	}
+}
+
+func Test_loadGraphCacheFailureKeepsRootPackageJSON(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cachePath := repoRoot.Join(_graphCacheFilename)
+	writeTestFile(t, cachePath, `{"key": "the-key", "packages": {
+		"//": {"packageJSONPath": "package.json", "internalDeps": ["a"]},
+		"a": {"packageJSONPath": "packages/a/package.json"}
+	}}`)
+	rootPackageJSON := &fs.PackageJSON{Name: "root"}
+	c := &Context{}
+	if _, err := c.loadGraphCache(repoRoot, rootPackageJSON, cachePath, "the-key"); err == nil {
+		t.Fatal("expected an error for a missing package.json")
+	}
+	if rootPackageJSON.InternalDeps != nil {
+		t.Errorf("root InternalDeps = %v, want the root package.json to be untouched", rootPackageJSON.InternalDeps)
+	}
+}
+
+func Test_graphCacheKeepsLockfileResolved(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cachePath := repoRoot.Join(_graphCacheFilename)
+	built := &Context{LockfileResolved: true}
+	if err := built.writeGraphCache(cachePath, "the-key"); err != nil {
+		t.Fatalf("writeGraphCache: %v", err)
+	}
+	loaded := &Context{}
+	ok, err := loaded.loadGraphCache(repoRoot, &fs.PackageJSON{Name: "root"}, cachePath, "the-key")
+	if err != nil || !ok {
+		t.Fatalf("loadGraphCache = %v, %v, want a cache hit", ok, err)
+	}
+	if loaded.Lockfile != nil {
+		t.Errorf("expected a graph loaded from the cache not to have a Lockfile")
+	}
+	if !loaded.LockfileResolved {
+		t.Error("expected LockfileResolved to be restored from the cache")
+	}
+}
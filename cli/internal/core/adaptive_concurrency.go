@@ -0,0 +1,70 @@
+package core
+
+import (
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+const (
+	// Above this load per CPU, the machine is considered overloaded and concurrency is reduced
+	_highLoadPerCPU = 1.0
+	// Below this load per CPU, the machine is considered to have spare capacity
+	_lowLoadPerCPU = 0.7
+)
+
+// AdaptiveConcurrency configures a walk of the task graph whose concurrency is adjusted
+// based on the observed system load, within the bounds of Min and Max.
+type AdaptiveConcurrency struct {
+	// Min is the lowest concurrency that will be used
+	Min int
+	// Max is the highest concurrency that will be used
+	Max int
+	// NumCPU is the number of CPUs the load average is measured against
+	NumCPU int
+	// Interval is how often the load is sampled
+	Interval time.Duration
+	// LoadAverage returns the current system load
+	LoadAverage func() (float64, error)
+}
+
+// nextLimit returns the concurrency to use given the current one and the observed load,
+// moving by at most one task at a time so that the limit doesn't oscillate wildly.
+func (a *AdaptiveConcurrency) nextLimit(current int, load float64) int {
+	loadPerCPU := load / float64(a.NumCPU)
+	next := current
+	if loadPerCPU > _highLoadPerCPU {
+		next--
+	} else if loadPerCPU < _lowLoadPerCPU {
+		next++
+	}
+	if next < a.Min {
+		next = a.Min
+	}
+	if next > a.Max {
+		next = a.Max
+	}
+	return next
+}
+
+// watch samples the system load and adjusts the limit of the given semaphore until done
+// is closed. If the load cannot be read, the limit is left as-is.
+func (a *AdaptiveConcurrency) watch(sema *util.DynamicSemaphore, done <-chan struct{}) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			load, err := a.LoadAverage()
+			if err != nil {
+				return
+			}
+			current := sema.Limit()
+			if next := a.nextLimit(current, load); next != current {
+				sema.SetLimit(next)
+			}
+		}
+	}
+}
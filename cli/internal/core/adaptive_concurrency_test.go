@@ -0,0 +1,28 @@
+package core
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAdaptiveConcurrencyNextLimit(t *testing.T) {
+	a := &AdaptiveConcurrency{Min: 1, Max: 4, NumCPU: 4}
+	tests := []struct {
+		name    string
+		current int
+		load    float64
+		want    int
+	}{
+		{"overloaded reduces", 3, 6.0, 2},
+		{"overloaded stays at min", 1, 6.0, 1},
+		{"idle increases", 3, 1.0, 4},
+		{"idle stays at max", 4, 1.0, 4},
+		{"moderate load is unchanged", 3, 3.5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, a.nextLimit(tt.current, tt.load), tt.want)
+		})
+	}
+}
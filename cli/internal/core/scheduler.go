@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/vercel/turborepo/cli/internal/util"
@@ -20,6 +21,12 @@ type Task struct {
 	Deps util.Set
 	// TopoDeps are dependencies across packages within the same topological graph (e.g. parent `build` -> child `build`) */
 	TopoDeps util.Set
+	// WeakDeps are tasks that must run first in the packages this package depends on, directly or
+	// not, but only if they are run anyway. Unlike TopoDeps, they never add tasks to the run.
+	WeakDeps util.Set
+	// ProdDepsOnly makes TopoDeps and WeakDeps follow ProdTopologicGraph rather than
+	// TopologicGraph
+	ProdDepsOnly bool
 }
 
 type Visitor = func(taskID string) error
@@ -27,6 +34,9 @@ type Visitor = func(taskID string) error
 type Scheduler struct {
 	// TopologicGraph is a graph of workspaces
 	TopologicGraph *dag.AcyclicGraph
+	// ProdTopologicGraph is a graph of the same workspaces with only the edges for production
+	// dependencies. If nil, TopologicGraph is used for every task.
+	ProdTopologicGraph *dag.AcyclicGraph
 	// TaskGraph is a graph of package-tasks
 	TaskGraph *dag.AcyclicGraph
 	// Tasks are a map of tasks in the scheduler
@@ -79,20 +89,48 @@ type ExecOpts struct {
 	Parallel bool
 	// Concurrency is the number of concurrent tasks that can be executed
 	Concurrency int
+	// AdaptiveConcurrency, if set, adjusts the number of concurrent tasks to the
+	// system load, starting from Concurrency
+	AdaptiveConcurrency *AdaptiveConcurrency
+	// IOConcurrency, if positive, is the number of concurrent tasks for which IsIOBound
+	// returns true. Those tasks don't count against Concurrency.
+	IOConcurrency int
+	IsIOBound     func(taskID string) bool
 }
 
 // Execute executes the pipeline, constructing an internal task graph and walking it accordingly.
 func (p *Scheduler) Execute(visitor Visitor, opts ExecOpts) []error {
-	var sema = util.NewSemaphore(opts.Concurrency)
+	var sema interface {
+		Acquire()
+		Release()
+	}
+	if opts.AdaptiveConcurrency != nil {
+		dynamicSema := util.NewDynamicSemaphore(opts.Concurrency)
+		done := make(chan struct{})
+		defer close(done)
+		go opts.AdaptiveConcurrency.watch(dynamicSema, done)
+		sema = dynamicSema
+	} else {
+		sema = util.NewSemaphore(opts.Concurrency)
+	}
+	var ioSema util.Semaphore
+	if opts.IOConcurrency > 0 && opts.IsIOBound != nil {
+		ioSema = util.NewSemaphore(opts.IOConcurrency)
+	}
 	return p.TaskGraph.Walk(func(v dag.Vertex) error {
 		// Always return if it is the root node
 		if strings.Contains(dag.VertexName(v), ROOT_NODE_NAME) {
 			return nil
 		}
-		// Acquire the semaphore unless parallel
+		// Acquire the semaphore for the task's resource class unless parallel
 		if !opts.Parallel {
-			sema.Acquire()
-			defer sema.Release()
+			if ioSema != nil && opts.IsIOBound(dag.VertexName(v)) {
+				ioSema.Acquire()
+				defer ioSema.Release()
+			} else {
+				sema.Acquire()
+				defer sema.Release()
+			}
 		}
 		return visitor(dag.VertexName(v))
 	})
@@ -134,6 +172,8 @@ func (p *Scheduler) generateTaskGraph(pkgs []string, taskNames []string, tasksOn
 	}
 
 	visited := make(util.Set)
+	// weakEdges are connected once every task to run is known, as [from, to] pairs
+	weakEdges := [][]string{}
 
 	for len(traversalQueue) > 0 {
 		taskId := traversalQueue[0]
@@ -166,15 +206,35 @@ func (p *Scheduler) generateTaskGraph(pkgs []string, taskNames []string, tasksOn
 			}
 
 			toTaskId := taskId
-			hasTopoDeps := task.TopoDeps.Len() > 0 && p.TopologicGraph.DownEdges(pkg).Len() > 0
+			topologicGraph := p.topologicGraphFor(task)
+			hasTopoDeps := task.TopoDeps.Len() > 0 && topologicGraph.DownEdges(pkg).Len() > 0
 			hasDeps := deps.Len() > 0
-			hasPackageTaskDeps := false
-			if _, ok := packageTasksDepsMap[toTaskId]; ok {
-				hasPackageTaskDeps = true
+			pkgTaskDeps := packageTasksDepsMap[toTaskId]
+			if task.Name == taskName {
+				// Package-task dependencies of a task definition shared by every package,
+				// skipping the package-task itself
+				for _, fromTaskId := range packageTasksDepsMap[taskName] {
+					if fromTaskId != toTaskId {
+						pkgTaskDeps = append(pkgTaskDeps, fromTaskId)
+					}
+				}
+			}
+			hasPackageTaskDeps := len(pkgTaskDeps) > 0
+
+			if task.WeakDeps.Len() > 0 {
+				depPkgs, err := topologicGraph.Ancestors(pkg)
+				if err != nil {
+					return err
+				}
+				for _, from := range task.WeakDeps.UnsafeListOfStrings() {
+					for depPkg := range depPkgs {
+						weakEdges = append(weakEdges, []string{util.GetTaskId(depPkg, from), toTaskId})
+					}
+				}
 			}
 
 			if hasTopoDeps {
-				depPkgs := p.TopologicGraph.DownEdges(pkg)
+				depPkgs := topologicGraph.DownEdges(pkg)
 				for _, from := range task.TopoDeps.UnsafeListOfStrings() {
 					// add task dep from all the package deps within repo
 					for depPkg := range depPkgs {
@@ -198,13 +258,11 @@ func (p *Scheduler) generateTaskGraph(pkgs []string, taskNames []string, tasksOn
 			}
 
 			if hasPackageTaskDeps {
-				if pkgTaskDeps, ok := packageTasksDepsMap[toTaskId]; ok {
-					for _, fromTaskId := range pkgTaskDeps {
-						p.TaskGraph.Add(fromTaskId)
-						p.TaskGraph.Add(toTaskId)
-						p.TaskGraph.Connect(dag.BasicEdge(toTaskId, fromTaskId))
-						traversalQueue = append(traversalQueue, fromTaskId)
-					}
+				for _, fromTaskId := range pkgTaskDeps {
+					p.TaskGraph.Add(fromTaskId)
+					p.TaskGraph.Add(toTaskId)
+					p.TaskGraph.Connect(dag.BasicEdge(toTaskId, fromTaskId))
+					traversalQueue = append(traversalQueue, fromTaskId)
 				}
 			}
 
@@ -215,9 +273,76 @@ func (p *Scheduler) generateTaskGraph(pkgs []string, taskNames []string, tasksOn
 			}
 		}
 	}
+
+	for _, edge := range weakEdges {
+		from, to := edge[0], edge[1]
+		if visited.Includes(from) {
+			p.TaskGraph.Connect(dag.BasicEdge(to, from))
+		}
+	}
 	return nil
 }
 
+// topologicGraphFor returns the graph of workspaces that the given task's topological
+// dependencies follow
+func (p *Scheduler) topologicGraphFor(task *Task) *dag.AcyclicGraph {
+	if task.ProdDepsOnly && p.ProdTopologicGraph != nil {
+		return p.ProdTopologicGraph
+	}
+	return p.TopologicGraph
+}
+
+// Dependents returns the sorted IDs of the tasks that depend on the given task, either
+// directly or through other tasks
+func (p *Scheduler) Dependents(taskID string) ([]string, error) {
+	descendents, err := p.TaskGraph.Descendents(taskID)
+	if err != nil {
+		return nil, err
+	}
+	dependents := make([]string, 0, len(descendents))
+	for _, v := range descendents {
+		dependents = append(dependents, dag.VertexName(v))
+	}
+	sort.Strings(dependents)
+	return dependents, nil
+}
+
+// TaskGraphWithoutRoot returns a copy of the task graph without the ROOT_NODE_NAME placeholder
+// that tasks without dependencies depend on, for showing users only the real dependencies
+// between their tasks
+func (p *Scheduler) TaskGraphWithoutRoot() *dag.AcyclicGraph {
+	graph := &dag.AcyclicGraph{}
+	for _, v := range p.TaskGraph.Vertices() {
+		if !strings.Contains(dag.VertexName(v), ROOT_NODE_NAME) {
+			graph.Add(v)
+		}
+	}
+	for _, edge := range p.TaskGraph.Edges() {
+		if graph.HasVertex(edge.Source()) && graph.HasVertex(edge.Target()) {
+			graph.Connect(edge)
+		}
+	}
+	return graph
+}
+
+// PruneTasks removes every task for which shouldPrune returns true from the task graph.
+// Dependents of a pruned task are connected directly to its dependencies so that the
+// remaining tasks still run in the same order.
+func (p *Scheduler) PruneTasks(shouldPrune func(taskID string) bool) {
+	for _, v := range p.TaskGraph.Vertices() {
+		taskID := dag.VertexName(v)
+		if taskID == ROOT_NODE_NAME || !shouldPrune(taskID) {
+			continue
+		}
+		for _, dependent := range p.TaskGraph.UpEdges(taskID) {
+			for _, dependency := range p.TaskGraph.DownEdges(taskID) {
+				p.TaskGraph.Connect(dag.BasicEdge(dependent, dependency))
+			}
+		}
+		p.TaskGraph.Remove(taskID)
+	}
+}
+
 func getPackageTaskDepsMap(packageTaskDeps [][]string) map[string][]string {
 	depMap := make(map[string][]string)
 	for _, packageTaskDep := range packageTaskDeps {
@@ -244,6 +369,9 @@ func (p *Scheduler) AddTask(task *Task) *Scheduler {
 	return p
 }
 
+// AddDep makes toTaskId depend on the package-task fromTaskId. toTaskId is either a
+// package-task or a task name, in which case the dependency applies to every package
+// using that task's shared definition.
 func (p *Scheduler) AddDep(fromTaskId string, toTaskId string) error {
 	fromPkg, _ := util.GetPackageTaskFromId(fromTaskId)
 	if fromPkg != ROOT_NODE_NAME && fromPkg != util.RootPkgName && !p.TopologicGraph.HasVertex(fromPkg) {
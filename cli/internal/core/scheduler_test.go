@@ -3,7 +3,9 @@ package core
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/util"
 	"gotest.tools/v3/assert"
@@ -167,6 +169,72 @@ libD#build
 	}
 }
 
+func TestWeakDependenciesDontExpandScope(t *testing.T) {
+	// app2 -> libB -> libD
+	//      \
+	//        > libC
+	graph := &dag.AcyclicGraph{}
+	graph.Add("app2")
+	graph.Add("libB")
+	graph.Add("libC")
+	graph.Add("libD")
+	graph.Connect(dag.BasicEdge("app2", "libB"))
+	graph.Connect(dag.BasicEdge("app2", "libC"))
+	graph.Connect(dag.BasicEdge("libB", "libD"))
+
+	p := NewScheduler(graph)
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: make(util.Set),
+		Deps:     make(util.Set),
+	})
+	weakOnBuild := make(util.Set)
+	weakOnBuild.Add("build")
+	p.AddTask(&Task{
+		Name:     "lint",
+		TopoDeps: make(util.Set),
+		Deps:     make(util.Set),
+		WeakDeps: weakOnBuild,
+	})
+	// libB isn't in scope, so neither of its tasks should run, but the build of
+	// libD, which app2 depends on through libB, should still run before app2#lint
+	err := p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"app2", "libC", "libD"},
+		TaskNames: []string{"build", "lint"},
+	})
+	if err != nil {
+		t.Fatalf("failed to prepare scheduler: %v", err)
+	}
+	errs := p.Execute(testVisitor, ExecOpts{
+		Concurrency: 10,
+	})
+	for _, err := range errs {
+		t.Fatalf("error executing tasks: %v", err)
+	}
+	expected := `
+___ROOT___
+app2#build
+  ___ROOT___
+app2#lint
+  ___ROOT___
+  libC#build
+  libD#build
+libC#build
+  ___ROOT___
+libC#lint
+  ___ROOT___
+libD#build
+  ___ROOT___
+libD#lint
+  ___ROOT___
+`
+	expected = strings.TrimSpace(expected)
+	actual := strings.TrimSpace(p.TaskGraph.String())
+	if actual != expected {
+		t.Errorf("task graph got:\n%v\nwant:\n%v", actual, expected)
+	}
+}
+
 func TestRunPackageTask(t *testing.T) {
 	graph := &dag.AcyclicGraph{}
 	graph.Add("app1")
@@ -209,6 +277,107 @@ libA#build
 	assert.Equal(t, expected, actual)
 }
 
+func TestDependOnSiblingPackageTask(t *testing.T) {
+	graph := &dag.AcyclicGraph{}
+	graph.Add("app1")
+	graph.Add("app2")
+	graph.Add("design-system")
+	// no dependencies between packages
+
+	p := NewScheduler(graph)
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: make(util.Set),
+		Deps:     make(util.Set),
+	})
+	// app2 overrides the shared definition, so it doesn't get its dependencies
+	p.AddTask(&Task{
+		Name:     "app2#build",
+		TopoDeps: make(util.Set),
+		Deps:     make(util.Set),
+	})
+	err := p.AddDep("design-system#build", "build")
+	assert.NilError(t, err, "AddDep")
+	err = p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"app1", "app2", "design-system"},
+		TaskNames: []string{"build"},
+	})
+	assert.NilError(t, err, "Prepare")
+	actual := strings.TrimSpace(p.TaskGraph.String())
+	expected := strings.TrimSpace(`
+___ROOT___
+app1#build
+  design-system#build
+app2#build
+  ___ROOT___
+design-system#build
+  ___ROOT___`)
+	assert.Equal(t, expected, actual)
+}
+
+func TestDependsOnCycleReportsPath(t *testing.T) {
+	graph := &dag.AcyclicGraph{}
+	graph.Add("a")
+	graph.Add("b")
+	// no dependencies between packages
+
+	p := NewScheduler(graph)
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: make(util.Set),
+		Deps:     make(util.Set),
+	})
+	// a#build and b#build each list the other in dependsOn
+	err := p.AddDep("b#build", "a#build")
+	assert.NilError(t, err, "AddDep")
+	err = p.AddDep("a#build", "b#build")
+	assert.NilError(t, err, "AddDep")
+	err = p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"a", "b"},
+		TaskNames: []string{"build"},
+	})
+	assert.NilError(t, err, "Prepare")
+	err = util.ValidateGraph(p.TaskGraph)
+	assert.ErrorContains(t, err, "a#build -> b#build -> a#build")
+}
+
+func TestDependents(t *testing.T) {
+	graph := &dag.AcyclicGraph{}
+	graph.Add("app")
+	graph.Add("lib")
+	graph.Add("other")
+	graph.Connect(dag.BasicEdge("app", "lib"))
+
+	p := NewScheduler(graph)
+	topoDeps := make(util.Set)
+	topoDeps.Add("build")
+	deps := make(util.Set)
+	deps.Add("build")
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: topoDeps,
+		Deps:     make(util.Set),
+	})
+	p.AddTask(&Task{
+		Name:     "test",
+		TopoDeps: make(util.Set),
+		Deps:     deps,
+	})
+	err := p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"app", "lib", "other"},
+		TaskNames: []string{"test"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	dependents, err := p.Dependents("lib#build")
+	assert.NilError(t, err, "Dependents")
+	assert.DeepEqual(t, dependents, []string{"app#build", "app#test", "lib#test"})
+
+	dependents, err = p.Dependents("other#test")
+	assert.NilError(t, err, "Dependents")
+	assert.DeepEqual(t, dependents, []string{})
+}
+
 func TestRunWithNoTasksFound(t *testing.T) {
 	graph := &dag.AcyclicGraph{}
 	graph.Add("app")
@@ -479,3 +648,122 @@ b#test
 c#test
   ___ROOT___
 `
+
+func TestExecuteResourceClassConcurrency(t *testing.T) {
+	var g dag.AcyclicGraph
+	packages := []string{"a", "b", "c", "d", "e", "f"}
+	for _, pkg := range packages {
+		g.Add(pkg)
+	}
+	p := NewScheduler(&g)
+	p.AddTask(&Task{Name: "build"})
+	p.AddTask(&Task{Name: "download"})
+	err := p.Prepare(&SchedulerExecutionOptions{
+		Packages:  packages,
+		TaskNames: []string{"build", "download"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	visitor := func(taskID string) error {
+		_, task := util.GetPackageTaskFromId(taskID)
+		mu.Lock()
+		running[task]++
+		if running[task] > maxRunning[task] {
+			maxRunning[task] = running[task]
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running[task]--
+		mu.Unlock()
+		return nil
+	}
+	errs := p.Execute(visitor, ExecOpts{
+		Concurrency:   2,
+		IOConcurrency: 6,
+		IsIOBound: func(taskID string) bool {
+			_, task := util.GetPackageTaskFromId(taskID)
+			return task == "download"
+		},
+	})
+	assert.Equal(t, len(errs), 0, "Execute")
+	assert.Assert(t, maxRunning["build"] <= 2, "expected at most 2 concurrent builds, got %v", maxRunning["build"])
+	assert.Assert(t, maxRunning["download"] > 2, "expected downloads to exceed the cpu limit, got %v", maxRunning["download"])
+	assert.Assert(t, maxRunning["download"] <= 6, "expected at most 6 concurrent downloads, got %v", maxRunning["download"])
+}
+
+func TestTaskGraphWithoutRoot(t *testing.T) {
+	var g dag.AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Connect(dag.BasicEdge("b", "a"))
+
+	p := NewScheduler(&g)
+	topoDeps := make(util.Set)
+	topoDeps.Add("build")
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: topoDeps,
+	})
+	err := p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"a", "b"},
+		TaskNames: []string{"build"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	graph := p.TaskGraphWithoutRoot()
+	for _, v := range graph.Vertices() {
+		assert.Assert(t, !strings.Contains(dag.VertexName(v), ROOT_NODE_NAME), "unexpected vertex %v", v)
+	}
+	assert.Equal(t, len(graph.Vertices()), 2)
+	assert.Equal(t, len(graph.Edges()), 1)
+	assert.Assert(t, graph.DownEdges("b#build").Include("a#build"))
+	assert.Equal(t, graph.DownEdges("a#build").Len(), 0)
+
+	// The scheduler's own graph still has the placeholder to execute from
+	assert.Assert(t, p.TaskGraph.HasVertex(ROOT_NODE_NAME))
+	assert.Assert(t, p.TaskGraph.DownEdges("a#build").Include(ROOT_NODE_NAME))
+}
+
+func TestProdDepsOnly(t *testing.T) {
+	var g dag.AcyclicGraph
+	g.Add("app")
+	g.Add("lib")
+	g.Add("test-utils")
+	g.Connect(dag.BasicEdge("app", "lib"))
+	g.Connect(dag.BasicEdge("app", "test-utils"))
+	var prod dag.AcyclicGraph
+	prod.Add("app")
+	prod.Add("lib")
+	prod.Add("test-utils")
+	prod.Connect(dag.BasicEdge("app", "lib"))
+
+	p := NewScheduler(&g)
+	p.ProdTopologicGraph = &prod
+	topoDeps := make(util.Set)
+	topoDeps.Add("build")
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: topoDeps,
+	})
+	p.AddTask(&Task{
+		Name:         "deploy",
+		TopoDeps:     topoDeps,
+		ProdDepsOnly: true,
+	})
+	err := p.Prepare(&SchedulerExecutionOptions{
+		Packages:  []string{"app"},
+		TaskNames: []string{"build", "deploy"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	buildDeps := p.TaskGraph.DownEdges("app#build")
+	assert.Assert(t, buildDeps.Include("lib#build"))
+	assert.Assert(t, buildDeps.Include("test-utils#build"))
+	deployDeps := p.TaskGraph.DownEdges("app#deploy")
+	assert.Equal(t, deployDeps.Len(), 1)
+	assert.Assert(t, deployDeps.Include("lib#build"))
+}
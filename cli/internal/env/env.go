@@ -3,6 +3,7 @@ package env
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -10,8 +11,13 @@ import (
 )
 
 func getEnvMap() map[string]string {
+	return EnvironMap(os.Environ())
+}
+
+// EnvironMap converts key=value pairs, as returned by os.Environ, into a map of names to values
+func EnvironMap(environ []string) map[string]string {
 	envMap := make(map[string]string)
-	for _, envVar := range os.Environ() {
+	for _, envVar := range environ {
 		if i := strings.Index(envVar, "="); i >= 0 {
 			parts := strings.SplitN(envVar, "=", 2)
 			envMap[parts[0]] = strings.Join(parts[1:], "")
@@ -20,6 +26,68 @@ func getEnvMap() map[string]string {
 	return envMap
 }
 
+// _negationPrefix marks a wildcard pattern that excludes the variables it matches
+const _negationPrefix = "!"
+
+// wildcardToRegexp converts a pattern in which "*" matches any run of characters into an
+// anchored regular expression
+func wildcardToRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// excludedByWildcards returns a function reporting whether a variable name is matched by
+// one of the "!"-prefixed patterns
+func excludedByWildcards(patterns []string) func(name string) bool {
+	exclusions := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, _negationPrefix) {
+			exclusions = append(exclusions, wildcardToRegexp(strings.TrimPrefix(pattern, _negationPrefix)))
+		}
+	}
+	return func(name string) bool {
+		for _, exclusion := range exclusions {
+			if exclusion.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FromWildcards returns the sorted names of the variables selected by the given patterns. A
+// pattern may use "*" to match any run of characters, in which case it selects the matching
+// variables set in envMap. A pattern without "*" selects that name whether or not it is set,
+// so that its absence is hashed too. Patterns prefixed with "!" exclude the names they match
+// from the result, regardless of their position in the list.
+func FromWildcards(envMap map[string]string, patterns []string) []string {
+	excluded := excludedByWildcards(patterns)
+	names := make(util.Set)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, _negationPrefix) {
+			continue
+		}
+		if !strings.Contains(pattern, "*") {
+			if !excluded(pattern) {
+				names.Add(pattern)
+			}
+			continue
+		}
+		inclusion := wildcardToRegexp(pattern)
+		for name := range envMap {
+			if inclusion.MatchString(name) && !excluded(name) {
+				names.Add(name)
+			}
+		}
+	}
+	sortedNames := names.UnsafeListOfStrings()
+	sort.Strings(sortedNames)
+	return sortedNames
+}
+
 // getEnvPairsFromKeys returns a slice of key=value pairs for all env var keys specified in envKeys
 func getEnvPairsFromKeys(envKeys []string, allEnvVars map[string]string) []string {
 	hashableConfigEnvPairs := []string{}
@@ -54,12 +122,15 @@ func getEnvPairsFromPrefixes(includePrefixes []string, excludePrefix string, all
 	return allEnvPairs
 }
 
-// GetHashableEnvPairs returns all sorted key=value env var pairs for both frameworks and from envKeys
+// GetHashableEnvPairs returns all sorted key=value env var pairs for both frameworks and from envKeys.
+// envKeys may contain wildcards and negations, as described by FromWildcards. Negations also
+// exclude framework variables.
 func GetHashableEnvPairs(envKeys []string, envPrefixes []string) []string {
 	allEnvVars := getEnvMap()
 	excludePrefix := allEnvVars["TURBO_CI_VENDOR_ENV_KEY"]
-	hashableEnvFromKeys := getEnvPairsFromKeys(envKeys, allEnvVars)
+	hashableEnvFromKeys := getEnvPairsFromKeys(FromWildcards(allEnvVars, envKeys), allEnvVars)
 	hashableEnvFromPrefixes := getEnvPairsFromPrefixes(envPrefixes, excludePrefix, allEnvVars)
+	excluded := excludedByWildcards(envKeys)
 
 	// convert to set to eliminate duplicates, then cast back to slice to sort for stable hashing
 	uniqueHashableEnvPairs := make(util.Set, len(hashableEnvFromKeys)+len(hashableEnvFromPrefixes))
@@ -67,7 +138,9 @@ func GetHashableEnvPairs(envKeys []string, envPrefixes []string) []string {
 		uniqueHashableEnvPairs.Add(pair)
 	}
 	for _, pair := range hashableEnvFromPrefixes {
-		uniqueHashableEnvPairs.Add(pair)
+		if name := strings.SplitN(pair, "=", 2)[0]; !excluded(name) {
+			uniqueHashableEnvPairs.Add(pair)
+		}
 	}
 
 	allHashableEnvPairs := uniqueHashableEnvPairs.UnsafeListOfStrings()
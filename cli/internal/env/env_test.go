@@ -275,6 +275,15 @@ func TestGetHashableEnvPairs(t *testing.T) {
 			},
 			want: []string{"MANUAL=true", "NEXT_PUBLIC_VERCEL_ENV=true"},
 		},
+		{
+			env:  []string{"NEXT_PUBLIC_A=a", "NEXT_PUBLIC_SECRET=s", "API_URL=url", "API_TOKEN=token"},
+			name: "wildcards and negations",
+			args: args{
+				envKeys:     []string{"API_*", "!*_TOKEN", "!NEXT_PUBLIC_SECRET"},
+				envPrefixes: []string{"NEXT_PUBLIC_"},
+			},
+			want: []string{"API_URL=url", "NEXT_PUBLIC_A=a"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -289,3 +298,64 @@ func TestGetHashableEnvPairs(t *testing.T) {
 		})
 	}
 }
+
+func TestFromWildcards(t *testing.T) {
+	envMap := map[string]string{
+		"API_URL":     "url",
+		"API_TOKEN":   "token",
+		"AWS_REGION":  "us-east-1",
+		"AWS_SECRET":  "secret",
+		"LITERAL.*":   "literal",
+		"LITERALXYZ":  "not literal",
+		"UNRELATED":   "unrelated",
+		"API_VERSION": "2",
+	}
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "no patterns",
+			patterns: []string{},
+			want:     []string{},
+		},
+		{
+			name:     "names without wildcards are kept even if unset",
+			patterns: []string{"UNRELATED", "UNSET"},
+			want:     []string{"UNRELATED", "UNSET"},
+		},
+		{
+			name:     "wildcard matches set variables",
+			patterns: []string{"API_*"},
+			want:     []string{"API_TOKEN", "API_URL", "API_VERSION"},
+		},
+		{
+			name:     "wildcard in the middle",
+			patterns: []string{"A*_*N"},
+			want:     []string{"API_TOKEN", "API_VERSION", "AWS_REGION"},
+		},
+		{
+			name:     "negation applies regardless of order",
+			patterns: []string{"!*_TOKEN", "API_*", "AWS_*", "!AWS_SECRET"},
+			want:     []string{"API_URL", "API_VERSION", "AWS_REGION"},
+		},
+		{
+			name:     "negation excludes names without wildcards",
+			patterns: []string{"API_TOKEN", "!API_*"},
+			want:     []string{},
+		},
+		{
+			name:     "regular expression characters are literal",
+			patterns: []string{"LITERAL.*"},
+			want:     []string{"LITERAL.*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromWildcards(envMap, tt.patterns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromWildcards() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/karrick/godirwalk"
 )
@@ -14,6 +15,30 @@ import (
 // RecursiveCopy copies either a single file or a directory.
 // 'mode' is the mode of the destination file.
 func RecursiveCopy(from string, to string) error {
+	return RecursiveCopyWith(from, to, CopyFile, nil)
+}
+
+// RecursiveCopyMatching is like RecursiveCopy, but only copies the files for which include
+// returns true, given their path relative to from. Directories are only created as needed
+// to hold the copied files.
+func RecursiveCopyMatching(from string, to string, include func(relativePath string) bool) error {
+	return RecursiveCopyWith(from, to, CopyFile, include)
+}
+
+// RecursiveLink is like RecursiveCopy, but hardlinks regular files instead of copying them.
+// See LinkFile for the caveats that apply to linked files.
+func RecursiveLink(from string, to string) error {
+	return RecursiveCopyWith(from, to, LinkFile, nil)
+}
+
+// RecursiveLinkMatching is like RecursiveCopyMatching, but hardlinks regular files instead of copying them.
+func RecursiveLinkMatching(from string, to string, include func(relativePath string) bool) error {
+	return RecursiveCopyWith(from, to, LinkFile, include)
+}
+
+// RecursiveCopyWith is the general form of RecursiveCopy and friends. Each file is put into
+// place by copyFile. If include is non-nil, only the files for which it returns true are copied.
+func RecursiveCopyWith(from string, to string, copyFile func(from *LstatCachedFile, to string) error, include func(relativePath string) bool) error {
 	// Verified all callers are passing in absolute paths for from (and to)
 	statedFrom := LstatCachedFile{Path: UnsafeToAbsolutePath(from)}
 	fromType, err := statedFrom.GetType()
@@ -23,15 +48,23 @@ func RecursiveCopy(from string, to string) error {
 
 	if fromType.IsDir() {
 		return WalkMode(statedFrom.Path.ToStringDuringMigration(), func(name string, isDir bool, fileType os.FileMode) error {
-			dest := filepath.Join(to, name[len(statedFrom.Path.ToString()):])
-			if isDir {
+			relativePath := name[len(statedFrom.Path.ToString()):]
+			dest := filepath.Join(to, relativePath)
+			if include != nil {
+				if isDir || !include(strings.TrimPrefix(relativePath, string(filepath.Separator))) {
+					return nil
+				}
+				if err := os.MkdirAll(filepath.Dir(dest), DirPermissions); err != nil {
+					return err
+				}
+			} else if isDir {
 				return os.MkdirAll(dest, DirPermissions)
 			}
 			// name is absolute, (originates from godirwalk)
-			return CopyFile(&LstatCachedFile{Path: UnsafeToAbsolutePath(name), fileType: &fileType}, dest)
+			return copyFile(&LstatCachedFile{Path: UnsafeToAbsolutePath(name), fileType: &fileType}, dest)
 		})
 	}
-	return CopyFile(&statedFrom, to)
+	return copyFile(&statedFrom, to)
 }
 
 // Walk implements an equivalent to filepath.Walk.
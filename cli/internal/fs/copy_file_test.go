@@ -95,6 +95,30 @@ func TestCopyOrLinkFileWithPerms(t *testing.T) {
 	assert.Equal(t, info.Mode(), readonlyMode, "expected dest to have matching permissions")
 }
 
+func TestLinkFile(t *testing.T) {
+	src := fs.NewDir(t, "link-file")
+	dst := fs.NewDir(t, "link-file-dist")
+	srcFilePath := filepath.Join(src.Path(), "foo")
+	dstFilePath := filepath.Join(dst.Path(), "nested", "foo")
+	assert.NilError(t, ioutil.WriteFile(srcFilePath, []byte("foo"), 0644), "WriteFile")
+	// An existing file at the destination is replaced
+	assert.NilError(t, EnsureDir(dstFilePath), "EnsureDir")
+	assert.NilError(t, ioutil.WriteFile(dstFilePath, []byte("stale"), 0644), "WriteFile")
+
+	err := LinkFile(&LstatCachedFile{Path: turbopath.AbsolutePath(srcFilePath)}, dstFilePath)
+	assert.NilError(t, err, "LinkFile")
+
+	srcInfo, err := os.Lstat(srcFilePath)
+	assert.NilError(t, err, "Lstat")
+	dstInfo, err := os.Lstat(dstFilePath)
+	assert.NilError(t, err, "Lstat")
+	assert.Assert(t, os.SameFile(srcInfo, dstInfo), "expected dest to be a hardlink to src")
+	assert.Equal(t, srcInfo.Mode(), os.FileMode(0644), "expected the mode of the linked file to be unchanged")
+	contents, err := ioutil.ReadFile(dstFilePath)
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "foo")
+}
+
 func TestRecursiveCopy(t *testing.T) {
 	// Directory layout:
 	//
@@ -88,6 +88,54 @@ func CopyFile(from *LstatCachedFile, to string) error {
 	return writeFileFromStream(fromFile, to, fromMode)
 }
 
+// LinkFile hardlinks 'from' to 'to', replacing any existing file at 'to'. Symlinks are
+// copied as with CopyFile, and if the link cannot be created, e.g. because the paths are
+// on different filesystems, the file is copied instead.
+//
+// Both paths refer to the same file once linked, so modifying 'to' in place also modifies
+// 'from'. The mode is left as it is, since it is shared with 'from' too. Callers must
+// replace linked files, e.g. via rename, or call BreakHardlink before changing them.
+func LinkFile(from *LstatCachedFile, to string) error {
+	fromMode, err := from.GetMode()
+	if err != nil {
+		return errors.Wrapf(err, "getting mode for %v", from.Path)
+	}
+	if !fromMode.IsRegular() {
+		return CopyFile(from, to)
+	}
+	if err := EnsureDir(to); err != nil {
+		return err
+	}
+	if err := os.Remove(to); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(from.Path.ToString(), to); err != nil {
+		return CopyFile(from, to)
+	}
+	return nil
+}
+
+// BreakHardlink gives the regular file at 'path' its own copy of its contents if it is
+// hardlinked elsewhere, e.g. by LinkFile, so that it can then be modified in place without
+// modifying the other links too. A missing file is not an error.
+func BreakHardlink(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || !isHardlinked(info) {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer util.CloseAndIgnoreError(file)
+	return writeFileFromStream(file, path, info.Mode())
+}
+
 // writeFileFromStream writes data from a reader to the file named 'to', with an attempt to perform
 // a copy & rename to avoid chaos if anything goes wrong partway.
 func writeFileFromStream(fromFile io.Reader, to string, mode os.FileMode) error {
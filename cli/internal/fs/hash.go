@@ -47,13 +47,18 @@ func GitLikeHashFile(filePath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return GitLikeHash(file, stat.Size())
+}
+
+// GitLikeHash is like GitLikeHashFile, but hashes size bytes read from reader
+func GitLikeHash(reader io.Reader, size int64) (string, error) {
 	hash := sha1.New()
 	hash.Write([]byte("blob"))
 	hash.Write([]byte(" "))
-	hash.Write([]byte(strconv.FormatInt(stat.Size(), 10)))
+	hash.Write([]byte(strconv.FormatInt(size, 10)))
 	hash.Write([]byte{0})
 
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(hash, reader); err != nil {
 		return "", err
 	}
 
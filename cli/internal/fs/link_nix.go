@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// isHardlinked reports whether the file described by info has more than one link
+func isHardlinked(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		// Without a link count, assume the worst
+		return true
+	}
+	return stat.Nlink > 1
+}
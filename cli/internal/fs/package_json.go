@@ -23,6 +23,7 @@ type PackageJSON struct {
 	PackageJSONPath        turbopath.AnchoredSystemPath // relative path from repo root to the package.json file
 	Dir                    turbopath.AnchoredSystemPath // relative path from repo root to the package
 	InternalDeps           []string
+	InternalProdDeps       []string // the InternalDeps that are dependencies or optionalDependencies
 	UnresolvedExternalDeps map[string]string
 	ExternalDeps           []string
 	TransitiveDeps         []string
@@ -0,0 +1,90 @@
+package fs
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// TaskOutputs are a task's output globs, split into the ones that include files and
+// the ones that exclude them, without their "!" prefix
+type TaskOutputs struct {
+	Inclusions []string `json:"inclusions"`
+	Exclusions []string `json:"exclusions"`
+}
+
+// Sort returns a copy of the outputs with both lists sorted
+func (to TaskOutputs) Sort() TaskOutputs {
+	inclusions := make([]string, len(to.Inclusions))
+	exclusions := make([]string, len(to.Exclusions))
+	copy(inclusions, to.Inclusions)
+	copy(exclusions, to.Exclusions)
+	sort.Strings(inclusions)
+	sort.Strings(exclusions)
+	return TaskOutputs{
+		Inclusions: inclusions,
+		Exclusions: exclusions,
+	}
+}
+
+// PristinePipeline is the form of a Pipeline that is hashed. Lists whose order doesn't
+// change what a task does are sorted, so that reordering them in turbo.json doesn't
+// change the hash.
+type PristinePipeline map[string]pristineTaskDefinition
+
+type pristineTaskDefinition struct {
+	Outputs                 TaskOutputs         `json:"outputs"`
+	ShouldCache             bool                `json:"cache"`
+	CacheScope              CacheScope          `json:"cacheScope"`
+	EnvVarDependencies      []string            `json:"env"`
+	TopologicalDependencies []string            `json:"topologicalDependencies"`
+	TaskDependencies        []string            `json:"taskDependencies"`
+	Inputs                  []string            `json:"inputs"`
+	OutputMode              util.TaskOutputMode `json:"outputMode"`
+	PreserveOutputs         []string            `json:"preserveOutputs"`
+	ResourceClass           ResourceClass       `json:"resourceClass"`
+	SarifOutputs            []string            `json:"sarifOutputs"`
+	Timeout                 time.Duration       `json:"timeout"`
+	HasTimeout              bool                `json:"hasTimeout"`
+	ProdDependenciesOnly    bool                `json:"prodDependenciesOnly"`
+}
+
+// Pristine returns the form of the pipeline that is hashed
+func (pc Pipeline) Pristine() PristinePipeline {
+	pristine := make(PristinePipeline, len(pc))
+	for taskID, taskDefinition := range pc {
+		inclusions, exclusions := SplitOutputGlobs(taskDefinition.Outputs)
+		pristine[taskID] = pristineTaskDefinition{
+			Outputs:                 TaskOutputs{Inclusions: inclusions, Exclusions: exclusions}.Sort(),
+			ShouldCache:             taskDefinition.ShouldCache,
+			CacheScope:              taskDefinition.CacheScope.Hashed(),
+			EnvVarDependencies:      sortedCopy(taskDefinition.EnvVarDependencies),
+			TopologicalDependencies: sortedCopy(taskDefinition.TopologicalDependencies),
+			TaskDependencies:        sortedCopy(taskDefinition.TaskDependencies),
+			Inputs:                  sortedCopy(taskDefinition.Inputs),
+			OutputMode:              taskDefinition.OutputMode,
+			PreserveOutputs:         sortedCopy(taskDefinition.PreserveOutputs),
+			ResourceClass:           taskDefinition.ResourceClass,
+			SarifOutputs:            sortedCopy(taskDefinition.SarifOutputs),
+			Timeout:                 taskDefinition.Timeout,
+			HasTimeout:              taskDefinition.HasTimeout,
+			ProdDependenciesOnly:    taskDefinition.ProdDependenciesOnly,
+		}
+	}
+	return pristine
+}
+
+// Bytes serializes the pipeline. Semantically equal pipelines serialize to the same bytes.
+func (pp PristinePipeline) Bytes() ([]byte, error) {
+	// Map keys are marshalled in sorted order
+	return json.Marshal(pp)
+}
+
+func sortedCopy(values []string) []string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PristinePipelineBytes(t *testing.T) {
+	pristineBytes := func(rawPipeline string) []byte {
+		var pipeline Pipeline
+		assert.NoError(t, json.Unmarshal([]byte(rawPipeline), &pipeline))
+		bytes, err := pipeline.Pristine().Bytes()
+		assert.NoError(t, err)
+		return bytes
+	}
+
+	a := pristineBytes(`{
+		"build": {
+			"dependsOn": ["^build", "codegen", "$API_URL", "$NODE_ENV"],
+			"outputs": ["dist/**", "!dist/**/*.map", ".next/**", "!.next/cache/**"],
+			"inputs": ["src/**", "package.json"],
+			"timeout": "5m"
+		},
+		"codegen": {"outputs": []}
+	}`)
+	b := pristineBytes(`{
+		"codegen": {"outputs": []},
+		"build": {
+			"timeout": "5m",
+			"inputs": ["package.json", "src/**"],
+			"outputs": ["!.next/cache/**", ".next/**", "!dist/**/*.map", "dist/**"],
+			"dependsOn": ["$NODE_ENV", "codegen", "$API_URL", "^build"]
+		}
+	}`)
+	assert.Equal(t, string(a), string(b))
+
+	c := pristineBytes(`{
+		"build": {
+			"dependsOn": ["^build", "codegen", "$API_URL", "$NODE_ENV"],
+			"outputs": ["dist/**", "!dist/**/*.map", ".next/**"],
+			"inputs": ["src/**", "package.json"],
+			"timeout": "5m"
+		},
+		"codegen": {"outputs": []}
+	}`)
+	assert.NotEqual(t, string(a), string(c))
+}
+
+func Test_TaskOutputsSort(t *testing.T) {
+	outputs := TaskOutputs{
+		Inclusions: []string{"dist/**", ".next/**"},
+		Exclusions: []string{"dist/**/*.map", ".next/cache/**"},
+	}
+	sorted := outputs.Sort()
+	assert.Equal(t, []string{".next/**", "dist/**"}, sorted.Inclusions)
+	assert.Equal(t, []string{".next/cache/**", "dist/**/*.map"}, sorted.Exclusions)
+	// The original is left as it was
+	assert.Equal(t, []string{"dist/**", ".next/**"}, outputs.Inclusions)
+}
+
+func Test_PristineReadOnlyCacheScope(t *testing.T) {
+	readOnly, err := Pipeline{"build": {CacheScope: CacheScopeReadOnly}}.Pristine().Bytes()
+	assert.NoError(t, err)
+	readWrite, err := Pipeline{"build": {CacheScope: CacheScopeBoth}}.Pristine().Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, string(readWrite), string(readOnly))
+}
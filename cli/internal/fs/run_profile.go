@@ -0,0 +1,85 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// _runProfileTasksKey is the key of a profile listing the tasks to run, rather than a flag
+const _runProfileTasksKey = "tasks"
+
+// RunProfile is a named set of tasks and `turbo run` flags from the "profiles" key of turbo.json
+type RunProfile struct {
+	// Tasks are run when none are given on the command line
+	Tasks []string
+	// Flags maps the names of `turbo run` flags to their values. Flags that can be given more
+	// than once, such as --filter, may have several values.
+	Flags map[string][]string
+}
+
+// UnmarshalJSON reads a profile such as {"tasks": ["build"], "filter": ["...[main]"], "concurrency": "50%"}.
+// Flag values may be strings, numbers, booleans, or lists of those.
+func (p *RunProfile) UnmarshalJSON(data []byte) error {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Flags = make(map[string][]string, len(raw))
+	for key, value := range raw {
+		values, err := runProfileValues(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+		if key == _runProfileTasksKey {
+			p.Tasks = values
+		} else {
+			p.Flags[key] = values
+		}
+	}
+	return nil
+}
+
+// runProfileValues converts a value of a profile to the strings it would be passed as on the command line
+func runProfileValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return nil, fmt.Errorf("lists can't be nested")
+			}
+			itemValues, err := runProfileValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("expected a string, number, boolean, or list, got %v", value)
+}
+
+// GetProfile returns the profile with the given name
+func (c *TurboJSON) GetProfile(name string) (RunProfile, error) {
+	if profile, ok := c.Profiles[name]; ok {
+		return profile, nil
+	}
+	if len(c.Profiles) == 0 {
+		return RunProfile{}, fmt.Errorf("unknown profile %q: %v doesn't define any \"profiles\"", name, configFile)
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for profileName := range c.Profiles {
+		names = append(names, profileName)
+	}
+	sort.Strings(names)
+	return RunProfile{}, fmt.Errorf("unknown profile %q, expected one of: %v", name, strings.Join(names, ", "))
+}
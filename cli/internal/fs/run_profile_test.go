@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunProfileUnmarshalJSON(t *testing.T) {
+	turboJSON := &TurboJSON{}
+	err := json.Unmarshal([]byte(`{
+		"pipeline": {"build": {}},
+		"profiles": {
+			"ci": {"tasks": ["build", "test"], "filter": ["...[main]"], "concurrency": "50%", "continue": true, "task-timeout": 30},
+			"dev": {"tasks": ["dev"], "parallel": true}
+		}
+	}`), turboJSON)
+	assert.NoError(t, err)
+
+	profile, err := turboJSON.GetProfile("ci")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build", "test"}, profile.Tasks)
+	assert.Equal(t, map[string][]string{
+		"filter":       {"...[main]"},
+		"concurrency":  {"50%"},
+		"continue":     {"true"},
+		"task-timeout": {"30"},
+	}, profile.Flags)
+
+	_, err = turboJSON.GetProfile("release")
+	assert.EqualError(t, err, `unknown profile "release", expected one of: ci, dev`)
+
+	_, err = (&TurboJSON{}).GetProfile("ci")
+	assert.ErrorContains(t, err, "doesn't define any")
+}
+
+func TestRunProfileInvalidValue(t *testing.T) {
+	profile := &RunProfile{}
+	err := json.Unmarshal([]byte(`{"filter": {"include": "web"}}`), profile)
+	assert.ErrorContains(t, err, `invalid value for "filter"`)
+
+	err = json.Unmarshal([]byte(`{"filter": [["web"]]}`), profile)
+	assert.ErrorContains(t, err, "nested")
+}
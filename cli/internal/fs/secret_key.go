@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// ReadOrCreateKey returns the random key stored at path, creating it first if there is none.
+// Keys are kept outside of repositories and caches, e.g. in GetTurboDataDir, so that what they
+// key can't be forged or checked against guesses by someone who can only read those.
+func ReadOrCreateKey(path turbopath.AbsolutePath) ([]byte, error) {
+	if err := path.EnsureDir(); err != nil {
+		return nil, err
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	key := []byte(hex.EncodeToString(random))
+	// Only create the key if there isn't one yet, so that concurrent runs agree on it
+	f, err := path.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		existing, err := path.ReadFile()
+		if err == nil && len(existing) == 0 {
+			return nil, fmt.Errorf("key file %v is empty", path)
+		}
+		return existing, err
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+// HashSecretValue returns a keyed hash of a value that must not be written to disk as is,
+// such as the value of an env var. Without the key, guesses can't be checked against it.
+func HashSecretValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOrCreateKey(t *testing.T) {
+	path := AbsolutePathFromUpstream(t.TempDir()).Join("keys", "test.key")
+	key, err := ReadOrCreateKey(path)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, key)
+
+	info, err := path.Lstat()
+	assert.NoError(t, err)
+	assert.Equal(t, "-rw-------", info.Mode().String())
+
+	again, err := ReadOrCreateKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again, "expected the existing key to be reused")
+}
+
+func TestHashSecretValue(t *testing.T) {
+	hash := HashSecretValue([]byte("key"), "secret")
+	assert.Equal(t, hash, HashSecretValue([]byte("key"), "secret"))
+	assert.NotEqual(t, hash, HashSecretValue([]byte("other key"), "secret"))
+	assert.NotEqual(t, hash, HashSecretValue([]byte("key"), "other secret"))
+}
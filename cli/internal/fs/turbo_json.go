@@ -2,10 +2,14 @@ package fs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"github.com/vercel/turborepo/cli/internal/util"
@@ -16,11 +20,20 @@ const (
 	configFile                   = "turbo.json"
 	envPipelineDelimiter         = "$"
 	topologicalPipelineDelimiter = "^"
+	outputExclusionPrefix        = "!"
+	// repoRootOutputPrefix anchors an output glob at the root of the repository, rather than
+	// at the package whose task writes it
+	repoRootOutputPrefix = "//"
+	// globalDependencyInterpolation starts a reference to an env var within a globalDependencies
+	// path, as in "${CONFIG_DIR}/shared.json", as opposed to a bare "$VAR" env var dependency
+	globalDependencyInterpolation = "${"
 )
 
 var defaultOutputs = []string{"dist/**/*", "build/**/*"}
 
 type rawTurboJSON struct {
+	// Schema is the JSON schema that editors validate the configFile against
+	Schema string `json:"$schema,omitempty"`
 	// Global root filesystem dependencies
 	GlobalDependencies []string `json:"globalDependencies,omitempty"`
 	// Global env
@@ -30,6 +43,11 @@ type rawTurboJSON struct {
 	Pipeline Pipeline
 	// Configuration options when interfacing with the remote cache
 	RemoteCacheOptions RemoteCacheOptions `json:"remoteCache,omitempty"`
+	// Profiles are named sets of tasks and flags for `turbo run --config-profile`
+	Profiles map[string]RunProfile `json:"profiles,omitempty"`
+	// FrameworkEnvPrefixes replaces the prefixes of the env vars hashed for tasks of the
+	// inferred frameworks, keyed by framework slug
+	FrameworkEnvPrefixes map[string][]string `json:"frameworkEnvPrefixes,omitempty"`
 }
 
 // TurboJSON is the root turborepo configuration
@@ -38,6 +56,9 @@ type TurboJSON struct {
 	GlobalEnv          []string
 	Pipeline           Pipeline
 	RemoteCacheOptions RemoteCacheOptions
+	Profiles           map[string]RunProfile
+	// FrameworkEnvPrefixes replaces the env prefixes of inferred frameworks, keyed by slug
+	FrameworkEnvPrefixes map[string][]string
 }
 
 // RemoteCacheOptions is a struct for deserializing .remoteCache of configFile
@@ -46,13 +67,116 @@ type RemoteCacheOptions struct {
 	Signature bool   `json:"signature,omitempty"`
 }
 
+// CacheScope selects which caches a task's outputs are read from and written to
+type CacheScope string
+
+const (
+	// CacheScopeBoth uses both the local filesystem cache and the remote cache
+	CacheScopeBoth CacheScope = "both"
+	// CacheScopeLocal only uses the local filesystem cache, e.g. for machine-specific artifacts
+	CacheScopeLocal CacheScope = "local"
+	// CacheScopeRemote only uses the remote cache
+	CacheScopeRemote CacheScope = "remote"
+	// CacheScopeNone disables caching for the task
+	CacheScopeNone CacheScope = "none"
+	// CacheScopeReadOnly restores outputs from both caches, but never writes new artifacts,
+	// e.g. for flaky tasks whose outputs shouldn't be shared
+	CacheScopeReadOnly CacheScope = "readonly"
+)
+
+// Hashed returns the scope as it is included in hashes. A readonly task restores the artifacts
+// that a read-write task writes, so it has to produce the same hashes.
+func (s CacheScope) Hashed() CacheScope {
+	if s == CacheScopeReadOnly {
+		return CacheScopeBoth
+	}
+	return s
+}
+
+// UnmarshalJSON accepts either one of the named scopes, or a boolean where
+// true means CacheScopeBoth and false means CacheScopeNone
+func (s *CacheScope) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		if enabled {
+			*s = CacheScopeBoth
+		} else {
+			*s = CacheScopeNone
+		}
+		return nil
+	}
+	var scope string
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return fmt.Errorf("invalid value for \"cache\": %v. Expected true, false, \"local\", \"remote\", \"both\", \"readonly\" or \"none\"", string(data))
+	}
+	switch CacheScope(scope) {
+	case CacheScopeBoth, CacheScopeLocal, CacheScopeRemote, CacheScopeNone, CacheScopeReadOnly:
+		*s = CacheScope(scope)
+		return nil
+	}
+	return fmt.Errorf("invalid value for \"cache\": %q. Expected true, false, \"local\", \"remote\", \"both\", \"readonly\" or \"none\"", scope)
+}
+
+// ResourceClass is the resource that a task is mostly bound by, which decides the
+// concurrency budget it runs under
+type ResourceClass string
+
+const (
+	// ResourceClassCPU is for tasks bound by CPU, such as builds. Tasks are cpu-bound by default.
+	ResourceClassCPU ResourceClass = "cpu"
+	// ResourceClassIO is for tasks that mostly wait on I/O, such as downloads
+	ResourceClassIO ResourceClass = "io"
+)
+
+// UnmarshalJSON accepts one of the named resource classes
+func (r *ResourceClass) UnmarshalJSON(data []byte) error {
+	var class string
+	if err := json.Unmarshal(data, &class); err != nil {
+		return fmt.Errorf("invalid value for \"resourceClass\": %v. Expected \"cpu\" or \"io\"", string(data))
+	}
+	switch ResourceClass(class) {
+	case ResourceClassCPU, ResourceClassIO:
+		*r = ResourceClass(class)
+		return nil
+	}
+	return fmt.Errorf("invalid value for \"resourceClass\": %q. Expected \"cpu\" or \"io\"", class)
+}
+
+// TaskTimeout is how long a task may run for before it is killed, written as a
+// duration such as "10m". "0" means the task may run for as long as it needs.
+type TaskTimeout time.Duration
+
+// UnmarshalJSON accepts a non-negative duration
+func (t *TaskTimeout) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid value for \"timeout\": %v. Expected a duration such as \"10m\"", string(data))
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return fmt.Errorf("invalid value for \"timeout\": %q. Expected a duration such as \"10m\"", value)
+	}
+	*t = TaskTimeout(timeout)
+	return nil
+}
+
 type pipelineJSON struct {
 	Outputs    *[]string           `json:"outputs"`
-	Cache      *bool               `json:"cache,omitempty"`
+	Cache      *CacheScope         `json:"cache,omitempty"`
 	DependsOn  []string            `json:"dependsOn,omitempty"`
 	Inputs     []string            `json:"inputs,omitempty"`
 	OutputMode util.TaskOutputMode `json:"outputMode,omitempty"`
 	Env        []string            `json:"env,omitempty"`
+	// PreserveOutputs are globs of files that restoring the task's outputs must leave as they are
+	PreserveOutputs []string `json:"preserveOutputs,omitempty"`
+	// ResourceClass is whether the task is "cpu" or "io" bound
+	ResourceClass ResourceClass `json:"resourceClass,omitempty"`
+	// SarifOutputs are globs of the SARIF reports among the task's outputs
+	SarifOutputs []string `json:"sarifOutputs,omitempty"`
+	// Timeout is how long the task may run for
+	Timeout *TaskTimeout `json:"timeout,omitempty"`
+	// ProdDependenciesOnly is whether "^" dependencies only follow production dependencies
+	ProdDependenciesOnly bool `json:"prodDependenciesOnly,omitempty"`
 }
 
 // Pipeline is a struct for deserializing .pipeline in configFile
@@ -60,17 +184,48 @@ type Pipeline map[string]TaskDefinition
 
 // TaskDefinition is a representation of the configFile pipeline for further computation.
 type TaskDefinition struct {
+	// Outputs are package-relative globs of the files the task writes. Globs prefixed
+	// with "!" exclude the files they match from the other globs. They default to
+	// dist/** and build/** unless HasOutputs is set.
 	Outputs                 []string
+	HasOutputs              bool
 	ShouldCache             bool
+	CacheScope              CacheScope
 	EnvVarDependencies      []string
 	TopologicalDependencies []string
 	TaskDependencies        []string
 	Inputs                  []string
 	OutputMode              util.TaskOutputMode
+	// PreserveOutputs are globs of files that are left untouched when the task's outputs are
+	// restored from the cache. Like Outputs, they are relative to the package unless they
+	// start with "//".
+	PreserveOutputs []string
+	// ResourceClass is the resource the task is bound by. Empty means ResourceClassCPU.
+	ResourceClass ResourceClass
+	// SarifOutputs are package-relative globs of the SARIF reports the task writes
+	SarifOutputs []string
+	// Timeout is how long the task may run for before it is killed, if HasTimeout is set.
+	// Otherwise the run's --task-timeout applies. A Timeout of 0 means the task is never killed.
+	// These are values rather than a pointer so that the task definition hashes the same way every run.
+	Timeout    time.Duration
+	HasTimeout bool
+	// ProdDependenciesOnly restricts TopologicalDependencies to the packages that this
+	// package has as dependencies or optionalDependencies, leaving out its devDependencies
+	ProdDependenciesOnly bool
 }
 
 // ReadTurboConfig toggles between reading from package.json or the configFile to support early adopters.
 func ReadTurboConfig(rootPath turbopath.AbsolutePath, rootPackageJSON *PackageJSON) (*TurboJSON, error) {
+	return readTurboConfig(rootPath, rootPackageJSON, false)
+}
+
+// ReadStrictTurboConfig behaves like ReadTurboConfig, but returns an error rather than
+// logging a warning if the root package.json has a "turbo" key.
+func ReadStrictTurboConfig(rootPath turbopath.AbsolutePath, rootPackageJSON *PackageJSON) (*TurboJSON, error) {
+	return readTurboConfig(rootPath, rootPackageJSON, true)
+}
+
+func readTurboConfig(rootPath turbopath.AbsolutePath, rootPackageJSON *PackageJSON, strict bool) (*TurboJSON, error) {
 
 	turboJSONPath := rootPath.Join(configFile)
 
@@ -80,13 +235,20 @@ func ReadTurboConfig(rootPath turbopath.AbsolutePath, rootPackageJSON *PackageJS
 	// If the configFile exists, use that
 	if turboJSONPath.FileExists() {
 		turboJSON, err := readTurboJSON(turboJSONPath)
-		if err != nil {
+		var posErr *positionError
+		if errors.As(err, &posErr) {
+			// Report the position the way compilers do, e.g. turbo.json:3:5: ...
+			return nil, fmt.Errorf("%s:%w", configFile, err)
+		} else if err != nil {
 			return nil, fmt.Errorf("%s: %w", configFile, err)
 		}
 
 		// If pkg.Turbo exists, log a warning and delete it from the representation
 		// TODO: turn off this warning eventually
 		if hasLegacyConfig {
+			if strict {
+				return nil, fmt.Errorf("\"turbo\" key in package.json is no longer supported, remove it and use %s instead", configFile)
+			}
 			log.Printf("[WARNING] Ignoring \"turbo\" key in package.json, using %s instead.", configFile)
 			rootPackageJSON.LegacyTurboConfig = nil
 		}
@@ -97,6 +259,9 @@ func ReadTurboConfig(rootPath turbopath.AbsolutePath, rootPackageJSON *PackageJS
 	// Use pkg.Turbo if the configFile doesn't exist and we want the fallback feature
 	// TODO: turn this fallback off eventually
 	if hasLegacyConfig {
+		if strict {
+			return nil, fmt.Errorf("\"turbo\" in package.json is deprecated. Migrate to %s by running \"npx @turbo/codemod create-turbo-config\"", configFile)
+		}
 		log.Printf("[DEPRECATED] \"turbo\" in package.json is deprecated. Migrate to %s by running \"npx @turbo/codemod create-turbo-config\"\n", configFile)
 		return rootPackageJSON.LegacyTurboConfig, nil
 	}
@@ -120,12 +285,40 @@ func readTurboJSON(path turbopath.AbsolutePath) (*TurboJSON, error) {
 	err = jsonc.Unmarshal(data, &turboJSON)
 
 	if err != nil {
-		return nil, err
+		return nil, locateError(data, err)
 	}
 
 	return turboJSON, nil
 }
 
+// UnmarshalJSON deserializes the pipeline, recording which task an error in a
+// TaskDefinition was found in
+func (pc *Pipeline) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return withKey("pipeline", err)
+	}
+	if raw == nil {
+		*pc = nil
+		return nil
+	}
+	taskIDs := make([]string, 0, len(raw))
+	for taskID := range raw {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	pipeline := make(Pipeline, len(raw))
+	for _, taskID := range taskIDs {
+		var taskDefinition TaskDefinition
+		if err := json.Unmarshal(raw[taskID], &taskDefinition); err != nil {
+			return withKey("pipeline", withKey(taskID, err))
+		}
+		pipeline[taskID] = taskDefinition
+	}
+	*pc = pipeline
+	return nil
+}
+
 // GetTaskDefinition returns a TaskDefinition from a serialized definition in configFile
 func (pc Pipeline) GetTaskDefinition(taskID string) (TaskDefinition, bool) {
 	if entry, ok := pc[taskID]; ok {
@@ -136,6 +329,21 @@ func (pc Pipeline) GetTaskDefinition(taskID string) (TaskDefinition, bool) {
 	return entry, ok
 }
 
+// RestrictedCacheScopes returns the scopes, other than "both" and "none", that tasks in the
+// pipeline restrict their caching to
+func (pc Pipeline) RestrictedCacheScopes() []CacheScope {
+	scopes := []CacheScope{}
+	for _, scope := range []CacheScope{CacheScopeLocal, CacheScopeRemote} {
+		for _, taskDefinition := range pc {
+			if taskDefinition.CacheScope == scope {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
 // HasTask returns true if the given task is defined in the pipeline, either directly or
 // via a package task (`pkg#task`)
 func (pc Pipeline) HasTask(task string) bool {
@@ -153,11 +361,102 @@ func (pc Pipeline) HasTask(task string) bool {
 	return false
 }
 
+// resolveTaskDependency returns the pipeline key that the dependsOn entry dep of the task
+// at key resolves to, or "" if dep is not defined in the pipeline. Bare task names in a
+// package task resolve to the same package's entry when there is one. A `pkg#task` entry
+// that isn't a pipeline key is skipped: it runs the generic definition for another package,
+// which is a different task from the one at key even when the task names match.
+func (pc Pipeline) resolveTaskDependency(key string, dep string) string {
+	if util.IsPackageTask(dep) {
+		if pc.has(dep) {
+			return dep
+		}
+		return ""
+	} else if util.IsPackageTask(key) {
+		pkg, _ := util.GetPackageTaskFromId(key)
+		if packageTask := util.GetTaskId(pkg, dep); pc.has(packageTask) {
+			return packageTask
+		}
+	}
+	if pc.has(dep) {
+		return dep
+	}
+	return ""
+}
+
+func (pc Pipeline) has(key string) bool {
+	_, ok := pc[key]
+	return ok
+}
+
+// FindTaskDependencyCycle returns a chain of pipeline keys, starting and ending with the
+// same key, linked by non-topological dependsOn entries, or nil if there is no such cycle.
+// Unlike validating the task graph, this does not depend on which packages exist.
+func (pc Pipeline) FindTaskDependencyCycle() []string {
+	keys := make([]string, 0, len(pc))
+	for key := range pc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return util.FindCycle(keys, func(key string) []string {
+		deps := []string{}
+		for _, dep := range pc[key].TaskDependencies {
+			if next := pc.resolveTaskDependency(key, dep); next != "" {
+				deps = append(deps, next)
+			}
+		}
+		return deps
+	})
+}
+
+// SplitOutputGlobs separates output globs into the globs of files to include and the
+// "!"-prefixed globs of files to exclude, returned without their prefix
+func SplitOutputGlobs(outputs []string) (inclusions []string, exclusions []string) {
+	for _, output := range outputs {
+		if strings.HasPrefix(output, outputExclusionPrefix) {
+			exclusions = append(exclusions, strings.TrimPrefix(output, outputExclusionPrefix))
+		} else {
+			inclusions = append(inclusions, output)
+		}
+	}
+	return inclusions, exclusions
+}
+
+// RepoRelativeOutputGlob returns the repo-relative form of an output glob, without any "!"
+// prefix, of the package in pkgDir. Globs are relative to the package unless they start with
+// "//", which makes them relative to the repo root.
+func RepoRelativeOutputGlob(pkgDir string, output string) string {
+	if strings.HasPrefix(output, repoRootOutputPrefix) {
+		return filepath.Clean(filepath.FromSlash(strings.TrimPrefix(output, repoRootOutputPrefix)))
+	}
+	return filepath.Join(pkgDir, output)
+}
+
+// checkRepoRootOutput returns an error if a "//"-anchored output glob reaches outside of the
+// repo root, which is where restoring outputs from the cache refuses to write files
+func checkRepoRootOutput(output string) error {
+	glob := strings.TrimPrefix(output, outputExclusionPrefix)
+	if !strings.HasPrefix(glob, repoRootOutputPrefix) {
+		return nil
+	}
+	relative := RepoRelativeOutputGlob("", glob)
+	if filepath.IsAbs(relative) || relative == ".." || strings.HasPrefix(relative, nonRelativeSentinel) {
+		return fmt.Errorf("invalid output %q: outputs starting with %q must be within the repository root", output, repoRootOutputPrefix)
+	}
+	if relative == "." {
+		return fmt.Errorf("invalid output %q: outputs starting with %q must name files within the repository root, such as \"//dist/**\"", output, repoRootOutputPrefix)
+	}
+	return nil
+}
+
 // UnmarshalJSON deserializes JSON into a TaskDefinition
 func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
+	if err := checkKnownKeys(data, pipelineJSON{}); err != nil {
+		return err
+	}
 	rawPipeline := &pipelineJSON{}
 	if err := json.Unmarshal(data, &rawPipeline); err != nil {
-		return err
+		return asKeyError(err)
 	}
 
 	// We actually need a nil value to be able to unmarshal the json
@@ -166,14 +465,24 @@ func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 	// always unmarshal into an empty array which is not what we want.
 	if rawPipeline.Outputs != nil {
 		c.Outputs = *rawPipeline.Outputs
+		c.HasOutputs = true
 	} else {
 		c.Outputs = defaultOutputs
 	}
+	for _, output := range c.Outputs {
+		if err := checkRepoRootOutput(output); err != nil {
+			return err
+		}
+	}
+	if inclusions, _ := SplitOutputGlobs(c.Outputs); len(c.Outputs) > 0 && len(inclusions) == 0 {
+		log.Printf("[WARNING] The outputs %v only exclude files, so no outputs will be cached. Add a glob of the files to include, such as \"dist/**\".", strings.Join(c.Outputs, ", "))
+	}
 	if rawPipeline.Cache == nil {
-		c.ShouldCache = true
+		c.CacheScope = CacheScopeBoth
 	} else {
-		c.ShouldCache = *rawPipeline.Cache
+		c.CacheScope = *rawPipeline.Cache
 	}
+	c.ShouldCache = c.CacheScope != CacheScopeNone
 
 	envVarDependencies := make(util.Set)
 	c.TopologicalDependencies = []string{}
@@ -203,14 +512,30 @@ func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 	c.EnvVarDependencies = envVarDependencies.UnsafeListOfStrings()
 	c.Inputs = rawPipeline.Inputs
 	c.OutputMode = rawPipeline.OutputMode
+	c.PreserveOutputs = rawPipeline.PreserveOutputs
+	for _, output := range c.PreserveOutputs {
+		if err := checkRepoRootOutput(output); err != nil {
+			return err
+		}
+	}
+	c.ResourceClass = rawPipeline.ResourceClass
+	c.SarifOutputs = rawPipeline.SarifOutputs
+	if rawPipeline.Timeout != nil {
+		c.Timeout = time.Duration(*rawPipeline.Timeout)
+		c.HasTimeout = true
+	}
+	c.ProdDependenciesOnly = rawPipeline.ProdDependenciesOnly
 	return nil
 }
 
 // UnmarshalJSON deserializes TurboJSON objects into struct
 func (c *TurboJSON) UnmarshalJSON(data []byte) error {
+	if err := checkKnownKeys(data, rawTurboJSON{}); err != nil {
+		return err
+	}
 	raw := &rawTurboJSON{}
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return err
+		return asKeyError(err)
 	}
 
 	envVarDependencies := make(util.Set)
@@ -227,7 +552,7 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 	}
 
 	for _, value := range raw.GlobalDependencies {
-		if strings.HasPrefix(value, envPipelineDelimiter) {
+		if strings.HasPrefix(value, envPipelineDelimiter) && !strings.HasPrefix(value, globalDependencyInterpolation) {
 			envVarDependencies.Add(strings.TrimPrefix(value, envPipelineDelimiter))
 		} else {
 			globalFileDependencies.Add(value)
@@ -241,6 +566,8 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 	// copy these over, we don't need any changes here.
 	c.Pipeline = raw.Pipeline
 	c.RemoteCacheOptions = raw.RemoteCacheOptions
+	c.Profiles = raw.Profiles
+	c.FrameworkEnvPrefixes = raw.FrameworkEnvPrefixes
 
 	return nil
 }
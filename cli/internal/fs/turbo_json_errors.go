@@ -0,0 +1,260 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var errUnknownKey = errors.New("unknown key")
+
+// keyError is a problem with the value of a key in the configFile. path holds the keys
+// leading to the value, from the root of the document.
+type keyError struct {
+	path []string
+	err  error
+}
+
+func (e *keyError) Error() string {
+	if len(e.path) == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%q: %v", strings.Join(e.path, "."), e.err)
+}
+
+func (e *keyError) Unwrap() error {
+	return e.err
+}
+
+// asKeyError converts a json type error in to a keyError for the field it was found at
+func asKeyError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		var path []string
+		if typeErr.Field != "" {
+			path = strings.Split(typeErr.Field, ".")
+		}
+		return &keyError{
+			path: path,
+			err:  fmt.Errorf("expected %v, got %v", typeErr.Type, typeErr.Value),
+		}
+	}
+	return err
+}
+
+// withKey records that err was found in the value of key. Errors that aren't about
+// a particular key, such as invalid env declarations, are returned unchanged.
+func withKey(key string, err error) error {
+	err = asKeyError(err)
+	var ke *keyError
+	if errors.As(err, &ke) {
+		return &keyError{path: append([]string{key}, ke.path...), err: ke.err}
+	}
+	return err
+}
+
+// checkKnownKeys returns an error for a key of the json object in data that doesn't
+// correspond to one of the fields of v, suggesting the field that was likely meant.
+// Keys are matched case-insensitively, like encoding/json does.
+func checkKnownKeys(data []byte, v interface{}) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// Let the caller report values that aren't objects
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	known := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if tag := t.Field(i).Tag.Get("json"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		known = append(known, name)
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		found := false
+		suggestion := ""
+		bestDistance := _maxSuggestionDistance + 1
+		for _, name := range known {
+			if strings.EqualFold(key, name) {
+				found = true
+				break
+			}
+			if distance := editDistance(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance {
+				suggestion = name
+				bestDistance = distance
+			}
+		}
+		if found {
+			continue
+		}
+		err := errUnknownKey
+		if suggestion != "" {
+			err = fmt.Errorf("%w, did you mean %q?", errUnknownKey, suggestion)
+		}
+		return &keyError{path: []string{key}, err: err}
+	}
+	return nil
+}
+
+// _maxSuggestionDistance is the largest number of edits between an unknown key and a known
+// one for the known key to be suggested as a typo fix
+const _maxSuggestionDistance = 2
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = substitution
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// positionError is an error found at a 1-based line and column of the configFile
+type positionError struct {
+	line   int
+	column int64
+	err    error
+}
+
+func (e *positionError) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.line, e.column, e.err)
+}
+
+func (e *positionError) Unwrap() error {
+	return e.err
+}
+
+// locateError finds the line and column in the configFile that err was found at,
+// if it can be located. data is the contents of the configFile.
+func locateError(data []byte, err error) error {
+	// Comments are blanked out rather than removed, so that offsets into the
+	// parsed json are also offsets into the configFile.
+	blanked := BlankComments(data)
+	var offset int64 = -1
+	var ke *keyError
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &ke) {
+		offset = findKeyOffset(blanked, ke.path)
+	} else {
+		// jsonc reports offsets into the document with comments and whitespace
+		// stripped, so parse again to find where the syntax error is.
+		var v interface{}
+		if parseErr := json.Unmarshal(blanked, &v); errors.As(parseErr, &syntaxErr) {
+			// The offset is just past the offending byte
+			offset = syntaxErr.Offset - 1
+			err = syntaxErr
+		}
+	}
+	if offset < 0 {
+		return err
+	}
+	return &positionError{
+		line:   1 + bytes.Count(data[:offset], []byte("\n")),
+		column: offset - int64(bytes.LastIndexByte(data[:offset], '\n')),
+		err:    err,
+	}
+}
+
+// findKeyOffset returns the offset of the deepest key along path that appears in data,
+// or -1 if the first key is not found
+func findKeyOffset(data []byte, path []string) int64 {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var offset int64 = -1
+	for _, key := range path {
+		if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+			return offset
+		}
+		found := false
+		for decoder.More() {
+			keyStart := decoder.InputOffset()
+			token, err := decoder.Token()
+			if err != nil {
+				return offset
+			}
+			if name, ok := token.(string); ok && strings.EqualFold(name, key) {
+				// The decoder's offset is after the previous value, so skip past
+				// the separator to the start of the key
+				offset = keyStart + int64(bytes.IndexByte(data[keyStart:], '"'))
+				found = true
+				break
+			}
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return offset
+			}
+		}
+		if !found {
+			return offset
+		}
+	}
+	return offset
+}
+
+// BlankComments replaces the comments in a jsonc document with spaces, keeping newlines
+// so that line numbers and offsets are unchanged
+func BlankComments(data []byte) []byte {
+	blanked := make([]byte, len(data))
+	copy(blanked, data)
+	inString := false
+	for i := 0; i < len(blanked); i++ {
+		ch := blanked[i]
+		if inString {
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case ch == '"':
+			inString = true
+		case ch == '#' || (ch == '/' && i+1 < len(blanked) && blanked[i+1] == '/'):
+			for ; i < len(blanked) && blanked[i] != '\n'; i++ {
+				blanked[i] = ' '
+			}
+		case ch == '/' && i+1 < len(blanked) && blanked[i+1] == '*':
+			end := bytes.Index(blanked[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(blanked)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if blanked[i] != '\n' {
+					blanked[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return blanked
+}
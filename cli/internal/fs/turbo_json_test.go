@@ -1,10 +1,16 @@
 package fs
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
@@ -30,18 +36,22 @@ func Test_ReadTurboConfig(t *testing.T) {
 	pipelineExpected := map[string]TaskDefinition{
 		"build": {
 			Outputs:                 []string{"dist/**", ".next/**"},
+			HasOutputs:              true,
 			TopologicalDependencies: []string{"build"},
 			EnvVarDependencies:      []string{},
 			TaskDependencies:        []string{},
 			ShouldCache:             true,
+			CacheScope:              CacheScopeBoth,
 			OutputMode:              util.NewTaskOutput,
 		},
 		"lint": {
 			Outputs:                 []string{},
+			HasOutputs:              true,
 			TopologicalDependencies: []string{},
 			EnvVarDependencies:      []string{"MY_VAR"},
 			TaskDependencies:        []string{},
 			ShouldCache:             true,
+			CacheScope:              CacheScopeBoth,
 			OutputMode:              util.NewTaskOutput,
 		},
 		"dev": {
@@ -50,14 +60,17 @@ func Test_ReadTurboConfig(t *testing.T) {
 			TopologicalDependencies: []string{},
 			TaskDependencies:        []string{},
 			ShouldCache:             false,
+			CacheScope:              CacheScopeNone,
 			OutputMode:              util.FullTaskOutput,
 		},
 		"publish": {
 			Outputs:                 []string{"dist/**"},
+			HasOutputs:              true,
 			EnvVarDependencies:      []string{},
 			TopologicalDependencies: []string{"publish"},
 			TaskDependencies:        []string{"build", "admin#lint"},
 			ShouldCache:             false,
+			CacheScope:              CacheScopeNone,
 			Inputs:                  []string{"build/**/*"},
 			OutputMode:              util.FullTaskOutput,
 		},
@@ -92,6 +105,7 @@ func Test_ReadTurboConfig_Legacy(t *testing.T) {
 			EnvVarDependencies:      []string{},
 			TaskDependencies:        []string{},
 			ShouldCache:             true,
+			CacheScope:              CacheScopeBoth,
 			OutputMode:              util.FullTaskOutput,
 		},
 	}
@@ -119,10 +133,12 @@ func Test_ReadTurboConfig_BothCorrectAndLegacy(t *testing.T) {
 	pipelineExpected := map[string]TaskDefinition{
 		"build": {
 			Outputs:                 []string{"dist/**", ".next/**"},
+			HasOutputs:              true,
 			TopologicalDependencies: []string{"build"},
 			EnvVarDependencies:      []string{},
 			TaskDependencies:        []string{},
 			ShouldCache:             true,
+			CacheScope:              CacheScopeBoth,
 			OutputMode:              util.NewTaskOutput,
 		},
 	}
@@ -216,7 +232,7 @@ func Test_ReadTurboConfig_EnvDeclarations(t *testing.T) {
 
 	// check global env vars also
 	assert.EqualValues(t, sortedArray([]string{"FOO", "BAR", "BAZ", "QUX"}), sortedArray(turboJSON.GlobalEnv))
-	assert.EqualValues(t, sortedArray([]string{"somefile.txt"}), sortedArray(turboJSON.GlobalDeps))
+	assert.EqualValues(t, sortedArray([]string{"somefile.txt", "${CONFIG_DIR}/shared.json"}), sortedArray(turboJSON.GlobalDeps))
 }
 
 // Helpers
@@ -262,3 +278,288 @@ func sortedArray(arr []string) []string {
 	sort.Strings(arr)
 	return arr
 }
+
+func Test_TaskDefinitionCacheScope(t *testing.T) {
+	testCases := []struct {
+		config      string
+		scope       CacheScope
+		shouldCache bool
+		wantErr     string
+	}{
+		{config: `{}`, scope: CacheScopeBoth, shouldCache: true},
+		{config: `{"cache": true}`, scope: CacheScopeBoth, shouldCache: true},
+		{config: `{"cache": false}`, scope: CacheScopeNone, shouldCache: false},
+		{config: `{"cache": "local"}`, scope: CacheScopeLocal, shouldCache: true},
+		{config: `{"cache": "remote"}`, scope: CacheScopeRemote, shouldCache: true},
+		{config: `{"cache": "none"}`, scope: CacheScopeNone, shouldCache: false},
+		{config: `{"cache": "readonly"}`, scope: CacheScopeReadOnly, shouldCache: true},
+		{config: `{"cache": "everywhere"}`, wantErr: "invalid value for \"cache\": \"everywhere\". Expected true, false, \"local\", \"remote\", \"both\", \"readonly\" or \"none\""},
+	}
+	for _, tc := range testCases {
+		var taskDefinition TaskDefinition
+		err := taskDefinition.UnmarshalJSON([]byte(tc.config))
+		if tc.wantErr != "" {
+			assert.EqualError(t, err, tc.wantErr, tc.config)
+			continue
+		}
+		assert.NoError(t, err, tc.config)
+		assert.Equal(t, tc.scope, taskDefinition.CacheScope, tc.config)
+		assert.Equal(t, tc.shouldCache, taskDefinition.ShouldCache, tc.config)
+	}
+
+	pipeline := Pipeline{
+		"build":       {CacheScope: CacheScopeBoth},
+		"native":      {CacheScope: CacheScopeLocal},
+		"also-native": {CacheScope: CacheScopeLocal},
+	}
+	assert.Equal(t, []CacheScope{CacheScopeLocal}, pipeline.RestrictedCacheScopes())
+}
+
+func Test_TaskDefinitionTimeout(t *testing.T) {
+	testCases := []struct {
+		config     string
+		timeout    time.Duration
+		hasTimeout bool
+		wantErr    string
+	}{
+		{config: `{}`},
+		{config: `{"timeout": "10m"}`, timeout: 10 * time.Minute, hasTimeout: true},
+		{config: `{"timeout": "0"}`, timeout: 0, hasTimeout: true},
+		{config: `{"timeout": "-1s"}`, wantErr: "invalid value for \"timeout\": \"-1s\". Expected a duration such as \"10m\""},
+		{config: `{"timeout": 600}`, wantErr: "invalid value for \"timeout\": 600. Expected a duration such as \"10m\""},
+	}
+	for _, tc := range testCases {
+		var taskDefinition TaskDefinition
+		err := taskDefinition.UnmarshalJSON([]byte(tc.config))
+		if tc.wantErr != "" {
+			assert.EqualError(t, err, tc.wantErr, tc.config)
+			continue
+		}
+		assert.NoError(t, err, tc.config)
+		assert.Equal(t, tc.timeout, taskDefinition.Timeout, tc.config)
+		assert.Equal(t, tc.hasTimeout, taskDefinition.HasTimeout, tc.config)
+	}
+
+	// The same definition must hash the same, however many times it is parsed
+	var first, second TaskDefinition
+	assert.NoError(t, first.UnmarshalJSON([]byte(`{"timeout": "10m"}`)))
+	assert.NoError(t, second.UnmarshalJSON([]byte(`{"timeout": "10m"}`)))
+	firstHash, err := HashObject(first)
+	assert.NoError(t, err)
+	secondHash, err := HashObject(second)
+	assert.NoError(t, err)
+	assert.Equal(t, firstHash, secondHash)
+}
+
+func Test_TaskDefinitionProdDependenciesOnly(t *testing.T) {
+	var taskDefinition TaskDefinition
+	err := taskDefinition.UnmarshalJSON([]byte(`{"dependsOn": ["^build"], "prodDependenciesOnly": true}`))
+	assert.NoError(t, err)
+	assert.True(t, taskDefinition.ProdDependenciesOnly)
+	assert.Equal(t, []string{"build"}, taskDefinition.TopologicalDependencies)
+
+	taskDefinition = TaskDefinition{}
+	err = taskDefinition.UnmarshalJSON([]byte(`{"dependsOn": ["^build"]}`))
+	assert.NoError(t, err)
+	assert.False(t, taskDefinition.ProdDependenciesOnly)
+}
+
+func Test_TaskDefinitionOutputExclusions(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	var taskDefinition TaskDefinition
+	assert.NoError(t, taskDefinition.UnmarshalJSON([]byte(`{"outputs": ["dist/**", "!dist/**/*.map"]}`)))
+	inclusions, exclusions := SplitOutputGlobs(taskDefinition.Outputs)
+	assert.Equal(t, []string{"dist/**"}, inclusions)
+	assert.Equal(t, []string{"dist/**/*.map"}, exclusions)
+	assert.Empty(t, logs.String())
+
+	assert.NoError(t, taskDefinition.UnmarshalJSON([]byte(`{"outputs": ["!dist/**/*.map"]}`)))
+	inclusions, exclusions = SplitOutputGlobs(taskDefinition.Outputs)
+	assert.Empty(t, inclusions)
+	assert.Equal(t, []string{"dist/**/*.map"}, exclusions)
+	assert.Contains(t, logs.String(), "[WARNING] The outputs !dist/**/*.map only exclude files")
+
+	// An empty list of outputs is a task without outputs, rather than one excluding them all
+	logs.Reset()
+	assert.NoError(t, taskDefinition.UnmarshalJSON([]byte(`{"outputs": []}`)))
+	assert.Empty(t, logs.String())
+}
+
+func Test_TaskDefinitionRepoRootOutputs(t *testing.T) {
+	var taskDefinition TaskDefinition
+	assert.NoError(t, taskDefinition.UnmarshalJSON([]byte(`{"outputs": ["dist/**", "//dist/web/**", "!//dist/web/**/*.map"]}`)))
+	inclusions, exclusions := SplitOutputGlobs(taskDefinition.Outputs)
+	pkgDir := filepath.Join("apps", "web")
+	assert.Equal(t, filepath.Join("apps", "web", "dist", "**"), RepoRelativeOutputGlob(pkgDir, inclusions[0]))
+	assert.Equal(t, filepath.Join("dist", "web", "**"), RepoRelativeOutputGlob(pkgDir, inclusions[1]))
+	assert.Equal(t, filepath.Join("dist", "web", "**", "*.map"), RepoRelativeOutputGlob(pkgDir, exclusions[0]))
+
+	for _, output := range []string{"//../dist/**", "//dist/../../**", "!//..", "///dist/**", "//", "//."} {
+		err := taskDefinition.UnmarshalJSON([]byte(fmt.Sprintf(`{"outputs": [%q]}`, output)))
+		assert.ErrorContains(t, err, fmt.Sprintf("invalid output %q", output))
+	}
+}
+
+func Test_FindTaskDependencyCycle(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pipeline Pipeline
+		want     []string
+	}{
+		{
+			name: "no cycle",
+			pipeline: Pipeline{
+				"build":   {TopologicalDependencies: []string{"build"}, TaskDependencies: []string{"codegen"}},
+				"test":    {TaskDependencies: []string{"build", "missing"}},
+				"codegen": {},
+			},
+			want: nil,
+		},
+		{
+			name: "self reference",
+			pipeline: Pipeline{
+				"build": {TaskDependencies: []string{"build"}},
+			},
+			want: []string{"build", "build"},
+		},
+		{
+			name: "indirect cycle",
+			pipeline: Pipeline{
+				"build":   {TaskDependencies: []string{"codegen"}},
+				"codegen": {TaskDependencies: []string{"lint"}},
+				"lint":    {TaskDependencies: []string{"build"}},
+				"test":    {TaskDependencies: []string{"build"}},
+			},
+			want: []string{"build", "codegen", "lint", "build"},
+		},
+		{
+			name: "package task resolves bare names within its package",
+			pipeline: Pipeline{
+				"web#build": {TaskDependencies: []string{"lint"}},
+				"web#lint":  {TaskDependencies: []string{"web#build"}},
+				"lint":      {},
+			},
+			want: []string{"web#build", "web#lint", "web#build"},
+		},
+		{
+			name: "package task dependency without its own key is skipped",
+			pipeline: Pipeline{
+				"build": {TaskDependencies: []string{"docs#build"}},
+			},
+			want: nil,
+		},
+		{
+			name: "package task dependency with its own key",
+			pipeline: Pipeline{
+				"build":        {TaskDependencies: []string{"docs#build"}},
+				"docs#build":   {TaskDependencies: []string{"docs#codegen"}},
+				"docs#codegen": {TaskDependencies: []string{"docs#build"}},
+			},
+			want: []string{"docs#build", "docs#codegen", "docs#build"},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, tc.pipeline.FindTaskDependencyCycle(), tc.name)
+	}
+}
+
+func Test_ReadStrictTurboConfig(t *testing.T) {
+	for _, fixture := range []string{"legacy-only", "both"} {
+		testDir := getTestDir(t, fixture)
+		rootPackageJSON, err := ReadPackageJSON(testDir.Join("package.json"))
+		if err != nil {
+			t.Fatalf("invalid parse: %#v", err)
+		}
+
+		_, err = ReadStrictTurboConfig(testDir, rootPackageJSON)
+		assert.ErrorContains(t, err, "package.json", fixture)
+	}
+
+	testDir := getTestDir(t, "correct")
+	rootPackageJSON, err := ReadPackageJSON(testDir.Join("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	_, err = ReadStrictTurboConfig(testDir, rootPackageJSON)
+	assert.NoError(t, err)
+}
+
+func Test_ReadTurboConfigErrorPositions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "trailing comma",
+			config: `{
+  "pipeline": {
+    "build": {
+      "outputs": ["dist/**"],
+    }
+  }
+}`,
+			wantErr: "turbo.json:5:5: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			name: "unknown key",
+			config: `{
+  // the pipeline
+  "pipeline": {
+    "build": {
+      "outptus": ["dist/**"]
+    }
+  }
+}`,
+			wantErr: "turbo.json:5:7: \"pipeline.build.outptus\": unknown key, did you mean \"outputs\"?",
+		},
+		{
+			name: "wrong-typed outputs",
+			config: `{
+  "$schema": "https://turborepo.org/schema.json",
+  "pipeline": {
+    "build": {},
+    "test": { "outputs": "coverage/**" }
+  }
+}`,
+			wantErr: "turbo.json:5:15: \"pipeline.test.outputs\": expected []string, got string",
+		},
+	}
+	for _, tc := range testCases {
+		testDir := AbsolutePathFromUpstream(t.TempDir())
+		assert.NoError(t, testDir.Join(configFile).WriteFile([]byte(tc.config), 0644), tc.name)
+
+		_, err := ReadTurboConfig(testDir, &PackageJSON{})
+		assert.EqualError(t, err, tc.wantErr, tc.name)
+	}
+}
+
+func Test_TaskDefinitionUnknownKeys(t *testing.T) {
+	testCases := []struct {
+		config  string
+		wantErr string
+	}{
+		{config: `{"output": ["dist/**"]}`, wantErr: "\"output\": unknown key, did you mean \"outputs\"?"},
+		{config: `{"dependOn": ["^build"]}`, wantErr: "\"dependOn\": unknown key, did you mean \"dependsOn\"?"},
+		{config: `{"input": ["src/**"]}`, wantErr: "\"input\": unknown key, did you mean \"inputs\"?"},
+		{config: `{"outputs": [], "outputmode": "full"}`, wantErr: ""},
+		{config: `{"persistent": true}`, wantErr: "\"persistent\": unknown key"},
+	}
+	for _, tc := range testCases {
+		var taskDefinition TaskDefinition
+		err := taskDefinition.UnmarshalJSON([]byte(tc.config))
+		if tc.wantErr == "" {
+			assert.NoError(t, err, tc.config)
+			continue
+		}
+		assert.EqualError(t, err, tc.wantErr, tc.config)
+		assert.ErrorIs(t, err, errUnknownKey, tc.config)
+	}
+
+	var pipeline Pipeline
+	err := json.Unmarshal([]byte(`{"build": {"outputs": []}, "test": {"cahce": false}}`), &pipeline)
+	assert.EqualError(t, err, "\"pipeline.test.cahce\": unknown key, did you mean \"cache\"?")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/fatih/color"
@@ -44,6 +45,38 @@ func (g *GraphVisualizer) generateDotString() string {
 	}))
 }
 
+// generateMermaidString converts the TaskGraph dag into a mermaid flowchart. Task ids contain
+// characters that mermaid doesn't allow in node ids, so nodes get generated ids and are
+// labelled with the task id.
+func (g *GraphVisualizer) generateMermaidString() string {
+	names := make([]string, 0, len(g.TaskGraph.Vertices()))
+	for _, v := range g.TaskGraph.Vertices() {
+		names = append(names, dag.VertexName(v))
+	}
+	sort.Strings(names)
+	nodeIDs := make(map[string]string, len(names))
+	for i, name := range names {
+		nodeIDs[name] = fmt.Sprintf("T%v", i)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("\t%v(\"%v\")\n", nodeIDs[name], strings.ReplaceAll(name, `"`, "#quot;")))
+	}
+	for _, name := range names {
+		deps := []string{}
+		for _, dep := range g.TaskGraph.DownEdges(name) {
+			deps = append(deps, dag.VertexName(dep))
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			sb.WriteString(fmt.Sprintf("\t%v --> %v\n", nodeIDs[name], nodeIDs[dep]))
+		}
+	}
+	return sb.String()
+}
+
 // Outputs a warning when a file was requested, but graphviz is not available
 func (g *GraphVisualizer) graphVizWarnUI() {
 	g.ui.Warn(color.New(color.FgYellow, color.Bold, color.ReverseVideo).Sprint(" WARNING ") + color.YellowString(" `turbo` uses Graphviz to generate an image of your\ngraph, but Graphviz isn't installed on this machine.\n\nYou can download Graphviz from https://graphviz.org/download.\n\nIn the meantime, you can use this string output with an\nonline Dot graph viewer."))
@@ -55,6 +88,12 @@ func (g *GraphVisualizer) RenderDotGraph() {
 	g.ui.Output(g.generateDotString())
 }
 
+// RenderMermaidGraph renders a mermaid graph string for the current TaskGraph
+func (g *GraphVisualizer) RenderMermaidGraph() {
+	g.ui.Output("")
+	g.ui.Output(g.generateMermaidString())
+}
+
 // GenerateGraphFile saves a visualization of the TaskGraph to a file (or renders a DotGraph as a fallback))
 func (g *GraphVisualizer) GenerateGraphFile(outputName string) error {
 	graphString := g.generateDotString()
@@ -65,6 +104,14 @@ func (g *GraphVisualizer) GenerateGraphFile(outputName string) error {
 		ext = ".jpg"
 		outputFilename = g.repoRoot.Join(outputName + ext)
 	}
+	if ext == ".mmd" || ext == ".mermaid" {
+		if err := outputFilename.WriteFile([]byte(g.generateMermaidString()), 0644); err != nil {
+			return fmt.Errorf("error writing graph contents: %w", err)
+		}
+		g.ui.Output("")
+		g.ui.Output(fmt.Sprintf("✔ Generated task graph in %s", ui.Bold(outputFilename.ToString())))
+		return nil
+	}
 	if ext == ".html" {
 		f, err := outputFilename.Create()
 		if err != nil {
@@ -85,7 +132,7 @@ func (g *GraphVisualizer) GenerateGraphFile(outputName string) error {
 			return fmt.Errorf("error writing graph contents: %w", writeErr1)
 		}
 
-		_, writeErr2 := f.WriteString("const s = `" + graphString + "`.replace(/\\_\\_\\_ROOT\\_\\_\\_/g, \"Root\").replace(/\\[root\\]/g, \"\");new Viz().renderSVGElement(s).then(el => document.body.appendChild(el)).catch(e => console.error(e));")
+		_, writeErr2 := f.WriteString("const s = `" + graphString + "`.replace(/\\[root\\]/g, \"\");new Viz().renderSVGElement(s).then(el => document.body.appendChild(el)).catch(e => console.error(e));")
 		if writeErr2 != nil {
 			return fmt.Errorf("error creating file: %w", writeErr2)
 		}
@@ -0,0 +1,60 @@
+package graphvisualizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pyr-sh/dag"
+	"github.com/vercel/turborepo/cli/internal/core"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+func Test_generateMermaidString(t *testing.T) {
+	graph := &dag.AcyclicGraph{}
+	graph.Add("web#build")
+	graph.Add("ui#build")
+	graph.Connect(dag.BasicEdge("web#build", "ui#build"))
+
+	g := &GraphVisualizer{TaskGraph: graph}
+	expected := "graph TD\n" +
+		"\tT0(\"ui#build\")\n" +
+		"\tT1(\"web#build\")\n" +
+		"\tT1 --> T0\n"
+	if got := g.generateMermaidString(); got != expected {
+		t.Errorf("generateMermaidString() got\n%v\nwant\n%v", got, expected)
+	}
+}
+
+func Test_noRootNode(t *testing.T) {
+	topoGraph := &dag.AcyclicGraph{}
+	topoGraph.Add("web")
+	topoGraph.Add("ui")
+	topoGraph.Connect(dag.BasicEdge("web", "ui"))
+
+	engine := core.NewScheduler(topoGraph)
+	topoDeps := make(util.Set)
+	topoDeps.Add("build")
+	engine.AddTask(&core.Task{
+		Name:     "build",
+		TopoDeps: topoDeps,
+	})
+	if err := engine.Prepare(&core.SchedulerExecutionOptions{
+		Packages:  []string{"web", "ui"},
+		TaskNames: []string{"build"},
+	}); err != nil {
+		t.Fatalf("failed to prepare task graph: %v", err)
+	}
+
+	g := New("", nil, engine.TaskGraphWithoutRoot())
+	for name, output := range map[string]string{
+		"dot":     g.generateDotString(),
+		"mermaid": g.generateMermaidString(),
+	} {
+		if strings.Contains(output, core.ROOT_NODE_NAME) {
+			t.Errorf("expected no %v node in %v output, got\n%v", core.ROOT_NODE_NAME, name, output)
+		}
+		if !strings.Contains(output, "ui#build") || !strings.Contains(output, "web#build") {
+			t.Errorf("expected both tasks in %v output, got\n%v", name, output)
+		}
+	}
+}
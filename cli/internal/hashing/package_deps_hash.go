@@ -4,17 +4,22 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"log"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
+	gitignore "github.com/sabhiram/go-gitignore"
+	"github.com/vercel/turborepo/cli/internal/doublestar"
 	"github.com/vercel/turborepo/cli/internal/encoding/gitoutput"
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/globby"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"github.com/vercel/turborepo/cli/internal/util"
+	"golang.org/x/sync/errgroup"
 )
 
 // PackageDepsOptions are parameters for getting git hashes for a filesystem
@@ -24,10 +29,43 @@ type PackageDepsOptions struct {
 	PackagePath turbopath.AnchoredSystemPath
 
 	InputPatterns []string
+
+	// DefaultInputs controls which files are hashed when InputPatterns is empty.
+	// If omitted, DefaultInputsAll is used.
+	DefaultInputs DefaultInputs
+
+	// UseRepoTree takes the files checked in to the package from a single `git ls-tree` of the
+	// whole repository, shared between packages, rather than running it in each package.
+	// It has no effect when InputPatterns are given.
+	UseRepoTree bool
+
+	// NoGit hashes the contents of the files in the package directly, rather than asking git,
+	// for when the repository isn't a git checkout. Only the .gitignore files in the root of
+	// the repository and of the package are respected, and DefaultInputs has no effect.
+	NoGit bool
 }
 
+// DefaultInputs is a policy for which files in a package are hashed when no inputs are declared
+type DefaultInputs string
+
+const (
+	// DefaultInputsAll hashes every file in the package that isn't ignored by git, including untracked files
+	DefaultInputsAll DefaultInputs = "all"
+	// DefaultInputsTracked hashes only the files in the package that are tracked by git
+	DefaultInputsTracked DefaultInputs = "tracked"
+)
+
 // GetPackageDeps Builds an object containing git hashes for the files under the specified `packagePath` folder.
 func GetPackageDeps(rootPath turbopath.AbsolutePath, p *PackageDepsOptions) (map[turbopath.AnchoredUnixPath]string, error) {
+	if p.NoGit {
+		return manuallyHashPackage(rootPath, p)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		_gitUnavailableWarning.Do(func() {
+			log.Printf("[WARNING] git was not found, so the contents of package files are hashed instead: %v", err)
+		})
+		return manuallyHashPackage(rootPath, p)
+	}
 	pkgPath := rootPath.Join(p.PackagePath.ToStringDuringMigration())
 	// Add all the checked in hashes.
 	var result map[turbopath.AnchoredUnixPath]string
@@ -36,7 +74,13 @@ func GetPackageDeps(rootPath turbopath.AbsolutePath, p *PackageDepsOptions) (map
 	calculatedInputs := make([]string, len(p.InputPatterns))
 	copy(calculatedInputs, p.InputPatterns)
 
-	if len(calculatedInputs) == 0 {
+	if len(calculatedInputs) == 0 && p.UseRepoTree {
+		repoLsTreeOutput, err := memoizedGitLsTree(rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not get git hashes for files in package %s: %w", p.PackagePath, err)
+		}
+		result = slicePackageTree(repoLsTreeOutput, p.PackagePath)
+	} else if len(calculatedInputs) == 0 {
 		gitLsTreeOutput, err := gitLsTree(pkgPath)
 		if err != nil {
 			return nil, fmt.Errorf("could not get git hashes for files in package %s: %w", p.PackagePath, err)
@@ -93,8 +137,12 @@ func GetPackageDeps(rootPath turbopath.AbsolutePath, p *PackageDepsOptions) (map
 		return nil, fmt.Errorf("Could not get git hashes from git status: %v", err)
 	}
 
+	skipUntracked := len(p.InputPatterns) == 0 && p.DefaultInputs == DefaultInputsTracked
 	var filesToHash []turbopath.AnchoredSystemPath
 	for filePath, status := range gitStatusOutput {
+		if skipUntracked && status.isUntracked() {
+			continue
+		}
 		if status.isDelete() {
 			delete(result, filePath)
 		} else {
@@ -115,6 +163,80 @@ func GetPackageDeps(rootPath turbopath.AbsolutePath, p *PackageDepsOptions) (map
 	return result, nil
 }
 
+// _gitUnavailableWarning makes sure that a missing git is only warned about once per run
+var _gitUnavailableWarning sync.Once
+
+func safeCompileIgnoreFile(filepath string) (*gitignore.GitIgnore, error) {
+	if fs.FileExists(filepath) {
+		return gitignore.CompileIgnoreFile(filepath)
+	}
+	// no op
+	return gitignore.CompileIgnoreLines([]string{}...), nil
+}
+
+// manuallyHashPackage hashes the files in the package by walking its directory, without git.
+// Instead of implementing all of gitignore, we only respect .gitignore in the root and in the
+// directory of the package.
+func manuallyHashPackage(rootPath turbopath.AbsolutePath, p *PackageDepsOptions) (map[turbopath.AnchoredUnixPath]string, error) {
+	hashObject := make(map[turbopath.AnchoredUnixPath]string)
+	ignore, err := safeCompileIgnoreFile(rootPath.Join(".gitignore").ToString())
+	if err != nil {
+		return nil, err
+	}
+
+	ignorePkg, err := safeCompileIgnoreFile(rootPath.Join(p.PackagePath.ToStringDuringMigration(), ".gitignore").ToString())
+	if err != nil {
+		return nil, err
+	}
+
+	includePattern := ""
+	if len(p.InputPatterns) > 0 {
+		// As with git, package.json is always hashed so that changes to its scripts are a cache miss
+		inputs := append([]string{"package.json"}, p.InputPatterns...)
+		includePattern = "{" + strings.Join(inputs, ",") + "}"
+	}
+
+	rootPathPrefix := turbopath.AbsoluteSystemPathFromUpstream(rootPath.ToString())
+	pathPrefix := rootPath.Join(p.PackagePath.ToStringDuringMigration()).ToString()
+	convertedPathPrefix := turbopath.AbsoluteSystemPathFromUpstream(pathPrefix)
+	err = fs.Walk(pathPrefix, func(name string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		convertedName := turbopath.AbsoluteSystemPathFromUpstream(name)
+		repoRelativePath, err := convertedName.RelativeTo(rootPathPrefix)
+		if err != nil {
+			return fmt.Errorf("File path cannot be made relative: %w", err)
+		}
+		relativePath, err := convertedName.RelativeTo(convertedPathPrefix)
+		if err != nil {
+			return fmt.Errorf("File path cannot be made relative: %w", err)
+		}
+		if ignore.MatchesPath(repoRelativePath.ToUnixPath().ToString()) || ignorePkg.MatchesPath(relativePath.ToUnixPath().ToString()) {
+			return nil
+		}
+		if includePattern != "" {
+			val, err := doublestar.PathMatch(includePattern, relativePath.ToString())
+			if err != nil {
+				return err
+			}
+			if !val {
+				return nil
+			}
+		}
+		hash, err := fs.GitLikeHashFile(convertedName.ToString())
+		if err != nil {
+			return fmt.Errorf("could not hash file %v. \n%w", convertedName.ToString(), err)
+		}
+		hashObject[relativePath.ToUnixPath()] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashObject, nil
+}
+
 func manuallyHashFiles(rootPath turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath) (map[turbopath.AnchoredUnixPath]string, error) {
 	hashObject := make(map[turbopath.AnchoredUnixPath]string)
 	for _, file := range files {
@@ -128,9 +250,18 @@ func manuallyHashFiles(rootPath turbopath.AbsoluteSystemPath, files []turbopath.
 	return hashObject, nil
 }
 
+// _hashableDepsMinChunkSize is the fewest files a `git hash-object` process is started for
+// when GetHashableDeps splits up the files between workers
+const _hashableDepsMinChunkSize = 500
+
+// _hashWorkerLimit bounds the number of workers hashing files at once, since hashing is
+// CPU-bound and starting more processes than there are CPUs only adds overhead
+var _hashWorkerLimit = runtime.NumCPU()
+
 // GetHashableDeps hashes the list of given files, then returns a map of normalized path to hash
-// this map is suitable for cross-platform caching.
-func GetHashableDeps(rootPath turbopath.AbsolutePath, files []turbopath.AbsoluteSystemPath) (map[turbopath.AnchoredUnixPath]string, error) {
+// this map is suitable for cross-platform caching. Large lists are split between up to
+// workerCount concurrent workers.
+func GetHashableDeps(rootPath turbopath.AbsolutePath, files []turbopath.AbsoluteSystemPath, workerCount int) (map[turbopath.AnchoredUnixPath]string, error) {
 	output := make([]turbopath.AnchoredSystemPath, len(files))
 	convertedRootPath := turbopath.AbsoluteSystemPathFromUpstream(rootPath.ToString())
 
@@ -141,15 +272,56 @@ func GetHashableDeps(rootPath turbopath.AbsolutePath, files []turbopath.Absolute
 		}
 		output[index] = anchoredSystemPath
 	}
-	hashObject, err := gitHashObject(convertedRootPath, output)
+
+	if workerCount > _hashWorkerLimit {
+		workerCount = _hashWorkerLimit
+	}
+	if workerCount <= 1 || len(output) <= _hashableDepsMinChunkSize {
+		return hashFiles(convertedRootPath, output)
+	}
+	// One chunk per worker, so that each starts a single process
+	chunkSize := (len(output) + workerCount - 1) / workerCount
+	if chunkSize < _hashableDepsMinChunkSize {
+		chunkSize = _hashableDepsMinChunkSize
+	}
+	hashObject := make(map[turbopath.AnchoredUnixPath]string, len(output))
+	mu := sync.Mutex{}
+	hashErrs := &errgroup.Group{}
+	for start := 0; start < len(output); start += chunkSize {
+		end := start + chunkSize
+		if end > len(output) {
+			end = len(output)
+		}
+		chunk := output[start:end]
+		hashErrs.Go(func() error {
+			chunkHashes, err := hashFiles(convertedRootPath, chunk)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for path, hash := range chunkHashes {
+				hashObject[path] = hash
+			}
+			return nil
+		})
+	}
+	if err := hashErrs.Wait(); err != nil {
+		return nil, err
+	}
+	return hashObject, nil
+}
+
+// hashFiles hashes the given files with git, falling back to hashing them manually
+func hashFiles(rootPath turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath) (map[turbopath.AnchoredUnixPath]string, error) {
+	hashObject, err := gitHashObject(rootPath, files)
 	if err != nil {
-		manuallyHashedObject, err := manuallyHashFiles(convertedRootPath, output)
+		manuallyHashedObject, err := manuallyHashFiles(rootPath, files)
 		if err != nil {
 			return nil, err
 		}
 		hashObject = manuallyHashedObject
 	}
-
 	return hashObject, nil
 }
 
@@ -324,6 +496,51 @@ func gitLsTree(rootPath turbopath.AbsolutePath) (map[turbopath.AnchoredUnixPath]
 	return output, nil
 }
 
+// Packages without inputs share the same `git ls-tree` of the repository, so only run it once.
+func memoizeGitLsTree() func(turbopath.AbsolutePath) (map[turbopath.AnchoredUnixPath]string, error) {
+	cacheMutex := &sync.Mutex{}
+	cachedResult := map[turbopath.AbsolutePath]map[turbopath.AnchoredUnixPath]string{}
+	cachedError := map[turbopath.AbsolutePath]error{}
+
+	return func(rootPath turbopath.AbsolutePath) (map[turbopath.AnchoredUnixPath]string, error) {
+		// Hold the lock while listing, so that packages hashed concurrently wait for the
+		// first listing rather than each starting their own.
+		cacheMutex.Lock()
+		defer cacheMutex.Unlock()
+		if result, ok := cachedResult[rootPath]; ok {
+			return result, cachedError[rootPath]
+		}
+
+		invokedResult, invokedErr := gitLsTree(rootPath)
+		cachedResult[rootPath] = invokedResult
+		cachedError[rootPath] = invokedErr
+
+		return invokedResult, invokedErr
+	}
+}
+
+var memoizedGitLsTree = memoizeGitLsTree()
+
+// slicePackageTree picks the files under the package out of a `git ls-tree` of the repository,
+// anchoring them at the package directory like running `git ls-tree` in the package would.
+func slicePackageTree(repoTree map[turbopath.AnchoredUnixPath]string, packagePath turbopath.AnchoredSystemPath) map[turbopath.AnchoredUnixPath]string {
+	prefix := packagePath.ToUnixPath().ToString()
+	result := make(map[turbopath.AnchoredUnixPath]string)
+	if prefix == "" || prefix == "." {
+		for filePath, hash := range repoTree {
+			result[filePath] = hash
+		}
+		return result
+	}
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	for filePath, hash := range repoTree {
+		if relativePath := strings.TrimPrefix(filePath.ToString(), prefix); relativePath != filePath.ToString() {
+			result[turbopath.AnchoredUnixPathFromUpstream(relativePath)] = hash
+		}
+	}
+	return result
+}
+
 // getTraversePath gets the distance of the current working directory to the repository root.
 // This is used to convert repo-relative paths to cwd-relative paths.
 //
@@ -383,6 +600,10 @@ func (s statusCode) isDelete() bool {
 	return s.x == "D" || s.y == "D"
 }
 
+func (s statusCode) isUntracked() bool {
+	return s.x == "?"
+}
+
 // gitStatus returns a map of paths to their `git` status code. This can be used to identify what should
 // be done with files that do not currently match what is in the index.
 //
@@ -302,6 +302,30 @@ func TestGetPackageDeps(t *testing.T) {
 				"dir/nested-file":  "bfe53d766e64d78f80050b73cd1c88095bc70abb",
 			},
 		},
+		// when only tracked files are hashed by default, untracked files are excluded
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				DefaultInputs: DefaultInputsTracked,
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"committed-file":  "3a29e62ea9ba15c4a4009d1f605d391cdd262033",
+				"package.json":    "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+				"dir/nested-file": "bfe53d766e64d78f80050b73cd1c88095bc70abb",
+			},
+		},
+		// the default inputs policy doesn't apply to explicit inputs
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				InputPatterns: []string{"uncommitted-file"},
+				DefaultInputs: DefaultInputsTracked,
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"package.json":     "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+				"uncommitted-file": "4e56ad89387e6379e4e91ddfe9872cf6a72c9976",
+			},
+		},
 		// with inputs, only the specified inputs are hashed
 		{
 			opts: &PackageDepsOptions{
@@ -384,3 +408,272 @@ func Test_memoizedGetTraversePath(t *testing.T) {
 
 	assert.Check(t, gotOne == gotTwo, "The strings are identical.")
 }
+
+func TestGetPackageDepsUseRepoTree(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	files := map[string]string{
+		"package.json":               "{}",
+		"root-file":                  "root",
+		"pkg/package.json":           "{}",
+		"pkg/src/index.js":           "index",
+		"pkg-two/package.json":       "{}",
+		"pkg-two/file":               "a package sharing a prefix with pkg",
+		"nested/pkg/package.json":    "{}",
+		"nested/pkg/dir/nested-file": "nested",
+	}
+	for name, contents := range files {
+		path := repoRoot.Join(filepath.FromSlash(name))
+		assert.NilError(t, path.EnsureDir(), "EnsureDir")
+		assert.NilError(t, path.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	requireGitCmd(t, repoRoot, "init", ".")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.name", "test")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.email", "test@example.com")
+	requireGitCmd(t, repoRoot, "add", ".")
+	requireGitCmd(t, repoRoot, "commit", "-m", "foo")
+
+	// The working tree differs from HEAD, so the status still has to be applied to the slice
+	assert.NilError(t, repoRoot.Join("pkg", "src", "index.js").Remove(), "Remove")
+	assert.NilError(t, repoRoot.Join("pkg", "untracked-file").WriteFile([]byte("untracked"), 0644), "WriteFile")
+
+	for _, packagePath := range []turbopath.AnchoredSystemPath{"", "pkg", "pkg-two", turbopath.AnchoredSystemPath(filepath.Join("nested", "pkg"))} {
+		for _, defaultInputs := range []DefaultInputs{DefaultInputsAll, DefaultInputsTracked} {
+			want, err := GetPackageDeps(repoRoot, &PackageDepsOptions{PackagePath: packagePath, DefaultInputs: defaultInputs})
+			assert.NilError(t, err, "GetPackageDeps")
+			got, err := GetPackageDeps(repoRoot, &PackageDepsOptions{PackagePath: packagePath, DefaultInputs: defaultInputs, UseRepoTree: true})
+			assert.NilError(t, err, "GetPackageDeps with UseRepoTree")
+			assert.DeepEqual(t, got, want)
+		}
+	}
+}
+
+// writeHashableFiles writes count files, each with distinct contents, under a new directory
+func writeHashableFiles(tb testing.TB, count int) (turbopath.AbsolutePath, []turbopath.AbsoluteSystemPath) {
+	tb.Helper()
+	rootPath := fs.AbsolutePathFromUpstream(tb.TempDir())
+	files := make([]turbopath.AbsoluteSystemPath, count)
+	for i := 0; i < count; i++ {
+		dir := rootPath.Join(fmt.Sprintf("dir%v", i%10))
+		if err := dir.MkdirAll(); err != nil {
+			tb.Fatalf("failed to create %v: %v", dir, err)
+		}
+		file := dir.Join(fmt.Sprintf("file%v.txt", i))
+		if err := file.WriteFile([]byte(fmt.Sprintf("contents %v", i)), 0644); err != nil {
+			tb.Fatalf("failed to write %v: %v", file, err)
+		}
+		files[i] = turbopath.AbsoluteSystemPathFromUpstream(file.ToString())
+	}
+	return rootPath, files
+}
+
+func TestGetHashableDepsConcurrency(t *testing.T) {
+	// Pin the worker limit so that the files are split between several workers no matter
+	// how many CPUs the machine running the test has
+	defer func(limit int) { _hashWorkerLimit = limit }(_hashWorkerLimit)
+	_hashWorkerLimit = 4
+	rootPath, files := writeHashableFiles(t, 3*_hashableDepsMinChunkSize+7)
+	serial, err := GetHashableDeps(rootPath, files, 1)
+	if err != nil {
+		t.Fatalf("GetHashableDeps: %v", err)
+	}
+	if len(serial) != len(files) {
+		t.Errorf("got %v hashes, want one for each of %v files", len(serial), len(files))
+	}
+	concurrent, err := GetHashableDeps(rootPath, files, 4)
+	if err != nil {
+		t.Fatalf("GetHashableDeps: %v", err)
+	}
+	if !reflect.DeepEqual(serial, concurrent) {
+		t.Errorf("expected hashing files concurrently not to change their hashes")
+	}
+}
+
+// BenchmarkGetHashableDeps compares hashing files serially and concurrently. Workers are
+// capped at the number of CPUs, so the two only differ on machines with more than one.
+func BenchmarkGetHashableDeps(b *testing.B) {
+	rootPath, files := writeHashableFiles(b, 5000)
+	for _, workerCount := range []int{1, 10} {
+		b.Run(fmt.Sprintf("workers=%v", workerCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := GetHashableDeps(rootPath, files, workerCount); err != nil {
+					b.Fatalf("GetHashableDeps: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_manuallyHashPackage(t *testing.T) {
+	rootIgnore := strings.Join([]string{
+		"ignoreme",
+		"ignorethisdir/",
+	}, "\n")
+	pkgIgnore := strings.Join([]string{
+		"pkgignoreme",
+		"pkgignorethisdir/",
+	}, "\n")
+	root, err := os.MkdirTemp("", "turbo-manual-file-hashing-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	repoRoot := turbopath.AbsoluteSystemPathFromUpstream(root)
+	pkgName := turbopath.AnchoredSystemPath("libA")
+	type fileHash struct {
+		contents string
+		hash     string
+	}
+	files := map[turbopath.AnchoredUnixPath]fileHash{
+		"top-level-file":              {"top-level-file-contents", ""},
+		"other-dir/other-dir-file":    {"other-dir-file-contents", ""},
+		"ignoreme":                    {"anything", ""},
+		"libA/some-file":              {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
+		"libA/some-dir/other-file":    {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
+		"libA/some-dir/another-one":   {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
+		"libA/ignoreme":               {"anything", ""},
+		"libA/ignorethisdir/anything": {"anything", ""},
+		"libA/pkgignoreme":            {"anything", ""},
+		"libA/pkgignorethisdir/file":  {"anything", ""},
+	}
+
+	rootIgnoreFile, err := os.Create(repoRoot.Join(".gitignore").ToString())
+	if err != nil {
+		t.Fatalf("failed to create .gitignore: %v", err)
+	}
+	_, err = rootIgnoreFile.WriteString(rootIgnore)
+	if err != nil {
+		t.Fatalf("failed to write contents to .gitignore: %v", err)
+	}
+	rootIgnoreFile.Close()
+	pkgIgnoreFilename := pkgName.RestoreAnchor(repoRoot).Join(".gitignore")
+	err = fs.EnsureDir(pkgIgnoreFilename.ToString())
+	if err != nil {
+		t.Fatalf("failed to ensure directories for %v: %v", pkgIgnoreFilename, err)
+	}
+	pkgIgnoreFile, err := os.Create(pkgIgnoreFilename.ToString())
+	if err != nil {
+		t.Fatalf("failed to create libA/.gitignore: %v", err)
+	}
+	_, err = pkgIgnoreFile.WriteString(pkgIgnore)
+	if err != nil {
+		t.Fatalf("failed to write contents to libA/.gitignore: %v", err)
+	}
+	pkgIgnoreFile.Close()
+	for path, spec := range files {
+		filename := path.ToSystemPath().RestoreAnchor(repoRoot)
+		err = fs.EnsureDir(filename.ToString())
+		if err != nil {
+			t.Fatalf("failed to ensure directories for %v: %v", filename, err)
+		}
+		f, err := os.Create(filename.ToString())
+		if err != nil {
+			t.Fatalf("failed to create file: %v: %v", filename, err)
+		}
+		_, err = f.WriteString(spec.contents)
+		if err != nil {
+			t.Fatalf("failed to write contents to %v: %v", filename, err)
+		}
+		f.Close()
+	}
+	// now that we've created the repo, expect our .gitignore file too
+	files[turbopath.AnchoredUnixPath("libA/.gitignore")] = fileHash{contents: "", hash: "3237694bc3312ded18386964a855074af7b066af"}
+
+	hashes, err := manuallyHashPackage(turbopath.AbsolutePath(repoRoot.ToString()), &PackageDepsOptions{PackagePath: pkgName})
+	if err != nil {
+		t.Fatalf("failed to calculate manual hashes: %v", err)
+	}
+	prefix := pkgName + "/"
+	prefixLen := len(prefix)
+	count := 0
+	for path, spec := range files {
+		if strings.HasPrefix(path.ToString(), prefix.ToString()) {
+			got, ok := hashes[turbopath.AnchoredUnixPath(path[prefixLen:])]
+			if !ok {
+				if spec.hash != "" {
+					t.Errorf("did not find hash for %v, but wanted one %v", path, prefixLen)
+				}
+			} else if got != spec.hash {
+				t.Errorf("hash of %v, got %v want %v", path, got, spec.hash)
+			} else {
+				count++
+			}
+		}
+	}
+	if count != len(hashes) {
+		t.Errorf("found extra hashes in %v", hashes)
+	}
+
+	count = 0
+	justFileHashes, err := manuallyHashPackage(turbopath.AbsolutePath(repoRoot.ToString()), &PackageDepsOptions{PackagePath: pkgName, InputPatterns: []string{filepath.FromSlash("**/*file")}})
+	if err != nil {
+		t.Fatalf("failed to calculate manual hashes: %v", err)
+	}
+	for path, spec := range files {
+		if strings.HasPrefix(path.ToString(), prefix.ToString()) {
+			shouldInclude := strings.HasSuffix(path.ToString(), "file")
+			got, ok := justFileHashes[turbopath.AnchoredUnixPath(path[prefixLen:])]
+			if !ok && shouldInclude {
+				if spec.hash != "" {
+					t.Errorf("did not find hash for %v, but wanted one", path)
+				}
+			} else if shouldInclude && got != spec.hash {
+				t.Errorf("hash of %v, got %v want %v", path, got, spec.hash)
+			} else if shouldInclude {
+				count++
+			}
+		}
+	}
+	if count != len(justFileHashes) {
+		t.Errorf("found extra hashes in %v", hashes)
+	}
+}
+
+func TestGetPackageDepsNoGit(t *testing.T) {
+	// A temp dir outside of any git repository, like an exported tarball or a Docker build context
+	repoRoot := turbopath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	files := map[string]string{
+		".gitignore":                "dist/\n",
+		"web/package.json":          "{}",
+		"web/src/index.ts":          "index",
+		"web/src/util/strings.ts":   "strings",
+		"web/README.md":             "readme",
+		"web/dist/index.js":         "built",
+		"other/src/not-in-web.ts":   "other",
+		"web/node_modules/.package": "ignored by the package",
+		"web/.gitignore":            "node_modules/\n",
+	}
+	for path, contents := range files {
+		filename := turbopath.AnchoredUnixPath(path).ToSystemPath().RestoreAnchor(repoRoot)
+		assert.NilError(t, fs.EnsureDir(filename.ToString()))
+		assert.NilError(t, os.WriteFile(filename.ToString(), []byte(contents), 0644))
+	}
+	wantHash := func(path string) string {
+		hash, err := fs.GitLikeHashFile(turbopath.AnchoredUnixPath(path).ToSystemPath().RestoreAnchor(repoRoot).ToString())
+		assert.NilError(t, err)
+		return hash
+	}
+	rootPath := turbopath.AbsolutePath(repoRoot.ToString())
+
+	all, err := GetPackageDeps(rootPath, &PackageDepsOptions{PackagePath: "web", NoGit: true})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, all, map[turbopath.AnchoredUnixPath]string{
+		".gitignore":          wantHash("web/.gitignore"),
+		"README.md":           wantHash("web/README.md"),
+		"package.json":        wantHash("web/package.json"),
+		"src/index.ts":        wantHash("web/src/index.ts"),
+		"src/util/strings.ts": wantHash("web/src/util/strings.ts"),
+	})
+
+	inputs, err := GetPackageDeps(rootPath, &PackageDepsOptions{PackagePath: "web", InputPatterns: []string{"src/**"}, NoGit: true})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, inputs, map[turbopath.AnchoredUnixPath]string{
+		"package.json":        wantHash("web/package.json"),
+		"src/index.ts":        wantHash("web/src/index.ts"),
+		"src/util/strings.ts": wantHash("web/src/util/strings.ts"),
+	})
+
+	// Without git on the PATH, the files are hashed the same way
+	t.Setenv("PATH", "")
+	fallback, err := GetPackageDeps(rootPath, &PackageDepsOptions{PackagePath: "web"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, fallback, all)
+}
@@ -1,6 +1,12 @@
 package inference
 
-import "github.com/vercel/turborepo/cli/internal/fs"
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+)
 
 // Framework is an identifier for something that we wish to inference against.
 type Framework struct {
@@ -145,6 +151,54 @@ func (f Framework) match(pkg *fs.PackageJSON) bool {
 	return f.DependencyMatch.match(pkg)
 }
 
+// DefaultEnvPrefixToken in the configured env prefixes of a framework stands for its built-in
+// prefix, so that the configuration can add to it rather than replace it
+const DefaultEnvPrefixToken = "$TURBO_DEFAULT$"
+
+// EnvPrefixes returns the prefixes of the env vars that are hashed for tasks of the framework.
+// configured maps framework slugs to the prefixes that replace their built-in one.
+func (f Framework) EnvPrefixes(configured map[string][]string) []string {
+	prefixes, ok := configured[f.Slug]
+	if !ok {
+		prefixes = []string{DefaultEnvPrefixToken}
+	}
+	envPrefixes := []string{}
+	for _, prefix := range prefixes {
+		if prefix == DefaultEnvPrefixToken {
+			prefix = f.EnvPrefix
+		}
+		// An empty prefix would hash every env var
+		if prefix != "" {
+			envPrefixes = append(envPrefixes, prefix)
+		}
+	}
+	return envPrefixes
+}
+
+// ValidateEnvPrefixes checks that the configured env prefixes are for known frameworks
+func ValidateEnvPrefixes(configured map[string][]string) error {
+	for slug := range configured {
+		if getFramework(slug) == nil {
+			slugs := make([]string, len(_frameworks))
+			for i, framework := range _frameworks {
+				slugs[i] = framework.Slug
+			}
+			sort.Strings(slugs)
+			return fmt.Errorf("unknown framework %q in frameworkEnvPrefixes, expected one of: %v", slug, strings.Join(slugs, ", "))
+		}
+	}
+	return nil
+}
+
+func getFramework(slug string) *Framework {
+	for _, framework := range _frameworks {
+		if framework.Slug == slug {
+			return &framework
+		}
+	}
+	return nil
+}
+
 // InferFramework returns a reference to a matched framework
 func InferFramework(pkg *fs.PackageJSON) *Framework {
 	if pkg == nil {
@@ -85,3 +85,54 @@ func TestInferFramework(t *testing.T) {
 		})
 	}
 }
+
+func TestFrameworkEnvPrefixes(t *testing.T) {
+	nextjs := getFrameworkBySlug("nextjs")
+	tests := []struct {
+		name       string
+		configured map[string][]string
+		want       []string
+	}{
+		{
+			name:       "Built-in prefix when unconfigured",
+			configured: nil,
+			want:       []string{"NEXT_PUBLIC_"},
+		},
+		{
+			name:       "Configured prefixes replace the built-in one",
+			configured: map[string][]string{"nextjs": {"PUBLIC_"}},
+			want:       []string{"PUBLIC_"},
+		},
+		{
+			name:       "Default token keeps the built-in prefix",
+			configured: map[string][]string{"nextjs": {DefaultEnvPrefixToken, "PUBLIC_"}},
+			want:       []string{"NEXT_PUBLIC_", "PUBLIC_"},
+		},
+		{
+			name:       "Empty list hashes no framework env vars",
+			configured: map[string][]string{"nextjs": {}},
+			want:       []string{},
+		},
+		{
+			name:       "Other frameworks are left alone",
+			configured: map[string][]string{"vite": {"PUBLIC_"}},
+			want:       []string{"NEXT_PUBLIC_"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextjs.EnvPrefixes(tt.configured); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnvPrefixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEnvPrefixes(t *testing.T) {
+	if err := ValidateEnvPrefixes(map[string][]string{"nextjs": {"PUBLIC_"}}); err != nil {
+		t.Errorf("ValidateEnvPrefixes() error = %v, want nil", err)
+	}
+	if err := ValidateEnvPrefixes(map[string][]string{"next": {"PUBLIC_"}}); err == nil {
+		t.Error("ValidateEnvPrefixes() error = nil, want an error for an unknown framework")
+	}
+}
@@ -30,7 +30,7 @@ type BerryLockfile map[string]*YarnLockfileEntry
 var _ Lockfile = (*BerryLockfile)(nil)
 
 // ResolvePackage Given a package and version returns the key, resolved version, and if it was found
-func (l *BerryLockfile) ResolvePackage(name string, version string) (string, string, bool) {
+func (l *BerryLockfile) ResolvePackage(_ turbopath.AnchoredUnixPath, name string, version string) (string, string, bool) {
 	for _, key := range yarnPossibleKeys(name, version) {
 		if entry, ok := (*l)[key]; ok {
 			return key, entry.Version, true
@@ -10,7 +10,8 @@ import (
 // Lockfile Interface for general operations that work accross all lockfiles
 type Lockfile interface {
 	// ResolvePackage Given a package and version returns the key, resolved version, and if it was found
-	ResolvePackage(name string, version string) (string, string, bool)
+	// The workspace is the location of the workspace whose dependency is being resolved.
+	ResolvePackage(workspace turbopath.AnchoredUnixPath, name string, version string) (string, string, bool)
 	// AllDependencies Given a lockfile key return all (dev/optional/peer) dependencies of that package
 	AllDependencies(key string) (map[string]string, bool)
 	// Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
@@ -0,0 +1,286 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// _npmNodeModules is the directory segment that separates a package's location in the packages
+// map of package-lock.json from the locations of the packages installed beneath it
+const _npmNodeModules = "node_modules/"
+
+// NpmLockfile Go representation of the contents of 'package-lock.json'
+// Only lockfileVersion 2 and 3 are supported, as they record every installed package in the
+// packages map keyed by its location on disk.
+// Reference https://docs.npmjs.com/cli/v9/configuring-npm/package-lock-json
+type NpmLockfile struct {
+	Name            string                `json:"name,omitempty"`
+	Version         string                `json:"version,omitempty"`
+	LockfileVersion int                   `json:"lockfileVersion"`
+	Requires        bool                  `json:"requires,omitempty"`
+	Packages        map[string]NpmPackage `json:"packages"`
+	// Dependencies is the lockfileVersion 1 section that v2 lockfiles keep for older npm
+	// versions. It is only ever copied, as the packages map holds the same information.
+	Dependencies map[string]json.RawMessage `json:"dependencies,omitempty"`
+}
+
+var _ Lockfile = (*NpmLockfile)(nil)
+
+// ErrUnsupportedNpmLockfileVersion is returned for package-lock.json files with a
+// lockfileVersion other than 2 or 3
+var ErrUnsupportedNpmLockfileVersion = errors.New("unsupported lockfileVersion")
+
+// NpmPackage an entry in the packages map of package-lock.json
+type NpmPackage struct {
+	// Name is only present for the root, workspaces, and packages installed under an alias
+	Name             string            `json:"name,omitempty"`
+	Version          string            `json:"version,omitempty"`
+	Resolved         string            `json:"resolved,omitempty"`
+	Integrity        string            `json:"integrity,omitempty"`
+	Link             bool              `json:"link,omitempty"`
+	Dev              bool              `json:"dev,omitempty"`
+	Optional         bool              `json:"optional,omitempty"`
+	DevOptional      bool              `json:"devOptional,omitempty"`
+	Peer             bool              `json:"peer,omitempty"`
+	InBundle         bool              `json:"inBundle,omitempty"`
+	HasInstallScript bool              `json:"hasInstallScript,omitempty"`
+	HasShrinkwrap    bool              `json:"hasShrinkwrap,omitempty"`
+	License          string            `json:"license,omitempty"`
+	Workspaces       json.RawMessage   `json:"workspaces,omitempty"`
+	Dependencies     map[string]string `json:"dependencies,omitempty"`
+	// DevDependencies are only recorded for the root and workspaces, as they are never
+	// installed for anything else
+	DevDependencies      map[string]string `json:"devDependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string `json:"peerDependencies,omitempty"`
+	PeerDependenciesMeta json.RawMessage   `json:"peerDependenciesMeta,omitempty"`
+	Bin                  json.RawMessage   `json:"bin,omitempty"`
+	Engines              json.RawMessage   `json:"engines,omitempty"`
+	OS                   []string          `json:"os,omitempty"`
+	CPU                  []string          `json:"cpu,omitempty"`
+	Deprecated           string            `json:"deprecated,omitempty"`
+	Funding              json.RawMessage   `json:"funding,omitempty"`
+}
+
+func isSupportedNpmVersion(version int) error {
+	if version == 2 || version == 3 {
+		return nil
+	}
+	return errors.Wrapf(ErrUnsupportedNpmLockfileVersion, "Unable to read package-lock.json with lockfileVersion: %v. Supported lockfile versions are [2 3]", version)
+}
+
+// DecodeNpmLockfile parse an npm lockfile
+func DecodeNpmLockfile(contents []byte) (*NpmLockfile, error) {
+	var lockfile NpmLockfile
+	if err := json.Unmarshal(contents, &lockfile); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal package-lock.json")
+	}
+
+	if err := isSupportedNpmVersion(lockfile.LockfileVersion); err != nil {
+		return nil, err
+	}
+
+	return &lockfile, nil
+}
+
+// ResolvePackage Given a package and version returns the key, resolved version, and if it was found
+// The version is either a specifier from a package.json, or the key of an installed package as
+// returned by AllDependencies.
+func (l *NpmLockfile) ResolvePackage(workspace turbopath.AnchoredUnixPath, name string, version string) (string, string, bool) {
+	// Check if the version is already the location of the installed package
+	if entry, ok := l.Packages[version]; ok && !entry.Link && npmPackageName(version) == name {
+		return version, entry.Version, true
+	}
+
+	// Prefer the copy that the workspace would load, which is the one in its own node_modules
+	// or else the hoisted one, followed by the copies nested within other workspaces and packages
+	dir := workspace.ToString()
+	if dir == "." {
+		dir = ""
+	}
+	first, hasFirst := l.findInstalled(dir, name)
+	hoistedKey := _npmNodeModules + name
+	candidates := []string{}
+	for key, entry := range l.Packages {
+		if entry.Link || key == first || key == hoistedKey || npmPackageName(key) != name {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+	sort.Strings(candidates)
+	if entry, ok := l.Packages[hoistedKey]; ok && !entry.Link && hoistedKey != first {
+		candidates = append([]string{hoistedKey}, candidates...)
+	}
+	if hasFirst {
+		candidates = append([]string{first}, candidates...)
+	}
+	if len(candidates) == 0 {
+		return "", "", false
+	}
+
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		// Specifiers such as aliases, tags, urls, and git repos can't be matched against the
+		// installed versions, so fall back to what npm installed for everyone else
+		return candidates[0], l.Packages[candidates[0]].Version, true
+	}
+	for _, key := range candidates {
+		installed, err := semver.NewVersion(l.Packages[key].Version)
+		if err != nil {
+			continue
+		}
+		if constraint.Check(installed) {
+			return key, l.Packages[key].Version, true
+		}
+	}
+
+	return "", "", false
+}
+
+// AllDependencies Given a lockfile key return all (dev/optional/peer) dependencies of that package
+// Each dependency that is installed is given by the key of the copy that node would load for
+// the package, so that nested copies are resolved to the right version.
+func (l *NpmLockfile) AllDependencies(key string) (map[string]string, bool) {
+	deps := map[string]string{}
+	entry, ok := l.Packages[key]
+	if !ok {
+		return deps, false
+	}
+
+	addDeps := func(dependencies map[string]string) {
+		for name, version := range dependencies {
+			if depKey, ok := l.findInstalled(key, name); ok {
+				deps[name] = depKey
+			} else {
+				deps[name] = version
+			}
+		}
+	}
+	addDeps(entry.Dependencies)
+	addDeps(entry.OptionalDependencies)
+	addDeps(entry.PeerDependencies)
+
+	return deps, true
+}
+
+// findInstalled follows node's module resolution, looking for the named package in the
+// node_modules of the given location and then in those of each of its parents
+func (l *NpmLockfile) findInstalled(key string, name string) (string, bool) {
+	dir := key
+	for {
+		candidate := _npmNodeModules + name
+		if dir != "" {
+			candidate = dir + "/" + candidate
+		}
+		if entry, ok := l.Packages[candidate]; ok && !entry.Link {
+			return candidate, true
+		}
+		if dir == "" {
+			return "", false
+		}
+		dir = npmParentDir(dir)
+	}
+}
+
+// Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
+func (l *NpmLockfile) Subgraph(workspacePackages []turbopath.AnchoredSystemPath, packages []string) (Lockfile, error) {
+	lockfilePackages := make(map[string]NpmPackage, len(packages)+2*len(workspacePackages)+1)
+	if root, ok := l.Packages[""]; ok {
+		lockfilePackages[""] = root
+	}
+
+	workspaces := make(map[string]bool, len(workspacePackages))
+	for _, workspacePath := range workspacePackages {
+		workspace := workspacePath.ToUnixPath().ToString()
+		entry, ok := l.Packages[workspace]
+		if !ok {
+			return nil, fmt.Errorf("Unable to find lockfile entry for workspace package %s", workspace)
+		}
+		lockfilePackages[workspace] = entry
+		workspaces[workspace] = true
+	}
+	// Keep the links npm creates in node_modules for each of the workspaces
+	for key, entry := range l.Packages {
+		if entry.Link && workspaces[entry.Resolved] {
+			lockfilePackages[key] = entry
+		}
+	}
+
+	for _, key := range packages {
+		entry, ok := l.Packages[key]
+		if !ok {
+			return nil, fmt.Errorf("Unable to find lockfile entry for %s", key)
+		}
+		lockfilePackages[key] = entry
+	}
+
+	// Only the hoisted packages can be picked out of the legacy dependencies section
+	var dependencies map[string]json.RawMessage
+	if l.Dependencies != nil {
+		dependencies = make(map[string]json.RawMessage)
+		for name, dependency := range l.Dependencies {
+			if _, ok := lockfilePackages[_npmNodeModules+name]; ok {
+				dependencies[name] = dependency
+			}
+		}
+	}
+
+	lockfile := NpmLockfile{
+		Name:            l.Name,
+		Version:         l.Version,
+		LockfileVersion: l.LockfileVersion,
+		Requires:        l.Requires,
+		Packages:        lockfilePackages,
+		Dependencies:    dependencies,
+	}
+
+	return &lockfile, nil
+}
+
+// Encode encode the lockfile representation and write it to the given writer
+func (l *NpmLockfile) Encode(w io.Writer) error {
+	if err := isSupportedNpmVersion(l.LockfileVersion); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(l); err != nil {
+		return errors.Wrap(err, "unable to encode npm lockfile")
+	}
+	return nil
+}
+
+// Patches return a list of patches used in the lockfile
+func (l *NpmLockfile) Patches() []turbopath.AnchoredUnixPath {
+	return nil
+}
+
+// npmPackageName returns the name of the package installed at the given location, or "" if the
+// location isn't within a node_modules directory
+func npmPackageName(key string) string {
+	i := strings.LastIndex(key, _npmNodeModules)
+	if i == -1 || (i > 0 && key[i-1] != '/') {
+		return ""
+	}
+	return key[i+len(_npmNodeModules):]
+}
+
+// npmParentDir returns the location of the package or workspace whose node_modules holds the
+// package at the given location, or "" if it is installed at the root
+func npmParentDir(key string) string {
+	i := strings.LastIndex(key, _npmNodeModules)
+	if i <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(key[:i], "/")
+}
@@ -0,0 +1,178 @@
+package lockfile
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+var _npmFixtures = []string{"npm-lock-v2.json", "npm-lock-v3.json"}
+
+func getNpmFixture(t *testing.T, name string) *NpmLockfile {
+	contents, err := getFixture(t, name)
+	if err != nil {
+		t.Fatalf("failure getting fixture: %v", err)
+	}
+	lockfile, err := DecodeNpmLockfile(contents)
+	if err != nil {
+		t.Fatalf("failure decoding lockfile: %v", err)
+	}
+	return lockfile
+}
+
+func Test_NpmRoundtrip(t *testing.T) {
+	for _, name := range _npmFixtures {
+		contents, err := getFixture(t, name)
+		if err != nil {
+			t.Fatalf("failure getting fixture: %v", err)
+		}
+		lockfile, err := DecodeNpmLockfile(contents)
+		if err != nil {
+			t.Fatalf("decoding failed %v", err)
+		}
+		var b bytes.Buffer
+		if err := lockfile.Encode(&b); err != nil {
+			t.Fatalf("encoding failed %v", err)
+		}
+		assert.Equal(t, b.String(), string(contents), name)
+		newLockfile, err := DecodeNpmLockfile(b.Bytes())
+		if err != nil {
+			t.Fatalf("decoding failed %v", err)
+		}
+
+		assert.DeepEqual(t, lockfile, newLockfile)
+	}
+}
+
+func Test_NpmUnsupportedVersion(t *testing.T) {
+	_, err := DecodeNpmLockfile([]byte(`{"lockfileVersion": 1, "dependencies": {}}`))
+	assert.ErrorContains(t, err, "lockfileVersion: 1")
+	assert.ErrorIs(t, err, ErrUnsupportedNpmLockfileVersion)
+}
+
+func Test_NpmResolvePackage(t *testing.T) {
+	tests := []struct {
+		name      string
+		specifier string
+		key       string
+		version   string
+		found     bool
+	}{
+		{"react", "^18.2.0", "node_modules/react", "18.2.0", true},
+		// chalk 5 is hoisted, while packages/ui has its own copy of chalk 4
+		{"chalk", "^5.2.0", "node_modules/chalk", "5.2.0", true},
+		{"chalk", "^4.1.2", "packages/ui/node_modules/chalk", "4.1.2", true},
+		{"chalk", "^3.0.0", "", "", false},
+		{"lodash", "latest", "node_modules/lodash", "4.17.21", true},
+		// Workspaces are linked into node_modules, but aren't external dependencies
+		{"ui", "*", "", "", false},
+		{"left-pad", "^1.3.0", "", "", false},
+	}
+	for _, name := range _npmFixtures {
+		lockfile := getNpmFixture(t, name)
+		for _, tt := range tests {
+			key, version, found := lockfile.ResolvePackage("", tt.name, tt.specifier)
+			assert.Equal(t, found, tt.found, "%v %v@%v", name, tt.name, tt.specifier)
+			assert.Equal(t, key, tt.key, "%v %v@%v", name, tt.name, tt.specifier)
+			assert.Equal(t, version, tt.version, "%v %v@%v", name, tt.name, tt.specifier)
+		}
+	}
+}
+
+func Test_NpmResolvePackageInWorkspace(t *testing.T) {
+	tests := []struct {
+		workspace turbopath.AnchoredUnixPath
+		specifier string
+		key       string
+		version   string
+	}{
+		// packages/ui loads its own copy of chalk, even for a specifier chalk 5 satisfies
+		{"packages/ui", "*", "packages/ui/node_modules/chalk", "4.1.2"},
+		{"apps/web", "*", "node_modules/chalk", "5.2.0"},
+		{"", "*", "node_modules/chalk", "5.2.0"},
+		// A copy that doesn't satisfy the specifier isn't the one that was installed for it
+		{"packages/ui", "^5.2.0", "node_modules/chalk", "5.2.0"},
+	}
+	for _, name := range _npmFixtures {
+		lockfile := getNpmFixture(t, name)
+		for _, tt := range tests {
+			key, version, found := lockfile.ResolvePackage(tt.workspace, "chalk", tt.specifier)
+			assert.Assert(t, found, "%v %v chalk@%v", name, tt.workspace, tt.specifier)
+			assert.Equal(t, key, tt.key, "%v %v chalk@%v", name, tt.workspace, tt.specifier)
+			assert.Equal(t, version, tt.version, "%v %v chalk@%v", name, tt.workspace, tt.specifier)
+		}
+	}
+}
+
+func Test_NpmTransitiveResolution(t *testing.T) {
+	for _, name := range _npmFixtures {
+		lockfile := getNpmFixture(t, name)
+
+		key, _, found := lockfile.ResolvePackage("", "chalk", "^4.1.2")
+		assert.Assert(t, found, "chalk@^4.1.2")
+
+		// Dependencies are found in the node_modules of the package's parents
+		deps, found := lockfile.AllDependencies(key)
+		assert.Assert(t, found, key)
+		assert.DeepEqual(t, deps, map[string]string{
+			"ansi-styles":    "node_modules/ansi-styles",
+			"supports-color": "node_modules/supports-color",
+		})
+
+		// and in its own node_modules before that
+		deps, found = lockfile.AllDependencies(deps["supports-color"])
+		assert.Assert(t, found, "node_modules/supports-color")
+		assert.DeepEqual(t, deps, map[string]string{"has-flag": "node_modules/supports-color/node_modules/has-flag"})
+
+		key, version, found := lockfile.ResolvePackage("", "has-flag", deps["has-flag"])
+		assert.Assert(t, found, "has-flag")
+		assert.Equal(t, key, "node_modules/supports-color/node_modules/has-flag")
+		assert.Equal(t, version, "4.0.0")
+
+		_, found = lockfile.AllDependencies("node_modules/left-pad")
+		assert.Assert(t, !found, "node_modules/left-pad")
+	}
+}
+
+func Test_NpmSubgraph(t *testing.T) {
+	for _, name := range _npmFixtures {
+		lockfile := getNpmFixture(t, name)
+
+		workspaces := []turbopath.AnchoredSystemPath{turbopath.AnchoredUnixPath("apps/web").ToSystemPath()}
+		packages := []string{"node_modules/react", "node_modules/loose-envify", "node_modules/js-tokens"}
+		subgraph, err := lockfile.Subgraph(workspaces, packages)
+		assert.NilError(t, err, "Subgraph")
+
+		pruned := subgraph.(*NpmLockfile)
+		keys := []string{}
+		for key := range pruned.Packages {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		assert.DeepEqual(t, keys, []string{
+			"",
+			"apps/web",
+			"node_modules/js-tokens",
+			"node_modules/loose-envify",
+			"node_modules/react",
+			"node_modules/web",
+		})
+		assert.Equal(t, pruned.LockfileVersion, lockfile.LockfileVersion)
+		if lockfile.Dependencies != nil {
+			assert.Equal(t, len(pruned.Dependencies), 4)
+		}
+
+		// The pruned lockfile survives being written out and read back
+		var b bytes.Buffer
+		assert.NilError(t, pruned.Encode(&b), "Encode")
+		decoded, err := DecodeNpmLockfile(b.Bytes())
+		assert.NilError(t, err, "Decode")
+		assert.DeepEqual(t, decoded, pruned)
+
+		_, err = lockfile.Subgraph(workspaces, []string{"node_modules/left-pad"})
+		assert.ErrorContains(t, err, "node_modules/left-pad")
+	}
+}
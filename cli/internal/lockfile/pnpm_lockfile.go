@@ -127,7 +127,7 @@ func DecodePnpmLockfile(contents []byte) (*PnpmLockfile, error) {
 }
 
 // ResolvePackage Given a package and version returns the key, resolved version, and if it was found
-func (p *PnpmLockfile) ResolvePackage(name string, version string) (string, string, bool) {
+func (p *PnpmLockfile) ResolvePackage(_ turbopath.AnchoredUnixPath, name string, version string) (string, string, bool) {
 	resolvedVersion, ok := p.resolveSpecifier(name, version)
 	if !ok {
 		return "", "", false
@@ -3,10 +3,12 @@ package lockfile
 import (
 	"bytes"
 	"os"
+	"sort"
 	"testing"
 
 	"github.com/pkg/errors"
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"gotest.tools/v3/assert"
 )
 
@@ -27,7 +29,7 @@ func getFixture(t *testing.T, name string) ([]byte, error) {
 }
 
 func Test_Roundtrip(t *testing.T) {
-	lockfiles := []string{"pnpm6-workspace.yaml", "pnpm7-workspace.yaml"}
+	lockfiles := []string{"pnpm6-workspace.yaml", "pnpm7-workspace.yaml", "pnpm7-transitive.yaml"}
 
 	for _, lockfilePath := range lockfiles {
 		lockfileContent, err := getFixture(t, lockfilePath)
@@ -81,3 +83,67 @@ func Test_SpecifierResolution(t *testing.T) {
 		assert.Equal(t, actualVersion, testCase.version, "%s@%s", testCase.pkg, testCase.version)
 	}
 }
+
+func Test_TransitiveResolution(t *testing.T) {
+	contents, err := getFixture(t, "pnpm7-transitive.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	lockfile, err := DecodePnpmLockfile(contents)
+	if err != nil {
+		t.Errorf("failure decoding lockfile: %v", err)
+	}
+
+	key, version, found := lockfile.ResolvePackage("", "left-pad-wrapper", "^1.0.0")
+	assert.Assert(t, found, "left-pad-wrapper@^1.0.0")
+	assert.Equal(t, key, "/left-pad-wrapper/1.2.0")
+	assert.Equal(t, version, "1.2.0")
+
+	deps, found := lockfile.AllDependencies(key)
+	assert.Assert(t, found, key)
+	assert.DeepEqual(t, deps, map[string]string{"left-pad": "1.3.0"})
+
+	// Transitive dependencies are listed by their resolved version
+	key, version, found = lockfile.ResolvePackage("", "left-pad", deps["left-pad"])
+	assert.Assert(t, found, "left-pad@1.3.0")
+	assert.Equal(t, key, "/left-pad/1.3.0")
+	assert.Equal(t, version, "1.3.0")
+}
+
+func Test_Subgraph(t *testing.T) {
+	contents, err := getFixture(t, "pnpm7-workspace.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+	lockfile, err := DecodePnpmLockfile(contents)
+	if err != nil {
+		t.Errorf("failure decoding lockfile: %v", err)
+	}
+
+	workspaces := []turbopath.AnchoredSystemPath{turbopath.AnchoredUnixPath("packages/ui").ToSystemPath()}
+	packages := []string{"/react/18.2.0", "/loose-envify/1.4.0", "/js-tokens/4.0.0"}
+	subgraph, err := lockfile.Subgraph(workspaces, packages)
+	assert.NilError(t, err, "Subgraph")
+
+	pruned := subgraph.(*PnpmLockfile)
+	importers := []string{}
+	for importer := range pruned.Importers {
+		importers = append(importers, importer)
+	}
+	sort.Strings(importers)
+	assert.DeepEqual(t, importers, []string{".", "packages/ui"})
+	assert.Equal(t, len(pruned.Packages), len(packages))
+	for _, key := range packages {
+		assert.DeepEqual(t, pruned.Packages[key], lockfile.Packages[key])
+	}
+
+	// The pruned lockfile survives being written out and read back
+	var b bytes.Buffer
+	assert.NilError(t, subgraph.Encode(&b), "Encode")
+	decoded, err := DecodePnpmLockfile(b.Bytes())
+	assert.NilError(t, err, "DecodePnpmLockfile")
+	assert.DeepEqual(t, decoded, pruned)
+
+	_, err = lockfile.Subgraph(workspaces, []string{"/not-a-package/1.0.0"})
+	assert.ErrorContains(t, err, "/not-a-package/1.0.0")
+}
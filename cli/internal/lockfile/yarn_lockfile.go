@@ -22,7 +22,7 @@ type YarnLockfile struct {
 var _ Lockfile = (*YarnLockfile)(nil)
 
 // ResolvePackage Given a package and version returns the key, resolved version, and if it was found
-func (l *YarnLockfile) ResolvePackage(name string, version string) (string, string, bool) {
+func (l *YarnLockfile) ResolvePackage(_ turbopath.AnchoredUnixPath, name string, version string) (string, string, bool) {
 	for _, key := range yarnPossibleKeys(name, version) {
 		if entry, ok := (l.inner)[key]; ok {
 			return key, entry.Version, true
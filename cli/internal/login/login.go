@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vercel/turborepo/cli/internal/client"
@@ -23,6 +24,13 @@ const defaultHostname = "127.0.0.1"
 const defaultPort = 9789
 const defaultSSOProvider = "SAML/OIDC Single Sign-On"
 
+// _ssoVerifyAttempts is the number of times we try to verify an SSO token before
+// asking the user whether to keep trying
+const _ssoVerifyAttempts = 3
+
+// alias so we can shorten the wait in tests
+var _ssoVerifyRetryDelay = 2 * time.Second
+
 // NewLoginCommand returns the cobra subcommand for turbo login
 func NewLoginCommand(helper *cmdutil.Helper) *cobra.Command {
 	var ssoTeam string
@@ -42,6 +50,7 @@ func NewLoginCommand(helper *cmdutil.Helper) *cobra.Command {
 				openURL:             browser.OpenBrowser,
 				client:              base.APIClient,
 				promptEnableCaching: promptEnableCaching,
+				promptRetry:         promptRetrySSOVerification,
 			}
 			if ssoTeam != "" {
 				err := login.loginSSO(ctx, ssoTeam)
@@ -50,6 +59,9 @@ func NewLoginCommand(helper *cmdutil.Helper) *cobra.Command {
 						base.UI.Info("Canceled. Turborepo not set up.")
 					} else if errors.Is(err, errTryAfterEnable) || errors.Is(err, errNeedCachingEnabled) || errors.Is(err, errOverage) {
 						base.UI.Info("Remote Caching not enabled. Please run 'turbo login' again after Remote Caching has been enabled")
+					} else if errors.Is(err, client.ErrInvalidSSOToken) {
+						base.LogError("SSO login failed: %v", err)
+						base.UI.Info(fmt.Sprintf("Your SSO login could not be verified. Please start over by running 'turbo login --sso-team=%v'", ssoTeam))
 					} else {
 						base.LogError("SSO login failed: %v", err)
 					}
@@ -90,6 +102,7 @@ type login struct {
 	// to allow for injection of a client in tests
 	client              userClient
 	promptEnableCaching func() (bool, error)
+	promptRetry         func() (bool, error)
 }
 
 func (l *login) directUserToURL(url string) {
@@ -190,9 +203,9 @@ func (l *login) loginSSO(ctx context.Context, ssoTeam string) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to make sso token name")
 	}
-	verifiedUser, err := l.client.VerifySSOToken(verificationToken, tokenName)
+	verifiedUser, err := l.verifySSOToken(rootctx, verificationToken, tokenName)
 	if err != nil {
-		return errors.Wrap(err, "failed to verify SSO token")
+		return err
 	}
 
 	l.client.SetToken(verifiedUser.Token)
@@ -236,6 +249,40 @@ func (l *login) loginSSO(ctx context.Context, ssoTeam string) error {
 	return nil
 }
 
+// verifySSOToken exchanges a verification token for an auth token. Failures are retried a
+// bounded number of times before asking the user whether to keep trying. A rejected token
+// will never succeed, so that is reported immediately.
+func (l *login) verifySSOToken(ctx context.Context, verificationToken string, tokenName string) (*client.VerifiedSSOUser, error) {
+	for {
+		var lastErr error
+		for attempt := 1; attempt <= _ssoVerifyAttempts; attempt++ {
+			verifiedUser, err := l.client.VerifySSOToken(verificationToken, tokenName)
+			if err == nil {
+				return verifiedUser, nil
+			} else if errors.Is(err, client.ErrInvalidSSOToken) {
+				return nil, errors.Wrap(err, "failed to verify SSO token")
+			}
+			lastErr = err
+			l.base.Logger.Debug("failed to verify SSO token", "attempt", attempt, "error", err)
+			if attempt < _ssoVerifyAttempts {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(_ssoVerifyRetryDelay):
+				}
+			}
+		}
+		l.base.UI.Warn(fmt.Sprintf("Could not reach the SSO verification service: %v", lastErr))
+		shouldRetry, err := l.promptRetry()
+		if err != nil {
+			return nil, err
+		}
+		if !shouldRetry {
+			return nil, errors.Wrap(lastErr, "failed to verify SSO token")
+		}
+	}
+}
+
 func (l *login) verifyCachingEnabled(teamID string) error {
 	cachingStatus, err := l.client.GetCachingStatus()
 	if err != nil {
@@ -26,6 +26,9 @@ type dummyClient struct {
 	createdSSOTokenName string
 	team                *client.Team
 	cachingStatus       util.CachingStatus
+	// verifyErrs are returned, in order, by calls to VerifySSOToken before it succeeds
+	verifyErrs  []error
+	verifyCalls int
 }
 
 func (d *dummyClient) SetToken(t string) {
@@ -48,6 +51,12 @@ func (d *dummyClient) SetTeamID(teamID string) {}
 
 func (d *dummyClient) VerifySSOToken(token string, tokenName string) (*client.VerifiedSSOUser, error) {
 	d.createdSSOTokenName = tokenName
+	d.verifyCalls++
+	if len(d.verifyErrs) > 0 {
+		err := d.verifyErrs[0]
+		d.verifyErrs = d.verifyErrs[1:]
+		return nil, err
+	}
 	return &client.VerifiedSSOUser{
 		Token:  "actual-sso-token",
 		TeamID: "sso-team-id",
@@ -63,6 +72,8 @@ type testResult struct {
 	stepCh              chan struct{}
 	client              dummyClient
 	shouldEnableCaching bool
+	shouldRetry         bool
+	retryPrompts        int
 }
 
 func (tr *testResult) getTestLogin() login {
@@ -85,6 +96,10 @@ func (tr *testResult) getTestLogin() login {
 		promptEnableCaching: func() (bool, error) {
 			return tr.shouldEnableCaching, nil
 		},
+		promptRetry: func() (bool, error) {
+			tr.retryPrompts++
+			return tr.shouldRetry, nil
+		},
 	}
 }
 
@@ -228,3 +243,63 @@ func Test_ssoCachingDisabledDontEnable(t *testing.T) {
 		t.Errorf("loginSSO got %v, want %v", err, errNeedCachingEnabled)
 	}
 }
+
+func noSSOVerifyRetryDelay(t *testing.T) {
+	t.Helper()
+	previous := _ssoVerifyRetryDelay
+	_ssoVerifyRetryDelay = 0
+	t.Cleanup(func() { _ssoVerifyRetryDelay = previous })
+}
+
+func Test_ssoRetriesNetworkErrors(t *testing.T) {
+	noSSOVerifyRetryDelay(t)
+	ctx := context.Background()
+	redirectParams := make(url.Values)
+	redirectParams.Add("token", "verification-token")
+	redirectParams.Add("email", "test@example.com")
+	test := newTest(t, "http://127.0.0.1:9789/?"+redirectParams.Encode())
+	test.shouldRetry = true
+	networkErr := errors.New("connection reset by peer")
+	for i := 0; i < _ssoVerifyAttempts+1; i++ {
+		test.client.verifyErrs = append(test.client.verifyErrs, networkErr)
+	}
+	login := test.getTestLogin()
+	err := login.loginSSO(ctx, "my-team")
+	if err != nil {
+		t.Errorf("expected to succeed, got error %v", err)
+	}
+	if test.retryPrompts != 1 {
+		t.Errorf("retry prompts got %v, want 1", test.retryPrompts)
+	}
+	if test.client.verifyCalls != _ssoVerifyAttempts+2 {
+		t.Errorf("verify calls got %v, want %v", test.client.verifyCalls, _ssoVerifyAttempts+2)
+	}
+	if test.userConfig.Token() != "actual-sso-token" {
+		t.Errorf("user config token got %v want actual-sso-token", test.userConfig.Token())
+	}
+}
+
+func Test_ssoInvalidTokenIsNotRetried(t *testing.T) {
+	noSSOVerifyRetryDelay(t)
+	ctx := context.Background()
+	redirectParams := make(url.Values)
+	redirectParams.Add("token", "verification-token")
+	redirectParams.Add("email", "test@example.com")
+	test := newTest(t, "http://127.0.0.1:9789/?"+redirectParams.Encode())
+	test.shouldRetry = true
+	test.client.verifyErrs = []error{fmt.Errorf("%w: 404 - Not found", client.ErrInvalidSSOToken)}
+	login := test.getTestLogin()
+	err := login.loginSSO(ctx, "my-team")
+	if !errors.Is(err, client.ErrInvalidSSOToken) {
+		t.Errorf("loginSSO got %v, want %v", err, client.ErrInvalidSSOToken)
+	}
+	if test.client.verifyCalls != 1 {
+		t.Errorf("verify calls got %v, want 1", test.client.verifyCalls)
+	}
+	if test.retryPrompts != 0 {
+		t.Errorf("retry prompts got %v, want 0", test.retryPrompts)
+	}
+	if test.userConfig.Token() != "" {
+		t.Errorf("user config token got %v, want it to be unset", test.userConfig.Token())
+	}
+}
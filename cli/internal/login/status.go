@@ -12,6 +12,25 @@ var (
 	errTryAfterEnable     = errors.New("link after enabling caching")
 )
 
+func promptRetrySSOVerification() (bool, error) {
+	shouldRetry := false
+	err := survey.AskOne(
+		&survey.Confirm{
+			Default: true,
+			Message: util.Sprintf("Failed to verify your SSO login. Would you like to try again?"),
+		},
+		&shouldRetry,
+		survey.WithValidator(survey.Required),
+		survey.WithIcons(func(icons *survey.IconSet) {
+			icons.Question.Format = "gray+hb"
+		}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return shouldRetry, nil
+}
+
 func promptEnableCaching() (bool, error) {
 	shouldEnable := false
 	err := survey.AskOne(
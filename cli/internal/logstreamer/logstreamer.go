@@ -9,11 +9,15 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 )
 
 type Logstreamer struct {
 	Logger *log.Logger
-	buf    *bytes.Buffer
+	// LineLock, if set, is held while each line is written. Streamers sharing a LineLock
+	// never interleave their lines, even if the Logger's writer splits up writes.
+	LineLock sync.Locker
+	buf      *bytes.Buffer
 	// If prefix == stdout, colors green
 	// If prefix == stderr, colors red
 	// Else, prefix is taken as-is, and prepended to anything
@@ -129,5 +133,9 @@ func (l *Logstreamer) out(str string) {
 		str = l.prefix + str
 	}
 
+	if l.LineLock != nil {
+		l.LineLock.Lock()
+		defer l.LineLock.Unlock()
+	}
 	l.Logger.Print(str)
 }
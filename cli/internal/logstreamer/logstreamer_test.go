@@ -10,7 +10,9 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -112,3 +114,49 @@ func TestLogstreamerFlush(t *testing.T) {
 		t.Fatalf("Expected '%s', got '%s'.", text, s)
 	}
 }
+
+// trickleWriter writes one byte at a time, yielding in between, so that concurrent
+// unguarded writes are likely to interleave
+type trickleWriter struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (w *trickleWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.mu.Lock()
+		w.buffer.WriteByte(b)
+		w.mu.Unlock()
+		runtime.Gosched()
+	}
+	return len(p), nil
+}
+
+func TestLogstreamerLineLock(t *testing.T) {
+	output := &trickleWriter{}
+	lineLock := &sync.Mutex{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(task int) {
+			defer wg.Done()
+			logStreamer := NewLogstreamer(log.New(output, "", 0), fmt.Sprintf("task-%v: ", task), false)
+			logStreamer.LineLock = lineLock
+			for j := 0; j < 20; j++ {
+				fmt.Fprintf(logStreamer, "line %v of task %v\n", j, task)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(output.buffer.String()), "\n")
+	if len(lines) != 80 {
+		t.Fatalf("Expected 80 lines, got %v", len(lines))
+	}
+	for _, line := range lines {
+		var task, j, lineTask int
+		if _, err := fmt.Sscanf(line, "task-%d: line %d of task %d", &task, &j, &lineTask); err != nil || task != lineTask {
+			t.Fatalf("Expected a whole line from one task, got '%s'", line)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package ls
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/vercel/turborepo/cli/internal/cache"
+	"github.com/vercel/turborepo/cli/internal/cmdutil"
+	"github.com/vercel/turborepo/cli/internal/context"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/scm"
+	"github.com/vercel/turborepo/cli/internal/scope"
+	"github.com/vercel/turborepo/cli/internal/util"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/pkg/errors"
+)
+
+type opts struct {
+	json           bool
+	filterPatterns []string
+}
+
+var _filterHelp = `Mark the packages matched by the given selector as in the
+filter, using the same syntax as turbo run --filter.
+--filter can be specified multiple times.`
+
+func addLsFlags(opts *opts, flags *pflag.FlagSet) {
+	flags.BoolVar(&opts.json, "json", false, "Output the package graph as JSON.")
+	flags.StringArrayVar(&opts.filterPatterns, "filter", nil, _filterHelp)
+	// No-op the cwd flag while the root level command is not yet cobra
+	_ = flags.String("cwd", "", "")
+	if err := flags.MarkHidden("cwd"); err != nil {
+		// Fail fast if we have misconfigured our flags
+		panic(err)
+	}
+}
+
+// errReservedCommand is returned when ls is given arguments or flags it doesn't take, as
+// they were likely meant for a task named ls. The name is reserved for this command, so
+// "turbo ls" never falls through to running a task named ls.
+var errReservedCommand = errors.New("\"ls\" is a reserved command name. To run a task named ls, use \"turbo run ls\"")
+
+// GetCmd returns the ls subcommand for use with cobra
+func GetCmd(helper *cmdutil.Helper) *cobra.Command {
+	opts := &opts{}
+	cmd := &cobra.Command{
+		Use:                   "ls [<flags>]",
+		Short:                 "List the packages in your monorepo and their dependencies.",
+		SilenceUsage:          true,
+		SilenceErrors:         true,
+		DisableFlagsInUseLine: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errReservedCommand
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			base, err := helper.GetCmdBase(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			l := &ls{
+				base,
+			}
+			if err := l.ls(opts); err != nil {
+				logError(l.base.Logger, l.base.UI, err)
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%v. %w", err, errReservedCommand)
+	})
+	addLsFlags(opts, cmd.Flags())
+	return cmd
+}
+
+func logError(logger hclog.Logger, ui cli.Ui, err error) {
+	logger.Error("error", err)
+	pref := color.New(color.Bold, color.FgRed, color.ReverseVideo).Sprint(" ERROR ")
+	ui.Error(fmt.Sprintf("%s%s", pref, color.RedString(" %v", err)))
+}
+
+type ls struct {
+	base *cmdutil.CmdBase
+}
+
+// packageSummary describes a package in the graph and whether the filters selected it.
+// ExternalDeps counts the external packages it resolves to in the lockfile.
+type packageSummary struct {
+	Name         string   `json:"name"`
+	Dir          string   `json:"dir"`
+	InternalDeps []string `json:"internalDeps"`
+	ExternalDeps int      `json:"externalDeps"`
+	InFilter     bool     `json:"inFilter"`
+}
+
+// lsSummary is the output of turbo ls --json
+type lsSummary struct {
+	Packages []packageSummary `json:"packages"`
+}
+
+func (l *ls) ls(opts *opts) error {
+	cacheDir := cache.DefaultLocation(l.base.RepoRoot)
+	rootPackageJSON, err := fs.ReadPackageJSON(l.base.RepoRoot.Join("package.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read package.json: %w", err)
+	}
+	ctx, err := context.New(context.WithGraph(l.base.RepoRoot, rootPackageJSON, cacheDir))
+	if err != nil {
+		return errors.Wrap(err, "could not construct graph")
+	}
+	scmInstance, err := scm.FromInRepo(l.base.RepoRoot.ToStringDuringMigration())
+	if err != nil {
+		if errors.Is(err, scm.ErrFallback) {
+			l.base.Logger.Warn("", "warning", err)
+		} else {
+			return errors.Wrap(err, "failed to create SCM")
+		}
+	}
+	scopeOpts := &scope.Opts{FilterPatterns: opts.filterPatterns}
+	filteredPkgs, _, err := scope.ResolvePackages(scopeOpts, l.base.RepoRoot.ToStringDuringMigration(), scmInstance, ctx, l.base.UI, l.base.Logger)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve packages")
+	}
+
+	summary := summarizePackages(ctx, filteredPkgs)
+	if opts.json {
+		bytes, err := summary.render()
+		if err != nil {
+			return errors.Wrap(err, "failed to render JSON")
+		}
+		l.base.UI.Output(string(bytes))
+		return nil
+	}
+	l.base.UI.Info(util.Sprintf("${CYAN}${BOLD}Packages${RESET}"))
+	summary.writeTable(os.Stdout)
+	return nil
+}
+
+// summarizePackages describes each of the packages in the graph, sorted by name
+func summarizePackages(ctx *context.Context, filteredPkgs util.Set) *lsSummary {
+	names := make([]string, len(ctx.PackageNames))
+	copy(names, ctx.PackageNames)
+	sort.Strings(names)
+	summary := &lsSummary{Packages: make([]packageSummary, 0, len(names))}
+	for _, name := range names {
+		pkg := ctx.PackageInfos[name]
+		internalDeps := make([]string, len(pkg.InternalDeps))
+		copy(internalDeps, pkg.InternalDeps)
+		sort.Strings(internalDeps)
+		summary.Packages = append(summary.Packages, packageSummary{
+			Name:         name,
+			Dir:          pkg.Dir.ToUnixPath().ToString(),
+			InternalDeps: internalDeps,
+			ExternalDeps: len(pkg.ExternalDeps),
+			InFilter:     filteredPkgs.Includes(name),
+		})
+	}
+	return summary
+}
+
+func (s *lsSummary) render() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// writeTable writes the summary in the same layout as the packages in a dry run
+func (s *lsSummary) writeTable(w io.Writer) {
+	p := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(p, "Name\tPath\tInternal Deps\tExternal Deps\tIn Filter\t")
+	for _, pkg := range s.Packages {
+		fmt.Fprintf(p, "%s\t%s\t%s\t%d\t%v\t\n", pkg.Name, pkg.Dir, strings.Join(pkg.InternalDeps, ", "), pkg.ExternalDeps, pkg.InFilter)
+	}
+	p.Flush()
+}
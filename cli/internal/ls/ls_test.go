@@ -0,0 +1,67 @@
+package ls
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/cmdutil"
+	"github.com/vercel/turborepo/cli/internal/context"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+func Test_summarizePackages(t *testing.T) {
+	ctx := &context.Context{
+		PackageNames: []string{"web", "ui"},
+		PackageInfos: map[interface{}]*fs.PackageJSON{
+			"web": {
+				Name:         "web",
+				Dir:          turbopath.AnchoredSystemPath("apps/web"),
+				InternalDeps: []string{"ui", "config"},
+				ExternalDeps: []string{"next@13.0.0", "react@18.2.0"},
+			},
+			"ui": {
+				Name: "ui",
+				Dir:  turbopath.AnchoredSystemPath("packages/ui"),
+			},
+		},
+	}
+	summary := summarizePackages(ctx, util.SetFromStrings([]string{"ui"}))
+	assert.Equal(t, []packageSummary{
+		{Name: "ui", Dir: "packages/ui", InternalDeps: []string{}, ExternalDeps: 0, InFilter: true},
+		{Name: "web", Dir: "apps/web", InternalDeps: []string{"config", "ui"}, ExternalDeps: 2, InFilter: false},
+	}, summary.Packages)
+
+	rendered, err := summary.render()
+	assert.NoError(t, err)
+	assert.Contains(t, string(rendered), `"internalDeps": []`)
+
+	table := &bytes.Buffer{}
+	summary.writeTable(table)
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	assert.Equal(t, []string{
+		"Name Path        Internal Deps External Deps In Filter",
+		"ui   packages/ui               0             true",
+		"web  apps/web    config, ui    2             false",
+	}, trimLines(lines))
+}
+
+func trimLines(lines []string) []string {
+	trimmed := make([]string, len(lines))
+	for i, line := range lines {
+		trimmed[i] = strings.TrimRight(line, " ")
+	}
+	return trimmed
+}
+
+func TestLsCommandIsReserved(t *testing.T) {
+	for _, args := range [][]string{{"build"}, {"--concurrency=2"}} {
+		cmd := GetCmd(cmdutil.NewHelper("test-version"))
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		assert.ErrorIs(t, err, errReservedCommand, args)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/util"
 )
 
 // PackageTask represents running a particular task in a particular package
@@ -31,14 +32,28 @@ func (pt *PackageTask) OutputPrefix() string {
 	return fmt.Sprintf("%v:%v", pt.PackageName, pt.Task)
 }
 
+// LogPrefix returns the prefix for this task's lines of output in the given mode
+func (pt *PackageTask) LogPrefix(mode util.LogPrefixMode) string {
+	switch mode {
+	case util.PackageLogPrefix:
+		return pt.PackageName
+	case util.TaskLogPrefix:
+		return pt.Task
+	case util.NoLogPrefix:
+		return ""
+	}
+	return pt.OutputPrefix()
+}
+
 // RepoRelativeLogFile returns the path to the log file for this task execution as a
 // relative path from the root of the monorepo.
 func (pt *PackageTask) RepoRelativeLogFile() string {
 	return filepath.Join(pt.Pkg.Dir.ToStringDuringMigration(), ".turbo", fmt.Sprintf("turbo-%v.log", pt.Task))
 }
 
-// HashableOutputs returns the package-relative globs for files to be considered outputs
-// of this task
+// HashableOutputs returns the globs for files to be considered outputs of this task. They
+// are relative to the package, except for those starting with "//", which are relative to
+// the repo root.
 func (pt *PackageTask) HashableOutputs() []string {
 	outputs := []string{fmt.Sprintf(".turbo/turbo-%v.log", pt.Task)}
 	outputs = append(outputs, pt.TaskDefinition.Outputs...)
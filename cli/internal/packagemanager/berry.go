@@ -19,6 +19,8 @@ var nodejsBerry = PackageManager{
 	Specfile:   "package.json",
 	Lockfile:   "yarn.lock",
 	PackageDir: "node_modules",
+	// Written regardless of nodeLinker, so it also covers Plug'n'Play installs
+	InstallStateFile: ".yarn/install-state.gz",
 
 	getWorkspaceGlobs: func(rootpath turbopath.AbsolutePath) ([]string, error) {
 		pkg, err := fs.ReadPackageJSON(rootpath.Join("package.json"))
@@ -42,12 +44,20 @@ var nodejsBerry = PackageManager{
 	},
 
 	canPrune: func(cwd turbopath.AbsolutePath) (bool, error) {
-		if isNMLinker, err := util.IsNMLinker(cwd.ToStringDuringMigration()); err != nil {
+		nodeLinker, err := util.GetNodeLinker(cwd.ToStringDuringMigration())
+		if err != nil {
 			return false, errors.Wrap(err, "could not determine if yarn is using `nodeLinker: node-modules`")
-		} else if !isNMLinker {
-			return false, errors.New("only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time")
 		}
-		return true, nil
+		switch nodeLinker {
+		case "node-modules":
+			return true, nil
+		case util.PnPLinker:
+			// A pruned Plug'n'Play install can't be produced from a subset of .pnp.cjs and the
+			// .yarn cache, so point the user at the configuration that prune does support.
+			return false, errors.New("yarn Plug'n'Play is not supported by prune. Set `nodeLinker: node-modules` in .yarnrc.yml and run `yarn install` before running prune")
+		default:
+			return false, errors.Errorf("yarn `nodeLinker: %v` is not supported by prune. Only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time", nodeLinker)
+		}
 	},
 
 	// Versions newer than 2.0 are berry, and before that we simply call them yarn.
@@ -0,0 +1,47 @@
+package packagemanager
+
+import (
+	"fmt"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+var nodejsBun = PackageManager{
+	Name:     "nodejs-bun",
+	Slug:     "bun",
+	Command:  "bun",
+	Specfile: "package.json",
+	// bun.lockb is a binary lockfile, so there is no readLockfile to parse it
+	Lockfile:     "bun.lockb",
+	PackageDir:   "node_modules",
+	ArgSeparator: []string{"--"},
+
+	getWorkspaceGlobs: func(rootpath turbopath.AbsolutePath) ([]string, error) {
+		pkg, err := fs.ReadPackageJSON(rootpath.Join("package.json"))
+		if err != nil {
+			return nil, fmt.Errorf("package.json: %w", err)
+		}
+		if len(pkg.Workspaces) == 0 {
+			return nil, fmt.Errorf("package.json: no workspaces found. Turborepo requires bun workspaces to be defined in the root package.json")
+		}
+		return pkg.Workspaces, nil
+	},
+
+	getWorkspaceIgnores: func(pm PackageManager, rootpath turbopath.AbsolutePath) ([]string, error) {
+		return []string{
+			"**/node_modules/**",
+		}, nil
+	},
+
+	Matches: func(manager string, version string) (bool, error) {
+		return manager == "bun", nil
+	},
+
+	detect: func(projectDirectory turbopath.AbsolutePath, packageManager *PackageManager) (bool, error) {
+		specfileExists := projectDirectory.Join(packageManager.Specfile).FileExists()
+		lockfileExists := projectDirectory.Join(packageManager.Lockfile).FileExists()
+
+		return (specfileExists && lockfileExists), nil
+	},
+}
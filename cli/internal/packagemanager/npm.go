@@ -1,20 +1,24 @@
 package packagemanager
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/lockfile"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 )
 
 var nodejsNpm = PackageManager{
-	Name:         "nodejs-npm",
-	Slug:         "npm",
-	Command:      "npm",
-	Specfile:     "package.json",
-	Lockfile:     "package-lock.json",
-	PackageDir:   "node_modules",
-	ArgSeparator: []string{"--"},
+	Name:       "nodejs-npm",
+	Slug:       "npm",
+	Command:    "npm",
+	Specfile:   "package.json",
+	Lockfile:   "package-lock.json",
+	PackageDir: "node_modules",
+	// npm rewrites its hidden lockfile whenever it changes node_modules
+	InstallStateFile: "node_modules/.package-lock.json",
+	ArgSeparator:     []string{"--"},
 
 	getWorkspaceGlobs: func(rootpath turbopath.AbsolutePath) ([]string, error) {
 		pkg, err := fs.ReadPackageJSON(rootpath.Join("package.json"))
@@ -47,4 +51,20 @@ var nodejsNpm = PackageManager{
 
 		return (specfileExists && lockfileExists), nil
 	},
+
+	readLockfile: func(contents []byte) (lockfile.Lockfile, error) {
+		npmLockfile, err := lockfile.DecodeNpmLockfile(contents)
+		if errors.Is(err, lockfile.ErrUnsupportedNpmLockfileVersion) {
+			// lockfileVersion 1 doesn't record where each package is installed, so those
+			// repositories carry on without a lockfile, as they did before it was read
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return npmLockfile, nil
+	},
+
+	// npm may be chosen by the packageManager field of package.json without there being a
+	// package-lock.json, in which case the repository carries on without a lockfile
+	lockfileOptional: true,
 }
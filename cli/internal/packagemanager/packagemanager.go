@@ -5,6 +5,7 @@
 package packagemanager
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -39,6 +40,10 @@ type PackageManager struct {
 	// The directory in which package assets are stored by the Package Manager.
 	PackageDir string
 
+	// The location of the file the Package Manager writes at the end of every install.
+	// Empty if it does not write one.
+	InstallStateFile string
+
 	// The location of the file that defines the workspace. Empty if workspaces defined in package.json
 	WorkspaceConfigurationPath string
 
@@ -63,6 +68,9 @@ type PackageManager struct {
 
 	// Read a lockfile for a given package manager
 	readLockfile func(contents []byte) (lockfile.Lockfile, error)
+
+	// Whether a missing lockfile is read as no lockfile rather than as an error
+	lockfileOptional bool
 }
 
 var packageManagers = []PackageManager{
@@ -71,10 +79,11 @@ var packageManagers = []PackageManager{
 	nodejsNpm,
 	nodejsPnpm,
 	nodejsPnpm6,
+	nodejsBun,
 }
 
 var (
-	packageManagerPattern = `(npm|pnpm|yarn)@(\d+)\.\d+\.\d+(-.+)?`
+	packageManagerPattern = `(npm|pnpm|yarn|bun)@(\d+)\.\d+\.\d+(-.+)?`
 	packageManagerRegex   = regexp.MustCompile(packageManagerPattern)
 )
 
@@ -175,10 +184,76 @@ func (pm PackageManager) ReadLockfile(cacheDir turbopath.AbsolutePath, projectDi
 	if pm.readLockfile == nil {
 		return nil, nil
 	}
-	contents, err := os.ReadFile(string(projectDirectory.Join(pm.Lockfile)))
+	lockfilePath := projectDirectory.Join(pm.Lockfile)
+	if pm.lockfileOptional && !lockfilePath.FileExists() {
+		return nil, nil
+	}
+	contents, err := os.ReadFile(lockfilePath.ToString())
 	if err != nil {
 		return nil, fmt.Errorf("reading %s: %w", pm.Lockfile, err)
 	}
 
 	return pm.readLockfile(contents)
 }
+
+// ErrNotInstalled is returned by CheckInstalled when dependencies need to be installed
+var ErrNotInstalled = errors.New("dependencies are not installed")
+
+// _installCheckFile is the project-relative file in which CheckInstalled records the contents
+// of the lockfile and the install state file it last saw
+var _installCheckFile = filepath.Join(".turbo", "install-check.json")
+
+// installCheck is what CheckInstalled records in _installCheckFile
+type installCheck struct {
+	InstallStateHash string `json:"installStateHash"`
+	LockfileHash     string `json:"lockfileHash"`
+}
+
+// CheckInstalled returns an error wrapping ErrNotInstalled if the dependencies of the project
+// have not been installed, or if the lockfile has changed since they were last installed.
+// Changes are detected by content rather than modification times, which checkouts and CI
+// caches don't preserve: if the lockfile differs from the previous check while the install
+// state file doesn't, there hasn't been an install since the lockfile changed.
+func (pm PackageManager) CheckInstalled(projectDirectory turbopath.AbsolutePath) error {
+	installHint := fmt.Sprintf("run `%v install` first", pm.Command)
+	if pm.InstallStateFile == "" {
+		// Without an install state file the most we can check is that packages have been installed at all
+		if !projectDirectory.Join(pm.PackageDir).DirExists() {
+			return fmt.Errorf("%w: %v does not exist, %v", ErrNotInstalled, pm.PackageDir, installHint)
+		}
+		return nil
+	}
+	installStateHash, err := fs.GitLikeHashFile(projectDirectory.Join(pm.InstallStateFile).ToString())
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %v does not exist, %v", ErrNotInstalled, pm.InstallStateFile, installHint)
+	} else if err != nil {
+		return fmt.Errorf("checking %v: %w", pm.InstallStateFile, err)
+	}
+	lockfileHash, err := fs.GitLikeHashFile(projectDirectory.Join(pm.Lockfile).ToString())
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing to compare the install against
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking %v: %w", pm.Lockfile, err)
+	}
+	current := installCheck{InstallStateHash: installStateHash, LockfileHash: lockfileHash}
+	checkFile := projectDirectory.Join(_installCheckFile)
+	if contents, err := checkFile.ReadFile(); err == nil {
+		previous := installCheck{}
+		if json.Unmarshal(contents, &previous) == nil && previous.InstallStateHash == current.InstallStateHash && previous.LockfileHash != current.LockfileHash {
+			return fmt.Errorf("%w: %v has changed since the last install, %v", ErrNotInstalled, pm.Lockfile, installHint)
+		}
+	}
+	// Without a previous check, assume the install matches the lockfile
+	contents, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err := checkFile.EnsureDir(); err != nil {
+		return fmt.Errorf("recording install check: %w", err)
+	}
+	if err := checkFile.WriteFile(contents, 0644); err != nil {
+		return fmt.Errorf("recording install check: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
@@ -83,6 +84,13 @@ func TestParsePackageManagerString(t *testing.T) {
 			wantVersion:    "111.0.1",
 			wantErr:        false,
 		},
+		{
+			name:           "supports bun",
+			packageManager: "bun@1.0.1",
+			wantManager:    "bun",
+			wantVersion:    "1.0.1",
+			wantErr:        false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -198,6 +206,12 @@ func Test_readPackageManager(t *testing.T) {
 			want:    "nodejs-berry",
 			wantErr: false,
 		},
+		{
+			name:    "finds bun from a package manager string",
+			pkg:     &fs.PackageJSON{PackageManager: "bun@1.0.1"},
+			want:    "nodejs-bun",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -232,6 +246,7 @@ func Test_GetWorkspaces(t *testing.T) {
 		"nodejs-yarn":  repoRoot.Join("../../../examples/basic"),
 		"nodejs-pnpm":  repoRoot.Join("../../../examples/with-pnpm"),
 		"nodejs-pnpm6": repoRoot.Join("../../../examples/with-pnpm"),
+		"nodejs-bun":   repoRoot.Join("../../../examples/basic"),
 	}
 
 	want := map[string][]string{
@@ -270,6 +285,13 @@ func Test_GetWorkspaces(t *testing.T) {
 			filepath.ToSlash(filepath.Join(cwd, "../../../examples/with-pnpm/packages/tsconfig/package.json")),
 			filepath.ToSlash(filepath.Join(cwd, "../../../examples/with-pnpm/packages/ui/package.json")),
 		},
+		"nodejs-bun": {
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/docs/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/web/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/eslint-config-custom/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/tsconfig/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/ui/package.json")),
+		},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -321,6 +343,7 @@ func Test_GetWorkspaceIgnores(t *testing.T) {
 		"nodejs-yarn":  {"apps/*/node_modules/**", "packages/*/node_modules/**"},
 		"nodejs-pnpm":  {"**/node_modules/**", "**/bower_components/**"},
 		"nodejs-pnpm6": {"**/node_modules/**", "**/bower_components/**"},
+		"nodejs-bun":   {"**/node_modules/**"},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -376,6 +399,7 @@ func Test_CanPrune(t *testing.T) {
 		"nodejs-yarn":  {true, false},
 		"nodejs-pnpm":  {true, false},
 		"nodejs-pnpm6": {true, false},
+		"nodejs-bun":   {false, false},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -403,3 +427,134 @@ func Test_CanPrune(t *testing.T) {
 		})
 	}
 }
+
+func Test_CanPruneBerryNodeLinker(t *testing.T) {
+	tests := []struct {
+		name      string
+		yarnRC    string
+		want      bool
+		wantError string
+	}{
+		{
+			name:   "node-modules",
+			yarnRC: "nodeLinker: node-modules\n",
+			want:   true,
+		},
+		{
+			name:      "default is pnp",
+			yarnRC:    "yarnPath: .yarn/releases/yarn-3.2.1.cjs\n",
+			wantError: "yarn Plug'n'Play is not supported by prune. Set `nodeLinker: node-modules` in .yarnrc.yml and run `yarn install` before running prune",
+		},
+		{
+			name:      "pnpm linker",
+			yarnRC:    "nodeLinker: pnpm\n",
+			wantError: "yarn `nodeLinker: pnpm` is not supported by prune. Only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootPath := fs.AbsolutePathFromUpstream(t.TempDir())
+			err := rootPath.Join(".yarnrc.yml").WriteFile([]byte(tt.yarnRC), 0644)
+			assert.NilError(t, err, "WriteFile")
+
+			canPrune, err := nodejsBerry.CanPrune(rootPath)
+			if tt.wantError != "" {
+				assert.Error(t, err, tt.wantError)
+			} else {
+				assert.NilError(t, err, "CanPrune")
+			}
+			assert.Equal(t, canPrune, tt.want)
+		})
+	}
+}
+
+func Test_CheckInstalled(t *testing.T) {
+	tests := []struct {
+		name           string
+		packageManager PackageManager
+		files          []string
+		wantErr        bool
+	}{
+		{
+			name:           "npm never installed",
+			packageManager: nodejsNpm,
+			files:          []string{"package-lock.json"},
+			wantErr:        true,
+		},
+		{
+			name:           "npm installed",
+			packageManager: nodejsNpm,
+			files:          []string{"package-lock.json", "node_modules/.package-lock.json"},
+		},
+		{
+			name:           "berry installed with pnp",
+			packageManager: nodejsBerry,
+			files:          []string{"yarn.lock", ".yarn/install-state.gz"},
+		},
+		{
+			name:           "bun without node_modules",
+			packageManager: nodejsBun,
+			files:          []string{"bun.lockb"},
+			wantErr:        true,
+		},
+		{
+			name:           "bun installed",
+			packageManager: nodejsBun,
+			files:          []string{"bun.lockb", "node_modules/a/index.js"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+			for _, name := range tt.files {
+				file := repoRoot.Join(name)
+				assert.NilError(t, file.EnsureDir())
+				assert.NilError(t, file.WriteFile([]byte(name), 0644))
+			}
+			err := tt.packageManager.CheckInstalled(repoRoot)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrNotInstalled)
+				assert.ErrorContains(t, err, tt.packageManager.Command+" install")
+			} else {
+				assert.NilError(t, err)
+			}
+		})
+	}
+}
+
+func Test_CheckInstalledComparesContents(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	lockfile := repoRoot.Join("pnpm-lock.yaml")
+	installState := repoRoot.Join("node_modules", ".modules.yaml")
+	assert.NilError(t, installState.EnsureDir())
+	assert.NilError(t, lockfile.WriteFile([]byte("lockfileVersion: 5.4"), 0644))
+	assert.NilError(t, installState.WriteFile([]byte("prunedAt: 1"), 0644))
+	assert.NilError(t, nodejsPnpm.CheckInstalled(repoRoot))
+
+	// Modification times alone don't count as a change
+	future := time.Now().Add(time.Hour)
+	assert.NilError(t, os.Chtimes(lockfile.ToString(), future, future))
+	assert.NilError(t, nodejsPnpm.CheckInstalled(repoRoot))
+
+	assert.NilError(t, lockfile.WriteFile([]byte("lockfileVersion: 5.4\nfoo: 1"), 0644))
+	err := nodejsPnpm.CheckInstalled(repoRoot)
+	assert.ErrorIs(t, err, ErrNotInstalled)
+	assert.ErrorContains(t, err, "pnpm-lock.yaml has changed")
+
+	// An install rewrites the install state file
+	assert.NilError(t, installState.WriteFile([]byte("prunedAt: 2"), 0644))
+	assert.NilError(t, nodejsPnpm.CheckInstalled(repoRoot))
+}
+
+func Test_ReadLockfileWithoutLockfile(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	cacheDir := repoRoot.Join("node_modules", ".cache", "turbo")
+
+	// npm can be chosen by the packageManager field alone
+	lockfile, err := nodejsNpm.ReadLockfile(cacheDir, repoRoot)
+	assert.NilError(t, err)
+	assert.Assert(t, lockfile == nil)
+
+	_, err = nodejsPnpm.ReadLockfile(cacheDir, repoRoot)
+	assert.ErrorContains(t, err, "reading pnpm-lock.yaml")
+}
@@ -17,12 +17,13 @@ type PnpmWorkspaces struct {
 }
 
 var nodejsPnpm = PackageManager{
-	Name:       "nodejs-pnpm",
-	Slug:       "pnpm",
-	Command:    "pnpm",
-	Specfile:   "package.json",
-	Lockfile:   "pnpm-lock.yaml",
-	PackageDir: "node_modules",
+	Name:             "nodejs-pnpm",
+	Slug:             "pnpm",
+	Command:          "pnpm",
+	Specfile:         "package.json",
+	Lockfile:         "pnpm-lock.yaml",
+	PackageDir:       "node_modules",
+	InstallStateFile: "node_modules/.modules.yaml",
 	// pnpm v7+ changed their handling of '--'. We no longer need to pass it to pass args to
 	// the script being run, and in fact doing so will cause the '--' to be passed through verbatim,
 	// potentially breaking scripts that aren't expecting it.
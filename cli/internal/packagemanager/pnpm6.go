@@ -23,6 +23,7 @@ var nodejsPnpm6 = PackageManager{
 	Specfile:                   "package.json",
 	Lockfile:                   "pnpm-lock.yaml",
 	PackageDir:                 "node_modules",
+	InstallStateFile:           "node_modules/.modules.yaml",
 	ArgSeparator:               []string{"--"},
 	WorkspaceConfigurationPath: "pnpm-workspace.yaml",
 
@@ -13,13 +13,14 @@ import (
 )
 
 var nodejsYarn = PackageManager{
-	Name:         "nodejs-yarn",
-	Slug:         "yarn",
-	Command:      "yarn",
-	Specfile:     "package.json",
-	Lockfile:     "yarn.lock",
-	PackageDir:   "node_modules",
-	ArgSeparator: []string{"--"},
+	Name:             "nodejs-yarn",
+	Slug:             "yarn",
+	Command:          "yarn",
+	Specfile:         "package.json",
+	Lockfile:         "yarn.lock",
+	PackageDir:       "node_modules",
+	InstallStateFile: "node_modules/.yarn-integrity",
+	ArgSeparator:     []string{"--"},
 
 	getWorkspaceGlobs: func(rootpath turbopath.AbsolutePath) ([]string, error) {
 		pkg, err := fs.ReadPackageJSON(rootpath.Join("package.json"))
@@ -0,0 +1,216 @@
+package prune
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+)
+
+// objectEntry is the position of an entry of an object, such as a task in the pipeline
+type objectEntry struct {
+	name string
+	// start is where the entry's leading whitespace and comments begin
+	start int
+	// value is where the entry's value begins
+	value int
+	// end is where the entry's value ends, before any comma
+	end int
+	// trail is where the rest of the line following the entry's comma ends, so that a
+	// comment on that line stays with the entry. It equals end when there's no comma.
+	trail int
+	comma bool
+}
+
+// removePipelineEntries removes the given tasks from the pipeline of a turbo.json, editing
+// its text so that everything else, including comments, is kept as it was written.
+func removePipelineEntries(contents []byte, taskIDs map[string]bool) ([]byte, error) {
+	s := &jsoncScanner{b: fs.BlankComments(contents), original: contents}
+	start, err := s.pipelineObject()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.objectEntries(start)
+	if err != nil {
+		return nil, err
+	}
+	kept := []objectEntry{}
+	for _, entry := range entries {
+		if !taskIDs[entry.name] {
+			kept = append(kept, entry)
+		}
+	}
+	// tail is what follows the last entry, up to the closing brace
+	tail := start + 1
+	if len(entries) > 0 {
+		tail = entries[len(entries)-1].trail
+	}
+	var b strings.Builder
+	b.Write(contents[:start+1])
+	for i, entry := range kept {
+		b.Write(contents[entry.start:entry.end])
+		if i < len(kept)-1 {
+			b.WriteString(",")
+		}
+		if entry.comma {
+			b.Write(contents[entry.end+1 : entry.trail])
+		}
+	}
+	b.Write(contents[tail:])
+	return []byte(b.String()), nil
+}
+
+// jsoncScanner finds the positions of values in JSON with comments. It scans a copy of the
+// document with its comments blanked out, at the same offsets as in the original.
+type jsoncScanner struct {
+	b        []byte
+	original []byte
+}
+
+// skipSpace returns the position of the first character at or after i that isn't whitespace
+// or part of a comment
+func (s *jsoncScanner) skipSpace(i int) int {
+	for i < len(s.b) && (s.b[i] == ' ' || s.b[i] == '\t' || s.b[i] == '\r' || s.b[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// lineEnd returns the position of the end of the line containing i, before the newline
+func (s *jsoncScanner) lineEnd(i int) int {
+	if end := strings.IndexByte(string(s.b[i:]), '\n'); end != -1 {
+		return i + end
+	}
+	return len(s.b)
+}
+
+// trailingComment returns where a line comment following i on the same line ends, or i
+func (s *jsoncScanner) trailingComment(i int) int {
+	j := i
+	for j < len(s.b) && (s.b[j] == ' ' || s.b[j] == '\t' || s.b[j] == '\r') {
+		j++
+	}
+	end := s.lineEnd(i)
+	if j == end && !bytes.Equal(s.b[i:end], s.original[i:end]) {
+		return end
+	}
+	return i
+}
+
+// value returns the end of the value starting at i
+func (s *jsoncScanner) value(i int) (int, error) {
+	if i >= len(s.b) {
+		return 0, fmt.Errorf("unexpected end of turbo.json")
+	}
+	switch s.b[i] {
+	case '"':
+		return s.str(i)
+	case '{', '[':
+		depth := 0
+		for i < len(s.b) {
+			i = s.skipSpace(i)
+			if i >= len(s.b) {
+				break
+			}
+			switch s.b[i] {
+			case '"':
+				end, err := s.str(i)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+			i++
+		}
+		return 0, fmt.Errorf("unexpected end of turbo.json")
+	}
+	for i < len(s.b) && !strings.ContainsRune(",}] \t\r\n", rune(s.b[i])) {
+		i++
+	}
+	return i, nil
+}
+
+// str returns the end of the string starting at i
+func (s *jsoncScanner) str(i int) (int, error) {
+	for j := i + 1; j < len(s.b); j++ {
+		switch s.b[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string in turbo.json")
+}
+
+// objectEntries returns the entries of the object starting at i
+func (s *jsoncScanner) objectEntries(i int) ([]objectEntry, error) {
+	if i >= len(s.b) || s.b[i] != '{' {
+		return nil, fmt.Errorf("expected an object in turbo.json")
+	}
+	entries := []objectEntry{}
+	start := i + 1
+	for {
+		key := s.skipSpace(start)
+		if key >= len(s.b) {
+			return nil, fmt.Errorf("unexpected end of turbo.json")
+		}
+		if s.b[key] == '}' {
+			return entries, nil
+		}
+		keyEnd, err := s.str(key)
+		if err != nil {
+			return nil, err
+		}
+		var name string
+		if err := json.Unmarshal(s.b[key:keyEnd], &name); err != nil {
+			return nil, err
+		}
+		colon := s.skipSpace(keyEnd)
+		if colon >= len(s.b) || s.b[colon] != ':' {
+			return nil, fmt.Errorf("expected a colon after %q in turbo.json", name)
+		}
+		value := s.skipSpace(colon + 1)
+		end, err := s.value(value)
+		if err != nil {
+			return nil, err
+		}
+		entry := objectEntry{name: name, start: start, value: value, end: end, trail: end}
+		next := s.skipSpace(end)
+		if next < len(s.b) && s.b[next] == ',' {
+			// Comments between the value and the comma stay with the entry
+			entry.end = next
+			entry.comma = true
+			entry.trail = s.trailingComment(next + 1)
+			start = entry.trail
+		}
+		entries = append(entries, entry)
+		if !entry.comma {
+			return entries, nil
+		}
+	}
+}
+
+// pipelineObject returns the start of the value of the top-level "pipeline" key
+func (s *jsoncScanner) pipelineObject() (int, error) {
+	entries, err := s.objectEntries(s.skipSpace(0))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.name == "pipeline" {
+			return entry.value, nil
+		}
+	}
+	return 0, fmt.Errorf("turbo.json has no pipeline")
+}
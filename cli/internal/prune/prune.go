@@ -2,7 +2,9 @@ package prune
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -12,23 +14,27 @@ import (
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"github.com/vercel/turborepo/cli/internal/ui"
+	"github.com/vercel/turborepo/cli/internal/util"
 
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
+	"muzzammil.xyz/jsonc"
 )
 
 type opts struct {
 	scope     string
 	docker    bool
 	outputDir string
+	json      bool
 }
 
 func addPruneFlags(opts *opts, flags *pflag.FlagSet) {
 	flags.StringVar(&opts.scope, "scope", "", "Specify package to act as entry point for pruned monorepo (required).")
 	flags.BoolVar(&opts.docker, "docker", false, "Output pruned workspace into 'full' and 'json' directories optimized for Docker layer caching.")
 	flags.StringVar(&opts.outputDir, "out-dir", "out", "Set the root directory for files output by this command")
+	flags.BoolVar(&opts.json, "json", false, "Output a summary of the pruned workspaces as JSON.")
 	// No-op the cwd flag while the root level command is not yet cobra
 	_ = flags.String("cwd", "", "")
 	if err := flags.MarkHidden("cwd"); err != nil {
@@ -80,6 +86,28 @@ type prune struct {
 	base *cmdutil.CmdBase
 }
 
+// prunedWorkspace is a workspace included in the pruned monorepo
+type prunedWorkspace struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+// pruneSummary is the output of turbo prune --json
+type pruneSummary struct {
+	Scope      string            `json:"scope"`
+	OutDir     string            `json:"outDir"`
+	Docker     bool              `json:"docker"`
+	Workspaces []prunedWorkspace `json:"workspaces"`
+}
+
+// render returns the summary as JSON, with the workspaces sorted by name
+func (s *pruneSummary) render() ([]byte, error) {
+	sort.Slice(s.Workspaces, func(i, j int) bool {
+		return s.Workspaces[i].Name < s.Workspaces[j].Name
+	})
+	return json.MarshalIndent(s, "", "  ")
+}
+
 // Prune creates a smaller monorepo with only the required workspaces
 func (p *prune) prune(opts *opts) error {
 	cacheDir := cache.DefaultLocation(p.base.RepoRoot)
@@ -118,7 +146,15 @@ func (p *prune) prune(opts *opts) error {
 		return errors.Errorf("this command is not yet implemented for %s", ctx.PackageManager.Name)
 	}
 
-	p.base.UI.Output(fmt.Sprintf("Generating pruned monorepo for %v in %v", ui.Bold(opts.scope), ui.Bold(outDir.ToString())))
+	summary := &pruneSummary{
+		Scope:      opts.scope,
+		OutDir:     outDir.ToString(),
+		Docker:     opts.docker,
+		Workspaces: []prunedWorkspace{},
+	}
+	if !opts.json {
+		p.base.UI.Output(fmt.Sprintf("Generating pruned monorepo for %v in %v", ui.Bold(opts.scope), ui.Bold(outDir.ToString())))
+	}
 
 	packageJSONPath := outDir.Join("package.json")
 	if err := packageJSONPath.EnsureDir(); err != nil {
@@ -141,10 +177,12 @@ func (p *prune) prune(opts *opts) error {
 	lockfileKeys := make([]string, 0, len(rootPackageJSON.TransitiveDeps))
 	lockfileKeys = append(lockfileKeys, rootPackageJSON.TransitiveDeps...)
 
+	packages := make(util.Set)
 	for _, internalDep := range targets {
 		if internalDep == ctx.RootNode {
 			continue
 		}
+		packages.Add(internalDep)
 		workspaces = append(workspaces, ctx.PackageInfos[internalDep].Dir)
 		targetDir := fullDir.Join(ctx.PackageInfos[internalDep].Dir.ToStringDuringMigration())
 		if err := targetDir.EnsureDir(); err != nil {
@@ -165,7 +203,13 @@ func (p *prune) prune(opts *opts) error {
 
 		lockfileKeys = append(lockfileKeys, ctx.PackageInfos[internalDep].TransitiveDeps...)
 
-		p.base.UI.Output(fmt.Sprintf(" - Added %v", ctx.PackageInfos[internalDep].Name))
+		summary.Workspaces = append(summary.Workspaces, prunedWorkspace{
+			Name: ctx.PackageInfos[internalDep].Name,
+			Dir:  ctx.PackageInfos[internalDep].Dir.ToUnixPath().ToString(),
+		})
+		if !opts.json {
+			p.base.UI.Output(fmt.Sprintf(" - Added %v", ctx.PackageInfos[internalDep].Name))
+		}
 	}
 	p.base.Logger.Trace("new workspaces", "value", workspaces)
 	if fs.FileExists(".gitignore") {
@@ -175,7 +219,7 @@ func (p *prune) prune(opts *opts) error {
 	}
 
 	if fs.FileExists("turbo.json") {
-		if err := fs.CopyFile(&fs.LstatCachedFile{Path: p.base.RepoRoot.Join("turbo.json")}, fullDir.Join("turbo.json").ToStringDuringMigration()); err != nil {
+		if err := writePrunedTurboJSON(p.base.RepoRoot.Join("turbo.json"), fullDir.Join("turbo.json"), packages); err != nil {
 			return errors.Wrap(err, "failed to copy root turbo.json")
 		}
 	}
@@ -221,5 +265,49 @@ func (p *prune) prune(opts *opts) error {
 		return errors.Wrap(err, "Failed to flush pruned lockfile")
 	}
 
+	if opts.json {
+		bytes, err := summary.render()
+		if err != nil {
+			return errors.Wrap(err, "failed to render JSON")
+		}
+		p.base.UI.Output(string(bytes))
+	}
 	return nil
 }
+
+// writePrunedTurboJSON copies the turbo.json at src to dst, leaving out the pipeline
+// entries for tasks of packages that aren't in the pruned workspace. Tasks that aren't
+// scoped to a package, and those of the root package, are kept as they are.
+func writePrunedTurboJSON(src turbopath.AbsolutePath, dst turbopath.AbsolutePath, packages util.Set) error {
+	contents, err := src.ReadFile()
+	if err != nil {
+		return err
+	}
+	var turboJSON map[string]json.RawMessage
+	if err := jsonc.Unmarshal(contents, &turboJSON); err != nil {
+		return err
+	}
+	var pipeline map[string]json.RawMessage
+	if rawPipeline, ok := turboJSON["pipeline"]; ok {
+		if err := json.Unmarshal(rawPipeline, &pipeline); err != nil {
+			return err
+		}
+	}
+	pruned := make(map[string]bool)
+	for taskID := range pipeline {
+		if !util.IsPackageTask(taskID) {
+			continue
+		}
+		packageName, _ := util.GetPackageTaskFromId(taskID)
+		if packageName != util.RootPkgName && !packages.Includes(packageName) {
+			pruned[taskID] = true
+		}
+	}
+	// Keep the file as it was written, comments and all, other than the pruned entries
+	if len(pruned) > 0 {
+		if contents, err = removePipelineEntries(contents, pruned); err != nil {
+			return err
+		}
+	}
+	return dst.WriteFile(contents, 0644)
+}
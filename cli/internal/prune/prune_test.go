@@ -0,0 +1,111 @@
+package prune
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/util"
+	"muzzammil.xyz/jsonc"
+)
+
+func Test_writePrunedTurboJSON(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	outDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	src := repoRoot.Join("turbo.json")
+	assert.NoError(t, src.WriteFile([]byte(`{
+  // pipeline for the whole repo
+  "$schema": "https://turborepo.org/schema.json",
+  "globalDependencies": [".env"],
+  "pipeline": {
+    "build": {"dependsOn": ["^build"]},
+    "web#build": {"dependsOn": ["^build"], "outputs": [".next/**"]}, // next app
+    // docs site
+    "docs#build": {"outputs": ["out/**"]},
+    "@acme/ui#test": {},
+    "//#lint": {}
+  }
+}`), 0644))
+
+	dst := outDir.Join("turbo.json")
+	assert.NoError(t, writePrunedTurboJSON(src, dst, util.SetFromStrings([]string{"web", "@acme/ui"})))
+	contents, err := dst.ReadFile()
+	assert.NoError(t, err)
+	var pruned struct {
+		GlobalDependencies []string                   `json:"globalDependencies"`
+		Pipeline           map[string]json.RawMessage `json:"pipeline"`
+	}
+	assert.NoError(t, jsonc.Unmarshal(contents, &pruned))
+	assert.Contains(t, string(contents), "// pipeline for the whole repo")
+	assert.Contains(t, string(contents), "// next app")
+	assert.NotContains(t, string(contents), "docs")
+	tasks := []string{}
+	for taskID := range pruned.Pipeline {
+		tasks = append(tasks, taskID)
+	}
+	sort.Strings(tasks)
+	assert.Equal(t, []string{"//#lint", "@acme/ui#test", "build", "web#build"}, tasks)
+	assert.JSONEq(t, `{"dependsOn": ["^build"], "outputs": [".next/**"]}`, string(pruned.Pipeline["web#build"]))
+	assert.Equal(t, []string{".env"}, pruned.GlobalDependencies)
+
+	// Nothing to prune leaves the file untouched
+	assert.NoError(t, writePrunedTurboJSON(src, dst, util.SetFromStrings([]string{"web", "docs", "@acme/ui"})))
+	original, err := src.ReadFile()
+	assert.NoError(t, err)
+	contents, err = dst.ReadFile()
+	assert.NoError(t, err)
+	assert.Equal(t, string(original), string(contents))
+}
+
+func Test_writePrunedTurboJSONHashComments(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	outDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	src := repoRoot.Join("turbo.json")
+	assert.NoError(t, src.WriteFile([]byte(`{
+  # pipeline for the whole repo
+  "pipeline": {
+    "web#build": {"outputs": [".next/**"]}, # next app
+    # docs site
+    "docs#build": {"outputs": ["out/**"]}
+  }
+}`), 0644))
+
+	dst := outDir.Join("turbo.json")
+	assert.NoError(t, writePrunedTurboJSON(src, dst, util.SetFromStrings([]string{"web"})))
+	contents, err := dst.ReadFile()
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "# pipeline for the whole repo")
+	assert.Contains(t, string(contents), "# next app")
+	assert.NotContains(t, string(contents), "docs")
+	var pruned struct {
+		Pipeline map[string]json.RawMessage `json:"pipeline"`
+	}
+	assert.NoError(t, json.Unmarshal(fs.BlankComments(contents), &pruned))
+	assert.Len(t, pruned.Pipeline, 1)
+	assert.JSONEq(t, `{"outputs": [".next/**"]}`, string(pruned.Pipeline["web#build"]))
+}
+
+func Test_pruneSummary(t *testing.T) {
+	summary := &pruneSummary{
+		Scope:  "web",
+		OutDir: "/repo/out",
+		Docker: true,
+		Workspaces: []prunedWorkspace{
+			{Name: "web", Dir: "apps/web"},
+			{Name: "@acme/ui", Dir: "packages/ui"},
+		},
+	}
+	bytes, err := summary.render()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+  "scope": "web",
+  "outDir": "/repo/out",
+  "docker": true,
+  "workspaces": [
+    {"name": "@acme/ui", "dir": "packages/ui"},
+    {"name": "web", "dir": "apps/web"}
+  ]
+}`, string(bytes))
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vercel/turborepo/cli/internal/analytics"
+	"github.com/vercel/turborepo/cli/internal/cache"
+)
+
+// _cacheEventHit is the event caches report restored artifacts with
+const _cacheEventHit = "HIT"
+
+// cacheHitRecorder passes the events of the caches on to analytics, and remembers which
+// cache each artifact was restored from and how long its task took to run
+type cacheHitRecorder struct {
+	analytics.Recorder
+	mu   sync.Mutex
+	hits map[string]*cache.CacheEvent
+}
+
+func newCacheHitRecorder(recorder analytics.Recorder) *cacheHitRecorder {
+	return &cacheHitRecorder{
+		Recorder: recorder,
+		hits:     make(map[string]*cache.CacheEvent),
+	}
+}
+
+// LogEvent implements analytics.Recorder
+func (r *cacheHitRecorder) LogEvent(payload analytics.EventPayload) {
+	if event, ok := payload.(*cache.CacheEvent); ok && event.Event == _cacheEventHit {
+		r.mu.Lock()
+		r.hits[event.Hash] = event
+		r.mu.Unlock()
+	}
+	r.Recorder.LogEvent(payload)
+}
+
+// hit returns the source the artifact with the given hash was restored from, and how
+// long its task took to run when it was cached
+func (r *cacheHitRecorder) hit(hash string) (string, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event, ok := r.hits[hash]
+	if !ok {
+		return "", 0, false
+	}
+	return event.Source, time.Duration(event.Duration) * time.Millisecond, true
+}
@@ -0,0 +1,223 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/taskhash"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// _taskHashInputsDir is the repo-relative directory that the inputs to the most recently
+// cached hash of each task are recorded in, one file per task
+var _taskHashInputsDir = filepath.Join(".turbo", "task-hash-inputs")
+
+// recordedTaskHash is the breakdown of the most recently cached hash of a task
+type recordedTaskHash struct {
+	TaskID    string                      `json:"taskId"`
+	Breakdown *taskhash.TaskHashBreakdown `json:"breakdown"`
+}
+
+// taskHashInputsPath returns the file that the hash inputs of the given task are recorded in.
+// Task IDs can contain path separators, so the file is named after their hash.
+func taskHashInputsPath(repoRoot turbopath.AbsolutePath, taskID string) (turbopath.AbsolutePath, error) {
+	name, err := fs.HashObject(taskID)
+	if err != nil {
+		return "", err
+	}
+	return repoRoot.Join(_taskHashInputsDir, name+".json"), nil
+}
+
+// readTaskHashInputs returns the hash inputs recorded for the given task, or nil if none
+// were recorded
+func readTaskHashInputs(repoRoot turbopath.AbsolutePath, taskID string) (*taskhash.TaskHashBreakdown, error) {
+	path, err := taskHashInputsPath(repoRoot, taskID)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := path.ReadFile()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	recorded := &recordedTaskHash{}
+	if err := json.Unmarshal(contents, recorded); err != nil {
+		return nil, fmt.Errorf("reading hash inputs of %v: %w", taskID, err)
+	}
+	if recorded.TaskID != taskID {
+		return nil, nil
+	}
+	return recorded.Breakdown, nil
+}
+
+// writeTaskHashInputs records the hash inputs of a task whose outputs are cached, for later
+// runs to compare against
+func writeTaskHashInputs(repoRoot turbopath.AbsolutePath, taskID string, breakdown *taskhash.TaskHashBreakdown) error {
+	path, err := taskHashInputsPath(repoRoot, taskID)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(&recordedTaskHash{TaskID: taskID, Breakdown: breakdown}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	return path.WriteFile(bytes, 0644)
+}
+
+// cacheMissReport lists why each task that was run missed the cache
+type cacheMissReport struct {
+	Tasks []cacheMissReportTask `json:"tasks"`
+}
+
+type cacheMissReportTask struct {
+	TaskID string `json:"taskId"`
+	Hash   string `json:"hash"`
+	// PreviousHash is the most recently cached hash of the task, if one was recorded
+	PreviousHash string `json:"previousHash,omitempty"`
+	// Changes describe each hash input that differs from the previous hash
+	Changes []string `json:"changes"`
+}
+
+// newCacheMissReport explains the cache miss of each of the given tasks against the hash
+// inputs recorded for them. Env var values are hashed with envVarKey.
+func newCacheMissReport(repoRoot turbopath.AbsolutePath, misses []string, hashes *taskhash.Tracker, envVarKey []byte) (*cacheMissReport, error) {
+	report := &cacheMissReport{Tasks: []cacheMissReportTask{}}
+	for _, taskID := range misses {
+		current, err := hashes.GetTaskHashBreakdown(taskID, envVarKey)
+		if err != nil {
+			return nil, err
+		}
+		previous, err := readTaskHashInputs(repoRoot, taskID)
+		if err != nil {
+			return nil, err
+		}
+		task := cacheMissReportTask{
+			TaskID: taskID,
+			Hash:   current.Hash,
+		}
+		if previous == nil {
+			task.Changes = []string{"no previous hash recorded"}
+		} else {
+			task.PreviousHash = previous.Hash
+			task.Changes = explainTaskHashChange(previous, current)
+		}
+		report.Tasks = append(report.Tasks, task)
+	}
+	return report, nil
+}
+
+// write saves the report as JSON to path
+func (c *cacheMissReport) write(path turbopath.AbsolutePath) error {
+	bytes, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	return path.WriteFile(bytes, 0644)
+}
+
+// explainTaskHashChange describes each difference between the previous hash inputs of a task
+// and the current ones
+func explainTaskHashChange(previous *taskhash.TaskHashBreakdown, current *taskhash.TaskHashBreakdown) []string {
+	changes := []string{}
+	if previous.Hash == current.Hash {
+		return append(changes, "hash unchanged, its outputs were not found in the cache")
+	}
+	if previous.FileHashes != nil && current.FileHashes != nil {
+		for _, file := range sortedKeys(previous.FileHashes, current.FileHashes) {
+			before, hadFile := previous.FileHashes[file]
+			after, hasFile := current.FileHashes[file]
+			if change := describeChange(hadFile, hasFile, before != after); change != "" {
+				changes = append(changes, fmt.Sprintf("file %v %v", file, change))
+			}
+		}
+	} else if previous.HashOfFiles != current.HashOfFiles {
+		changes = append(changes, "input files changed")
+	}
+	for _, name := range sortedKeys(previous.EnvVarHashes, current.EnvVarHashes) {
+		before, hadVar := previous.EnvVarHashes[name]
+		after, hasVar := current.EnvVarHashes[name]
+		if change := describeChange(hadVar, hasVar, before != after); change != "" {
+			changes = append(changes, fmt.Sprintf("env var %v %v", name, change))
+		}
+	}
+	if previous.ExternalDepsHash != current.ExternalDepsHash {
+		changes = append(changes, "external dependencies changed")
+	}
+	if !sameStrings(previous.DependencyHashes, current.DependencyHashes) {
+		changes = append(changes, "hashes of dependency tasks changed")
+	}
+	if previous.GlobalHash != current.GlobalHash {
+		changes = append(changes, "global hash changed")
+	}
+	if !sameStrings(previous.Outputs, current.Outputs) {
+		changes = append(changes, "outputs changed")
+	}
+	if !sameStrings(previous.PassThroughArgs, current.PassThroughArgs) {
+		changes = append(changes, "pass through arguments changed")
+	}
+	if previous.CacheScope != current.CacheScope {
+		changes = append(changes, fmt.Sprintf("cache scope changed from %q to %q", previous.CacheScope, current.CacheScope))
+	}
+	if previous.DefaultInputs != current.DefaultInputs {
+		changes = append(changes, fmt.Sprintf("default inputs changed from %q to %q", previous.DefaultInputs, current.DefaultInputs))
+	}
+	return changes
+}
+
+// sameStrings returns whether two lists hold the same strings in the same order. A nil list
+// is the same as an empty one, since they can't be told apart once recorded.
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeCacheMissReport writes why each cacheable task that was run missed the cache, then
+// records the hash inputs of the tasks whose outputs are now cached for later runs
+func (r *run) writeCacheMissReport(summary *runSummary, pipeline fs.Pipeline, rs *runSpec, hashes *taskhash.Tracker) error {
+	cacheable := func(taskID string) bool {
+		taskDefinition, ok := pipeline.GetTaskDefinition(taskID)
+		return ok && taskDefinition.ShouldCache
+	}
+	envVarKey, err := envVarHashKey()
+	if err != nil {
+		return err
+	}
+	report, err := newCacheMissReport(r.base.RepoRoot, summary.cacheMisses(cacheable), hashes, envVarKey)
+	if err != nil {
+		return err
+	}
+	if err := report.write(fs.ResolveUnknownPath(r.base.RepoRoot, rs.Opts.runOpts.cacheMissReport)); err != nil {
+		return err
+	}
+	for _, task := range summary.Tasks {
+		built := task.Status == TargetBuilt.String() && !rs.Opts.runcacheOpts.SkipWrites
+		if !cacheable(task.TaskID) || (!built && task.Status != TargetCached.String()) {
+			continue
+		}
+		breakdown, err := hashes.GetTaskHashBreakdown(task.TaskID, envVarKey)
+		if err != nil {
+			return err
+		}
+		if err := writeTaskHashInputs(r.base.RepoRoot, task.TaskID, breakdown); err != nil {
+			r.logWarning(fmt.Sprintf("failed to record the hash inputs of %v", task.TaskID), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package run
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/taskhash"
+)
+
+func Test_explainTaskHashChange(t *testing.T) {
+	previous := &taskhash.TaskHashBreakdown{
+		Hash:             "before",
+		HashOfFiles:      "files-before",
+		FileHashes:       map[string]string{"src/index.ts": "a", "src/removed.ts": "b", "package.json": "c"},
+		ExternalDepsHash: "deps",
+		EnvVarHashes:     map[string]string{"API_URL": "x", "NODE_ENV": "y"},
+		DependencyHashes: []string{"dep-before"},
+		GlobalHash:       "global",
+		Outputs:          []string{"dist/**"},
+	}
+	current := &taskhash.TaskHashBreakdown{
+		Hash:             "after",
+		HashOfFiles:      "files-after",
+		FileHashes:       map[string]string{"src/index.ts": "changed", "src/added.ts": "d", "package.json": "c"},
+		ExternalDepsHash: "deps",
+		EnvVarHashes:     map[string]string{"API_URL": "x", "NODE_ENV": "z"},
+		DependencyHashes: []string{"dep-after"},
+		GlobalHash:       "global",
+		Outputs:          []string{"dist/**"},
+		PassThroughArgs:  []string{},
+	}
+	want := []string{
+		"file src/added.ts added",
+		"file src/index.ts changed",
+		"file src/removed.ts removed",
+		"env var NODE_ENV changed",
+		"hashes of dependency tasks changed",
+	}
+	if got := explainTaskHashChange(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("explainTaskHashChange got %v, want %v", got, want)
+	}
+
+	// Without the hashes of each file, only the hash of all of them can be compared
+	previous.FileHashes = nil
+	want[0] = "input files changed"
+	want = append(want[:1], want[3:]...)
+	if got := explainTaskHashChange(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("explainTaskHashChange got %v, want %v", got, want)
+	}
+
+	want = []string{"hash unchanged, its outputs were not found in the cache"}
+	if got := explainTaskHashChange(current, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("explainTaskHashChange got %v, want %v", got, want)
+	}
+}
+
+func Test_taskHashInputsRoundTrip(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	previous, err := readTaskHashInputs(repoRoot, "@acme/ui#build")
+	if err != nil {
+		t.Fatalf("readTaskHashInputs: %v", err)
+	}
+	if previous != nil {
+		t.Errorf("expected no hash inputs before any were recorded, got %v", previous)
+	}
+
+	breakdown := &taskhash.TaskHashBreakdown{
+		Hash:         "hash",
+		EnvVarHashes: map[string]string{"API_URL": "x"},
+		Outputs:      []string{"dist/**"},
+	}
+	if err := writeTaskHashInputs(repoRoot, "@acme/ui#build", breakdown); err != nil {
+		t.Fatalf("writeTaskHashInputs: %v", err)
+	}
+	got, err := readTaskHashInputs(repoRoot, "@acme/ui#build")
+	if err != nil {
+		t.Fatalf("readTaskHashInputs: %v", err)
+	}
+	if !reflect.DeepEqual(got, breakdown) {
+		t.Errorf("readTaskHashInputs got %#v, want %#v", got, breakdown)
+	}
+	other, err := readTaskHashInputs(repoRoot, "@acme/ui#test")
+	if err != nil {
+		t.Fatalf("readTaskHashInputs: %v", err)
+	}
+	if other != nil {
+		t.Errorf("expected no hash inputs for another task, got %v", other)
+	}
+}
@@ -0,0 +1,80 @@
+package run
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vercel/turborepo/cli/internal/cmdutil"
+	"github.com/vercel/turborepo/cli/internal/context"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// completeTasks completes task names from the pipeline in turbo.json
+func completeTasks(helper *cmdutil.Helper) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		base, err := helper.GetCmdBase(cmd.Flags())
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.Join("package.json"))
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		turboJSON, err := fs.ReadTurboConfig(base.RepoRoot, rootPackageJSON)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return taskCompletions(turboJSON.Pipeline, args, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completePackages completes the names of the packages in the monorepo, for use with --filter and --scope
+func completePackages(helper *cmdutil.Helper, opts *Opts) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		base, err := helper.GetCmdBase(cmd.Flags())
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.Join("package.json"))
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		pkgDepGraph, err := context.New(context.WithGraph(base.RepoRoot, rootPackageJSON, opts.cacheOpts.ResolveCacheDir(base.RepoRoot)))
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return packageCompletions(pkgDepGraph.PackageNames, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// taskCompletions returns the tasks in the pipeline that start with toComplete and haven't
+// already been specified. Package-specific tasks, such as web#build, are not valid targets.
+func taskCompletions(pipeline fs.Pipeline, specified []string, toComplete string) []string {
+	alreadySpecified := make(util.Set)
+	for _, task := range specified {
+		alreadySpecified.Add(task)
+	}
+	completions := []string{}
+	for task := range pipeline {
+		if util.IsPackageTask(task) || alreadySpecified.Includes(task) || !strings.HasPrefix(task, toComplete) {
+			continue
+		}
+		completions = append(completions, task)
+	}
+	sort.Strings(completions)
+	return completions
+}
+
+// packageCompletions returns the package names that start with toComplete
+func packageCompletions(packageNames []string, toComplete string) []string {
+	completions := []string{}
+	for _, name := range packageNames {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	sort.Strings(completions)
+	return completions
+}
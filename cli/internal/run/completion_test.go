@@ -0,0 +1,27 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/fs"
+)
+
+func Test_taskCompletions(t *testing.T) {
+	pipeline := fs.Pipeline{
+		"build":     {},
+		"test":      {},
+		"typecheck": {},
+		"web#build": {},
+	}
+	assert.Equal(t, []string{"build", "test", "typecheck"}, taskCompletions(pipeline, nil, ""))
+	assert.Equal(t, []string{"test", "typecheck"}, taskCompletions(pipeline, nil, "t"))
+	assert.Equal(t, []string{"typecheck"}, taskCompletions(pipeline, []string{"test"}, "t"))
+	assert.Equal(t, []string{}, taskCompletions(pipeline, nil, "web"))
+}
+
+func Test_packageCompletions(t *testing.T) {
+	packageNames := []string{"web", "docs", "@repo/ui", "webhooks"}
+	assert.Equal(t, []string{"@repo/ui", "docs", "web", "webhooks"}, packageCompletions(packageNames, ""))
+	assert.Equal(t, []string{"web", "webhooks"}, packageCompletions(packageNames, "web"))
+}
@@ -0,0 +1,133 @@
+package run
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/process"
+)
+
+// The lifecycle events written to an event stream
+const (
+	_runStartEvent     = "run-start"
+	_taskStartEvent    = "task-start"
+	_taskCacheHitEvent = "task-cache-hit"
+	_taskEndEvent      = "task-end"
+	_runEndEvent       = "run-end"
+)
+
+// streamEvent is a single line of an event stream. Task events carry the task as it
+// would appear in the run summary.
+type streamEvent struct {
+	Event string          `json:"event"`
+	Time  time.Time       `json:"time"`
+	Task  *runSummaryTask `json:"task,omitempty"`
+	// ExitCode is set for task-end and run-end events
+	ExitCode *int `json:"exitCode,omitempty"`
+	// DurationMs is the duration of the whole run, set for run-end events
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// eventStream writes run lifecycle events as newline-delimited JSON as they happen, so
+// that the progress of a run can be followed live.
+type eventStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	// file is nil when writing to stdout, which isn't ours to close
+	file   *os.File
+	closed bool
+}
+
+// newEventStream writes events to the file at the given path, or to stdout for "-"
+func newEventStream(path string, stdout io.Writer) (*eventStream, error) {
+	if path == "-" {
+		return &eventStream{encoder: json.NewEncoder(stdout)}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open event stream")
+	}
+	return &eventStream{encoder: json.NewEncoder(file), file: file}, nil
+}
+
+// emit writes a single event. Events are written unbuffered, and are dropped once the
+// stream is closed.
+func (s *eventStream) emit(event *streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	// A dashboard missing an event shouldn't fail the run
+	_ = s.encoder.Encode(event)
+}
+
+func (s *eventStream) runStarted(startAt time.Time) {
+	s.emit(&streamEvent{Event: _runStartEvent, Time: startAt})
+}
+
+func (s *eventStream) runEnded(startAt time.Time, exitCode int) {
+	now := time.Now()
+	s.emit(&streamEvent{
+		Event:      _runEndEvent,
+		Time:       now,
+		ExitCode:   &exitCode,
+		DurationMs: now.Sub(startAt).Milliseconds(),
+	})
+}
+
+// runExitCode is the exit code of a run that returned err
+func runExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr := &process.ChildExit{}
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode
+	}
+	return 1
+}
+
+func (s *eventStream) taskStarted(state *BuildTargetState) {
+	s.emit(&streamEvent{Event: _taskStartEvent, Time: state.StartAt, Task: state.summaryTask()})
+}
+
+// taskFinished writes a task-end event for the task, preceded by a task-cache-hit
+// event if its outputs were restored from cache
+func (s *eventStream) taskFinished(state *BuildTargetState) {
+	now := time.Now()
+	task := state.summaryTask()
+	if state.Status == TargetCached {
+		s.emit(&streamEvent{Event: _taskCacheHitEvent, Time: now, Task: task})
+	}
+	exitCode := 0
+	if state.Status == TargetBuildFailed {
+		exitCode = 1
+		exitErr := &process.ChildExit{}
+		if errors.As(state.Err, &exitErr) {
+			exitCode = exitErr.ExitCode
+		}
+	}
+	s.emit(&streamEvent{Event: _taskEndEvent, Time: now, Task: task, ExitCode: &exitCode})
+}
+
+// Close stops writing events and closes the underlying file. It is safe to call more than once.
+func (s *eventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+}
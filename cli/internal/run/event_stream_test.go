@@ -0,0 +1,81 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/process"
+)
+
+func Test_eventStream(t *testing.T) {
+	out := &bytes.Buffer{}
+	events, err := newEventStream("-", out)
+	assert.NoError(t, err)
+	startAt := time.Now()
+	runState := NewRunState(startAt, "")
+	runState.events = events
+
+	events.runStarted(startAt)
+	runState.Run("libA#build")(TargetCached, nil)
+	runState.Run("libB#build")(TargetBuildFailed, &process.ChildExit{ExitCode: 2, Command: "npm run build"})
+	events.runEnded(startAt, 2)
+	events.Close()
+	// Events after closing are dropped
+	runState.Run("libC#build")(TargetBuilt, nil)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	got := make([]streamEvent, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &got[i]), line)
+	}
+	kinds := []string{}
+	for _, event := range got {
+		kinds = append(kinds, event.Event)
+	}
+	assert.Equal(t, []string{"run-start", "task-start", "task-cache-hit", "task-end", "task-start", "task-end", "run-end"}, kinds)
+
+	assert.Equal(t, "libA#build", got[1].Task.TaskID)
+	assert.Equal(t, "building", got[1].Task.Status)
+	assert.Nil(t, got[1].ExitCode)
+	assert.Equal(t, "cached", got[3].Task.Status)
+	assert.Equal(t, 0, *got[3].ExitCode)
+	assert.Equal(t, "libB#build", got[5].Task.TaskID)
+	assert.Equal(t, "failed", got[5].Task.Status)
+	assert.Equal(t, 2, *got[5].ExitCode)
+	assert.Equal(t, 2, *got[6].ExitCode)
+}
+
+func Test_eventStreamFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "run.ndjson")
+	events, err := newEventStream(path, nil)
+	assert.NoError(t, err)
+	runState := NewRunState(time.Now(), "")
+	runState.events = events
+
+	runState.Run("libA#build")(TargetBuildFailed, errors.New("could not flush log output"))
+	events.Close()
+	events.Close()
+
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Len(t, lines, 2)
+	var end streamEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &end))
+	assert.Equal(t, "task-end", end.Event)
+	// Failures other than a non-zero exit are reported as exit code 1
+	assert.Equal(t, 1, *end.ExitCode)
+}
+
+func Test_runExitCode(t *testing.T) {
+	assert.Equal(t, 0, runExitCode(nil))
+	assert.Equal(t, 3, runExitCode(&process.ChildExit{ExitCode: 3}))
+	assert.Equal(t, 1, runExitCode(errors.New("error writing output manifest")))
+}
@@ -2,12 +2,14 @@ package run
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pyr-sh/dag"
+	turboenv "github.com/vercel/turborepo/cli/internal/env"
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/globby"
 	"github.com/vercel/turborepo/cli/internal/hashing"
@@ -18,37 +20,52 @@ import (
 
 const _globalCacheKey = "Real G's move in silence like lasagna"
 
+// _globalDependencyEnvRef matches references to env vars, such as "${CONFIG_DIR}", in globalDependencies
+var _globalDependencyEnvRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
 // Variables that we always include
 var _defaultEnvVars = []string{
 	"VERCEL_ANALYTICS_ID",
 }
 
-func calculateGlobalHash(rootpath turbopath.AbsolutePath, rootPackageJSON *fs.PackageJSON, pipeline fs.Pipeline, envVarDependencies []string, globalFileDependencies []string, packageManager *packagemanager.PackageManager, logger hclog.Logger, env []string) (string, error) {
+// calculateGlobalHash hashes the inputs shared by every task. If turboVersion is non-empty it is
+// included as well, so that upgrading turbo invalidates the cache. Leaving it empty keeps hashes,
+// and therefore cached artifacts, portable across turbo versions. If hashLockfile is false the
+// lockfile itself is left out, and changes to it only affect the hashes of tasks whose
+// resolved external dependencies changed. Up to workerCount processes hash the global files
+// at a time. The inputs to the hash are returned along with it.
+func calculateGlobalHash(rootpath turbopath.AbsolutePath, rootExternalDepsHash string, pipeline fs.Pipeline, envVarDependencies []string, globalFileDependencies []string, packageManager *packagemanager.PackageManager, logger hclog.Logger, env []string, turboVersion string, hashLockfile bool, workerCount int) (string, *globalHashInputs, error) {
+	envMap := turboenv.EnvironMap(env)
 	// Calculate env var dependencies
 	globalHashableEnvNames := []string{}
 	globalHashableEnvPairs := []string{}
 	for _, builtinEnvVar := range _defaultEnvVars {
 		globalHashableEnvNames = append(globalHashableEnvNames, builtinEnvVar)
-		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", builtinEnvVar, os.Getenv(builtinEnvVar)))
+		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", builtinEnvVar, envMap[builtinEnvVar]))
 	}
 
-	// Calculate global env var dependencies
-	for _, v := range envVarDependencies {
+	// Calculate global env var dependencies, resolving wildcards and negations
+	for _, v := range turboenv.FromWildcards(envMap, envVarDependencies) {
 		globalHashableEnvNames = append(globalHashableEnvNames, v)
-		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", v, os.Getenv(v)))
+		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", v, envMap[v]))
 	}
 
 	// Calculate global file dependencies
 	globalDeps := make(util.Set)
 	if len(globalFileDependencies) > 0 {
+		globs, err := expandGlobalDependencies(globalFileDependencies, envMap)
+		if err != nil {
+			return "", nil, err
+		}
+
 		ignores, err := packageManager.GetWorkspaceIgnores(rootpath)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
-		f, err := globby.GlobFiles(rootpath.ToStringDuringMigration(), globalFileDependencies, ignores)
+		f, err := globby.GlobFiles(rootpath.ToStringDuringMigration(), globs, ignores)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		for _, val := range f {
@@ -67,9 +84,13 @@ func calculateGlobalHash(rootpath turbopath.AbsolutePath, rootPackageJSON *fs.Pa
 	logger.Debug("global hash env vars", "vars", globalHashableEnvNames)
 
 	if !util.IsYarn(packageManager.Name) {
-		// If we are not in Yarn, add the specfile and lockfile to global deps
+		// If we are not in Yarn, add the specfile and lockfile to global deps. Binary
+		// lockfiles such as bun.lockb are hashed by their contents like any other file,
+		// and since they can't be parsed, hashLockfile is always true for them.
 		globalDeps.Add(filepath.Join(rootpath.ToStringDuringMigration(), packageManager.Specfile))
-		globalDeps.Add(filepath.Join(rootpath.ToStringDuringMigration(), packageManager.Lockfile))
+		if hashLockfile {
+			globalDeps.Add(filepath.Join(rootpath.ToStringDuringMigration(), packageManager.Lockfile))
+		}
 	}
 
 	// No prefix, global deps already have full paths
@@ -79,28 +100,119 @@ func calculateGlobalHash(rootpath turbopath.AbsolutePath, rootPackageJSON *fs.Pa
 		globalDepsPaths[i] = turbopath.AbsoluteSystemPathFromUpstream(path)
 	}
 
-	globalFileHashMap, err := hashing.GetHashableDeps(rootpath, globalDepsPaths)
+	globalFileHashMap, err := hashing.GetHashableDeps(rootpath, globalDepsPaths, workerCount)
+	if err != nil {
+		return "", nil, fmt.Errorf("error hashing files: %w", err)
+	}
+	// Hash the pristine form of the pipeline, which doesn't depend on the order of lists in
+	// turbo.json, nor on the addresses of pointers in task definitions
+	pristinePipeline, err := pipeline.Pristine().Bytes()
 	if err != nil {
-		return "", fmt.Errorf("error hashing files: %w", err)
+		return "", nil, fmt.Errorf("error serializing pipeline: %w", err)
 	}
 	globalHashable := struct {
 		globalFileHashMap    map[turbopath.AnchoredUnixPath]string
 		rootExternalDepsHash string
 		hashedSortedEnvPairs []string
 		globalCacheKey       string
-		pipeline             fs.Pipeline
+		pipeline             string
 	}{
 		globalFileHashMap:    globalFileHashMap,
-		rootExternalDepsHash: rootPackageJSON.ExternalDepsHash,
+		rootExternalDepsHash: rootExternalDepsHash,
 		hashedSortedEnvPairs: globalHashableEnvPairs,
 		globalCacheKey:       _globalCacheKey,
-		pipeline:             pipeline,
+		pipeline:             string(pristinePipeline),
+	}
+	var hashable interface{} = globalHashable
+	if turboVersion != "" {
+		// Wrap rather than extend globalHashable so that hashes are unchanged when this is off
+		hashable = struct {
+			globalHashable interface{}
+			turboVersion   string
+		}{
+			globalHashable: globalHashable,
+			turboVersion:   turboVersion,
+		}
+	}
+	globalHash, err := fs.HashObject(hashable)
+	if err != nil {
+		return "", nil, fmt.Errorf("error hashing global dependencies %w", err)
 	}
-	globalHash, err := fs.HashObject(globalHashable)
+
+	pipelineHash, err := fs.HashObject(string(pristinePipeline))
 	if err != nil {
-		return "", fmt.Errorf("error hashing global dependencies %w", err)
+		return "", nil, fmt.Errorf("error hashing pipeline %w", err)
+	}
+	inputs := &globalHashInputs{
+		GlobalHash:           globalHash,
+		GlobalFileHashes:     make(map[string]string, len(globalFileHashMap)),
+		RootExternalDepsHash: rootExternalDepsHash,
+		PipelineHash:         pipelineHash,
+		TurboVersion:         turboVersion,
+		envPairs:             globalHashableEnvPairs,
+	}
+	for path, hash := range globalFileHashMap {
+		inputs.GlobalFileHashes[path.ToString()] = hash
+	}
+	return globalHash, inputs, nil
+}
+
+// expandGlobalDependencies replaces references to env vars such as "${CONFIG_DIR}" in the given
+// globs with their values. Referencing a variable that isn't set is an error, rather than
+// silently globbing a different path.
+func expandGlobalDependencies(globs []string, env map[string]string) ([]string, error) {
+	expanded := make([]string, len(globs))
+	for i, glob := range globs {
+		var unset []string
+		expanded[i] = _globalDependencyEnvRef.ReplaceAllStringFunc(glob, func(ref string) string {
+			name := _globalDependencyEnvRef.FindStringSubmatch(ref)[1]
+			value, ok := env[name]
+			if !ok {
+				unset = append(unset, name)
+			}
+			return value
+		})
+		if len(unset) > 0 {
+			return nil, fmt.Errorf("globalDependencies entry %q references %v, which is not set", glob, strings.Join(unset, ", "))
+		}
+	}
+	return expanded, nil
+}
+
+// scopedRootExternalDepsHash hashes the external dependencies of the root package that are also
+// external dependencies of the given packages or of the workspace packages they depend on, so
+// that changes to root dependencies nothing in scope uses don't change the global hash. If the
+// root package itself is in scope, all of its external dependencies are hashed.
+func scopedRootExternalDepsHash(rootPackageJSON *fs.PackageJSON, packageInfos map[interface{}]*fs.PackageJSON, topoGraph *dag.AcyclicGraph, packages util.Set) (string, error) {
+	if packages.Includes(util.RootPkgName) {
+		return rootPackageJSON.ExternalDepsHash, nil
+	}
+	inScope := make(util.Set)
+	for _, pkg := range packages {
+		inScope.Add(pkg)
+		deps, err := topoGraph.Ancestors(pkg)
+		if err != nil {
+			return "", err
+		}
+		for dep := range deps {
+			inScope.Add(dep)
+		}
+	}
+	reachableDeps := make(util.Set)
+	for _, pkg := range inScope {
+		if info, ok := packageInfos[pkg]; ok {
+			for _, dep := range info.ExternalDeps {
+				reachableDeps.Add(dep)
+			}
+		}
+	}
+	rootDeps := []string{}
+	for _, dep := range rootPackageJSON.ExternalDeps {
+		if reachableDeps.Includes(dep) {
+			rootDeps = append(rootDeps, dep)
+		}
 	}
-	return globalHash, nil
+	return fs.HashObject(rootDeps)
 }
 
 // getHashableTurboEnvVarsFromOs returns a list of environment variables names and
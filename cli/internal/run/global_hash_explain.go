@@ -0,0 +1,168 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/ui"
+)
+
+// _globalHashInputsFile is the repo-relative file that the inputs to the previous run's
+// global hash are recorded in
+var _globalHashInputsFile = filepath.Join(".turbo", "global-hash-inputs.json")
+
+// _envVarHashKeyFile is the file in the turbo data directory holding the key that recorded
+// env var values are hashed with
+const _envVarHashKeyFile = "env-var-hash.key"
+
+// envVarHashKey returns the key that env var values are hashed with before they are recorded.
+// Since it is kept out of the repository, the recorded hashes can't be used to check guesses
+// of secret values.
+func envVarHashKey() ([]byte, error) {
+	return fs.ReadOrCreateKey(fs.GetTurboDataDir().Join(_envVarHashKeyFile))
+}
+
+// globalHashInputs records what went into a global hash, so that a later run can explain
+// why its global hash is different. Env var values are hashed with envVarHashKey so that
+// they aren't written to disk.
+type globalHashInputs struct {
+	GlobalHash           string            `json:"globalHash"`
+	GlobalFileHashes     map[string]string `json:"globalFileHashes"`
+	RootExternalDepsHash string            `json:"rootExternalDepsHash"`
+	EnvVarHashes         map[string]string `json:"envVarHashes"`
+	PipelineHash         string            `json:"pipelineHash"`
+	TurboVersion         string            `json:"turboVersion,omitempty"`
+	// envPairs are the "name=value" pairs of the env vars in the global hash
+	envPairs []string
+}
+
+// hashEnvVars records a keyed hash of the value of each env var in the global hash
+func (g *globalHashInputs) hashEnvVars(key []byte) {
+	g.EnvVarHashes = make(map[string]string, len(g.envPairs))
+	for _, pair := range g.envPairs {
+		kv := strings.SplitN(pair, "=", 2)
+		g.EnvVarHashes[kv[0]] = fs.HashSecretValue(key, kv[1])
+	}
+}
+
+// readGlobalHashInputs returns the global hash inputs recorded by the previous run,
+// or nil if none were recorded
+func readGlobalHashInputs(repoRoot turbopath.AbsolutePath) (*globalHashInputs, error) {
+	contents, err := repoRoot.Join(_globalHashInputsFile).ReadFile()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	inputs := &globalHashInputs{}
+	if err := json.Unmarshal(contents, inputs); err != nil {
+		return nil, fmt.Errorf("reading %v: %w", _globalHashInputsFile, err)
+	}
+	return inputs, nil
+}
+
+// write records the global hash inputs for the next run to compare against
+func (g *globalHashInputs) write(repoRoot turbopath.AbsolutePath) error {
+	bytes, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := repoRoot.Join(_globalHashInputsFile)
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	return path.WriteFile(bytes, 0644)
+}
+
+// explainChange describes each difference between the previous global hash inputs and
+// the current ones
+func (g *globalHashInputs) explainChange(previous *globalHashInputs) []string {
+	changes := []string{}
+	for _, file := range sortedKeys(previous.GlobalFileHashes, g.GlobalFileHashes) {
+		before, hadFile := previous.GlobalFileHashes[file]
+		after, hasFile := g.GlobalFileHashes[file]
+		if change := describeChange(hadFile, hasFile, before != after); change != "" {
+			changes = append(changes, fmt.Sprintf("global file %v %v", file, change))
+		}
+	}
+	for _, name := range sortedKeys(previous.EnvVarHashes, g.EnvVarHashes) {
+		before, hadVar := previous.EnvVarHashes[name]
+		after, hasVar := g.EnvVarHashes[name]
+		if change := describeChange(hadVar, hasVar, before != after); change != "" {
+			changes = append(changes, fmt.Sprintf("env var %v %v", name, change))
+		}
+	}
+	if previous.RootExternalDepsHash != g.RootExternalDepsHash {
+		changes = append(changes, "root external dependencies changed")
+	}
+	if previous.PipelineHash != g.PipelineHash {
+		changes = append(changes, "pipeline in turbo.json changed")
+	}
+	if previous.TurboVersion != g.TurboVersion {
+		changes = append(changes, fmt.Sprintf("turbo version changed from %q to %q", previous.TurboVersion, g.TurboVersion))
+	}
+	return changes
+}
+
+// explainGlobalHashChange prints how the current global hash inputs differ from the ones
+// recorded by the previous run, then records the current ones
+func (r *run) explainGlobalHashChange(current *globalHashInputs) {
+	key, err := envVarHashKey()
+	if err != nil {
+		r.logWarning("failed to load the key to hash env vars with", err)
+		return
+	}
+	current.hashEnvVars(key)
+	previous, err := readGlobalHashInputs(r.base.RepoRoot)
+	if err != nil {
+		r.logWarning("failed to read the previous global hash inputs", err)
+	} else if previous == nil {
+		r.base.UI.Output(ui.Dim("• Global hash: no previous run recorded"))
+	} else if previous.GlobalHash == current.GlobalHash {
+		r.base.UI.Output(ui.Dim("• Global hash: unchanged"))
+	} else {
+		r.base.UI.Output(ui.Dim(fmt.Sprintf("• Global hash: changed from %v to %v", previous.GlobalHash, current.GlobalHash)))
+		for _, change := range current.explainChange(previous) {
+			r.base.UI.Output(ui.Dim(fmt.Sprintf("  - %v", change)))
+		}
+	}
+	if err := current.write(r.base.RepoRoot); err != nil {
+		r.logWarning("failed to record the global hash inputs", err)
+	}
+}
+
+// describeChange describes how an entry present in the previous and current inputs
+// changed, or returns the empty string if it didn't
+func describeChange(before bool, after bool, differs bool) string {
+	switch {
+	case before && !after:
+		return "removed"
+	case !before && after:
+		return "added"
+	case differs:
+		return "changed"
+	}
+	return ""
+}
+
+// sortedKeys returns the union of the keys of the given maps, sorted
+func sortedKeys(maps ...map[string]string) []string {
+	keys := []string{}
+	seen := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
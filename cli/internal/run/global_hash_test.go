@@ -2,7 +2,14 @@ package run
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pyr-sh/dag"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/packagemanager"
+	"github.com/vercel/turborepo/cli/internal/util"
 )
 
 func Test_getHashableTurboEnvVarsFromOs(t *testing.T) {
@@ -24,3 +31,206 @@ func Test_getHashableTurboEnvVarsFromOs(t *testing.T) {
 		t.Errorf("getHashableTurboEnvVarsFromOs() env pairs got = %v, want %v", gotPairs, wantPairs)
 	}
 }
+
+func Test_calculateGlobalHashTurboVersion(t *testing.T) {
+	rootpath := fs.AbsolutePathFromUpstream(t.TempDir())
+	packageManager := &packagemanager.PackageManager{Name: "nodejs-yarn"}
+	hash := func(turboVersion string) string {
+		t.Helper()
+		h, _, err := calculateGlobalHash(rootpath, "", fs.Pipeline{}, nil, nil, packageManager, hclog.NewNullLogger(), nil, turboVersion, true, 1)
+		if err != nil {
+			t.Fatalf("calculateGlobalHash: %v", err)
+		}
+		return h
+	}
+	withoutVersion := hash("")
+	withVersion := hash("1.4.0")
+	if withoutVersion == withVersion {
+		t.Errorf("expected including the turbo version to change the global hash")
+	}
+	if withVersion != hash("1.4.0") {
+		t.Errorf("expected the global hash to be stable for the same turbo version")
+	}
+	if withVersion == hash("1.5.0") {
+		t.Errorf("expected different turbo versions to produce different global hashes")
+	}
+}
+
+func Test_scopedRootExternalDepsHash(t *testing.T) {
+	topoGraph := &dag.AcyclicGraph{}
+	topoGraph.Add("app")
+	topoGraph.Add("lib")
+	topoGraph.Add("other")
+	topoGraph.Connect(dag.BasicEdge("app", "lib"))
+	packageInfos := map[interface{}]*fs.PackageJSON{
+		"app":   {ExternalDeps: []string{"react@18.2.0"}},
+		"lib":   {ExternalDeps: []string{"typescript@4.7.4"}},
+		"other": {ExternalDeps: []string{"prettier@2.7.1"}},
+	}
+	rootPackageJSON := func(prettierVersion string) *fs.PackageJSON {
+		return &fs.PackageJSON{
+			ExternalDeps:     []string{"prettier@" + prettierVersion, "typescript@4.7.4"},
+			ExternalDepsHash: "full-hash-" + prettierVersion,
+		}
+	}
+	hash := func(root *fs.PackageJSON, packages ...string) string {
+		t.Helper()
+		h, err := scopedRootExternalDepsHash(root, packageInfos, topoGraph, util.SetFromStrings(packages))
+		if err != nil {
+			t.Fatalf("scopedRootExternalDepsHash: %v", err)
+		}
+		return h
+	}
+
+	// app reaches typescript through lib, but nothing in scope uses prettier
+	if hash(rootPackageJSON("2.7.1"), "app") != hash(rootPackageJSON("2.8.0"), "app") {
+		t.Error("expected a change to an unused root dependency not to change the hash")
+	}
+	if hash(rootPackageJSON("2.7.1"), "other") == hash(rootPackageJSON("2.8.0"), "other") {
+		t.Error("expected a change to a root dependency used in scope to change the hash")
+	}
+	if got := hash(rootPackageJSON("2.7.1"), "app", util.RootPkgName); got != "full-hash-2.7.1" {
+		t.Errorf("expected all root dependencies to be hashed when the root package is in scope, got %v", got)
+	}
+}
+
+func Test_globalHashInputsExplainChange(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	previous, err := readGlobalHashInputs(repoRoot)
+	if err != nil || previous != nil {
+		t.Fatalf("expected no previous inputs, got %v, %v", previous, err)
+	}
+
+	recorded := &globalHashInputs{
+		GlobalHash:           "previous-hash",
+		GlobalFileHashes:     map[string]string{"tsconfig.json": "a", "removed.json": "b", "same.json": "c"},
+		RootExternalDepsHash: "deps",
+		EnvVarHashes:         map[string]string{"API_URL": "d", "NODE_ENV": "e"},
+		PipelineHash:         "pipeline",
+	}
+	if err := recorded.write(repoRoot); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	previous, err = readGlobalHashInputs(repoRoot)
+	if err != nil {
+		t.Fatalf("readGlobalHashInputs: %v", err)
+	}
+	if !reflect.DeepEqual(previous, recorded) {
+		t.Errorf("readGlobalHashInputs got %v, want %v", previous, recorded)
+	}
+
+	current := &globalHashInputs{
+		GlobalHash:           "current-hash",
+		GlobalFileHashes:     map[string]string{"tsconfig.json": "changed", "added.json": "f", "same.json": "c"},
+		RootExternalDepsHash: "new-deps",
+		EnvVarHashes:         map[string]string{"API_URL": "changed", "CI": "g", "NODE_ENV": "e"},
+		PipelineHash:         "pipeline",
+	}
+	want := []string{
+		"global file added.json added",
+		"global file removed.json removed",
+		"global file tsconfig.json changed",
+		"env var API_URL changed",
+		"env var CI added",
+		"root external dependencies changed",
+	}
+	if got := current.explainChange(previous); !reflect.DeepEqual(got, want) {
+		t.Errorf("explainChange got %v, want %v", got, want)
+	}
+}
+
+func Test_calculateGlobalHashInputs(t *testing.T) {
+	rootpath := fs.AbsolutePathFromUpstream(t.TempDir())
+	packageManager := &packagemanager.PackageManager{Name: "nodejs-yarn"}
+	env := []string{"SOME_THASH_VAR=secret"}
+	hash, inputs, err := calculateGlobalHash(rootpath, "deps", fs.Pipeline{}, nil, nil, packageManager, hclog.NewNullLogger(), env, "", true, 1)
+	if err != nil {
+		t.Fatalf("calculateGlobalHash: %v", err)
+	}
+	if inputs.GlobalHash != hash {
+		t.Errorf("expected the inputs to record the global hash %v, got %v", hash, inputs.GlobalHash)
+	}
+	if inputs.RootExternalDepsHash != "deps" {
+		t.Errorf("expected the root external deps hash to be recorded, got %v", inputs.RootExternalDepsHash)
+	}
+	if inputs.EnvVarHashes != nil {
+		t.Errorf("expected env vars not to be hashed without a key, got %v", inputs.EnvVarHashes)
+	}
+	inputs.hashEnvVars([]byte("key"))
+	valueHash, ok := inputs.EnvVarHashes["SOME_THASH_VAR"]
+	if !ok || valueHash != fs.HashSecretValue([]byte("key"), "secret") {
+		t.Errorf("expected a keyed hash of the env var value to be recorded, got %v", inputs.EnvVarHashes)
+	}
+	inputs.hashEnvVars([]byte("other key"))
+	if inputs.EnvVarHashes["SOME_THASH_VAR"] == valueHash {
+		t.Error("expected the env var hash to depend on the key")
+	}
+}
+
+func Test_calculateGlobalHashWildcardEnv(t *testing.T) {
+	rootpath := fs.AbsolutePathFromUpstream(t.TempDir())
+	packageManager := &packagemanager.PackageManager{Name: "nodejs-yarn"}
+	env := []string{"API_URL=https://example.com", "API_KEY=secret", "OTHER=value"}
+	_, inputs, err := calculateGlobalHash(rootpath, "", fs.Pipeline{}, []string{"API_*", "!API_KEY"}, nil, packageManager, hclog.NewNullLogger(), env, "", true, 1)
+	if err != nil {
+		t.Fatalf("calculateGlobalHash: %v", err)
+	}
+	inputs.hashEnvVars([]byte("key"))
+	if got := inputs.EnvVarHashes["API_URL"]; got != fs.HashSecretValue([]byte("key"), "https://example.com") {
+		t.Errorf("expected API_URL to be hashed from the given environment, got %v", inputs.EnvVarHashes)
+	}
+	for _, name := range []string{"API_KEY", "OTHER"} {
+		if _, ok := inputs.EnvVarHashes[name]; ok {
+			t.Errorf("expected %v not to be hashed, got %v", name, inputs.EnvVarHashes)
+		}
+	}
+}
+
+func Test_expandGlobalDependencies(t *testing.T) {
+	env := map[string]string{"CONFIG_DIR": "config/linux", "EMPTY": ""}
+	got, err := expandGlobalDependencies([]string{"${CONFIG_DIR}/shared.json", "a/${EMPTY}b.json", "$CONFIG_DIR/c.json", "*.txt"}, env)
+	if err != nil {
+		t.Fatalf("expandGlobalDependencies: %v", err)
+	}
+	want := []string{"config/linux/shared.json", "a/b.json", "$CONFIG_DIR/c.json", "*.txt"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expandGlobalDependencies() got = %v, want %v", got, want)
+	}
+
+	_, err = expandGlobalDependencies([]string{"${MISSING}/shared.json"}, env)
+	if err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("expected an error naming the unset variable, got %v", err)
+	}
+}
+
+func Test_calculateGlobalHashInterpolatedDependency(t *testing.T) {
+	rootpath := fs.AbsolutePathFromUpstream(t.TempDir())
+	packageManager, err := packagemanager.GetPackageManager(rootpath, &fs.PackageJSON{PackageManager: "yarn@1.22.19"})
+	if err != nil {
+		t.Fatalf("GetPackageManager: %v", err)
+	}
+	if err := rootpath.Join("package.json").WriteFile([]byte(`{"workspaces": ["packages/*"]}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, dir := range []string{"linux", "darwin"} {
+		if err := rootpath.Join("config", dir).MkdirAll(); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := rootpath.Join("config", dir, "shared.json").WriteFile([]byte(dir), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	deps := []string{"${CONFIG_DIR}/shared.json"}
+	_, inputs, err := calculateGlobalHash(rootpath, "", fs.Pipeline{}, nil, deps, packageManager, hclog.NewNullLogger(), []string{"CONFIG_DIR=config/linux"}, "", true, 1)
+	if err != nil {
+		t.Fatalf("calculateGlobalHash: %v", err)
+	}
+	if _, ok := inputs.GlobalFileHashes["config/linux/shared.json"]; !ok || len(inputs.GlobalFileHashes) != 1 {
+		t.Errorf("expected only config/linux/shared.json to be hashed, got %v", inputs.GlobalFileHashes)
+	}
+
+	_, _, err = calculateGlobalHash(rootpath, "", fs.Pipeline{}, nil, deps, packageManager, hclog.NewNullLogger(), nil, "", true, 1)
+	if err == nil {
+		t.Errorf("expected an error when CONFIG_DIR is unset")
+	}
+}
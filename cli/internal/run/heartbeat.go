@@ -0,0 +1,134 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// _minHeartbeatInterval is the shortest interval accepted by --experimental-worker-heartbeat
+const _minHeartbeatInterval = time.Second
+
+// heartbeat prints a keep-alive line listing the running tasks whenever no task output has
+// been written for a given interval, so that CI providers don't kill a slow but healthy run
+// for being idle.
+type heartbeat struct {
+	interval time.Duration
+	out      io.Writer
+
+	mu         sync.Mutex
+	lastOutput time.Time
+	running    map[string]struct{}
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newHeartbeat(interval time.Duration, out io.Writer) *heartbeat {
+	return &heartbeat{
+		interval:   interval,
+		out:        out,
+		lastOutput: time.Now(),
+		running:    make(map[string]struct{}),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// start begins checking for idle output in the background until stop is called
+func (h *heartbeat) start() {
+	go func() {
+		defer close(h.stopped)
+		// Check more often than the interval so that a heartbeat isn't delayed by up to
+		// a whole interval after output stops
+		ticker := time.NewTicker(h.interval / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case now := <-ticker.C:
+				h.tick(now)
+			}
+		}
+	}()
+}
+
+// stop ends the background checks and waits for them to finish
+func (h *heartbeat) stop() {
+	close(h.done)
+	<-h.stopped
+}
+
+// taskStarted adds taskID to the tasks listed in heartbeats
+func (h *heartbeat) taskStarted(taskID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running[taskID] = struct{}{}
+}
+
+// taskFinished removes taskID from the tasks listed in heartbeats
+func (h *heartbeat) taskFinished(taskID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.running, taskID)
+}
+
+// Write records that task output was printed. It is meant to be used alongside the
+// writers that print task output.
+func (h *heartbeat) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastOutput = time.Now()
+	return len(p), nil
+}
+
+// tick prints a heartbeat if tasks are running and nothing has been printed for at least
+// the interval as of now
+func (h *heartbeat) tick(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.running) == 0 || now.Sub(h.lastOutput) < h.interval {
+		return
+	}
+	taskIDs := make([]string, 0, len(h.running))
+	for taskID := range h.running {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	fmt.Fprintf(h.out, "turbo: still running %v\n", strings.Join(taskIDs, ", "))
+	h.lastOutput = now
+}
+
+// heartbeatIntervalValue implements the --experimental-worker-heartbeat flag, rejecting
+// intervals too short to be useful, which would also be too short to check for.
+type heartbeatIntervalValue struct {
+	opts *runOpts
+}
+
+var _ pflag.Value = &heartbeatIntervalValue{}
+
+func (h *heartbeatIntervalValue) String() string {
+	return h.opts.heartbeatInterval.String()
+}
+
+func (h *heartbeatIntervalValue) Set(value string) error {
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if interval < _minHeartbeatInterval {
+		return fmt.Errorf("heartbeat interval must be at least %v, got %v", _minHeartbeatInterval, interval)
+	}
+	h.opts.heartbeatInterval = interval
+	return nil
+}
+
+func (h *heartbeatIntervalValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,66 @@
+package run
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_heartbeatTick(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := newHeartbeat(time.Minute, out)
+	start := h.lastOutput
+
+	// Nothing is running yet
+	h.tick(start.Add(2 * time.Minute))
+	assert.Empty(t, out.String())
+
+	h.taskStarted("web#build")
+	h.taskStarted("docs#build")
+	h.tick(start.Add(30 * time.Second))
+	assert.Empty(t, out.String(), "interval has not elapsed")
+
+	h.tick(start.Add(2 * time.Minute))
+	assert.Equal(t, "turbo: still running docs#build, web#build\n", out.String())
+
+	// The heartbeat itself counts as output
+	out.Reset()
+	h.tick(start.Add(2*time.Minute + 30*time.Second))
+	assert.Empty(t, out.String())
+
+	h.taskFinished("docs#build")
+	h.tick(start.Add(4 * time.Minute))
+	assert.Equal(t, "turbo: still running web#build\n", out.String())
+
+	// Task output resets the idle time
+	out.Reset()
+	_, err := h.Write([]byte("building\n"))
+	assert.NoError(t, err)
+	h.tick(h.lastOutput.Add(30 * time.Second))
+	assert.Empty(t, out.String())
+}
+
+func Test_heartbeatStartStop(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := newHeartbeat(time.Millisecond, out)
+	h.taskStarted("web#build")
+	h.start()
+	time.Sleep(20 * time.Millisecond)
+	h.stop()
+	assert.Contains(t, out.String(), "turbo: still running web#build\n")
+}
+
+func Test_heartbeatIntervalValue(t *testing.T) {
+	opts := &runOpts{}
+	value := &heartbeatIntervalValue{opts: opts}
+
+	assert.NoError(t, value.Set("5m"))
+	assert.Equal(t, 5*time.Minute, opts.heartbeatInterval)
+
+	for _, invalid := range []string{"0", "-1m", "3ns", "500ms", "soon"} {
+		assert.Error(t, value.Set(invalid), invalid)
+	}
+	assert.Equal(t, 5*time.Minute, opts.heartbeatInterval, "rejected values leave the interval unchanged")
+}
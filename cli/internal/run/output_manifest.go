@@ -0,0 +1,146 @@
+package run
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/nodes"
+	"github.com/vercel/turborepo/cli/internal/taskhash"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+const (
+	_cacheStatusHit  = "HIT"
+	_cacheStatusMiss = "MISS"
+)
+
+// outputManifest records which tasks completed during a run so that the files they
+// produced can be hashed and written out once the run is finished.
+type outputManifest struct {
+	mu    sync.Mutex
+	tasks []*outputManifestTask
+}
+
+type outputManifestTask struct {
+	TaskID      string `json:"taskId"`
+	Task        string `json:"task"`
+	Package     string `json:"package"`
+	Hash        string `json:"hash"`
+	CacheStatus string `json:"cacheStatus"`
+	// Failed is set for tasks whose command failed. Their outputs are recorded regardless,
+	// since the reports of failed linters and scanners are the ones worth reading.
+	Failed  bool                 `json:"failed,omitempty"`
+	Outputs []outputManifestFile `json:"outputs"`
+	// sarifGlobs are the repo-relative globs of the task's outputs that are SARIF reports
+	sarifGlobs []string
+}
+
+type outputManifestFile struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+func newOutputManifest() *outputManifest {
+	return &outputManifest{}
+}
+
+// add records a completed task. Its outputs are looked up from the tracker when the manifest is written.
+func (om *outputManifest) add(packageTask *nodes.PackageTask, hash string, cacheHit bool) {
+	om.addTask(packageTask, hash, cacheHit, false)
+}
+
+// addFailed records a task whose command failed
+func (om *outputManifest) addFailed(packageTask *nodes.PackageTask, hash string) {
+	om.addTask(packageTask, hash, false, true)
+}
+
+func (om *outputManifest) addTask(packageTask *nodes.PackageTask, hash string, cacheHit bool, failed bool) {
+	cacheStatus := _cacheStatusMiss
+	if cacheHit {
+		cacheStatus = _cacheStatusHit
+	}
+	var sarifGlobs []string
+	if packageTask.TaskDefinition != nil && packageTask.Pkg != nil {
+		for _, glob := range packageTask.TaskDefinition.SarifOutputs {
+			sarifGlobs = append(sarifGlobs, path.Join(packageTask.Pkg.Dir.ToUnixPath().ToString(), glob))
+		}
+	}
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	om.tasks = append(om.tasks, &outputManifestTask{
+		TaskID:      packageTask.TaskID,
+		Task:        packageTask.Task,
+		Package:     packageTask.PackageName,
+		Hash:        hash,
+		CacheStatus: cacheStatus,
+		Failed:      failed,
+		sarifGlobs:  sarifGlobs,
+	})
+}
+
+// write hashes the expanded outputs of every recorded task and writes the manifest as JSON to the given path
+func (om *outputManifest) write(path turbopath.AbsolutePath, repoRoot turbopath.AbsolutePath, taskHashes *taskhash.Tracker) error {
+	if err := om.resolveOutputs(repoRoot, taskHashes); err != nil {
+		return err
+	}
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	manifest := &struct {
+		Tasks []*outputManifestTask `json:"tasks"`
+	}{
+		Tasks: om.tasks,
+	}
+	bytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to render output manifest")
+	}
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	return path.WriteFile(bytes, 0644)
+}
+
+// resolveOutputs sorts the recorded tasks and hashes the expanded outputs of each of them
+func (om *outputManifest) resolveOutputs(repoRoot turbopath.AbsolutePath, taskHashes *taskhash.Tracker) error {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	sort.Slice(om.tasks, func(i, j int) bool {
+		return om.tasks[i].TaskID < om.tasks[j].TaskID
+	})
+	for _, task := range om.tasks {
+		outputs := taskHashes.GetExpandedOutputs(task.TaskID)
+		task.Outputs = make([]outputManifestFile, 0, len(outputs))
+		for _, output := range outputs {
+			hash, err := fs.GitLikeHashFile(repoRoot.Join(output.ToString()).ToString())
+			if err != nil {
+				return errors.Wrapf(err, "failed to hash output %v of %v", output, task.TaskID)
+			}
+			task.Outputs = append(task.Outputs, outputManifestFile{
+				Path: output.ToUnixPath().ToString(),
+				Hash: hash,
+			})
+		}
+		sort.Slice(task.Outputs, func(i, j int) bool {
+			return task.Outputs[i].Path < task.Outputs[j].Path
+		})
+	}
+	return nil
+}
+
+// changedTasksByPackage groups the recorded tasks that were not restored from cache and
+// didn't fail by package
+func (om *outputManifest) changedTasksByPackage() map[string][]*outputManifestTask {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	changed := make(map[string][]*outputManifestTask)
+	for _, task := range om.tasks {
+		if task.CacheStatus == _cacheStatusMiss && !task.Failed {
+			changed[task.Package] = append(changed[task.Package], task)
+		}
+	}
+	return changed
+}
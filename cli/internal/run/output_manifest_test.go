@@ -0,0 +1,62 @@
+package run
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/nodes"
+	"github.com/vercel/turborepo/cli/internal/taskhash"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_outputManifestWrite(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	outputFile := repoRoot.Join("libA", "dist", "index.js")
+	if err := outputFile.EnsureDir(); err != nil {
+		t.Fatalf("EnsureDir: %v", err)
+	}
+	if err := outputFile.WriteFile([]byte("some-file-contents"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	relativeOutput, err := repoRoot.RelativePathString(outputFile.ToString())
+	if err != nil {
+		t.Fatalf("RelativePathString: %v", err)
+	}
+	tracker := taskhash.NewTracker("root", "global", fs.Pipeline{}, nil)
+	tracker.SetExpandedOutputs("libA#build", []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredSystemPathFromUpstream(relativeOutput),
+	})
+
+	manifest := newOutputManifest()
+	manifest.add(&nodes.PackageTask{TaskID: "libB#build", Task: "build", PackageName: "libB"}, "hash-b", false)
+	manifest.add(&nodes.PackageTask{TaskID: "libA#build", Task: "build", PackageName: "libA"}, "hash-a", true)
+
+	manifestPath := repoRoot.Join("manifest.json")
+	if err := manifest.write(manifestPath, repoRoot, tracker); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	contents, err := manifestPath.ReadFile()
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var got struct {
+		Tasks []outputManifestTask `json:"tasks"`
+	}
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	assert.Len(t, got.Tasks, 2)
+	assert.Equal(t, "libA#build", got.Tasks[0].TaskID)
+	assert.Equal(t, _cacheStatusHit, got.Tasks[0].CacheStatus)
+	assert.EqualValues(t, []outputManifestFile{
+		{Path: "libA/dist/index.js", Hash: "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
+	}, got.Tasks[0].Outputs)
+	assert.Equal(t, "libB#build", got.Tasks[1].TaskID)
+	assert.Equal(t, _cacheStatusMiss, got.Tasks[1].CacheStatus)
+	assert.Empty(t, got.Tasks[1].Outputs)
+}
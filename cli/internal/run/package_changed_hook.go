@@ -0,0 +1,68 @@
+package run
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// _changedPackageEnvVar is set to the name of the changed package when invoking the package changed hook
+const _changedPackageEnvVar = "TURBO_CHANGED_PACKAGE"
+
+// packageChangedPayload is written as JSON to the standard input of the package changed hook
+type packageChangedPayload struct {
+	Package string                `json:"package"`
+	Tasks   []*outputManifestTask `json:"tasks"`
+}
+
+// runPackageChangedHooks invokes command once for every package that had at least one task
+// that was not restored from cache. The package name is passed in the TURBO_CHANGED_PACKAGE
+// environment variable, and its tasks and their outputs are written as JSON to stdin.
+// Every package is attempted, and the errors of any failed invocations are returned.
+func runPackageChangedHooks(ctx gocontext.Context, command string, repoRoot turbopath.AbsolutePath, manifest *outputManifest, stdout io.Writer) []error {
+	changed := manifest.changedTasksByPackage()
+	packages := make([]string, 0, len(changed))
+	for pkg := range changed {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+
+	var errs []error
+	for _, pkg := range packages {
+		payload, err := json.Marshal(&packageChangedPayload{
+			Package: pkg,
+			Tasks:   changed[pkg],
+		})
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to render changed outputs of %v", pkg))
+			continue
+		}
+		cmd := shellCommand(ctx, command)
+		cmd.Dir = repoRoot.ToString()
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%v=%v", _changedPackageEnvVar, pkg))
+		cmd.Stdin = strings.NewReader(string(payload))
+		cmd.Stdout = stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "package changed hook failed for %v", pkg))
+		}
+	}
+	return errs
+}
+
+// shellCommand runs command through the platform's shell
+func shellCommand(ctx gocontext.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,54 @@
+package run
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/nodes"
+)
+
+func Test_runPackageChangedHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook command uses sh syntax")
+	}
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	manifest := newOutputManifest()
+	manifest.add(&nodes.PackageTask{TaskID: "libA#build", Task: "build", PackageName: "libA"}, "hash-a", false)
+	manifest.add(&nodes.PackageTask{TaskID: "libA#test", Task: "test", PackageName: "libA"}, "hash-a-test", true)
+	manifest.add(&nodes.PackageTask{TaskID: "libB#build", Task: "build", PackageName: "libB"}, "hash-b", true)
+	manifest.addFailed(&nodes.PackageTask{TaskID: "libC#build", Task: "build", PackageName: "libC"}, "hash-c")
+
+	errs := runPackageChangedHooks(gocontext.Background(), `cat > "$TURBO_CHANGED_PACKAGE.json"`, repoRoot, manifest, os.Stdout)
+	if len(errs) != 0 {
+		t.Fatalf("runPackageChangedHooks: %v", errs)
+	}
+	if repoRoot.Join("libB.json").FileExists() {
+		t.Error("expected the hook not to run for libB, which was fully cached")
+	}
+	if repoRoot.Join("libC.json").FileExists() {
+		t.Error("expected the hook not to run for libC, whose build failed")
+	}
+	contents, err := repoRoot.Join("libA.json").ReadFile()
+	if err != nil {
+		t.Fatalf("expected the hook to run for libA: %v", err)
+	}
+	payload := &packageChangedPayload{}
+	if err := json.Unmarshal(contents, payload); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if payload.Package != "libA" {
+		t.Errorf("payload package got %v, want libA", payload.Package)
+	}
+	if len(payload.Tasks) != 1 || payload.Tasks[0].TaskID != "libA#build" {
+		t.Errorf("payload tasks got %v, want only libA#build", payload.Tasks)
+	}
+
+	errs = runPackageChangedHooks(gocontext.Background(), "exit 1", repoRoot, manifest, os.Stdout)
+	if len(errs) != 1 {
+		t.Errorf("expected one error from a failing hook, got %v", errs)
+	}
+}
@@ -0,0 +1,61 @@
+package run
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/client"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+const (
+	// _remoteCacheHealthTimeout bounds how long the run waits on the remote cache health check
+	_remoteCacheHealthTimeout = 5 * time.Second
+	// _remoteCacheSlowThreshold is how long the health check can take before the remote cache
+	// is reported as slow
+	_remoteCacheSlowThreshold = time.Second
+)
+
+// cachingStatusChecker asks the API whether remote caching is available, e.g. *client.ApiClient
+type cachingStatusChecker interface {
+	GetCachingStatus() (util.CachingStatus, error)
+}
+
+// remoteCacheHealth makes a cheap authenticated request to the remote cache and describes
+// whether remote caching will work for this run
+func remoteCacheHealth(checker cachingStatusChecker, timeout time.Duration, slowThreshold time.Duration) string {
+	type result struct {
+		status util.CachingStatus
+		err    error
+	}
+	results := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		status, err := checker.GetCachingStatus()
+		results <- result{status, err}
+	}()
+	var res result
+	select {
+	case res = <-results:
+	case <-time.After(timeout):
+		return fmt.Sprintf("unreachable (no response after %v)", timeout)
+	}
+	elapsed := time.Since(start)
+
+	if errors.Is(res.err, client.ErrUnauthorized) {
+		return "unauthorized (try \"turbo login\" again)"
+	} else if res.err != nil {
+		return fmt.Sprintf("unreachable (%v)", res.err)
+	}
+	switch res.status {
+	case util.CachingStatusDisabled:
+		return "disabled for this team"
+	case util.CachingStatusOverLimit:
+		return "over the usage limit"
+	}
+	if elapsed >= slowThreshold {
+		return fmt.Sprintf("reachable, but slow (responded in %v)", elapsed.Round(time.Millisecond))
+	}
+	return "reachable"
+}
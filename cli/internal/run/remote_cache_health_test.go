@@ -0,0 +1,68 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/client"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+type fakeStatusChecker struct {
+	status util.CachingStatus
+	err    error
+	delay  time.Duration
+}
+
+func (f *fakeStatusChecker) GetCachingStatus() (util.CachingStatus, error) {
+	time.Sleep(f.delay)
+	return f.status, f.err
+}
+
+func Test_remoteCacheHealth(t *testing.T) {
+	testCases := []struct {
+		name    string
+		checker *fakeStatusChecker
+		want    string
+	}{
+		{
+			name:    "reachable",
+			checker: &fakeStatusChecker{status: util.CachingStatusEnabled},
+			want:    "reachable",
+		},
+		{
+			name:    "unauthorized",
+			checker: &fakeStatusChecker{err: fmt.Errorf("failed to get caching status (403): forbidden: %w", client.ErrUnauthorized)},
+			want:    "unauthorized (try \"turbo login\" again)",
+		},
+		{
+			name:    "unreachable",
+			checker: &fakeStatusChecker{err: errors.New("connection refused")},
+			want:    "unreachable (connection refused)",
+		},
+		{
+			name:    "disabled",
+			checker: &fakeStatusChecker{status: util.CachingStatusDisabled},
+			want:    "disabled for this team",
+		},
+		{
+			name:    "over limit",
+			checker: &fakeStatusChecker{status: util.CachingStatusOverLimit},
+			want:    "over the usage limit",
+		},
+		{
+			name:    "timed out",
+			checker: &fakeStatusChecker{status: util.CachingStatusEnabled, delay: time.Second},
+			want:    "unreachable (no response after 50ms)",
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, remoteCacheHealth(tc.checker, 50*time.Millisecond, 50*time.Millisecond), tc.name)
+	}
+
+	slow := remoteCacheHealth(&fakeStatusChecker{status: util.CachingStatusEnabled, delay: 20 * time.Millisecond}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, slow, "reachable, but slow")
+}
@@ -1,14 +1,16 @@
 package run
 
 import (
+	"bytes"
 	gocontext "context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -28,6 +30,8 @@ import (
 	"github.com/vercel/turborepo/cli/internal/daemonclient"
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/graphvisualizer"
+	"github.com/vercel/turborepo/cli/internal/hashing"
+	"github.com/vercel/turborepo/cli/internal/inference"
 	"github.com/vercel/turborepo/cli/internal/logstreamer"
 	"github.com/vercel/turborepo/cli/internal/nodes"
 	"github.com/vercel/turborepo/cli/internal/packagemanager"
@@ -44,6 +48,7 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-hclog"
+	"github.com/kballard/go-shellquote"
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
 )
@@ -56,6 +61,10 @@ type completeGraph struct {
 	PackageInfos     map[interface{}]*fs.PackageJSON
 	GlobalHash       string
 	RootNode         string
+	// FrameworkEnvPrefixes replaces the env prefixes of inferred frameworks, keyed by slug
+	FrameworkEnvPrefixes map[string][]string
+	// ProdTopologicalGraph has only the edges of TopologicalGraph for production dependencies
+	ProdTopologicalGraph *dag.AcyclicGraph
 }
 
 // runSpec contains the run-specific configuration elements that come from a particular
@@ -66,11 +75,15 @@ type runSpec struct {
 	Opts         *Opts
 }
 
+// ArgsForTask returns the args passed after '--', followed by any given for the task with
+// --args-for, if the task is one of the targets
 func (rs *runSpec) ArgsForTask(task string) []string {
-	passThroughArgs := make([]string, 0, len(rs.Opts.runOpts.passThroughArgs))
+	taskArgs := rs.Opts.runOpts.passThroughArgsForTask[task]
+	passThroughArgs := make([]string, 0, len(rs.Opts.runOpts.passThroughArgs)+len(taskArgs))
 	for _, target := range rs.Targets {
 		if target == task {
 			passThroughArgs = append(passThroughArgs, rs.Opts.runOpts.passThroughArgs...)
+			passThroughArgs = append(passThroughArgs, taskArgs...)
 		}
 	}
 	return passThroughArgs
@@ -100,16 +113,73 @@ func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 		SilenceErrors:         true,
 		DisableFlagsInUseLine: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.runOpts.summaryFile == "-" && opts.runOpts.streamEvents == "-" {
+				return errors.New("only one of --experimental-summary-file and --experimental-stream-events can write to stdout")
+			}
+			var stdout io.Writer = os.Stdout
+			stdoutReserved := opts.runOpts.summaryFile == "-" || opts.runOpts.streamEvents == "-"
+			if stdoutReserved {
+				// Keep stdout for the run summary or events so that they can be piped, and send
+				// everything else, including task output, to stderr
+				stdout = os.Stderr
+			}
 			base, err := helper.GetCmdBase(cmd.Flags())
 			if err != nil {
 				return err
 			}
+			if stdoutReserved {
+				base.UI = helper.GetUIWithOutput(cmd.Flags(), stdout)
+			}
 			tasks, passThroughArgs := parseTasksAndPassthroughArgs(args, flags)
+			if opts.runOpts.configProfile != "" {
+				profile, err := readRunProfile(base.RepoRoot, opts.runOpts.configProfile)
+				if err != nil {
+					return err
+				}
+				if err := applyRunProfile(profile, flags, cmd.InheritedFlags()); err != nil {
+					return err
+				}
+				if len(tasks) == 0 {
+					tasks = profile.Tasks
+				}
+				if (opts.runOpts.summaryFile == "-" || opts.runOpts.streamEvents == "-") && !stdoutReserved {
+					// Output was already set up by the time the profile was read
+					return errors.New("a profile can't write the run summary or events to stdout, pass \"-\" on the command line instead")
+				}
+			}
+			if opts.runOpts.tasksFile != "" {
+				cwd, err := fs.GetCwd()
+				if err != nil {
+					return err
+				}
+				fileTasks, err := readTasksFile(fs.ResolveUnknownPath(cwd, opts.runOpts.tasksFile))
+				if err != nil {
+					return err
+				}
+				tasks = append(tasks, fileTasks...)
+			}
 			if len(tasks) == 0 {
 				return errors.New("at least one task must be specified")
 			}
 			opts.runOpts.passThroughArgs = passThroughArgs
+			opts.runOpts.passThroughArgsForTask, err = parseArgsForTasks(opts.runOpts.argsFor, tasks)
+			if err != nil {
+				return err
+			}
+			if flags.Changed("remote-only") || flags.Changed("cache") || os.Getenv("TURBO_REMOTE_ONLY") != "" {
+				// The user has explicitly chosen whether to use the filesystem cache
+				opts.runOpts.remoteOnlyForCI = false
+			}
+			if err := opts.cacheOpts.ResolveRemoteTimeout(flags); err != nil {
+				return err
+			}
+			if opts.runOpts.cacheWarm {
+				if err := opts.enableCacheWarming(); err != nil {
+					return err
+				}
+			}
 			run := configureRun(base, opts, signalWatcher)
+			run.stdout = stdout
 			ctx := cmd.Context()
 			if err := run.run(ctx, tasks); err != nil {
 				base.LogError("run failed: %v", err)
@@ -120,6 +190,12 @@ func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 	}
 	flags = cmd.Flags()
 	opts = optsFromFlags(flags)
+	cmd.ValidArgsFunction = completeTasks(helper)
+	for _, flag := range []string{"filter", "scope"} {
+		if err := cmd.RegisterFlagCompletionFunc(flag, completePackages(helper, opts)); err != nil {
+			panic(err)
+		}
+	}
 	return cmd
 }
 
@@ -130,6 +206,93 @@ func parseTasksAndPassthroughArgs(remainingArgs []string, flags *pflag.FlagSet)
 	return remainingArgs, nil
 }
 
+// parseArgsForTasks splits each --args-for value into the task it names and its args, which
+// are split like a shell would. Task names can contain ':', so a value is attributed to the
+// longest of the tasks being run that it starts with.
+func parseArgsForTasks(argsFor []string, tasks []string) (map[string][]string, error) {
+	if len(argsFor) == 0 {
+		return nil, nil
+	}
+	argsForTask := make(map[string][]string)
+	for _, value := range argsFor {
+		task := ""
+		for _, candidate := range tasks {
+			if strings.HasPrefix(value, candidate+":") && len(candidate) > len(task) {
+				task = candidate
+			}
+		}
+		if task == "" {
+			return nil, errors.Errorf("--args-for=%v must start with one of the tasks being run and a ':', such as %v:<args>", value, tasks[0])
+		}
+		args, err := shellquote.Split(value[len(task)+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "--args-for=%v", value)
+		}
+		argsForTask[task] = append(argsForTask[task], args...)
+	}
+	return argsForTask, nil
+}
+
+// _tasksFileComment matches a comment in a tasks file: a # at the start of a line or
+// following whitespace. Other #s are part of a task, such as in pkg#task.
+var _tasksFileComment = regexp.MustCompile(`(?:^|\s)#.*$`)
+
+// readTasksFile reads a list of tasks to run, one per line. Blank lines and
+// comments are ignored.
+func readTasksFile(path turbopath.AbsolutePath) ([]string, error) {
+	contents, err := path.ReadFile()
+	if err != nil {
+		return nil, fmt.Errorf("reading tasks file: %w", err)
+	}
+	tasks := []string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = _tasksFileComment.ReplaceAllString(strings.TrimSpace(line), "")
+		if task := strings.TrimSpace(line); task != "" {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// readRunProfile reads the named profile from turbo.json
+func readRunProfile(repoRoot turbopath.AbsolutePath, name string) (fs.RunProfile, error) {
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.Join("package.json"))
+	if err != nil {
+		return fs.RunProfile{}, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	turboJSON, err := fs.ReadTurboConfig(repoRoot, rootPackageJSON)
+	if err != nil {
+		return fs.RunProfile{}, err
+	}
+	return turboJSON.GetProfile(name)
+}
+
+// applyRunProfile sets the flags of the profile that weren't given on the command line.
+// Global flags such as --cwd have been acted on by the time the profile is read, so the
+// profile can't set them.
+func applyRunProfile(profile fs.RunProfile, flags *pflag.FlagSet, globalFlags *pflag.FlagSet) error {
+	names := make([]string, 0, len(profile.Flags))
+	for name := range profile.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil || name == "config-profile" || globalFlags.Lookup(name) != nil {
+			return fmt.Errorf("profile sets unknown flag %q", name)
+		}
+		if flag.Changed {
+			continue
+		}
+		for _, value := range profile.Flags[name] {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("profile sets invalid value %q for flag %q: %w", value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
 func optsFromFlags(flags *pflag.FlagSet) *Opts {
 	opts := getDefaultOptions()
 	aliases := make(map[string]string)
@@ -155,19 +318,35 @@ func configureRun(base *cmdutil.CmdBase, opts *Opts, signalWatcher *signals.Watc
 		opts.cacheOpts.SkipFilesystem = true
 	}
 
+	// The caches do the filtering when restoring outputs
+	opts.cacheOpts.RestoreFilter = opts.runcacheOpts.RestoreFilter
+
+	if opts.runOpts.summaryUploadHeader == "" {
+		// Allow passing credentials for the summary endpoint without putting them on the command line
+		opts.runOpts.summaryUploadHeader = os.Getenv("TURBO_SUMMARY_UPLOAD_HEADER")
+	}
+
 	processes := process.NewManager(base.Logger.Named("processes"))
 	signalWatcher.AddOnClose(processes.Close)
 	return &run{
-		base:      base,
-		opts:      opts,
-		processes: processes,
+		base:          base,
+		opts:          opts,
+		processes:     processes,
+		signalWatcher: signalWatcher,
+		summaryOut:    os.Stdout,
+		stdout:        os.Stdout,
 	}
 }
 
 type run struct {
-	base      *cmdutil.CmdBase
-	opts      *Opts
-	processes *process.Manager
+	base          *cmdutil.CmdBase
+	opts          *Opts
+	processes     *process.Manager
+	signalWatcher *signals.Watcher
+	// summaryOut receives the run summary or events when they are written to "-"
+	summaryOut io.Writer
+	// stdout receives the output of tasks and everything else turbo would print to stdout
+	stdout io.Writer
 }
 
 func (r *run) run(ctx gocontext.Context, targets []string) error {
@@ -177,13 +356,24 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read package.json: %w", err)
 	}
-	turboJSON, err := fs.ReadTurboConfig(r.base.RepoRoot, rootPackageJSON)
+	readTurboConfig := fs.ReadTurboConfig
+	if r.opts.runOpts.strictConfig {
+		readTurboConfig = fs.ReadStrictTurboConfig
+	}
+	turboJSON, err := readTurboConfig(r.base.RepoRoot, rootPackageJSON)
 	if err != nil {
 		return err
 	}
 	// TODO: these values come from a config file, hopefully viper can help us merge these
 	r.opts.cacheOpts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
-	pkgDepGraph, err := context.New(context.WithGraph(r.base.RepoRoot, rootPackageJSON, r.opts.cacheOpts.ResolveCacheDir(r.base.RepoRoot)))
+	if err := inference.ValidateEnvPrefixes(turboJSON.FrameworkEnvPrefixes); err != nil {
+		return err
+	}
+	withGraph := context.WithGraph
+	if r.opts.runOpts.depGraphCache {
+		withGraph = context.WithCachedGraph
+	}
+	pkgDepGraph, err := context.New(withGraph(r.base.RepoRoot, rootPackageJSON, r.opts.cacheOpts.ResolveCacheDir(r.base.RepoRoot)))
 	if err != nil {
 		return err
 	}
@@ -200,6 +390,10 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			r.opts.runcacheOpts.OutputWatcher = daemonClient
 		}
 	}
+	if r.opts.runcacheOpts.OutputWatcher == nil {
+		// Without the daemon, check the outputs against the files they matched when written
+		r.opts.runcacheOpts.OutputWatcher = runcache.NewPollingOutputWatcher(r.base.RepoRoot)
+	}
 
 	if err := util.ValidateGraph(&pkgDepGraph.TopologicalGraph); err != nil {
 		return errors.Wrap(err, "Invalid package dependency graph")
@@ -209,6 +403,17 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 	if err := validateTasks(pipeline, targets); err != nil {
 		return err
 	}
+	if r.opts.runOpts.detectConfigCycles {
+		if cycle := pipeline.FindTaskDependencyCycle(); cycle != nil {
+			return fmt.Errorf("circular dependsOn in turbo `pipeline` in \"turbo.json\": %v", strings.Join(cycle, " -> "))
+		}
+	}
+	// A dry run doesn't execute anything, so it doesn't need dependencies installed
+	if r.opts.runOpts.packageManagerInstallCheck && !r.opts.runOpts.dryRun {
+		if err := pkgDepGraph.PackageManager.CheckInstalled(r.base.RepoRoot); err != nil {
+			return err
+		}
+	}
 
 	scmInstance, err := scm.FromInRepo(r.base.RepoRoot.ToStringDuringMigration())
 	if err != nil {
@@ -233,20 +438,40 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			}
 		}
 	}
-	globalHash, err := calculateGlobalHash(
+	hashTurboVersion := ""
+	if r.opts.runOpts.hashIncludesTurboVersion {
+		hashTurboVersion = r.base.TurboVersion
+	}
+	rootExternalDepsHash := rootPackageJSON.ExternalDepsHash
+	// Without a parsed lockfile there are no resolved dependencies to hash instead of it
+	hashLockfile := true
+	if r.opts.runOpts.lockfileAwareGlobalHash && pkgDepGraph.LockfileResolved {
+		rootExternalDepsHash, err = scopedRootExternalDepsHash(rootPackageJSON, pkgDepGraph.PackageInfos, &pkgDepGraph.TopologicalGraph, filteredPkgs)
+		if err != nil {
+			return fmt.Errorf("failed to calculate global hash: %v", err)
+		}
+		hashLockfile = false
+	}
+	globalHash, globalHashInputs, err := calculateGlobalHash(
 		r.base.RepoRoot,
-		rootPackageJSON,
+		rootExternalDepsHash,
 		pipeline,
 		turboJSON.GlobalEnv,
 		turboJSON.GlobalDeps,
 		pkgDepGraph.PackageManager,
 		r.base.Logger,
 		os.Environ(),
+		hashTurboVersion,
+		hashLockfile,
+		r.opts.runOpts.concurrency,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to calculate global hash: %v", err)
 	}
 	r.base.Logger.Debug("global hash", "value", globalHash)
+	if r.opts.runOpts.explainGlobalHashChange {
+		r.explainGlobalHashChange(globalHashInputs)
+	}
 	r.base.Logger.Debug("local cache folder", "path", r.opts.cacheOpts.OverrideDir)
 
 	// TODO: consolidate some of these arguments
@@ -256,6 +481,9 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 		PackageInfos:     pkgDepGraph.PackageInfos,
 		GlobalHash:       globalHash,
 		RootNode:         pkgDepGraph.RootNode,
+
+		FrameworkEnvPrefixes: turboJSON.FrameworkEnvPrefixes,
+		ProdTopologicalGraph: pkgDepGraph.ProdTopologicalGraph(),
 	}
 	rs := &runSpec{
 		Targets:      targets,
@@ -272,11 +500,29 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 		vertexSet.Add(v)
 	}
 
-	engine, err := buildTaskGraph(&g.TopologicalGraph, g.Pipeline, rs)
+	engine, err := buildTaskGraph(&g.TopologicalGraph, g.ProdTopologicalGraph, g.Pipeline, rs)
 	if err != nil {
 		return errors.Wrap(err, "error preparing engine")
 	}
+	if rs.Opts.runOpts.skipMissingScripts {
+		pruneTasksWithoutScripts(engine, g.PackageInfos)
+	}
 	tracker := taskhash.NewTracker(g.RootNode, g.GlobalHash, g.Pipeline, g.PackageInfos)
+	if rs.Opts.runOpts.inputsDefaultAll {
+		tracker.SetDefaultInputs(hashing.DefaultInputsAll)
+	} else {
+		tracker.SetDefaultInputs(hashing.DefaultInputsTracked)
+	}
+	if rs.Opts.runOpts.inputGlobsFromTsconfig {
+		tracker.UseTsconfigInputs()
+	}
+	if rs.Opts.runOpts.sharedRepoTree {
+		tracker.UseRepoTree()
+	}
+	tracker.SetFrameworkEnvPrefixes(g.FrameworkEnvPrefixes)
+	if rs.Opts.runOpts.cacheMissReport != "" {
+		tracker.RecordFileHashes()
+	}
 	err = tracker.CalculateFileHashes(engine.TaskGraph.Vertices(), rs.Opts.runOpts.concurrency, r.base.RepoRoot)
 	if err != nil {
 		return errors.Wrap(err, "error hashing package files")
@@ -285,23 +531,31 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 	// If we are running in parallel, then we remove all the edges in the graph
 	// except for the root. Rebuild the task graph for backwards compatibility.
 	// We still use dependencies specified by the pipeline configuration.
+	// The production graph is pruned as well, for tasks with prodDependenciesOnly.
 	if rs.Opts.runOpts.parallel {
-		for _, edge := range g.TopologicalGraph.Edges() {
-			if edge.Target() != g.RootNode {
-				g.TopologicalGraph.RemoveEdge(edge)
+		for _, graph := range []*dag.AcyclicGraph{&g.TopologicalGraph, g.ProdTopologicalGraph} {
+			for _, edge := range graph.Edges() {
+				if edge.Target() != g.RootNode {
+					graph.RemoveEdge(edge)
+				}
 			}
 		}
-		engine, err = buildTaskGraph(&g.TopologicalGraph, g.Pipeline, rs)
+		engine, err = buildTaskGraph(&g.TopologicalGraph, g.ProdTopologicalGraph, g.Pipeline, rs)
 		if err != nil {
 			return errors.Wrap(err, "error preparing engine")
 		}
+		if rs.Opts.runOpts.skipMissingScripts {
+			pruneTasksWithoutScripts(engine, g.PackageInfos)
+		}
 	}
 
-	if rs.Opts.runOpts.graphFile != "" || rs.Opts.runOpts.graphDot {
-		visualizer := graphvisualizer.New(r.base.RepoRoot, r.base.UI, engine.TaskGraph)
+	if rs.Opts.runOpts.graphFile != "" || rs.Opts.runOpts.graphDot || rs.Opts.runOpts.graphMermaid {
+		visualizer := graphvisualizer.New(r.base.RepoRoot, r.base.UI, engine.TaskGraphWithoutRoot())
 
 		if rs.Opts.runOpts.graphDot {
 			visualizer.RenderDotGraph()
+		} else if rs.Opts.runOpts.graphMermaid {
+			visualizer.RenderMermaidGraph()
 		} else {
 			err := visualizer.GenerateGraphFile(rs.Opts.runOpts.graphFile)
 			if err != nil {
@@ -315,15 +569,22 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 		}
 		packagesInScope := rs.FilteredPkgs.UnsafeListOfStrings()
 		sort.Strings(packagesInScope)
+		dryRun := &dryRunSummary{
+			Packages: packagesInScope,
+			Tasks:    tasksRun,
+		}
+		if rs.Opts.runOpts.dryRunSummary {
+			summaryPath, err := dryRun.write(r.base.RepoRoot, startAt)
+			if err != nil {
+				return errors.Wrap(err, "failed to write dry run summary")
+			}
+			r.base.Logger.Debug("wrote dry run summary", "path", summaryPath)
+			if !rs.Opts.runOpts.dryRunJSON {
+				r.base.UI.Output(ui.Dim(fmt.Sprintf("• Wrote dry run summary to %v", summaryPath)))
+			}
+		}
 		if rs.Opts.runOpts.dryRunJSON {
-			dryRun := &struct {
-				Packages []string     `json:"packages"`
-				Tasks    []hashedTask `json:"tasks"`
-			}{
-				Packages: packagesInScope,
-				Tasks:    tasksRun,
-			}
-			bytes, err := json.MarshalIndent(dryRun, "", "  ")
+			bytes, err := dryRun.render()
 			if err != nil {
 				return errors.Wrap(err, "failed to render JSON")
 			}
@@ -331,7 +592,7 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 		} else {
 			r.base.UI.Output("")
 			r.base.UI.Info(util.Sprintf("${CYAN}${BOLD}Packages in Scope${RESET}"))
-			p := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			p := tabwriter.NewWriter(r.stdout, 0, 0, 1, ' ', 0)
 			fmt.Fprintln(p, "Name\tPath\t")
 			for _, pkg := range packagesInScope {
 				fmt.Fprintf(p, "%s\t%s\t\n", pkg, g.PackageInfos[pkg].Dir)
@@ -343,13 +604,14 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 
 			for _, task := range tasksRun {
 				r.base.UI.Info(util.Sprintf("${BOLD}%s${RESET}", task.TaskID))
-				w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				w := tabwriter.NewWriter(r.stdout, 0, 0, 1, ' ', 0)
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Task\t=\t%s\t${RESET}", task.Task))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Package\t=\t%s\t${RESET}", task.Package))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Hash\t=\t%s\t${RESET}", task.Hash))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Directory\t=\t%s\t${RESET}", task.Dir))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Command\t=\t%s\t${RESET}", task.Command))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Outputs\t=\t%s\t${RESET}", strings.Join(task.Outputs, ", ")))
+				fmt.Fprintln(w, util.Sprintf("  ${GREY}Cache\t=\t%s\t${RESET}", task.Cache))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Log File\t=\t%s\t${RESET}", task.LogFile))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependencies\t=\t%s\t${RESET}", strings.Join(task.Dependencies, ", ")))
 				fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependendents\t=\t%s\t${RESET}", strings.Join(task.Dependents, ", ")))
@@ -366,14 +628,14 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 	return nil
 }
 
-func buildTaskGraph(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs *runSpec) (*core.Scheduler, error) {
+func buildTaskGraph(topoGraph *dag.AcyclicGraph, prodTopoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs *runSpec) (*core.Scheduler, error) {
 	engine := core.NewScheduler(topoGraph)
+	engine.ProdTopologicGraph = prodTopoGraph
 	for taskName, taskDefinition := range pipeline {
 		topoDeps := make(util.Set)
 		deps := make(util.Set)
-		isPackageTask := util.IsPackageTask(taskName)
 		for _, dependency := range taskDefinition.TaskDependencies {
-			if isPackageTask && util.IsPackageTask(dependency) {
+			if util.IsPackageTask(dependency) {
 				err := engine.AddDep(dependency, taskName)
 				if err != nil {
 					return nil, err
@@ -386,9 +648,10 @@ func buildTaskGraph(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs *runSp
 			topoDeps.Add(dependency)
 		}
 		engine.AddTask(&core.Task{
-			Name:     taskName,
-			TopoDeps: topoDeps,
-			Deps:     deps,
+			Name:         taskName,
+			TopoDeps:     topoDeps,
+			Deps:         deps,
+			ProdDepsOnly: taskDefinition.ProdDependenciesOnly,
 		})
 	}
 
@@ -407,6 +670,20 @@ func buildTaskGraph(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs *runSp
 	return engine, nil
 }
 
+// pruneTasksWithoutScripts removes tasks that have no corresponding script in their
+// package's package.json from the task graph, so they are neither run nor reported
+func pruneTasksWithoutScripts(engine *core.Scheduler, packageInfos map[interface{}]*fs.PackageJSON) {
+	engine.PruneTasks(func(taskID string) bool {
+		pkgName, task := util.GetPackageTaskFromId(taskID)
+		pkg, ok := packageInfos[pkgName]
+		if !ok {
+			return false
+		}
+		_, ok = pkg.Scripts[task]
+		return !ok
+	})
+}
+
 // Opts holds the current run operations configuration
 type Opts struct {
 	runOpts      runOpts
@@ -428,6 +705,12 @@ type runOpts struct {
 	// If true, continue task executions even if a task fails.
 	continueOnError bool
 	passThroughArgs []string
+	// Args for individual tasks, each given as <task>:<args>
+	argsFor []string
+	// Args passed to individual tasks in addition to passThroughArgs, parsed from argsFor
+	passThroughArgsForTask map[string][]string
+	// Along with continueOnError, record the tasks that depend on a failed task as skipped
+	continueDependenciesOnly bool
 	// Restrict execution to only the listed task names. Default false
 	only bool
 	// Dry run flags
@@ -436,7 +719,81 @@ type runOpts struct {
 	// Graph flags
 	graphDot  bool
 	graphFile string
-	noDaemon  bool
+	// Print the graph as a mermaid flowchart rather than dot
+	graphMermaid bool
+	noDaemon     bool
+	// Path to write a manifest of the outputs produced by each task
+	outputManifest string
+	// Run tasks only to populate the cache: force execution, hide output, and don't fail on task errors
+	cacheWarm bool
+	// Skip the filesystem cache when running in CI with Remote Caching enabled
+	remoteOnlyForCI bool
+	// Reuse the package graph computed by a previous run if no manifests have changed
+	depGraphCache bool
+	// Adjust concurrency to the system load, starting from the configured concurrency
+	concurrencyAuto bool
+	// URL to POST a JSON summary of the run to once it completes, and an optional header to send with it
+	summaryUploadURL    string
+	summaryUploadHeader string
+	// Recalculate each task's hash and fail the task if it doesn't match
+	detectNonDeterministicHash bool
+	// Remove tasks without a script in their package from the task graph before running
+	skipMissingScripts bool
+	// Include the turbo version in the global hash, at the cost of cache reuse across versions
+	hashIncludesTurboVersion bool
+	// Command to run once for every package with tasks that weren't restored from cache, and
+	// whether a failure of that command fails the run
+	packageChangedCallback      string
+	packageChangedCallbackFatal bool
+	// Write the dry run summary to the run summary directory
+	dryRunSummary bool
+	// Fail instead of warning when the root package.json has a legacy "turbo" key
+	strictConfig bool
+	// Whether tasks without declared inputs hash untracked files in addition to files tracked by git
+	inputsDefaultAll bool
+	// Print summary stats for each task name after the run
+	taskGroupSummary bool
+	// Only include root external dependencies used by packages in scope in the global hash,
+	// rather than the whole lockfile
+	lockfileAwareGlobalHash bool
+	// Check the pipeline for circular dependsOn chains before building the task graph
+	detectConfigCycles bool
+	// Print the running tasks when no task output has been printed for this long. 0 disables it
+	heartbeatInterval time.Duration
+	// File to write the JSON summary of the run to once it completes, or "-" for stdout
+	summaryFile string
+	// Check whether the remote cache works before running any tasks
+	remoteCacheHealthCheck bool
+	// Add globs from each package's tsconfig.json to the inputs of its tasks
+	inputGlobsFromTsconfig bool
+	// Print how the global hash inputs differ from the previous run's
+	explainGlobalHashChange bool
+	// File listing tasks to run in addition to those passed as arguments
+	tasksFile string
+	// Number of concurrent io-bound tasks, which then don't count against concurrency. 0 disables the split.
+	ioConcurrency int
+	// Fail a task if its outputs fail verification after being written to the local cache
+	cachePutVerificationFatal bool
+	// Write each line of task output in full before another task's line
+	interleaveGuard bool
+	// Path to write the merged SARIF reports of all tasks to
+	summarySarif string
+	// Check that dependencies are installed and match the lockfile before running tasks
+	packageManagerInstallCheck bool
+	// Kill tasks that run for longer than this, unless their "timeout" says otherwise. 0 disables it
+	taskTimeout time.Duration
+	// File to write run lifecycle events to as they happen, or "-" for stdout
+	streamEvents string
+	// Fail the run if any task that caches its outputs wasn't restored from cache
+	failOnMiss bool
+	// Name of a profile in turbo.json to read tasks and flags from
+	configProfile string
+	// Don't warn about tasks whose outputs match no files
+	noEmptyOutputsWarning bool
+	// List the files checked in to each package from one `git ls-tree` of the whole repo
+	sharedRepoTree bool
+	// File to write why each task that was run missed the cache to
+	cacheMissReport string
 }
 
 var (
@@ -444,15 +801,120 @@ var (
 You can load the file up in chrome://tracing to see
 which parts of your build were slow.`
 	_continueHelp = `Continue execution even if a task exits with an error
-or non-zero exit code. The default behavior is to bail`
+or non-zero exit code. The default behavior is to bail.
+Tasks that depend on a failed task are never run. Use
+--continue=dependencies-only to also report them as skipped.`
 	_dryRunHelp = `List the packages in scope and the tasks that would be run,
 but don't actually run them. Passing --dry=json or
 --dry-run=json will render the output in JSON format.`
-	_graphHelp = `Generate a graph of the task execution and output to a file when a filename is specified (.svg, .png, .jpg, .pdf, .json, .html).
-Outputs dot graph to stdout when if no filename is provided`
-	_concurrencyHelp = `Limit the concurrency of task execution. Use 1 for serial (i.e. one-at-a-time) execution.`
-	_parallelHelp    = `Execute all tasks in parallel.`
-	_onlyHelp        = `Run only the specified tasks, not their dependencies.`
+	_graphHelp = `Generate a graph of the task execution and output to a file when a filename is specified (.svg, .png, .jpg, .pdf, .json, .html, .mmd).
+Outputs dot graph to stdout when if no filename is provided, or a mermaid graph with --graph=mermaid`
+	_concurrencyHelp    = `Limit the concurrency of task execution. Use 1 for serial (i.e. one-at-a-time) execution.`
+	_parallelHelp       = `Execute all tasks in parallel.`
+	_onlyHelp           = `Run only the specified tasks, not their dependencies.`
+	_outputManifestHelp = `Write a JSON manifest listing the output files of each task,
+their hashes, and whether the task was restored from cache.`
+	_cacheWarmHelp = `Execute tasks only to populate the cache. Implies --force,
+--output-logs=none and --continue. Task failures are
+reported but do not fail the run.`
+	_remoteOnlyForCIHelp = `When running in CI with Remote Caching enabled, skip the
+local filesystem cache since CI runners are ephemeral.
+An explicit --remote-only, --cache or TURBO_REMOTE_ONLY takes precedence.`
+	_depGraphCacheHelp = `Cache the package dependency graph in the cache directory and
+reuse it while the lockfile, turbo.json and every package.json
+are unchanged.`
+	_concurrencyAutoHelp = `Adjust the number of concurrent tasks to the system load,
+starting from --concurrency and never exceeding the larger
+of --concurrency and the number of CPUs. Only supported on
+Linux, other platforms keep a fixed concurrency.`
+	_summaryUploadURLHelp    = `POST a JSON summary of the run to this URL once it completes.`
+	_summaryUploadHeaderHelp = `Header to send with the run summary, in the form "Name: value".
+Defaults to the TURBO_SUMMARY_UPLOAD_HEADER environment variable.`
+	_detectNonDeterministicHashHelp = `Calculate each task's hash twice and fail the task, listing
+the differing inputs, if the hashes don't match.`
+	_skipMissingScriptsHelp = `Remove tasks that have no script in their package.json from
+the task graph, so that they don't appear in the graph,
+dry-run output or run summaries.`
+	_hashIncludesTurboVersionHelp = `Include the version of turbo in the global hash, so that
+upgrading turbo invalidates all cached artifacts. Caches
+are no longer shared between different versions of turbo.`
+	_packageChangedCallbackHelp = `Run this command once for every package with tasks that were
+not restored from cache. The package name is passed in the
+TURBO_CHANGED_PACKAGE environment variable, and its tasks and
+their outputs are written as JSON to stdin.`
+	_packageChangedCallbackFatalHelp = `Fail the run if the package changed callback fails. By default
+failures are reported as warnings.`
+	_dryRunSummaryHelp = `When used with --dry-run, also write the JSON summary of the
+planned run to .turbo/runs for comparison with later runs.`
+	_strictConfigHelp = `Fail instead of warning when the root package.json contains
+a deprecated "turbo" key.`
+	_inputsDefaultAllHelp = `For tasks that don't declare inputs, hash every file in the
+package that isn't ignored by git, including untracked files.
+Set to false to only hash files tracked by git.`
+	_taskGroupSummaryHelp = `After the run, also summarize the tasks grouped by task name,
+with the cache hit rate and total duration of each group.`
+	_lockfileAwareGlobalHashHelp = `Hash only the root dependencies used by packages in scope
+into the global hash, instead of the whole lockfile. Changes
+to the lockfile then only affect the tasks of packages whose
+resolved dependencies changed.`
+	_detectConfigCyclesHelp = `Check the turbo.json pipeline for tasks that depend on
+themselves, directly or through other tasks, and report
+the offending task keys before building the task graph.`
+	_heartbeatHelp = `When no task output has been printed for this long (e.g. 5m),
+print a line listing the running tasks, to keep CI providers
+from killing the run for being idle. Must be at least 1s.`
+	_summaryFileHelp = `Write a JSON summary of the run to this file once it
+completes. Use "-" to write it to stdout, in which case
+all other output is written to stderr.`
+	_remoteCacheHealthCheckHelp = `Before running tasks, check whether the remote cache is
+reachable and accepts your credentials, and print the result
+alongside the remote caching status.`
+	_inputGlobsFromTsconfigHelp = `For tasks that declare inputs, also hash the files that the
+package's tsconfig.json includes through its "include" and
+"files" keys, along with the tsconfig.json itself.`
+	_explainGlobalHashChangeHelp = `Record the inputs to the global hash, and when it differs
+from the previous run's, print the global files, env vars
+and other inputs that changed.`
+	_tasksFileHelp = `Read tasks to run from this file, one per line, in addition to
+any passed as arguments. Blank lines and # comments are ignored.
+A relative path is resolved against the current directory.`
+	_ioConcurrencyHelp = `Run tasks with "resourceClass": "io" under their own limit of
+this many concurrent tasks, leaving --concurrency to limit
+cpu-bound tasks. 0 runs all tasks under --concurrency.`
+	_cachePutVerificationFatalHelp = `Fail a task whose outputs fail --experimental-cache-put-verification.
+By default the failure is only logged.`
+	_interleaveGuardHelp = `Write each line of task output, with its prefix, in full before
+writing a line from another task, so that lines from concurrent
+tasks never mix.`
+	_summarySarifHelp = `Merge the SARIF reports that tasks list in "sarifOutputs"
+into a single report, and write it to this file once the
+run completes. Reports restored from cache are included.`
+	_packageManagerInstallCheckHelp = `Before running any tasks, check that dependencies have been
+installed and that the lockfile has not changed since, and
+fail with a prompt to install them if not.`
+	_taskTimeoutHelp = `Kill any task that is still running after this long (e.g. 30m)
+and fail it. A task's "timeout" in turbo.json takes precedence,
+so long-running tasks can set it to "0". 0 disables it.`
+	_streamEventsHelp = `Write run and task lifecycle events to this file as they happen,
+one JSON object per line. Use "-" to write them to stdout, in
+which case all other output is written to stderr.`
+	_failOnMissHelp = `Fail the run if any task that caches its outputs was not
+restored from cache, e.g. to check that a CI cache is warm.`
+	_configProfileHelp = `Read tasks and flags from the named entry of "profiles" in
+turbo.json. Tasks and flags given on the command line take
+precedence over the profile.`
+	_noEmptyOutputsWarningHelp = `Don't warn about tasks that complete without producing
+any files matching their outputs.`
+	_sharedRepoTreeHelp = `For tasks that don't declare inputs, list the files checked
+in to each package from a single "git ls-tree" of the whole
+repository rather than running it in every package.`
+	_cacheMissReportHelp = `Write why each task that was run missed the cache to this
+file as JSON, by comparing its hash inputs to those of its
+most recently cached hash. The hash inputs of cached tasks
+are only recorded in .turbo when this flag is passed.`
+	_argsForHelp = `Pass args to a single task, given as <task>:<args>, after
+any args passed after '--'. The args are split like a shell
+would and are part of the task's hash. Can be repeated.`
 )
 
 func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string) {
@@ -466,9 +928,45 @@ func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string)
 	})
 	flags.BoolVar(&opts.parallel, "parallel", false, _parallelHelp)
 	flags.StringVar(&opts.profile, "profile", "", _profileHelp)
-	flags.BoolVar(&opts.continueOnError, "continue", false, _continueHelp)
 	flags.BoolVar(&opts.only, "only", false, _onlyHelp)
 	flags.BoolVar(&opts.noDaemon, "no-daemon", false, "Run without using turbo's daemon process")
+	flags.StringVar(&opts.outputManifest, "experimental-output-manifest", "", _outputManifestHelp)
+	flags.BoolVar(&opts.cacheWarm, "experimental-cache-warm", false, _cacheWarmHelp)
+	flags.BoolVar(&opts.remoteOnlyForCI, "experimental-remote-only-for-ci", false, _remoteOnlyForCIHelp)
+	flags.BoolVar(&opts.depGraphCache, "experimental-dep-graph-cache", false, _depGraphCacheHelp)
+	flags.BoolVar(&opts.concurrencyAuto, "experimental-concurrency-auto", false, _concurrencyAutoHelp)
+	flags.StringVar(&opts.summaryUploadURL, "experimental-summary-upload-url", "", _summaryUploadURLHelp)
+	flags.StringVar(&opts.summaryUploadHeader, "experimental-summary-upload-header", "", _summaryUploadHeaderHelp)
+	flags.BoolVar(&opts.detectNonDeterministicHash, "experimental-detect-non-deterministic-hash", false, _detectNonDeterministicHashHelp)
+	flags.BoolVar(&opts.skipMissingScripts, "experimental-skip-missing-scripts-silently", false, _skipMissingScriptsHelp)
+	flags.BoolVar(&opts.hashIncludesTurboVersion, "experimental-hash-includes-turbo-version", false, _hashIncludesTurboVersionHelp)
+	flags.StringVar(&opts.packageChangedCallback, "experimental-package-changed-callback", "", _packageChangedCallbackHelp)
+	flags.BoolVar(&opts.packageChangedCallbackFatal, "experimental-package-changed-callback-fatal", false, _packageChangedCallbackFatalHelp)
+	flags.BoolVar(&opts.dryRunSummary, "experimental-dry-run-affects-summary-path", false, _dryRunSummaryHelp)
+	flags.BoolVar(&opts.strictConfig, "strict-config", false, _strictConfigHelp)
+	flags.BoolVar(&opts.inputsDefaultAll, "experimental-inputs-default-all", true, _inputsDefaultAllHelp)
+	flags.BoolVar(&opts.taskGroupSummary, "experimental-task-group-summary", false, _taskGroupSummaryHelp)
+	flags.BoolVar(&opts.lockfileAwareGlobalHash, "experimental-lockfile-aware-global-hash", false, _lockfileAwareGlobalHashHelp)
+	flags.BoolVar(&opts.detectConfigCycles, "experimental-detect-circular-task-deps-in-config", false, _detectConfigCyclesHelp)
+	flags.Var(&heartbeatIntervalValue{opts: opts}, "experimental-worker-heartbeat", _heartbeatHelp)
+	flags.StringVar(&opts.summaryFile, "experimental-summary-file", "", _summaryFileHelp)
+	flags.BoolVar(&opts.remoteCacheHealthCheck, "experimental-remote-cache-health-check", false, _remoteCacheHealthCheckHelp)
+	flags.BoolVar(&opts.inputGlobsFromTsconfig, "experimental-input-globs-from-tsconfig", false, _inputGlobsFromTsconfigHelp)
+	flags.BoolVar(&opts.explainGlobalHashChange, "experimental-explain-global-hash-change", false, _explainGlobalHashChangeHelp)
+	flags.StringVar(&opts.tasksFile, "experimental-tasks-from-file", "", _tasksFileHelp)
+	flags.IntVar(&opts.ioConcurrency, "experimental-concurrency-io-vs-cpu", 0, _ioConcurrencyHelp)
+	flags.BoolVar(&opts.cachePutVerificationFatal, "experimental-cache-put-verification-fatal", false, _cachePutVerificationFatalHelp)
+	flags.BoolVar(&opts.interleaveGuard, "experimental-interleave-guard", false, _interleaveGuardHelp)
+	flags.StringVar(&opts.summarySarif, "experimental-summary-sarif", "", _summarySarifHelp)
+	flags.BoolVar(&opts.packageManagerInstallCheck, "experimental-package-manager-install-check", false, _packageManagerInstallCheckHelp)
+	flags.DurationVar(&opts.taskTimeout, "task-timeout", 0, _taskTimeoutHelp)
+	flags.StringVar(&opts.streamEvents, "experimental-stream-events", "", _streamEventsHelp)
+	flags.BoolVar(&opts.failOnMiss, "fail-on-miss", false, _failOnMissHelp)
+	flags.StringVar(&opts.configProfile, "config-profile", "", _configProfileHelp)
+	flags.BoolVar(&opts.noEmptyOutputsWarning, "no-empty-outputs-warning", false, _noEmptyOutputsWarningHelp)
+	flags.BoolVar(&opts.sharedRepoTree, "experimental-shared-repo-tree", false, _sharedRepoTreeHelp)
+	flags.StringVar(&opts.cacheMissReport, "cache-miss-report", "", _cacheMissReportHelp)
+	flags.StringArrayVar(&opts.argsFor, "args-for", nil, _argsForHelp)
 	// This is a no-op flag, we don't need it anymore
 	flags.Bool("experimental-use-daemon", false, "Use the experimental turbo daemon")
 	// Daemon-related flags hidden for now, we can unhide when daemon is ready.
@@ -490,6 +988,13 @@ func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string)
 		NoOptDefVal: _dryRunNoValue,
 		Value:       &dryRunValue{opts: opts},
 	})
+	flags.AddFlag(&pflag.Flag{
+		Name:        "continue",
+		Usage:       _continueHelp,
+		DefValue:    _continueFalse,
+		NoOptDefVal: _continueTrue,
+		Value:       &continueValue{opts: opts},
+	})
 	flags.AddFlag(&pflag.Flag{
 		Name:        "graph",
 		Usage:       _graphHelp,
@@ -499,10 +1004,57 @@ func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string)
 	})
 }
 
+const (
+	_continueTrue             = "true"
+	_continueFalse            = "false"
+	_continueDependenciesOnly = "dependencies-only"
+)
+
+// continueValue implements a flag that can be treated as a boolean (--continue)
+// or a string (--continue=dependencies-only).
+type continueValue struct {
+	opts *runOpts
+}
+
+var _ pflag.Value = &continueValue{}
+
+func (c *continueValue) String() string {
+	if c.opts.continueDependenciesOnly {
+		return _continueDependenciesOnly
+	} else if c.opts.continueOnError {
+		return _continueTrue
+	}
+	return _continueFalse
+}
+
+func (c *continueValue) Set(value string) error {
+	switch value {
+	case _continueTrue:
+		c.opts.continueOnError = true
+		c.opts.continueDependenciesOnly = false
+	case _continueFalse:
+		c.opts.continueOnError = false
+		c.opts.continueDependenciesOnly = false
+	case _continueDependenciesOnly:
+		c.opts.continueOnError = true
+		c.opts.continueDependenciesOnly = true
+	default:
+		return fmt.Errorf("invalid continue mode: %v", value)
+	}
+	return nil
+}
+
+// Type implements Value.Type, and in this case is used to
+// show the values in the usage text.
+func (c *continueValue) Type() string {
+	return ""
+}
+
 const (
 	_graphText      = "graph"
 	_graphNoValue   = "<output filename>"
 	_graphTextValue = "true"
+	_graphMermaid   = "mermaid"
 )
 
 // graphValue implements a flag that can be treated as a boolean (--graph)
@@ -517,6 +1069,9 @@ func (d *graphValue) String() string {
 	if d.opts.graphDot {
 		return _graphText
 	}
+	if d.opts.graphMermaid {
+		return _graphMermaid
+	}
 	return d.opts.graphFile
 }
 
@@ -528,6 +1083,9 @@ func (d *graphValue) Set(value string) error {
 	} else if value == _graphTextValue {
 		// "true" is equivalent to just setting the boolean flag
 		d.opts.graphDot = true
+	} else if value == _graphMermaid {
+		d.opts.graphDot = false
+		d.opts.graphMermaid = true
 	} else {
 		d.opts.graphDot = false
 		d.opts.graphFile = value
@@ -590,10 +1148,43 @@ func (d *dryRunValue) Type() string {
 	return "/ dry "
 }
 
+// enableCacheWarming adjusts the options so that every task is executed and written to
+// the cache, without surfacing task output or failing on task errors.
+func (o *Opts) enableCacheWarming() error {
+	if o.runcacheOpts.SkipWrites {
+		return errors.New("--experimental-cache-warm cannot be used with --no-cache")
+	}
+	if o.runOpts.dryRun {
+		return errors.New("--experimental-cache-warm cannot be used with --dry-run")
+	}
+	noTaskOutput := util.NoTaskOutput
+	o.runcacheOpts.SkipReads = true
+	o.runcacheOpts.TaskOutputModeOverride = &noTaskOutput
+	o.runOpts.continueOnError = true
+	return nil
+}
+
+// newAdaptiveConcurrency configures load-based concurrency starting from the given baseline
+func newAdaptiveConcurrency(baseline int) *core.AdaptiveConcurrency {
+	numCPU := runtime.NumCPU()
+	max := baseline
+	if numCPU > max {
+		max = numCPU
+	}
+	return &core.AdaptiveConcurrency{
+		Min:         1,
+		Max:         max,
+		NumCPU:      numCPU,
+		Interval:    2 * time.Second,
+		LoadAverage: util.LoadAverage,
+	}
+}
+
 func getDefaultOptions() *Opts {
 	return &Opts{
 		runOpts: runOpts{
-			concurrency: 10,
+			concurrency:      10,
+			inputsDefaultAll: true,
 		},
 	}
 }
@@ -609,27 +1200,54 @@ func (r *run) logWarning(prefix string, err error) {
 	r.base.UI.Error(fmt.Sprintf("%s%s%s", ui.WARNING_PREFIX, prefix, color.YellowString(" %v", err)))
 }
 
-func (r *run) executeTasks(ctx gocontext.Context, g *completeGraph, rs *runSpec, engine *core.Scheduler, packageManager *packagemanager.PackageManager, hashes *taskhash.Tracker, startAt time.Time) error {
+func (r *run) executeTasks(ctx gocontext.Context, g *completeGraph, rs *runSpec, engine *core.Scheduler, packageManager *packagemanager.PackageManager, hashes *taskhash.Tracker, startAt time.Time) (retErr error) {
 	apiClient := r.base.APIClient
 	var analyticsSink analytics.Sink
 	if apiClient.IsLinked() {
 		analyticsSink = apiClient
+		if r.opts.runOpts.remoteOnlyForCI && ui.IsCIEnvironment && !r.opts.cacheOpts.SkipFilesystem {
+			r.opts.cacheOpts.SkipFilesystem = true
+			r.base.Logger.Info("running in CI with Remote Caching enabled, skipping the filesystem cache")
+			r.base.UI.Output(ui.Dim("• Running in CI: local filesystem caching disabled (pass --remote-only=false to keep it)"))
+		}
 	} else {
-		r.opts.cacheOpts.SkipRemote = true
+		// A bucket configured in the environment doesn't need the repository to be linked
+		if !cache.S3Configured() {
+			r.opts.cacheOpts.SkipRemote = true
+		}
 		analyticsSink = analytics.NullSink
 	}
+	if r.opts.cacheOpts.RemoteEnabled() {
+		remoteCachingStatus := "• Remote computation caching enabled"
+		if r.opts.runOpts.remoteCacheHealthCheck {
+			var checker cachingStatusChecker = apiClient
+			if s3Checker := cache.NewS3StatusChecker(r.opts.cacheOpts); s3Checker != nil {
+				checker = s3Checker
+			}
+			remoteCachingStatus += ": " + remoteCacheHealth(checker, _remoteCacheHealthTimeout, _remoteCacheSlowThreshold)
+		}
+		r.base.UI.Output(ui.Dim(remoteCachingStatus))
+	} else if r.opts.runOpts.remoteCacheHealthCheck {
+		r.base.UI.Output(ui.Dim("• Remote computation caching disabled (run \"turbo login\" and \"turbo link\" to enable it)"))
+	}
 	analyticsClient := analytics.NewClient(ctx, analyticsSink, r.base.Logger.Named("analytics"))
 	defer analyticsClient.CloseWithTimeout(50 * time.Millisecond)
+	cacheHits := newCacheHitRecorder(analyticsClient)
 	// Theoretically this is overkill, but bias towards not spamming the console
 	once := &sync.Once{}
-	turboCache, err := cache.New(rs.Opts.cacheOpts, r.base.RepoRoot, apiClient, analyticsClient, func(_cache cache.Cache, err error) {
+	onCacheRemoved := func(_cache cache.Cache, err error) {
 		// Currently the HTTP Cache is the only one that can be disabled.
 		// With a cache system refactor, we might consider giving names to the caches so
 		// we can accurately report them here.
 		once.Do(func() {
 			r.logWarning("Remote Caching is unavailable", err)
 		})
-	})
+	}
+	if rs.Opts.cacheOpts.StagedRestore {
+		// Don't leave staging directories behind if turbo is interrupted mid-restore
+		r.signalWatcher.AddOnClose(cache.InterruptStagedRestores)
+	}
+	turboCache, err := cache.New(rs.Opts.cacheOpts, r.base.RepoRoot, apiClient, cacheHits, onCacheRemoved)
 	if err != nil {
 		if errors.Is(err, cache.ErrNoCachesEnabled) {
 			r.logWarning("No caches are enabled. You can try \"turbo login\", \"turbo link\", or ensuring you are not passing --remote-only to enable caching", nil)
@@ -640,30 +1258,95 @@ func (r *run) executeTasks(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 	defer func() {
 		_ = spinner.WaitFor(ctx, turboCache.Shutdown, r.base.UI, "...writing to cache...", 1500*time.Millisecond)
 	}()
+	runcacheOpts := rs.Opts.runcacheOpts
+	for _, scope := range g.Pipeline.RestrictedCacheScopes() {
+		// Tasks restricted to one kind of cache get their own cache instance. A scope whose only
+		// cache is disabled is left with a no-op cache, so there's no need to warn about it.
+		scopedCache, err := cache.NewScoped(rs.Opts.cacheOpts, scope, r.base.RepoRoot, apiClient, cacheHits, onCacheRemoved)
+		if err != nil && !errors.Is(err, cache.ErrNoCachesEnabled) {
+			return errors.Wrapf(err, "failed to set up %v caching", scope)
+		}
+		defer func() {
+			_ = spinner.WaitFor(ctx, scopedCache.Shutdown, r.base.UI, "...writing to cache...", 1500*time.Millisecond)
+		}()
+		if runcacheOpts.ScopedCaches == nil {
+			runcacheOpts.ScopedCaches = make(map[fs.CacheScope]cache.Cache)
+		}
+		runcacheOpts.ScopedCaches[scope] = scopedCache
+	}
 	colorCache := colorcache.New()
 	runState := NewRunState(startAt, rs.Opts.runOpts.profile)
-	runCache := runcache.New(turboCache, r.base.RepoRoot, rs.Opts.runcacheOpts, colorCache)
+	if rs.Opts.runOpts.streamEvents != "" {
+		events, err := newEventStream(rs.Opts.runOpts.streamEvents, r.summaryOut)
+		if err != nil {
+			return err
+		}
+		// Close the stream cleanly if turbo is interrupted
+		r.signalWatcher.AddOnClose(events.Close)
+		defer events.Close()
+		events.runStarted(startAt)
+		// End the stream with the status of the run however it finishes
+		defer func() { events.runEnded(startAt, runExitCode(retErr)) }()
+		runState.events = events
+	}
+	runcacheOpts.Stdout = r.stdout
+	runCache := runcache.New(turboCache, r.base.RepoRoot, runcacheOpts, colorCache)
 	ec := &execContext{
-		colorCache:     colorCache,
 		runState:       runState,
 		rs:             rs,
 		ui:             &cli.ConcurrentUi{Ui: r.base.UI},
 		runCache:       runCache,
+		cacheHits:      cacheHits,
 		logger:         r.base.Logger,
 		packageManager: packageManager,
 		processes:      r.processes,
 		taskHashes:     hashes,
 		repoRoot:       r.base.RepoRoot,
+		outputLock:     &sync.Mutex{},
+		stdout:         r.stdout,
+	}
+	if rs.Opts.runOpts.outputManifest != "" || rs.Opts.runOpts.packageChangedCallback != "" || rs.Opts.runOpts.summarySarif != "" {
+		ec.outputManifest = newOutputManifest()
+	}
+	if rs.Opts.runOpts.heartbeatInterval > 0 {
+		ec.heartbeat = newHeartbeat(rs.Opts.runOpts.heartbeatInterval, r.stdout)
+		ec.heartbeat.start()
 	}
 
 	// run the thing
-	errs := engine.Execute(g.getPackageTaskVisitor(ctx, func(ctx gocontext.Context, packageTask *nodes.PackageTask) error {
-		deps := engine.TaskGraph.DownEdges(packageTask.TaskID)
-		return ec.exec(ctx, packageTask, deps)
-	}), core.ExecOpts{
+	execOpts := core.ExecOpts{
 		Parallel:    rs.Opts.runOpts.parallel,
 		Concurrency: rs.Opts.runOpts.concurrency,
-	})
+	}
+	if rs.Opts.runOpts.concurrencyAuto {
+		// The load is only sampled while tasks run, so check up front that it can be read at all
+		if _, err := util.LoadAverage(); err != nil {
+			r.logWarning("--experimental-concurrency-auto", fmt.Errorf("%v. Using a fixed concurrency of %v", err, rs.Opts.runOpts.concurrency))
+		} else {
+			execOpts.AdaptiveConcurrency = newAdaptiveConcurrency(rs.Opts.runOpts.concurrency)
+		}
+	}
+	if rs.Opts.runOpts.ioConcurrency > 0 {
+		execOpts.IOConcurrency = rs.Opts.runOpts.ioConcurrency
+		execOpts.IsIOBound = func(taskID string) bool {
+			taskDefinition, ok := g.Pipeline.GetTaskDefinition(taskID)
+			return ok && taskDefinition.ResourceClass == fs.ResourceClassIO
+		}
+	}
+	errs := engine.Execute(g.getPackageTaskVisitor(ctx, func(ctx gocontext.Context, packageTask *nodes.PackageTask) error {
+		deps := engine.TaskGraph.DownEdges(packageTask.TaskID)
+		err := ec.exec(ctx, packageTask, deps)
+		if err != nil && rs.Opts.runOpts.continueDependenciesOnly {
+			// The walk won't visit the tasks that depend on this one, so note them here
+			if dependents, dependentsErr := engine.Dependents(packageTask.TaskID); dependentsErr == nil {
+				runState.skipDependents(packageTask.TaskID, dependents)
+			}
+		}
+		return err
+	}), execOpts)
+	if ec.heartbeat != nil {
+		ec.heartbeat.stop()
+	}
 
 	// Track if we saw any child with a non-zero exit code
 	exitCode := 0
@@ -683,6 +1366,70 @@ func (r *run) executeTasks(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 	if err := runState.Close(r.base.UI, rs.Opts.runOpts.profile); err != nil {
 		return errors.Wrap(err, "error with profiler")
 	}
+	if rs.Opts.runOpts.cacheWarm {
+		// When warming the cache, failures are recorded but don't fail the run
+		runState.printCacheWarmSummary(r.base.UI)
+		exitCode = 0
+	}
+	if rs.Opts.runOpts.taskGroupSummary {
+		runState.printTaskGroupSummary(r.base.UI)
+	}
+	if rs.Opts.runOpts.failOnMiss {
+		misses := runState.summary(exitCode).cacheMisses(func(taskID string) bool {
+			taskDefinition, ok := g.Pipeline.GetTaskDefinition(taskID)
+			return ok && taskDefinition.ShouldCache
+		})
+		if len(misses) > 0 {
+			r.base.UI.Error(fmt.Sprintf("--fail-on-miss: tasks missed the cache: %v", strings.Join(misses, ", ")))
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+	if rs.Opts.runOpts.cacheMissReport != "" {
+		if err := r.writeCacheMissReport(runState.summary(exitCode), g.Pipeline, rs, hashes); err != nil {
+			return errors.Wrap(err, "error writing cache miss report")
+		}
+	}
+	if rs.Opts.runOpts.outputManifest != "" {
+		manifestPath := fs.ResolveUnknownPath(r.base.RepoRoot, rs.Opts.runOpts.outputManifest)
+		if err := ec.outputManifest.write(manifestPath, r.base.RepoRoot, hashes); err != nil {
+			return errors.Wrap(err, "error writing output manifest")
+		}
+	} else if rs.Opts.runOpts.packageChangedCallback != "" || rs.Opts.runOpts.summarySarif != "" {
+		if err := ec.outputManifest.resolveOutputs(r.base.RepoRoot, hashes); err != nil {
+			return errors.Wrap(err, "error hashing changed outputs")
+		}
+	}
+	if rs.Opts.runOpts.summarySarif != "" {
+		sarifPath := fs.ResolveUnknownPath(r.base.RepoRoot, rs.Opts.runOpts.summarySarif)
+		if err := ec.outputManifest.writeSarif(sarifPath, r.base.RepoRoot); err != nil {
+			return errors.Wrap(err, "error writing SARIF report")
+		}
+	}
+	if rs.Opts.runOpts.packageChangedCallback != "" {
+		for _, err := range runPackageChangedHooks(ctx, rs.Opts.runOpts.packageChangedCallback, r.base.RepoRoot, ec.outputManifest, r.stdout) {
+			if rs.Opts.runOpts.packageChangedCallbackFatal {
+				r.base.UI.Error(err.Error())
+				if exitCode == 0 {
+					exitCode = 1
+				}
+			} else {
+				r.logWarning("", err)
+			}
+		}
+	}
+	if rs.Opts.runOpts.summaryUploadURL != "" {
+		summary := runState.summary(exitCode)
+		if err := uploadRunSummary(ctx, rs.Opts.runOpts.summaryUploadURL, rs.Opts.runOpts.summaryUploadHeader, summary); err != nil {
+			r.logWarning("failed to upload run summary", err)
+		}
+	}
+	if rs.Opts.runOpts.summaryFile != "" {
+		if err := runState.summary(exitCode).write(rs.Opts.runOpts.summaryFile, r.summaryOut); err != nil {
+			r.logWarning("failed to write run summary", err)
+		}
+	}
 	if exitCode != 0 {
 		return &process.ChildExit{
 			ExitCode: exitCode,
@@ -698,14 +1445,40 @@ type hashedTask struct {
 	Hash         string   `json:"hash"`
 	Command      string   `json:"command"`
 	Outputs      []string `json:"outputs"`
+	Cache        string   `json:"cache"`
 	LogFile      string   `json:"logFile"`
 	Dir          string   `json:"directory"`
 	Dependencies []string `json:"dependencies"`
 	Dependents   []string `json:"dependents"`
 }
 
+// taskRelatives returns the ids of the tasks that the given task depends on, and of the tasks
+// that depend on it, both directly and transitively
+func taskRelatives(taskGraph *dag.AcyclicGraph, taskID string) ([]string, []string, error) {
+	ancestors, err := taskGraph.Ancestors(taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	stringAncestors := []string{}
+	for _, dep := range ancestors {
+		stringAncestors = append(stringAncestors, dag.VertexName(dep))
+	}
+	sort.Strings(stringAncestors)
+	descendents, err := taskGraph.Descendents(taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	stringDescendents := []string{}
+	for _, dep := range descendents {
+		stringDescendents = append(stringDescendents, dag.VertexName(dep))
+	}
+	sort.Strings(stringDescendents)
+	return stringAncestors, stringDescendents, nil
+}
+
 func (r *run) executeDryRun(ctx gocontext.Context, engine *core.Scheduler, g *completeGraph, taskHashes *taskhash.Tracker, rs *runSpec) ([]hashedTask, error) {
 	taskIDs := []hashedTask{}
+	taskGraph := engine.TaskGraphWithoutRoot()
 	errs := engine.Execute(g.getPackageTaskVisitor(ctx, func(ctx gocontext.Context, packageTask *nodes.PackageTask) error {
 		passThroughArgs := rs.ArgsForTask(packageTask.Task)
 		deps := engine.TaskGraph.DownEdges(packageTask.TaskID)
@@ -721,29 +1494,10 @@ func (r *run) executeDryRun(ctx gocontext.Context, engine *core.Scheduler, g *co
 		if isRootTask && commandLooksLikeTurbo(command) {
 			return fmt.Errorf("root task %v (%v) looks like it invokes turbo and might cause a loop", packageTask.Task, command)
 		}
-		ancestors, err := engine.TaskGraph.Ancestors(packageTask.TaskID)
-		if err != nil {
-			return err
-		}
-		stringAncestors := []string{}
-		for _, dep := range ancestors {
-			// Don't leak out internal ROOT_NODE_NAME nodes, which are just placeholders
-			if !strings.Contains(dep.(string), core.ROOT_NODE_NAME) {
-				stringAncestors = append(stringAncestors, dep.(string))
-			}
-		}
-		descendents, err := engine.TaskGraph.Descendents(packageTask.TaskID)
+		stringAncestors, stringDescendents, err := taskRelatives(taskGraph, packageTask.TaskID)
 		if err != nil {
 			return err
 		}
-		stringDescendents := []string{}
-		for _, dep := range descendents {
-			// Don't leak out internal ROOT_NODE_NAME nodes, which are just placeholders
-			if !strings.Contains(dep.(string), core.ROOT_NODE_NAME) {
-				stringDescendents = append(stringDescendents, dep.(string))
-			}
-		}
-		sort.Strings(stringDescendents)
 
 		taskIDs = append(taskIDs, hashedTask{
 			TaskID:       packageTask.TaskID,
@@ -753,6 +1507,7 @@ func (r *run) executeDryRun(ctx gocontext.Context, engine *core.Scheduler, g *co
 			Command:      command,
 			Dir:          packageTask.Pkg.Dir.ToString(),
 			Outputs:      packageTask.TaskDefinition.Outputs,
+			Cache:        string(packageTask.TaskDefinition.CacheScope),
 			LogFile:      packageTask.RepoRelativeLogFile(),
 			Dependencies: stringAncestors,
 			Dependents:   stringDescendents,
@@ -787,16 +1542,23 @@ func validateTasks(pipeline fs.Pipeline, tasks []string) error {
 }
 
 type execContext struct {
-	colorCache     *colorcache.ColorCache
 	runState       *RunState
 	rs             *runSpec
 	ui             cli.Ui
 	runCache       *runcache.RunCache
+	cacheHits      *cacheHitRecorder
 	logger         hclog.Logger
 	packageManager *packagemanager.PackageManager
 	processes      *process.Manager
 	taskHashes     *taskhash.Tracker
 	repoRoot       turbopath.AbsolutePath
+	outputManifest *outputManifest
+	heartbeat      *heartbeat
+	// outputLock is held while buffered task output is written to the terminal. With
+	// --experimental-interleave-guard it is also held for each line that tasks stream.
+	outputLock *sync.Mutex
+	// stdout receives the output of failed tasks run with errors-only output
+	stdout io.Writer
 }
 
 func (e *execContext) logError(log hclog.Logger, prefix string, err error) {
@@ -819,8 +1581,7 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 	tracer := e.runState.Run(packageTask.TaskID)
 
 	// Create a logger
-	colorPrefixer := e.colorCache.PrefixColor(packageTask.PackageName)
-	prettyTaskPrefix := colorPrefixer("%s: ", packageTask.OutputPrefix())
+	prettyTaskPrefix := e.runCache.LogPrefix(packageTask)
 	targetUi := &cli.PrefixedUi{
 		Ui:           e.ui,
 		OutputPrefix: prettyTaskPrefix,
@@ -835,6 +1596,12 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 	if err != nil {
 		e.ui.Error(fmt.Sprintf("Hashing error: %v", err))
 		// @TODO probably should abort fatally???
+	} else if e.rs.Opts.runOpts.detectNonDeterministicHash {
+		if err := e.taskHashes.VerifyTaskHash(packageTask, deps, passThroughArgs); err != nil {
+			tracer(TargetBuildFailed, err)
+			e.logError(targetLogger, "", err)
+			return err
+		}
 	}
 	// TODO(gsoltis): if/when we fix https://github.com/vercel/turborepo/issues/937
 	// the following block should never get hit. In the meantime, keep it after hashing
@@ -852,9 +1619,22 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 	if err != nil {
 		targetUi.Error(fmt.Sprintf("error fetching from cache: %s", err))
 	} else if hit {
+		if source, timeSaved, ok := e.cacheHits.hit(hash); ok {
+			e.runState.recordCacheHit(packageTask.TaskID, source, timeSaved)
+		}
 		tracer(TargetCached, nil)
+		e.recordOutputs(targetLogger, packageTask, taskCache, hash, true, false)
 		return nil
 	}
+	if e.rs.Opts.cacheOpts.HardlinkOutputs {
+		// Outputs restored by an earlier run may be hardlinks to the filesystem cache,
+		// which the task would otherwise modify when it rewrites them
+		if err := taskCache.BreakOutputHardlinks(); err != nil {
+			tracer(TargetBuildFailed, err)
+			e.logError(targetLogger, prettyTaskPrefix, err)
+			return err
+		}
+	}
 	// Setup command execution
 	argsactual := append([]string{"run"}, packageTask.Task)
 	if len(passThroughArgs) > 0 {
@@ -882,11 +1662,33 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 			os.Exit(1)
 		}
 	}
-	logger := log.New(writer, "", 0)
-	// Setup a streamer that we'll pipe cmd.Stdout to
-	logStreamerOut := logstreamer.NewLogstreamer(logger, prettyTaskPrefix, false)
+	var taskOutput io.Writer = writer
+	// When only showing the output of failed tasks, hold on to it until we know the outcome
+	var errorsOnlyOutput *bytes.Buffer
+	var errorsOnlyWriter io.WriteCloser
+	if taskCache.OutputMode() == util.ErrorsOnlyTaskOutput {
+		errorsOnlyOutput = &bytes.Buffer{}
+		errorsOnlyWriter = e.runCache.PrefixedWriter(packageTask, errorsOnlyOutput)
+		taskOutput = io.MultiWriter(writer, errorsOnlyWriter)
+	}
+	if e.heartbeat != nil {
+		// Only output that is printed as it happens keeps CI from timing out
+		if mode := taskCache.OutputMode(); mode == util.FullTaskOutput || mode == util.NewTaskOutput {
+			taskOutput = io.MultiWriter(taskOutput, e.heartbeat)
+		}
+		e.heartbeat.taskStarted(packageTask.TaskID)
+		defer e.heartbeat.taskFinished(packageTask.TaskID)
+	}
+	logger := log.New(taskOutput, "", 0)
+	// Setup a streamer that we'll pipe cmd.Stdout to. The task's prefix is added by the
+	// writers that print the output, so that it isn't stored in the log file.
+	logStreamerOut := logstreamer.NewLogstreamer(logger, "", false)
 	// Setup a streamer that we'll pipe cmd.Stderr to.
-	logStreamerErr := logstreamer.NewLogstreamer(logger, prettyTaskPrefix, false)
+	logStreamerErr := logstreamer.NewLogstreamer(logger, "", false)
+	if e.rs.Opts.runOpts.interleaveGuard {
+		logStreamerOut.LineLock = e.outputLock
+		logStreamerErr.LineLock = e.outputLock
+	}
 	cmd.Stderr = logStreamerErr
 	cmd.Stdout = logStreamerOut
 	// Flush/Reset any error we recorded
@@ -903,6 +1705,11 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 		if err := writer.Close(); err != nil {
 			closeErrors = append(closeErrors, errors.Wrap(err, "log file"))
 		}
+		if errorsOnlyWriter != nil {
+			if err := errorsOnlyWriter.Close(); err != nil {
+				closeErrors = append(closeErrors, errors.Wrap(err, "buffered output"))
+			}
+		}
 		if len(closeErrors) > 0 {
 			msgs := make([]string, len(closeErrors))
 			for i, err := range closeErrors {
@@ -913,8 +1720,12 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 		return nil
 	}
 
+	timeout := e.rs.Opts.runOpts.taskTimeout
+	if packageTask.TaskDefinition.HasTimeout {
+		timeout = packageTask.TaskDefinition.Timeout
+	}
 	// Run the command
-	if err := e.processes.Exec(cmd); err != nil {
+	if err := e.processes.ExecWithTimeout(cmd, timeout); err != nil {
 		// close off our outputs. We errored, so we mostly don't care if we fail to close
 		_ = closeOutputs()
 		// if we already know we're in the process of exiting,
@@ -922,7 +1733,14 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 		if errors.Is(err, process.ErrClosing) {
 			return nil
 		}
+		if errorsOnlyOutput != nil {
+			// Write the whole buffer at once, rather than between the lines of other tasks
+			e.outputLock.Lock()
+			_, _ = e.stdout.Write(errorsOnlyOutput.Bytes())
+			e.outputLock.Unlock()
+		}
 		tracer(TargetBuildFailed, err)
+		e.recordOutputs(targetLogger, packageTask, taskCache, hash, false, true)
 		targetLogger.Error("Error: command finished with error: %w", err)
 		if !e.rs.Opts.runOpts.continueOnError {
 			targetUi.Error(fmt.Sprintf("ERROR: command finished with error: %s", err))
@@ -940,15 +1758,56 @@ func (e *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask
 	} else {
 		if err = taskCache.SaveOutputs(ctx, targetLogger, targetUi, int(duration.Milliseconds())); err != nil {
 			e.logError(targetLogger, "", fmt.Errorf("error caching output: %w", err))
+			if e.rs.Opts.runOpts.cachePutVerificationFatal && errors.Is(err, cache.ErrPutVerificationFailed) {
+				tracer(TargetBuildFailed, err)
+				e.recordOutputs(targetLogger, packageTask, taskCache, hash, false, true)
+				return err
+			}
+		} else if !e.rs.Opts.runOpts.noEmptyOutputsWarning {
+			e.warnUnmatchedOutputs(targetLogger, targetUi, packageTask, taskCache)
 		}
 	}
 
 	// Clean up tracing
 	tracer(TargetBuilt, nil)
+	e.recordOutputs(targetLogger, packageTask, taskCache, hash, false, false)
 	targetLogger.Debug("done", "status", "complete", "duration", duration)
 	return nil
 }
 
+// warnUnmatchedOutputs warns if the task completed without producing any files matching its
+// outputs, so that misconfigured globs don't go unnoticed until the next run misses the cache
+func (e *execContext) warnUnmatchedOutputs(logger hclog.Logger, terminal cli.Ui, packageTask *nodes.PackageTask, taskCache runcache.TaskCache) {
+	unmatched, err := taskCache.UnmatchedOutputs()
+	if err != nil {
+		logger.Debug("failed to check outputs", "error", err)
+		return
+	}
+	if len(unmatched) == 0 {
+		return
+	}
+	terminal.Warn(fmt.Sprintf("%s task %v completed but produced no files matching its outputs: %v", ui.WARNING_PREFIX, packageTask.TaskID, unmatched))
+	e.runState.recordUnmatchedOutputs(packageTask.TaskID, unmatched)
+}
+
+// recordOutputs expands the outputs of a completed or failed task for inclusion in the output manifest
+func (e *execContext) recordOutputs(logger hclog.Logger, packageTask *nodes.PackageTask, taskCache runcache.TaskCache, hash string, cacheHit bool, failed bool) {
+	if e.outputManifest == nil {
+		return
+	}
+	outputs, err := taskCache.ExpandedOutputs()
+	if err != nil {
+		e.logError(logger, "", fmt.Errorf("error expanding outputs: %w", err))
+		return
+	}
+	e.taskHashes.SetExpandedOutputs(packageTask.TaskID, outputs)
+	if failed {
+		e.outputManifest.addFailed(packageTask, hash)
+	} else {
+		e.outputManifest.add(packageTask, hash, cacheHit)
+	}
+}
+
 func (g *completeGraph) getPackageTaskVisitor(ctx gocontext.Context, visitor func(ctx gocontext.Context, packageTask *nodes.PackageTask) error) func(taskID string) error {
 	return func(taskID string) error {
 
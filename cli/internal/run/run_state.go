@@ -2,6 +2,8 @@ package run
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,6 +40,7 @@ const (
 	TargetBuilt
 	TargetCached
 	TargetBuildFailed
+	TargetSkipped
 )
 
 type BuildTargetState struct {
@@ -50,6 +53,17 @@ type BuildTargetState struct {
 	Status RunResultStatus
 	// Error, only populated for failure statuses
 	Err error
+	// CacheSource is where the outputs were restored from, only populated for cached targets
+	CacheSource string
+	// TimeSaved is how long the target took when its outputs were cached, only populated
+	// for cached targets
+	TimeSaved time.Duration
+	// UnmatchedOutputs are the outputs of a target that completed without producing any files
+	// matching them
+	UnmatchedOutputs []string
+	// SkippedFor is the failed target that this target depends on, only populated for
+	// skipped targets
+	SkippedFor string
 }
 
 type RunState struct {
@@ -60,8 +74,12 @@ type RunState struct {
 	// Is the output streaming?
 	Cached    int
 	Attempted int
+	// Skipped counts the targets that weren't run because a target they depend on failed
+	Skipped int
 
 	startedAt time.Time
+	// events, if set, receives the start and end of each task as they happen
+	events *eventStream
 }
 
 // NewRunState creates a RunState instance for tracking events during the
@@ -105,22 +123,76 @@ func (r *RunState) Run(label string) func(outcome RunResultStatus, err error) {
 	}
 }
 
-func (r *RunState) add(result *RunResult, previous string, active bool) {
+// recordCacheHit notes where the outputs of the target were restored from and how long
+// it took when they were cached. It is called before the target is marked as cached.
+func (r *RunState) recordCacheHit(label string, source string, timeSaved time.Duration) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if s, ok := r.state[result.Label]; ok {
+	if s, ok := r.state[label]; ok {
+		s.CacheSource = source
+		s.TimeSaved = timeSaved
+	}
+}
+
+// recordUnmatchedOutputs notes that the target produced no files matching its outputs. It is
+// called before the target is marked as built.
+func (r *RunState) recordUnmatchedOutputs(label string, outputs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.state[label]; ok {
+		s.UnmatchedOutputs = outputs
+	}
+}
+
+// skipDependents records the targets that depend on the failed target as skipped, since they
+// won't be run. A target that depends on more than one failed target is recorded once.
+func (r *RunState) skipDependents(failed string, dependents []string) {
+	now := time.Now()
+	skipped := []BuildTargetState{}
+	r.mu.Lock()
+	for _, label := range dependents {
+		if _, ok := r.state[label]; ok {
+			continue
+		}
+		s := &BuildTargetState{
+			StartAt:    now,
+			Label:      label,
+			Status:     TargetSkipped,
+			SkippedFor: failed,
+		}
+		r.state[label] = s
+		r.Skipped++
+		skipped = append(skipped, *s)
+	}
+	r.mu.Unlock()
+	// Emit events once the lock is released, so that a slow reader doesn't hold up other tasks
+	if r.events != nil {
+		for i := range skipped {
+			r.events.taskFinished(&skipped[i])
+		}
+	}
+}
+
+func (r *RunState) add(result *RunResult, previous string, active bool) {
+	r.mu.Lock()
+	s, ok := r.state[result.Label]
+	if ok {
 		s.Status = result.Status
 		s.Err = result.Err
 		s.Duration = result.Duration
 	} else {
-		r.state[result.Label] = &BuildTargetState{
+		s = &BuildTargetState{
 			StartAt:  result.Time,
 			Label:    result.Label,
 			Status:   result.Status,
 			Err:      result.Err,
 			Duration: result.Duration,
 		}
+		r.state[result.Label] = s
 	}
+	// Copy the state for the event, which is emitted once the lock is released so that a slow
+	// reader doesn't hold up other tasks
+	event := *s
 	switch {
 	case result.Status == TargetBuildFailed:
 		r.Failure++
@@ -132,6 +204,14 @@ func (r *RunState) add(result *RunResult, previous string, active bool) {
 		r.Success++
 		r.Attempted++
 	}
+	r.mu.Unlock()
+	if r.events != nil {
+		if active {
+			r.events.taskStarted(&event)
+		} else {
+			r.events.taskFinished(&event)
+		}
+	}
 }
 
 // Close finishes a trace of a turbo run. The tracing file will be written if applicable,
@@ -148,11 +228,44 @@ func (r *RunState) Close(terminal cli.Ui, filename string) error {
 	terminal.Output("") // Clear the line
 	terminal.Output(util.Sprintf("${BOLD} Tasks:${BOLD_GREEN}    %v successful${RESET}${GRAY}, %v total${RESET}", r.Cached+r.Success, r.Attempted))
 	terminal.Output(util.Sprintf("${BOLD}Cached:    %v cached${RESET}${GRAY}, %v total${RESET}", r.Cached, r.Attempted))
+	terminal.Output(util.Sprintf("${BOLD}Result:    %v cached${RESET}${GRAY}, %v executed, %v errored${RESET}", r.Cached, r.Success, r.Failure))
+	if r.Skipped > 0 {
+		terminal.Output(util.Sprintf("${BOLD}Skipped:   %v${RESET}${GRAY} depending on failed tasks${RESET}", r.Skipped))
+	}
 	terminal.Output(util.Sprintf("${BOLD}  Time:    %v${RESET} %v${RESET}", time.Since(r.startedAt).Truncate(time.Millisecond), maybeFullTurbo))
+	if saved := r.summary(0).timeSaved(); saved.total() > 0 {
+		terminal.Output(util.Sprintf("${BOLD} Saved:    %v${RESET}${GRAY} by cache hits, %v local, %v remote${RESET}", saved.total(), saved.Local, saved.Remote))
+	}
 	terminal.Output("")
 	return nil
 }
 
+// tasksWithStatus returns the sorted labels of the tasks whose latest status matches the given one
+func (r *RunState) tasksWithStatus(status RunResultStatus) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	labels := []string{}
+	for label, state := range r.state {
+		if state.Status == status {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// printCacheWarmSummary writes out which tasks were executed to populate the cache,
+// and which failed to do so.
+func (r *RunState) printCacheWarmSummary(terminal cli.Ui) {
+	warmed := r.tasksWithStatus(TargetBuilt)
+	failed := r.tasksWithStatus(TargetBuildFailed)
+	terminal.Output(util.Sprintf("${BOLD}Warmed:    %v tasks${RESET}${GRAY}, %v failed${RESET}", len(warmed), len(failed)))
+	if len(failed) > 0 {
+		terminal.Output(util.Sprintf("${GRAY}Failed:    %v${RESET}", strings.Join(failed, ", ")))
+	}
+	terminal.Output("")
+}
+
 func writeChrometracing(filename string, terminal cli.Ui) error {
 	outputPath := chrometracing.Path()
 	if outputPath == "" {
@@ -0,0 +1,310 @@
+package run
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/process"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// _summaryUploadTimeout bounds how long we wait for the run summary endpoint
+// so that a slow service doesn't hold up the end of a run
+const _summaryUploadTimeout = 10 * time.Second
+
+// _runSummaryDir is the repo-relative directory that run summaries are written to
+var _runSummaryDir = filepath.Join(".turbo", "runs")
+
+// runSummary is the JSON document describing a completed run
+type runSummary struct {
+	StartedAt time.Time         `json:"startedAt"`
+	EndedAt   time.Time         `json:"endedAt"`
+	ExitCode  int               `json:"exitCode"`
+	Attempted int               `json:"attempted"`
+	Success   int               `json:"success"`
+	Cached    int               `json:"cached"`
+	Failure   int               `json:"failure"`
+	Skipped   int               `json:"skipped"`
+	Tasks     []*runSummaryTask `json:"tasks"`
+}
+
+type runSummaryTask struct {
+	TaskID     string    `json:"taskId"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Error      string    `json:"error,omitempty"`
+	// TimedOut is whether the task was killed for exceeding its timeout
+	TimedOut bool `json:"timedOut,omitempty"`
+	// CacheSource is "LOCAL" or "REMOTE" for tasks restored from cache
+	CacheSource string `json:"cacheSource,omitempty"`
+	// TimeSavedMs is how long a task restored from cache took when it was cached
+	TimeSavedMs int64 `json:"timeSavedMs,omitempty"`
+	// UnmatchedOutputs are the outputs of a task that completed without producing any
+	// files matching them
+	UnmatchedOutputs []string `json:"unmatchedOutputs,omitempty"`
+	// SkippedFor is the failed task that a skipped task depends on
+	SkippedFor string `json:"skippedFor,omitempty"`
+}
+
+// write saves the summary as JSON to path, or writes it to stdout if path is "-"
+func (s *runSummary) write(path string, stdout io.Writer) error {
+	bytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err := stdout.Write(append(bytes, '\n'))
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+// dryRunSummary is the JSON document describing the packages and tasks a dry run would execute
+type dryRunSummary struct {
+	Packages []string     `json:"packages"`
+	Tasks    []hashedTask `json:"tasks"`
+}
+
+func (s *dryRunSummary) render() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// write saves the summary in the run summary directory, named after the time the run started,
+// and returns the path it was written to
+func (s *dryRunSummary) write(repoRoot turbopath.AbsolutePath, startAt time.Time) (turbopath.AbsolutePath, error) {
+	bytes, err := s.render()
+	if err != nil {
+		return "", err
+	}
+	path := repoRoot.Join(_runSummaryDir, fmt.Sprintf("%v-dry.json", startAt.UTC().Format("20060102T150405.000Z")))
+	if err := path.EnsureDir(); err != nil {
+		return "", err
+	}
+	if err := path.WriteFile(bytes, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s RunResultStatus) String() string {
+	switch s {
+	case TargetBuilding:
+		return "building"
+	case TargetBuildStopped:
+		return "stopped"
+	case TargetBuilt:
+		return "built"
+	case TargetCached:
+		return "cached"
+	case TargetBuildFailed:
+		return "failed"
+	case TargetSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// summary collects the current state of the run into a runSummary
+func (r *RunState) summary(exitCode int) *runSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary := &runSummary{
+		StartedAt: r.startedAt,
+		EndedAt:   time.Now(),
+		ExitCode:  exitCode,
+		Attempted: r.Attempted,
+		Success:   r.Success,
+		Cached:    r.Cached,
+		Failure:   r.Failure,
+		Skipped:   r.Skipped,
+		Tasks:     make([]*runSummaryTask, 0, len(r.state)),
+	}
+	for _, state := range r.state {
+		summary.Tasks = append(summary.Tasks, state.summaryTask())
+	}
+	sort.Slice(summary.Tasks, func(i, j int) bool {
+		return summary.Tasks[i].TaskID < summary.Tasks[j].TaskID
+	})
+	return summary
+}
+
+// summaryTask describes the current state of a task for the run summary
+func (s *BuildTargetState) summaryTask() *runSummaryTask {
+	task := &runSummaryTask{
+		TaskID:           s.Label,
+		Status:           s.Status.String(),
+		StartedAt:        s.StartAt,
+		DurationMs:       s.Duration.Milliseconds(),
+		CacheSource:      s.CacheSource,
+		TimeSavedMs:      s.TimeSaved.Milliseconds(),
+		UnmatchedOutputs: s.UnmatchedOutputs,
+		SkippedFor:       s.SkippedFor,
+	}
+	if s.Err != nil {
+		task.Error = s.Err.Error()
+		timeoutErr := &process.ChildTimeout{}
+		task.TimedOut = errors.As(s.Err, &timeoutErr)
+	}
+	return task
+}
+
+// cacheMisses returns the IDs of the tasks that finished without being restored from
+// cache, leaving out those for which cacheable returns false
+func (s *runSummary) cacheMisses(cacheable func(taskID string) bool) []string {
+	misses := []string{}
+	for _, task := range s.Tasks {
+		if task.Status != TargetBuilt.String() && task.Status != TargetBuildFailed.String() {
+			continue
+		}
+		if cacheable(task.TaskID) {
+			misses = append(misses, task.TaskID)
+		}
+	}
+	return misses
+}
+
+// cacheTimeSaved sums the time that the tasks restored from cache took to run when they were
+// cached, by the source they were restored from
+type cacheTimeSaved struct {
+	Local  time.Duration
+	Remote time.Duration
+}
+
+func (t cacheTimeSaved) total() time.Duration {
+	return t.Local + t.Remote
+}
+
+// timeSaved returns the time saved by the tasks of the summary that were restored from cache
+func (s *runSummary) timeSaved() cacheTimeSaved {
+	saved := cacheTimeSaved{}
+	for _, task := range s.Tasks {
+		if task.Status != TargetCached.String() {
+			continue
+		}
+		duration := time.Duration(task.TimeSavedMs) * time.Millisecond
+		switch task.CacheSource {
+		case "LOCAL":
+			saved.Local += duration
+		case "REMOTE":
+			saved.Remote += duration
+		}
+	}
+	return saved
+}
+
+// taskGroupSummary aggregates the tasks of a run that share a task name across packages
+type taskGroupSummary struct {
+	Task      string
+	Attempted int
+	Cached    int
+	Failure   int
+	// Duration is the sum of the durations of the tasks in the group
+	Duration time.Duration
+}
+
+// hitRate returns the percentage of attempted tasks in the group that were restored from cache
+func (g *taskGroupSummary) hitRate() int {
+	if g.Attempted == 0 {
+		return 0
+	}
+	return g.Cached * 100 / g.Attempted
+}
+
+// taskGroups buckets the tasks of the summary by task name, sorted by task name. Tasks
+// that didn't finish are not counted.
+func (s *runSummary) taskGroups() []*taskGroupSummary {
+	groupsByTask := make(map[string]*taskGroupSummary)
+	groups := []*taskGroupSummary{}
+	for _, task := range s.Tasks {
+		_, taskName := util.GetPackageTaskFromId(task.TaskID)
+		group, ok := groupsByTask[taskName]
+		if !ok {
+			group = &taskGroupSummary{Task: taskName}
+			groupsByTask[taskName] = group
+			groups = append(groups, group)
+		}
+		switch task.Status {
+		case TargetCached.String():
+			group.Cached++
+		case TargetBuildFailed.String():
+			group.Failure++
+		case TargetBuilt.String():
+			// Only counted as attempted
+		default:
+			continue
+		}
+		group.Attempted++
+		group.Duration += time.Duration(task.DurationMs) * time.Millisecond
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Task < groups[j].Task
+	})
+	return groups
+}
+
+// printTaskGroupSummary writes out the cache hit rate and total duration for each task name
+func (r *RunState) printTaskGroupSummary(terminal cli.Ui) {
+	for _, group := range r.summary(0).taskGroups() {
+		terminal.Output(util.Sprintf("${BOLD}%v:${RESET}    %v cached${GRAY}, %v total, %v%% hit rate, %v failed, %v${RESET}",
+			group.Task, group.Cached, group.Attempted, group.hitRate(), group.Failure, group.Duration))
+	}
+	terminal.Output("")
+}
+
+// parseSummaryUploadHeader splits a header given as "Name: value"
+func parseSummaryUploadHeader(header string) (string, string, error) {
+	parts := strings.SplitN(header, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("invalid header %q, expected the form \"Name: value\"", header)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// uploadRunSummary POSTs the summary as JSON to the given url, optionally with an extra header
+// such as "Authorization: Bearer <token>"
+func uploadRunSummary(ctx gocontext.Context, url string, header string, summary *runSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return errors.Wrap(err, "failed to render run summary")
+	}
+	ctx, cancel := gocontext.WithTimeout(ctx, _summaryUploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		name, value, err := parseSummaryUploadHeader(header)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%v responded with %v", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package run
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/process"
+)
+
+func Test_uploadRunSummary(t *testing.T) {
+	var gotAuth string
+	var got runSummary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotAuth = req.Header.Get("Authorization")
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode summary: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	runState := NewRunState(time.Now(), "")
+	runState.Run("libA#build")(TargetBuilt, nil)
+	runState.Run("libB#build")(TargetBuildFailed, errors.New("exit status 1"))
+
+	err := uploadRunSummary(gocontext.Background(), server.URL, "Authorization: Bearer some-token", runState.summary(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer some-token", gotAuth)
+	assert.Equal(t, 1, got.ExitCode)
+	assert.Equal(t, 2, got.Attempted)
+	assert.Len(t, got.Tasks, 2)
+	assert.Equal(t, "libA#build", got.Tasks[0].TaskID)
+	assert.Equal(t, "built", got.Tasks[0].Status)
+	assert.Equal(t, "failed", got.Tasks[1].Status)
+	assert.Equal(t, "running libB#build failed: exit status 1", got.Tasks[1].Error)
+}
+
+func Test_runSummaryTimedOut(t *testing.T) {
+	runState := NewRunState(time.Now(), "")
+	runState.Run("libA#build")(TargetBuildFailed, errors.New("exit status 1"))
+	runState.Run("libB#build")(TargetBuildFailed, &process.ChildTimeout{Timeout: time.Minute, Command: "npm run build"})
+
+	summary := runState.summary(1)
+	assert.False(t, summary.Tasks[0].TimedOut)
+	assert.True(t, summary.Tasks[1].TimedOut)
+	assert.Equal(t, "running libB#build failed: command npm run build timed out after 1m0s", summary.Tasks[1].Error)
+}
+
+func Test_uploadRunSummaryErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	summary := NewRunState(time.Now(), "").summary(0)
+	err := uploadRunSummary(gocontext.Background(), server.URL, "", summary)
+	assert.EqualError(t, err, server.URL+" responded with 401 Unauthorized")
+
+	err = uploadRunSummary(gocontext.Background(), server.URL, "not-a-header", summary)
+	assert.EqualError(t, err, "invalid header \"not-a-header\", expected the form \"Name: value\"")
+}
+
+func Test_dryRunSummaryWrite(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	summary := &dryRunSummary{
+		Packages: []string{"libA"},
+		Tasks: []hashedTask{
+			{TaskID: "libA#build", Task: "build", Package: "libA", Hash: "some-hash"},
+		},
+	}
+	startAt := time.Date(2022, time.August, 1, 12, 30, 0, 0, time.UTC)
+	path, err := summary.write(repoRoot, startAt)
+	assert.NoError(t, err, "write")
+	assert.Equal(t, repoRoot.Join(".turbo", "runs", "20220801T123000.000Z-dry.json"), path)
+
+	contents, err := path.ReadFile()
+	assert.NoError(t, err, "ReadFile")
+	written := &dryRunSummary{}
+	assert.NoError(t, json.Unmarshal(contents, written), "Unmarshal")
+	assert.Equal(t, summary, written)
+}
+
+func Test_runSummaryWrite(t *testing.T) {
+	summary := &runSummary{
+		StartedAt: time.Date(2022, time.August, 1, 12, 30, 0, 0, time.UTC),
+		EndedAt:   time.Date(2022, time.August, 1, 12, 31, 0, 0, time.UTC),
+		ExitCode:  1,
+		Attempted: 1,
+		Failure:   1,
+		Tasks: []*runSummaryTask{
+			{TaskID: "libA#build", Status: "failed", DurationMs: 60000, Error: "exit status 1"},
+		},
+	}
+
+	stdout := &bytes.Buffer{}
+	assert.NoError(t, summary.write("-", stdout), "write to stdout")
+	written := &runSummary{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), written), "Unmarshal stdout")
+	assert.Equal(t, summary, written)
+
+	path := filepath.Join(t.TempDir(), "summaries", "run.json")
+	assert.NoError(t, summary.write(path, stdout), "write to file")
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(t, err, "ReadFile")
+	written = &runSummary{}
+	assert.NoError(t, json.Unmarshal(contents, written), "Unmarshal file")
+	assert.Equal(t, summary, written)
+}
+
+func Test_runSummaryTaskGroups(t *testing.T) {
+	summary := &runSummary{
+		Tasks: []*runSummaryTask{
+			{TaskID: "libA#test", Status: "cached", DurationMs: 10},
+			{TaskID: "libA#build", Status: "cached", DurationMs: 100},
+			{TaskID: "libB#build", Status: "built", DurationMs: 200},
+			{TaskID: "libC#build", Status: "failed", DurationMs: 300},
+			{TaskID: "libD#build", Status: "building"},
+		},
+	}
+	groups := summary.taskGroups()
+	assert.Equal(t, []*taskGroupSummary{
+		{Task: "build", Attempted: 3, Cached: 1, Failure: 1, Duration: 600 * time.Millisecond},
+		{Task: "test", Attempted: 1, Cached: 1, Duration: 10 * time.Millisecond},
+	}, groups)
+	assert.Equal(t, 33, groups[0].hitRate())
+	assert.Equal(t, 100, groups[1].hitRate())
+}
+
+func Test_runSummaryCacheMisses(t *testing.T) {
+	summary := &runSummary{
+		Tasks: []*runSummaryTask{
+			{TaskID: "libA#build", Status: "cached"},
+			{TaskID: "libB#build", Status: "built"},
+			{TaskID: "libC#build", Status: "failed"},
+			{TaskID: "libD#build", Status: "building"},
+			{TaskID: "web#dev", Status: "built"},
+		},
+	}
+	cacheable := func(taskID string) bool {
+		return taskID != "web#dev"
+	}
+	assert.Equal(t, []string{"libB#build", "libC#build"}, summary.cacheMisses(cacheable))
+
+	summary.Tasks = summary.Tasks[:1]
+	assert.Empty(t, summary.cacheMisses(cacheable))
+}
+
+func Test_runSummaryTimeSaved(t *testing.T) {
+	summary := &runSummary{
+		Tasks: []*runSummaryTask{
+			{TaskID: "libA#build", Status: "cached", CacheSource: "LOCAL", TimeSavedMs: 1500},
+			{TaskID: "libB#build", Status: "cached", CacheSource: "REMOTE", TimeSavedMs: 60000},
+			{TaskID: "libC#build", Status: "cached", CacheSource: "LOCAL", TimeSavedMs: 500},
+			{TaskID: "libD#build", Status: "built", DurationMs: 4000},
+			{TaskID: "libE#build", Status: "failed", DurationMs: 100},
+			{TaskID: "web#build", Status: "building"},
+		},
+	}
+	saved := summary.timeSaved()
+	assert.Equal(t, 2*time.Second, saved.Local)
+	assert.Equal(t, time.Minute, saved.Remote)
+	assert.Equal(t, time.Minute+2*time.Second, saved.total())
+
+	summary.Tasks = summary.Tasks[3:]
+	assert.Equal(t, time.Duration(0), summary.timeSaved().total())
+}
+
+func Test_runSummaryUnmatchedOutputs(t *testing.T) {
+	state := &BuildTargetState{
+		Label:            "web#build",
+		Status:           TargetBuilt,
+		UnmatchedOutputs: []string{"build/**"},
+	}
+	bytes, err := json.Marshal(state.summaryTask())
+	assert.NoError(t, err)
+	assert.Contains(t, string(bytes), `"unmatchedOutputs":["build/**"]`)
+
+	state.UnmatchedOutputs = nil
+	bytes, err = json.Marshal(state.summaryTask())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(bytes), "unmatchedOutputs")
+}
+
+func Test_runStateSkipDependents(t *testing.T) {
+	runState := NewRunState(time.Now(), "")
+	runState.Run("libA#build")(TargetBuildFailed, errors.New("exit status 1"))
+	runState.Run("libB#build")(TargetBuildFailed, errors.New("exit status 1"))
+	runState.skipDependents("libA#build", []string{"web#build", "web#test"})
+	// web#build depends on both failed tasks, so it was already skipped
+	runState.skipDependents("libB#build", []string{"web#build"})
+
+	summary := runState.summary(1)
+	assert.Equal(t, 2, summary.Failure)
+	assert.Equal(t, 2, summary.Skipped)
+	assert.Equal(t, 2, summary.Attempted)
+	statuses := map[string]string{}
+	skippedFor := map[string]string{}
+	for _, task := range summary.Tasks {
+		statuses[task.TaskID] = task.Status
+		skippedFor[task.TaskID] = task.SkippedFor
+	}
+	assert.Equal(t, "skipped", statuses["web#build"])
+	assert.Equal(t, "skipped", statuses["web#test"])
+	assert.Equal(t, "libA#build", skippedFor["web#build"])
+	assert.Empty(t, skippedFor["libA#build"])
+}
+
+func Test_runStateCloseResult(t *testing.T) {
+	runState := NewRunState(time.Now(), "")
+	runState.Run("libA#build")(TargetCached, nil)
+	runState.Run("libB#build")(TargetBuilt, nil)
+	runState.Run("libC#build")(TargetBuilt, nil)
+	runState.Run("libD#build")(TargetBuildFailed, errors.New("exit status 1"))
+
+	terminal := cli.NewMockUi()
+	assert.NoError(t, runState.Close(terminal, ""))
+	assert.Contains(t, terminal.OutputWriter.String(), "Result:    1 cached")
+	assert.Contains(t, terminal.OutputWriter.String(), "2 executed, 1 errored")
+}
@@ -1,13 +1,17 @@
 package run
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pyr-sh/dag"
 	"github.com/spf13/pflag"
 	"github.com/vercel/turborepo/cli/internal/cache"
+	"github.com/vercel/turborepo/cli/internal/core"
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/runcache"
 	"github.com/vercel/turborepo/cli/internal/scope"
@@ -33,10 +37,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -48,10 +54,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--scope=foo", "--scope=blah"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts: scope.Opts{
@@ -67,10 +75,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--concurrency=12"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 12,
+					concurrency:      12,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -82,10 +92,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--concurrency=100%"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: cpus,
+					concurrency:      cpus,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -97,12 +109,14 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--graph=g.png"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
-					graphFile:   "g.png",
-					graphDot:    false,
+					concurrency:      10,
+					inputsDefaultAll: true,
+					graphFile:        "g.png",
+					graphDot:         false,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -114,12 +128,33 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--graph"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
-					graphFile:   "",
-					graphDot:    true,
+					concurrency:      10,
+					inputsDefaultAll: true,
+					graphFile:        "",
+					graphDot:         true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
+				},
+				runcacheOpts: runcache.Opts{},
+				scopeOpts:    scope.Opts{},
+			},
+			[]string{"foo"},
+		},
+		{
+			"graph mermaid",
+			[]string{"foo", "--graph=mermaid"},
+			&Opts{
+				runOpts: runOpts{
+					concurrency:      10,
+					inputsDefaultAll: true,
+					graphFile:        "",
+					graphMermaid:     true,
+				},
+				cacheOpts: cache.Opts{
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -131,13 +166,15 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--graph=g.png", "--", "--boop", "zoop"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency:     10,
-					graphFile:       "g.png",
-					graphDot:        false,
-					passThroughArgs: []string{"--boop", "zoop"},
+					concurrency:      10,
+					inputsDefaultAll: true,
+					graphFile:        "g.png",
+					graphDot:         false,
+					passThroughArgs:  []string{"--boop", "zoop"},
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -149,10 +186,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--force"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{
 					SkipReads: true,
@@ -166,9 +205,11 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--remote-only"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
+					RemoteTimeout:  60 * time.Second,
 					Workers:        10,
 					SkipFilesystem: true,
 				},
@@ -182,10 +223,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--no-cache"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{
 					SkipWrites: true,
@@ -199,13 +242,15 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--graph=g.png", "--"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency:     10,
-					graphFile:       "g.png",
-					graphDot:        false,
-					passThroughArgs: []string{},
+					concurrency:      10,
+					inputsDefaultAll: true,
+					graphFile:        "g.png",
+					graphDot:         false,
+					passThroughArgs:  []string{},
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -217,10 +262,12 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--filter=bar", "--filter=...[main]"},
 			&Opts{
 				runOpts: runOpts{
-					concurrency: 10,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts: scope.Opts{
@@ -234,11 +281,32 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--continue"},
 			&Opts{
 				runOpts: runOpts{
-					continueOnError: true,
-					concurrency:     10,
+					continueOnError:  true,
+					concurrency:      10,
+					inputsDefaultAll: true,
+				},
+				cacheOpts: cache.Opts{
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
+				},
+				runcacheOpts: runcache.Opts{},
+				scopeOpts:    scope.Opts{},
+			},
+			[]string{"foo"},
+		},
+		{
+			"continue with dependencies only",
+			[]string{"foo", "--continue=dependencies-only"},
+			&Opts{
+				runOpts: runOpts{
+					continueOnError:          true,
+					continueDependenciesOnly: true,
+					concurrency:              10,
+					inputsDefaultAll:         true,
 				},
 				cacheOpts: cache.Opts{
-					Workers: 10,
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -250,12 +318,14 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--continue", "--cache-dir=bar"},
 			&Opts{
 				runOpts: runOpts{
-					continueOnError: true,
-					concurrency:     10,
+					continueOnError:  true,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					OverrideDir: "bar",
-					Workers:     10,
+					RemoteTimeout: 60 * time.Second,
+					OverrideDir:   "bar",
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
@@ -267,18 +337,39 @@ func TestParseConfig(t *testing.T) {
 			[]string{"foo", "--continue", "--cache-dir=" + defaultCwd.Join("bar").ToString()},
 			&Opts{
 				runOpts: runOpts{
-					continueOnError: true,
-					concurrency:     10,
+					continueOnError:  true,
+					concurrency:      10,
+					inputsDefaultAll: true,
 				},
 				cacheOpts: cache.Opts{
-					OverrideDir: defaultCwd.Join("bar").ToString(),
-					Workers:     10,
+					RemoteTimeout: 60 * time.Second,
+					OverrideDir:   defaultCwd.Join("bar").ToString(),
+					Workers:       10,
 				},
 				runcacheOpts: runcache.Opts{},
 				scopeOpts:    scope.Opts{},
 			},
 			[]string{"foo"},
 		},
+		{
+			"args for tasks",
+			[]string{"build", "test", "--args-for=test:--watch", "--args-for", "build:--mode prod", "--", "--foo"},
+			&Opts{
+				runOpts: runOpts{
+					concurrency:      10,
+					inputsDefaultAll: true,
+					argsFor:          []string{"test:--watch", "build:--mode prod"},
+					passThroughArgs:  []string{"--foo"},
+				},
+				cacheOpts: cache.Opts{
+					RemoteTimeout: 60 * time.Second,
+					Workers:       10,
+				},
+				runcacheOpts: runcache.Opts{},
+				scopeOpts:    scope.Opts{},
+			},
+			[]string{"build", "test"},
+		},
 	}
 
 	for i, tc := range cases {
@@ -324,7 +415,7 @@ func Test_dontSquashTasks(t *testing.T) {
 		Targets:      []string{"build"},
 		Opts:         &Opts{},
 	}
-	engine, err := buildTaskGraph(topoGraph, pipeline, rs)
+	engine, err := buildTaskGraph(topoGraph, nil, pipeline, rs)
 	if err != nil {
 		t.Fatalf("failed to build task graph: %v", err)
 	}
@@ -357,8 +448,218 @@ func Test_taskSelfRef(t *testing.T) {
 		Targets:      []string{"build"},
 		Opts:         &Opts{},
 	}
-	_, err := buildTaskGraph(topoGraph, pipeline, rs)
+	_, err := buildTaskGraph(topoGraph, nil, pipeline, rs)
 	if err == nil {
 		t.Fatalf("expected to failed to build task graph: %v", err)
 	}
 }
+
+func Test_siblingPackageTaskDep(t *testing.T) {
+	topoGraph := &dag.AcyclicGraph{}
+	topoGraph.Add("a")
+	topoGraph.Add("design-system")
+	// no dependencies between packages
+
+	filteredPkgs := make(util.Set)
+	filteredPkgs.Add("a")
+	filteredPkgs.Add("design-system")
+	rs := &runSpec{
+		FilteredPkgs: filteredPkgs,
+		Targets:      []string{"test"},
+		Opts:         &Opts{},
+	}
+	pipeline := map[string]fs.TaskDefinition{
+		"build": {},
+		"test": {
+			TaskDependencies: []string{"design-system#build"},
+		},
+	}
+	engine, err := buildTaskGraph(topoGraph, nil, pipeline, rs)
+	if err != nil {
+		t.Fatalf("failed to build task graph: %v", err)
+	}
+	for _, dependent := range []string{"a#test", "design-system#test"} {
+		if !engine.TaskGraph.DownEdges(dependent).Include("design-system#build") {
+			t.Errorf("expected %v to depend on design-system#build", dependent)
+		}
+	}
+
+	pipeline["test"] = fs.TaskDefinition{
+		TaskDependencies: []string{"missing#build"},
+	}
+	_, err = buildTaskGraph(topoGraph, nil, pipeline, rs)
+	if err == nil || !strings.Contains(err.Error(), "unknown package: missing") {
+		t.Errorf("expected an error for an unknown package, got %v", err)
+	}
+}
+
+func Test_pruneTasksWithoutScripts(t *testing.T) {
+	topoGraph := &dag.AcyclicGraph{}
+	topoGraph.Add("a")
+	topoGraph.Add("b")
+	topoGraph.Add("c")
+	topoGraph.Connect(dag.BasicEdge("a", "b"))
+	topoGraph.Connect(dag.BasicEdge("b", "c"))
+
+	pipeline := map[string]fs.TaskDefinition{
+		"build": {
+			TopologicalDependencies: []string{"build"},
+		},
+	}
+	filteredPkgs := make(util.Set)
+	filteredPkgs.Add("a")
+	filteredPkgs.Add("b")
+	filteredPkgs.Add("c")
+	rs := &runSpec{
+		FilteredPkgs: filteredPkgs,
+		Targets:      []string{"build"},
+		Opts:         &Opts{},
+	}
+	engine, err := buildTaskGraph(topoGraph, nil, pipeline, rs)
+	if err != nil {
+		t.Fatalf("failed to build task graph: %v", err)
+	}
+	packageInfos := map[interface{}]*fs.PackageJSON{
+		"a": {Scripts: map[string]string{"build": "tsc"}},
+		"b": {Scripts: map[string]string{}},
+		"c": {Scripts: map[string]string{"build": "tsc"}},
+	}
+	pruneTasksWithoutScripts(engine, packageInfos)
+
+	if engine.TaskGraph.HasVertex("b#build") {
+		t.Error("expected b#build to be pruned from the task graph")
+	}
+	deps := engine.TaskGraph.DownEdges("a#build")
+	if deps.Len() != 1 || !deps.Include("c#build") {
+		t.Errorf("expected a#build to depend on c#build, got %v", deps.List())
+	}
+}
+
+func Test_readTasksFile(t *testing.T) {
+	path := fs.AbsolutePathFromUpstream(t.TempDir()).Join("tasks.txt")
+	contents := "# generated tasks\nbuild\n\n  lint  \ntest # unit tests only\n  # docs#build\nweb#build\ndocs#lint\t# docs only\n"
+	if err := path.WriteFile([]byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write tasks file: %v", err)
+	}
+	tasks, err := readTasksFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build", "lint", "test", "web#build", "docs#lint"}, tasks)
+
+	_, err = readTasksFile(path.Join("missing"))
+	assert.Error(t, err)
+}
+
+func Test_applyRunProfile(t *testing.T) {
+	flags := pflag.NewFlagSet("test-flags", pflag.ContinueOnError)
+	opts := optsFromFlags(flags)
+	globalFlags := pflag.NewFlagSet("global-flags", pflag.ContinueOnError)
+	globalFlags.String("cwd", "", "")
+	assert.NoError(t, flags.Parse([]string{"--concurrency=3"}))
+
+	profile := fs.RunProfile{
+		Tasks: []string{"build", "test"},
+		Flags: map[string][]string{
+			"concurrency": {"50%"},
+			"filter":      {"...[main]", "web"},
+			"continue":    {"true"},
+		},
+	}
+	assert.NoError(t, applyRunProfile(profile, flags, globalFlags))
+	assert.Equal(t, 3, opts.runOpts.concurrency, "the command line should take precedence over the profile")
+	assert.Equal(t, []string{"...[main]", "web"}, opts.scopeOpts.FilterPatterns)
+	assert.True(t, opts.runOpts.continueOnError)
+
+	for name, values := range map[string][]string{
+		"not-a-flag":     {"x"},
+		"cwd":            {"elsewhere"},
+		"config-profile": {"other"},
+		"parallel":       {"sometimes"},
+	} {
+		err := applyRunProfile(fs.RunProfile{Flags: map[string][]string{name: values}}, flags, globalFlags)
+		assert.ErrorContains(t, err, name)
+	}
+}
+
+func Test_parseArgsForTasks(t *testing.T) {
+	tasks := []string{"build", "build:prod", "test"}
+
+	argsForTask, err := parseArgsForTasks(nil, tasks)
+	assert.NoError(t, err)
+	assert.Nil(t, argsForTask)
+
+	argsForTask, err = parseArgsForTasks([]string{
+		"test:--watch",
+		"build:prod:--minify 'out dir'",
+		"test:--coverage=true",
+	}, tasks)
+	assert.NoError(t, err)
+	assert.EqualValues(t, map[string][]string{
+		"test":       {"--watch", "--coverage=true"},
+		"build:prod": {"--minify", "out dir"},
+	}, argsForTask)
+
+	_, err = parseArgsForTasks([]string{"lint:--fix"}, tasks)
+	assert.ErrorContains(t, err, "--args-for=lint:--fix")
+
+	_, err = parseArgsForTasks([]string{"test:--grep 'unterminated"}, tasks)
+	assert.Error(t, err)
+}
+
+func Test_ArgsForTask(t *testing.T) {
+	rs := &runSpec{
+		Targets: []string{"build", "test"},
+		Opts: &Opts{
+			runOpts: runOpts{
+				passThroughArgs:        []string{"--foo"},
+				passThroughArgsForTask: map[string][]string{"test": {"--watch"}},
+			},
+		},
+	}
+
+	assert.EqualValues(t, []string{"--foo"}, rs.ArgsForTask("build"))
+	assert.EqualValues(t, []string{"--foo", "--watch"}, rs.ArgsForTask("test"))
+	assert.EqualValues(t, []string{}, rs.ArgsForTask("lint"))
+}
+
+func Test_taskRelatives(t *testing.T) {
+	topoGraph := &dag.AcyclicGraph{}
+	topoGraph.Add("a")
+	topoGraph.Add("b")
+	topoGraph.Add("c")
+	topoGraph.Connect(dag.BasicEdge("a", "b"))
+	topoGraph.Connect(dag.BasicEdge("b", "c"))
+
+	pipeline := map[string]fs.TaskDefinition{
+		"build": {
+			TopologicalDependencies: []string{"build"},
+		},
+	}
+	filteredPkgs := make(util.Set)
+	filteredPkgs.Add("a")
+	filteredPkgs.Add("b")
+	filteredPkgs.Add("c")
+	rs := &runSpec{
+		FilteredPkgs: filteredPkgs,
+		Targets:      []string{"build"},
+		Opts:         &Opts{},
+	}
+	engine, err := buildTaskGraph(topoGraph, nil, pipeline, rs)
+	if err != nil {
+		t.Fatalf("failed to build task graph: %v", err)
+	}
+	taskGraph := engine.TaskGraphWithoutRoot()
+
+	dependencies, dependents, err := taskRelatives(taskGraph, "b#build")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c#build"}, dependencies)
+	assert.Equal(t, []string{"a#build"}, dependents)
+
+	dependencies, dependents, err = taskRelatives(taskGraph, "c#build")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, dependencies)
+	assert.Equal(t, []string{"a#build", "b#build"}, dependents)
+
+	output, err := json.Marshal(hashedTask{TaskID: "c#build", Dependencies: dependencies, Dependents: dependents})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(output), core.ROOT_NODE_NAME)
+}
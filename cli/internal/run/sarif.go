@@ -0,0 +1,91 @@
+package run
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turborepo/cli/internal/doublestar"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+const (
+	_sarifVersion = "2.1.0"
+	_sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// sarifLog is the top level of a SARIF report. Runs are kept as they were written by
+// each task, since merging reports only concatenates their runs.
+type sarifLog struct {
+	Schema  string            `json:"$schema,omitempty"`
+	Version string            `json:"version"`
+	Runs    []json.RawMessage `json:"runs"`
+}
+
+// mergeSarif combines the runs of every SARIF report among the resolved outputs of the
+// recorded tasks into a single report. Reports restored from cache are included as well.
+func (om *outputManifest) mergeSarif(repoRoot turbopath.AbsolutePath) (*sarifLog, error) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	merged := &sarifLog{
+		Schema:  _sarifSchema,
+		Version: _sarifVersion,
+		Runs:    []json.RawMessage{},
+	}
+	for _, task := range om.tasks {
+		if len(task.sarifGlobs) == 0 {
+			continue
+		}
+		for _, output := range task.Outputs {
+			isSarif, err := matchesAny(task.sarifGlobs, output.Path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid sarifOutputs of %v", task.TaskID)
+			}
+			if !isSarif {
+				continue
+			}
+			contents, err := repoRoot.Join(output.Path).ReadFile()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read SARIF report %v of %v", output.Path, task.TaskID)
+			}
+			var report sarifLog
+			if err := json.Unmarshal(contents, &report); err != nil {
+				return nil, errors.Wrapf(err, "invalid SARIF report %v of %v", output.Path, task.TaskID)
+			}
+			if report.Version != _sarifVersion {
+				return nil, errors.Errorf("SARIF report %v of %v has version %q, expected %q", output.Path, task.TaskID, report.Version, _sarifVersion)
+			}
+			merged.Runs = append(merged.Runs, report.Runs...)
+		}
+	}
+	return merged, nil
+}
+
+// writeSarif merges the SARIF reports of the recorded tasks and writes them to the given path.
+// The outputs of the tasks must already be resolved.
+func (om *outputManifest) writeSarif(path turbopath.AbsolutePath, repoRoot turbopath.AbsolutePath) error {
+	merged, err := om.mergeSarif(repoRoot)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to render SARIF report")
+	}
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	return path.WriteFile(bytes, 0644)
+}
+
+func matchesAny(globs []string, unixPath string) (bool, error) {
+	for _, glob := range globs {
+		matches, err := doublestar.Match(glob, unixPath)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
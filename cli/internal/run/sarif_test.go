@@ -0,0 +1,87 @@
+package run
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/nodes"
+	"github.com/vercel/turborepo/cli/internal/taskhash"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_outputManifestWriteSarif(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	files := map[string]map[string]string{
+		"libA#lint": {
+			"libA/reports/lint.sarif": `{"version": "2.1.0", "runs": [{"tool": {"driver": {"name": "eslint"}}}]}`,
+			"libA/dist/index.js":      "not a report",
+		},
+		"libB#lint": {
+			"libB/scan.sarif": `{"version": "2.1.0", "runs": [{"tool": {"driver": {"name": "semgrep"}}}]}`,
+		},
+	}
+	tracker := taskhash.NewTracker("root", "global", fs.Pipeline{}, nil)
+	for taskID, taskFiles := range files {
+		outputs := []turbopath.AnchoredSystemPath{}
+		for name, contents := range taskFiles {
+			file := repoRoot.Join(name)
+			if err := file.EnsureDir(); err != nil {
+				t.Fatalf("EnsureDir: %v", err)
+			}
+			if err := file.WriteFile([]byte(contents), 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			outputs = append(outputs, turbopath.AnchoredUnixPath(name).ToSystemPath())
+		}
+		tracker.SetExpandedOutputs(taskID, outputs)
+	}
+
+	manifest := newOutputManifest()
+	// A failing linter's report is merged too
+	manifest.addFailed(&nodes.PackageTask{
+		TaskID:         "libA#lint",
+		Task:           "lint",
+		PackageName:    "libA",
+		Pkg:            &fs.PackageJSON{Dir: turbopath.AnchoredUnixPath("libA").ToSystemPath()},
+		TaskDefinition: &fs.TaskDefinition{SarifOutputs: []string{"reports/*.sarif"}},
+	}, "hash-a")
+	manifest.add(&nodes.PackageTask{
+		TaskID:         "libB#lint",
+		Task:           "lint",
+		PackageName:    "libB",
+		Pkg:            &fs.PackageJSON{Dir: turbopath.AnchoredUnixPath("libB").ToSystemPath()},
+		TaskDefinition: &fs.TaskDefinition{SarifOutputs: []string{"*.sarif"}},
+	}, "hash-b", true)
+	if err := manifest.resolveOutputs(repoRoot, tracker); err != nil {
+		t.Fatalf("resolveOutputs: %v", err)
+	}
+
+	sarifPath := repoRoot.Join("merged.sarif")
+	if err := manifest.writeSarif(sarifPath, repoRoot); err != nil {
+		t.Fatalf("writeSarif: %v", err)
+	}
+	contents, err := sarifPath.ReadFile()
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var got struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name string `json:"name"`
+				} `json:"driver"`
+			} `json:"tool"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	assert.Equal(t, _sarifVersion, got.Version)
+	assert.Len(t, got.Runs, 2)
+	assert.Equal(t, "eslint", got.Runs[0].Tool.Driver.Name)
+	assert.Equal(t, "semgrep", got.Runs[1].Tool.Driver.Name)
+}
@@ -0,0 +1,170 @@
+package runcache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/globby"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+)
+
+// _outputSnapshotDir is the repo-relative directory that output snapshots are written to
+var _outputSnapshotDir = filepath.Join(".turbo", "output-snapshots")
+
+// fileStamp is the modification time and size of a file when its snapshot was taken
+type fileStamp struct {
+	ModTime int64 `json:"modTime"`
+	Size    int64 `json:"size"`
+}
+
+// outputSnapshot records the files matched by each of a task's output globs after the
+// outputs for a hash were written
+type outputSnapshot struct {
+	Hash  string                          `json:"hash"`
+	Globs map[string]map[string]fileStamp `json:"globs"`
+}
+
+// PollingOutputWatcher implements OutputWatcher without the daemon. When outputs are written
+// it records the modification time and size of each matching file, and considers a glob
+// unchanged as long as the files it matched still have them. Checking only stats those
+// files, rather than globbing again.
+//
+// Snapshots are kept in memory and under .turbo, keyed by the set of output globs, so
+// writing the outputs for another hash replaces the snapshot for the previous one.
+// Anything unexpected, such as a missing or unreadable snapshot, counts as changed.
+type PollingOutputWatcher struct {
+	repoRoot  turbopath.AbsolutePath
+	mu        sync.Mutex
+	snapshots map[string]*outputSnapshot
+}
+
+var _ OutputWatcher = (*PollingOutputWatcher)(nil)
+
+// NewPollingOutputWatcher returns a PollingOutputWatcher for the outputs of the given repository
+func NewPollingOutputWatcher(repoRoot turbopath.AbsolutePath) *PollingOutputWatcher {
+	return &PollingOutputWatcher{
+		repoRoot:  repoRoot,
+		snapshots: make(map[string]*outputSnapshot),
+	}
+}
+
+// GetChangedOutputs implements OutputWatcher.GetChangedOutputs.
+func (w *PollingOutputWatcher) GetChangedOutputs(ctx context.Context, hash string, repoRelativeOutputGlobs []string) ([]string, error) {
+	snapshot := w.load(repoRelativeOutputGlobs)
+	if snapshot == nil || snapshot.Hash != hash {
+		return repoRelativeOutputGlobs, nil
+	}
+	changed := []string{}
+	for _, glob := range repoRelativeOutputGlobs {
+		files, ok := snapshot.Globs[glob]
+		if !ok || !w.unchanged(files) {
+			changed = append(changed, glob)
+		}
+	}
+	return changed, nil
+}
+
+// NotifyOutputsWritten implements OutputWatcher.NotifyOutputsWritten.
+func (w *PollingOutputWatcher) NotifyOutputsWritten(ctx context.Context, hash string, repoRelativeOutputGlobs []string) error {
+	key := snapshotKey(repoRelativeOutputGlobs)
+	// Until the new snapshot is complete, treat the outputs as changed
+	w.forget(key)
+	snapshot := &outputSnapshot{
+		Hash:  hash,
+		Globs: make(map[string]map[string]fileStamp, len(repoRelativeOutputGlobs)),
+	}
+	for _, glob := range repoRelativeOutputGlobs {
+		files, err := globby.GlobFiles(w.repoRoot.ToStringDuringMigration(), []string{glob}, nil)
+		if err != nil {
+			return err
+		}
+		stamps := make(map[string]fileStamp, len(files))
+		for _, file := range files {
+			info, err := os.Lstat(file)
+			if err != nil {
+				return err
+			}
+			relativePath, err := w.repoRoot.RelativePathString(file)
+			if err != nil {
+				return err
+			}
+			stamps[filepath.ToSlash(relativePath)] = fileStamp{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+		}
+		snapshot.Globs[glob] = stamps
+	}
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	path := w.repoRoot.Join(_outputSnapshotDir, key+".json")
+	if err := path.EnsureDir(); err != nil {
+		return err
+	}
+	if err := path.WriteFile(bytes, 0644); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.snapshots[key] = snapshot
+	return nil
+}
+
+// unchanged returns whether each of the files still has the modification time and size
+// it had when the snapshot was taken. A glob that matched nothing is never unchanged.
+func (w *PollingOutputWatcher) unchanged(files map[string]fileStamp) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for file, stamp := range files {
+		info, err := os.Lstat(w.repoRoot.Join(filepath.FromSlash(file)).ToString())
+		if err != nil || info.ModTime().UnixNano() != stamp.ModTime || info.Size() != stamp.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// load returns the snapshot for the given output globs from memory, or from .turbo if
+// it was written by a previous run, or nil if there isn't a usable one
+func (w *PollingOutputWatcher) load(repoRelativeOutputGlobs []string) *outputSnapshot {
+	key := snapshotKey(repoRelativeOutputGlobs)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if snapshot, ok := w.snapshots[key]; ok {
+		return snapshot
+	}
+	contents, err := w.repoRoot.Join(_outputSnapshotDir, key+".json").ReadFile()
+	if err != nil {
+		return nil
+	}
+	snapshot := &outputSnapshot{}
+	if err := json.Unmarshal(contents, snapshot); err != nil {
+		return nil
+	}
+	w.snapshots[key] = snapshot
+	return snapshot
+}
+
+// forget removes the snapshot for the given key, so that its outputs count as changed
+func (w *PollingOutputWatcher) forget(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.snapshots, key)
+	_ = os.Remove(w.repoRoot.Join(_outputSnapshotDir, key+".json").ToString())
+}
+
+// snapshotKey names the snapshot for a set of output globs, regardless of their order
+func snapshotKey(repoRelativeOutputGlobs []string) string {
+	globs := make([]string, len(repoRelativeOutputGlobs))
+	copy(globs, repoRelativeOutputGlobs)
+	sort.Strings(globs)
+	// Writing to an xxhash can't fail
+	key, _ := fs.HashObject(strings.Join(globs, "\n"))
+	return key
+}
@@ -0,0 +1,77 @@
+package runcache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/fs"
+)
+
+func TestPollingOutputWatcher(t *testing.T) {
+	ctx := context.Background()
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	for _, file := range []string{"a.js", "b.js"} {
+		path := repoRoot.Join("web", "dist", file)
+		assert.NoError(t, path.EnsureDir())
+		assert.NoError(t, path.WriteFile([]byte(file), 0644))
+	}
+	distGlob := filepath.Join("web", "dist", "**")
+	emptyGlob := filepath.Join("web", "build", "**")
+	globs := []string{distGlob, emptyGlob}
+
+	watcher := NewPollingOutputWatcher(repoRoot)
+	changed, err := watcher.GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed, "outputs that were never written should count as changed")
+
+	assert.NoError(t, watcher.NotifyOutputsWritten(ctx, "hash1", globs))
+	changed, err = watcher.GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{emptyGlob}, changed, "a glob that matched no files should count as changed")
+	changed, err = watcher.GetChangedOutputs(ctx, "hash2", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed)
+
+	// A later run reads the snapshot back from .turbo
+	changed, err = NewPollingOutputWatcher(repoRoot).GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{emptyGlob}, changed)
+
+	assert.NoError(t, repoRoot.Join("web", "dist", "a.js").WriteFile([]byte("changed"), 0644))
+	changed, err = watcher.GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed)
+
+	// Writing the outputs for another hash replaces the snapshot
+	assert.NoError(t, watcher.NotifyOutputsWritten(ctx, "hash2", globs))
+	changed, err = watcher.GetChangedOutputs(ctx, "hash2", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{emptyGlob}, changed)
+	changed, err = watcher.GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed)
+
+	assert.NoError(t, repoRoot.Join("web", "dist", "b.js").Remove())
+	changed, err = watcher.GetChangedOutputs(ctx, "hash2", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed)
+}
+
+func TestPollingOutputWatcherUnreadableSnapshot(t *testing.T) {
+	ctx := context.Background()
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	path := repoRoot.Join("web", "dist", "a.js")
+	assert.NoError(t, path.EnsureDir())
+	assert.NoError(t, path.WriteFile([]byte("a"), 0644))
+	globs := []string{filepath.Join("web", "dist", "**")}
+
+	assert.NoError(t, NewPollingOutputWatcher(repoRoot).NotifyOutputsWritten(ctx, "hash1", globs))
+	snapshotPath := repoRoot.Join(_outputSnapshotDir, snapshotKey(globs)+".json")
+	assert.NoError(t, snapshotPath.WriteFile([]byte("{not json"), 0644))
+
+	changed, err := NewPollingOutputWatcher(repoRoot).GetChangedOutputs(ctx, "hash1", globs)
+	assert.NoError(t, err)
+	assert.Equal(t, globs, changed)
+}
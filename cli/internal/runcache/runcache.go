@@ -5,8 +5,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/fatih/color"
@@ -15,7 +16,9 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/vercel/turborepo/cli/internal/cache"
 	"github.com/vercel/turborepo/cli/internal/colorcache"
+	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/globby"
+	"github.com/vercel/turborepo/cli/internal/logstreamer"
 	"github.com/vercel/turborepo/cli/internal/nodes"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"github.com/vercel/turborepo/cli/internal/ui"
@@ -32,6 +35,15 @@ type Opts struct {
 	TaskOutputModeOverride *util.TaskOutputMode
 	LogReplayer            LogReplayer
 	OutputWatcher          OutputWatcher
+	// ScopedCaches are used instead of the default cache for tasks configured with a matching cache scope
+	ScopedCaches map[fs.CacheScope]cache.Cache
+	// RestoreFilter lists repo-relative globs limiting which cached outputs are restored.
+	// The underlying caches must be configured with the same filter.
+	RestoreFilter []string
+	// LogPrefix selects which parts of a task's name prefix its lines of output
+	LogPrefix util.LogPrefixMode
+	// Stdout receives the output of tasks, and defaults to os.Stdout
+	Stdout io.Writer
 }
 
 // AddFlags adds the flags relevant to the runcache package to the given FlagSet
@@ -49,11 +61,24 @@ func AddFlags(opts *Opts, flags *pflag.FlagSet) {
 		Usage: `Set type of process output logging. Use "full" to show
 all output. Use "hash-only" to show only turbo-computed
 task hashes. Use "new-only" to show only new output with
-only hashes for cached tasks. Use "none" to hide process
-output.`,
+only hashes for cached tasks. Use "errors-only" to show
+only the output of failed tasks. Use "none" to hide process
+output. Overrides the outputMode of every task in turbo.json.`,
 		DefValue: defaultTaskOutputMode,
 		Value:    &taskOutputModeValue{opts: opts},
 	})
+	flags.AddFlag(&pflag.Flag{
+		Name: "log-prefix",
+		Usage: `Set how lines of task output are prefixed. Use "full" to
+prefix them with the package and task, as in web:build.
+Use "package" or "task" to prefix them with only one of
+the two, or "none" to leave them unprefixed.`,
+		DefValue: "full",
+		Value:    &logPrefixValue{opts: opts},
+	})
+	flags.StringArrayVar(&opts.RestoreFilter, "experimental-restore-outputs-filter", nil, `On a cache hit, only restore the outputs matching this glob,
+relative to the repository root. Can be repeated. Task logs
+are only replayed if they match as well.`)
 	_ = flags.Bool("stream", true, "Unused")
 	if err := flags.MarkDeprecated("stream", "[WARNING] The --stream flag is unnecessary and has been deprecated. It will be removed in future versions of turbo."); err != nil {
 		// fail fast if we've misconfigured our flags
@@ -102,16 +127,47 @@ func (l *taskOutputModeValue) Type() string {
 
 var _ pflag.Value = &taskOutputModeValue{}
 
+type logPrefixValue struct {
+	opts *Opts
+}
+
+func (l *logPrefixValue) String() string {
+	logPrefix, err := util.ToLogPrefixModeString(l.opts.LogPrefix)
+	if err != nil {
+		panic(err)
+	}
+	return logPrefix
+}
+
+func (l *logPrefixValue) Set(value string) error {
+	logPrefix, err := util.FromLogPrefixModeString(value)
+	if err != nil {
+		return fmt.Errorf("must be one of \"%v\"", l.Type())
+	}
+	l.opts.LogPrefix = logPrefix
+	return nil
+}
+
+func (l *logPrefixValue) Type() string {
+	return strings.Join(util.LogPrefixModeStrings, "|")
+}
+
+var _ pflag.Value = &logPrefixValue{}
+
 // RunCache represents the interface to the cache for a single `turbo run`
 type RunCache struct {
 	taskOutputModeOverride *util.TaskOutputMode
 	cache                  cache.Cache
+	scopedCaches           map[fs.CacheScope]cache.Cache
 	readsDisabled          bool
 	writesDisabled         bool
 	repoRoot               turbopath.AbsolutePath
 	logReplayer            LogReplayer
 	outputWatcher          OutputWatcher
 	colorCache             *colorcache.ColorCache
+	restoreFilter          []string
+	logPrefix              util.LogPrefixMode
+	stdout                 io.Writer
 }
 
 // New returns a new instance of RunCache, wrapping the given cache
@@ -119,12 +175,16 @@ func New(cache cache.Cache, repoRoot turbopath.AbsolutePath, opts Opts, colorCac
 	rc := &RunCache{
 		taskOutputModeOverride: opts.TaskOutputModeOverride,
 		cache:                  cache,
+		scopedCaches:           opts.ScopedCaches,
 		readsDisabled:          opts.SkipReads,
 		writesDisabled:         opts.SkipWrites,
 		repoRoot:               repoRoot,
 		logReplayer:            opts.LogReplayer,
 		outputWatcher:          opts.OutputWatcher,
 		colorCache:             colorCache,
+		restoreFilter:          opts.RestoreFilter,
+		logPrefix:              opts.LogPrefix,
+		stdout:                 opts.Stdout,
 	}
 	if rc.logReplayer == nil {
 		rc.logReplayer = defaultLogReplayer
@@ -132,6 +192,9 @@ func New(cache cache.Cache, repoRoot turbopath.AbsolutePath, opts Opts, colorCac
 	if rc.outputWatcher == nil {
 		rc.outputWatcher = &NoOpOutputWatcher{}
 	}
+	if rc.stdout == nil {
+		rc.stdout = os.Stdout
+	}
 	return rc
 }
 
@@ -139,12 +202,19 @@ func New(cache cache.Cache, repoRoot turbopath.AbsolutePath, opts Opts, colorCac
 // and controls access to the task's outputs
 type TaskCache struct {
 	rc                *RunCache
+	cache             cache.Cache
 	repoRelativeGlobs []string
-	hash              string
-	pt                *nodes.PackageTask
-	taskOutputMode    util.TaskOutputMode
-	cachingDisabled   bool
-	LogFileName       turbopath.AbsolutePath
+	// repoRelativeExclusions are the repo-relative globs of files excluded from the outputs
+	repoRelativeExclusions []string
+	// preservedGlobs are the repo-relative globs of files that restoring must not change
+	preservedGlobs  []string
+	hash            string
+	pt              *nodes.PackageTask
+	taskOutputMode  util.TaskOutputMode
+	cachingDisabled bool
+	// writesDisabled is set for tasks that only restore from the cache
+	writesDisabled bool
+	LogFileName    turbopath.AbsolutePath
 }
 
 // RestoreOutputs attempts to restore output for the corresponding task from the cache. Returns true
@@ -165,8 +235,14 @@ func (tc TaskCache) RestoreOutputs(ctx context.Context, terminal *cli.PrefixedUi
 	hasChangedOutputs := len(changedOutputGlobs) > 0
 	if hasChangedOutputs {
 		// Note that we currently don't use the output globs when restoring, but we could in the
-		// future to avoid doing unnecessary file I/O
-		hit, _, _, err := tc.rc.cache.Fetch(tc.rc.repoRoot.ToString(), tc.hash, changedOutputGlobs)
+		// future to avoid doing unnecessary file I/O. Excluding the preserved outputs leaves
+		// them as they are.
+		fetchGlobs := make([]string, 0, len(changedOutputGlobs)+len(tc.preservedGlobs))
+		fetchGlobs = append(fetchGlobs, changedOutputGlobs...)
+		for _, glob := range tc.preservedGlobs {
+			fetchGlobs = append(fetchGlobs, "!"+glob)
+		}
+		hit, _, _, err := tc.cache.Fetch(tc.rc.repoRoot.ToString(), tc.hash, fetchGlobs)
 		if err != nil {
 			return false, err
 		} else if !hit {
@@ -175,7 +251,10 @@ func (tc TaskCache) RestoreOutputs(ctx context.Context, terminal *cli.PrefixedUi
 			}
 			return false, nil
 		}
-		if err := tc.rc.outputWatcher.NotifyOutputsWritten(ctx, tc.hash, tc.repoRelativeGlobs); err != nil {
+		if len(tc.rc.restoreFilter) > 0 {
+			// Only some of the outputs were restored, so they can't be skipped next time
+			logger.Debug(fmt.Sprintf("Restored the outputs of %v matching %v", tc.pt.TaskID, strings.Join(tc.rc.restoreFilter, ", ")))
+		} else if err := tc.rc.outputWatcher.NotifyOutputsWritten(ctx, tc.hash, tc.repoRelativeGlobs); err != nil {
 			// Don't fail the whole operation just because we failed to watch the outputs
 			logger.Warn(fmt.Sprintf("Failed to mark outputs as cached for %v: %v", tc.pt.TaskID, err))
 			terminal.Warn(ui.Dim(fmt.Sprintf("Failed to mark outputs as cached for %v: %v", tc.pt.TaskID, err)))
@@ -186,16 +265,16 @@ func (tc TaskCache) RestoreOutputs(ctx context.Context, terminal *cli.PrefixedUi
 
 	switch tc.taskOutputMode {
 	// When only showing new task output, cached output should only show the computed hash
-	case util.NewTaskOutput:
+	case util.NewTaskOutput, util.ErrorsOnlyTaskOutput:
 		fallthrough
 	case util.HashTaskOutput:
 		terminal.Output(fmt.Sprintf("cache hit, suppressing output %s", ui.Dim(tc.hash)))
 	case util.FullTaskOutput:
 		logger.Debug("log file", "path", tc.LogFileName)
 		if tc.LogFileName.FileExists() {
-			// The task label is baked into the log file, so we need to grab the underlying Ui
-			// instance in order to not duplicate it
-			tc.rc.logReplayer(logger, terminal.Ui, tc.LogFileName)
+			// The log file is stored without the task's prefix, so that it can be replayed
+			// with whichever prefix this run uses
+			tc.rc.logReplayer(logger, terminal, tc.LogFileName)
 		}
 	default:
 		// NoLogs, do not output anything
@@ -214,20 +293,38 @@ type fileWriterCloser struct {
 	io.Writer
 	file  *os.File
 	bufio *bufio.Writer
+	// stdout, if set, prefixes the lines written to stdout
+	stdout io.Closer
 }
 
 func (fwc *fileWriterCloser) Close() error {
+	if fwc.stdout != nil {
+		if err := fwc.stdout.Close(); err != nil {
+			_ = fwc.file.Close()
+			return err
+		}
+	}
 	if err := fwc.bufio.Flush(); err != nil {
 		return err
 	}
 	return fwc.file.Close()
 }
 
+// OutputMode returns the way this task's output is displayed
+func (tc TaskCache) OutputMode() util.TaskOutputMode {
+	return tc.taskOutputMode
+}
+
 // OutputWriter creates a sink suitable for handling the output of the command associated
-// with this task.
+// with this task. The lines written to stdout are prefixed, but the log file keeps them as
+// the task wrote them.
 func (tc TaskCache) OutputWriter() (io.WriteCloser, error) {
 	if tc.cachingDisabled || tc.rc.writesDisabled {
-		return nopWriteCloser{os.Stdout}, nil
+		if tc.taskOutputMode == util.ErrorsOnlyTaskOutput {
+			// The caller buffers output to show if the task fails
+			return nopWriteCloser{ioutil.Discard}, nil
+		}
+		return tc.rc.PrefixedWriter(tc.pt, tc.rc.stdout), nil
 	}
 	// Setup log file
 	if err := tc.LogFileName.EnsureDir(); err != nil {
@@ -237,10 +334,8 @@ func (tc TaskCache) OutputWriter() (io.WriteCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	colorPrefixer := tc.rc.colorCache.PrefixColor(tc.pt.PackageName)
-	prettyTaskPrefix := colorPrefixer(tc.pt.OutputPrefix())
 	bufWriter := bufio.NewWriter(output)
-	if _, err := bufWriter.WriteString(fmt.Sprintf("%s: cache hit, replaying output %s\n", prettyTaskPrefix, ui.Dim(tc.hash))); err != nil {
+	if _, err := bufWriter.WriteString(fmt.Sprintf("%s %s\n", _logFileHeader, ui.Dim(tc.hash))); err != nil {
 		// We've already errored, we don't care if there's a further error closing the file we just
 		// failed to write to.
 		_ = output.Close()
@@ -250,11 +345,13 @@ func (tc TaskCache) OutputWriter() (io.WriteCloser, error) {
 		file:  output,
 		bufio: bufWriter,
 	}
-	if tc.taskOutputMode == util.NoTaskOutput || tc.taskOutputMode == util.HashTaskOutput {
+	if tc.taskOutputMode == util.NoTaskOutput || tc.taskOutputMode == util.HashTaskOutput || tc.taskOutputMode == util.ErrorsOnlyTaskOutput {
 		// only write to log file, not to stdout
 		fwc.Writer = bufWriter
 	} else {
-		fwc.Writer = io.MultiWriter(os.Stdout, bufWriter)
+		stdout := tc.rc.PrefixedWriter(tc.pt, tc.rc.stdout)
+		fwc.Writer = io.MultiWriter(stdout, bufWriter)
+		fwc.stdout = stdout
 	}
 	return fwc, nil
 }
@@ -263,13 +360,13 @@ var _emptyIgnore []string
 
 // SaveOutputs is responsible for saving the outputs of task to the cache, after the task has completed
 func (tc TaskCache) SaveOutputs(ctx context.Context, logger hclog.Logger, terminal cli.Ui, duration int) error {
-	if tc.cachingDisabled || tc.rc.writesDisabled {
+	if tc.cachingDisabled || tc.writesDisabled || tc.rc.writesDisabled {
 		return nil
 	}
 
 	logger.Debug("caching output", "outputs", tc.repoRelativeGlobs)
 
-	filesToBeCached, err := globby.GlobFiles(tc.rc.repoRoot.ToStringDuringMigration(), tc.repoRelativeGlobs, _emptyIgnore)
+	filesToBeCached, err := globby.GlobFiles(tc.rc.repoRoot.ToStringDuringMigration(), tc.repoRelativeGlobs, tc.repoRelativeExclusions)
 	if err != nil {
 		return err
 	}
@@ -286,7 +383,7 @@ func (tc TaskCache) SaveOutputs(ctx context.Context, logger hclog.Logger, termin
 		relativePaths[index] = relativePath
 	}
 
-	if err = tc.rc.cache.Put(tc.pt.Pkg.Dir.ToStringDuringMigration(), tc.hash, duration, relativePaths); err != nil {
+	if err = tc.cache.Put(tc.pt.Pkg.Dir.ToStringDuringMigration(), tc.hash, duration, relativePaths); err != nil {
 		return err
 	}
 	err = tc.rc.outputWatcher.NotifyOutputsWritten(ctx, tc.hash, tc.repoRelativeGlobs)
@@ -299,14 +396,97 @@ func (tc TaskCache) SaveOutputs(ctx context.Context, logger hclog.Logger, termin
 	return nil
 }
 
+// UnmatchedOutputs returns the outputs declared in the task's definition if they include files but
+// none of those are on disk, which usually means the globs are wrong. The task's log file, which is
+// always cached, isn't counted, and nil is returned for tasks that don't cache their outputs or
+// that use the default outputs.
+func (tc TaskCache) UnmatchedOutputs() ([]string, error) {
+	if tc.cachingDisabled || tc.writesDisabled || !tc.pt.TaskDefinition.HasOutputs {
+		return nil, nil
+	}
+	inclusions, _ := fs.SplitOutputGlobs(tc.pt.TaskDefinition.Outputs)
+	if len(inclusions) == 0 {
+		return nil, nil
+	}
+	repoRelativeInclusions := make([]string, len(inclusions))
+	for index, output := range inclusions {
+		repoRelativeInclusions[index] = fs.RepoRelativeOutputGlob(tc.pt.Pkg.Dir.ToStringDuringMigration(), output)
+	}
+	files, err := globby.GlobFiles(tc.rc.repoRoot.ToStringDuringMigration(), repoRelativeInclusions, tc.repoRelativeExclusions)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return nil, nil
+	}
+	return tc.pt.TaskDefinition.Outputs, nil
+}
+
+// ExpandedOutputs returns the repo-relative paths of the files currently on disk that match
+// this task's output globs
+func (tc TaskCache) ExpandedOutputs() ([]turbopath.AnchoredSystemPath, error) {
+	files, err := globby.GlobFiles(tc.rc.repoRoot.ToStringDuringMigration(), tc.repoRelativeGlobs, tc.repoRelativeExclusions)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]turbopath.AnchoredSystemPath, 0, len(files))
+	for _, file := range files {
+		relativePath, err := tc.rc.repoRoot.RelativePathString(file)
+		if err != nil {
+			return nil, fmt.Errorf("File path cannot be made relative: %w", err)
+		}
+		outputs = append(outputs, turbopath.AnchoredSystemPathFromUpstream(relativePath))
+	}
+	return outputs, nil
+}
+
+// BreakOutputHardlinks gives each of this task's outputs on disk its own copy of its contents,
+// so that running the task can't modify the cached artifacts that outputs restored as
+// hardlinks share their contents with.
+func (tc TaskCache) BreakOutputHardlinks() error {
+	files, err := globby.GlobFiles(tc.rc.repoRoot.ToStringDuringMigration(), tc.repoRelativeGlobs, tc.repoRelativeExclusions)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := fs.BreakHardlink(file); err != nil {
+			return fmt.Errorf("copying hardlinked output %v: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// LogPrefix returns the colored prefix, including its trailing separator, for the lines of
+// output of the given PackageTask, or an empty string if output isn't prefixed.
+// The color depends only on the package, whatever parts of the name are shown.
+func (rc *RunCache) LogPrefix(pt *nodes.PackageTask) string {
+	prefix := pt.LogPrefix(rc.logPrefix)
+	if prefix == "" {
+		return ""
+	}
+	return rc.colorCache.PrefixColor(pt.PackageName)("%s: ", prefix)
+}
+
+// PrefixedWriter returns a writer that adds the log prefix of the given PackageTask to each
+// line written to w. Closing it writes out a final line that has no trailing newline.
+func (rc *RunCache) PrefixedWriter(pt *nodes.PackageTask, w io.Writer) io.WriteCloser {
+	return logstreamer.NewLogstreamer(log.New(w, "", 0), rc.LogPrefix(pt), false)
+}
+
 // TaskCache returns a TaskCache instance, providing an interface to the underlying cache specific
 // to this run and the given PackageTask
 func (rc *RunCache) TaskCache(pt *nodes.PackageTask, hash string) TaskCache {
 	logFileName := rc.repoRoot.Join(pt.RepoRelativeLogFile())
-	hashableOutputs := pt.HashableOutputs()
-	repoRelativeGlobs := make([]string, len(hashableOutputs))
-	for index, output := range hashableOutputs {
-		repoRelativeGlobs[index] = filepath.Join(pt.Pkg.Dir.ToStringDuringMigration(), output)
+	// Output globs are relative to the package unless anchored at the repo root with "//",
+	// whether they include or exclude files
+	inclusions, exclusions := fs.SplitOutputGlobs(pt.HashableOutputs())
+	repoRelativeGlobs := make([]string, len(inclusions))
+	for index, output := range inclusions {
+		repoRelativeGlobs[index] = fs.RepoRelativeOutputGlob(pt.Pkg.Dir.ToStringDuringMigration(), output)
+	}
+	repoRelativeExclusions := make([]string, len(exclusions))
+	for index, output := range exclusions {
+		repoRelativeExclusions[index] = fs.RepoRelativeOutputGlob(pt.Pkg.Dir.ToStringDuringMigration(), output)
 	}
 
 	taskOutputMode := pt.TaskDefinition.OutputMode
@@ -314,17 +494,34 @@ func (rc *RunCache) TaskCache(pt *nodes.PackageTask, hash string) TaskCache {
 		taskOutputMode = *rc.taskOutputModeOverride
 	}
 
+	preservedGlobs := make([]string, len(pt.TaskDefinition.PreserveOutputs))
+	for index, glob := range pt.TaskDefinition.PreserveOutputs {
+		preservedGlobs[index] = fs.RepoRelativeOutputGlob(pt.Pkg.Dir.ToStringDuringMigration(), glob)
+	}
+
+	taskCache := rc.cache
+	if scopedCache, ok := rc.scopedCaches[pt.TaskDefinition.CacheScope]; ok {
+		taskCache = scopedCache
+	}
+
 	return TaskCache{
-		rc:                rc,
-		repoRelativeGlobs: repoRelativeGlobs,
-		hash:              hash,
-		pt:                pt,
-		taskOutputMode:    taskOutputMode,
-		cachingDisabled:   !pt.TaskDefinition.ShouldCache,
-		LogFileName:       logFileName,
+		rc:                     rc,
+		cache:                  taskCache,
+		repoRelativeGlobs:      repoRelativeGlobs,
+		repoRelativeExclusions: repoRelativeExclusions,
+		preservedGlobs:         preservedGlobs,
+		hash:                   hash,
+		pt:                     pt,
+		taskOutputMode:         taskOutputMode,
+		cachingDisabled:        !pt.TaskDefinition.ShouldCache,
+		writesDisabled:         pt.TaskDefinition.CacheScope == fs.CacheScopeReadOnly,
+		LogFileName:            logFileName,
 	}
 }
 
+// _logFileHeader starts the first line of every task's log file
+const _logFileHeader = "cache hit, replaying output"
+
 // defaultLogReplayer will try to replay logs back to the given Ui instance
 func defaultLogReplayer(logger hclog.Logger, output cli.Ui, logFileName turbopath.AbsolutePath) {
 	logger.Debug("start replaying logs")
@@ -335,8 +532,19 @@ func defaultLogReplayer(logger hclog.Logger, output cli.Ui, logFileName turbopat
 	}
 	defer func() { _ = f.Close() }()
 	scan := bufio.NewScanner(f)
+	// Older versions of turbo stored every line of the log with the task's prefix. Strip it,
+	// since output is already prefixed as it is replayed.
+	storedPrefix := ""
+	firstLine := true
 	for scan.Scan() {
-		output.Output(string(scan.Bytes())) //Writing to Stdout
+		line := scan.Text()
+		if firstLine {
+			firstLine = false
+			if i := strings.Index(line, _logFileHeader); i > 0 {
+				storedPrefix = line[:i]
+			}
+		}
+		output.Output(strings.TrimPrefix(line, storedPrefix)) //Writing to Stdout
 	}
 	logger.Debug("finish replaying logs")
 }
@@ -0,0 +1,397 @@
+package runcache
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turborepo/cli/internal/analytics"
+	"github.com/vercel/turborepo/cli/internal/cache"
+	"github.com/vercel/turborepo/cli/internal/colorcache"
+	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/nodes"
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"github.com/vercel/turborepo/cli/internal/util"
+)
+
+// overwritingCache is a cache that always hits, and restores by writing its contents over
+// the files in the repository
+type overwritingCache struct {
+	repoRoot turbopath.AbsolutePath
+	contents map[string]string
+}
+
+func (c *overwritingCache) Fetch(target string, hash string, files []string) (bool, []string, int, error) {
+	for file, contents := range c.contents {
+		path := c.repoRoot.Join(file)
+		if err := path.EnsureDir(); err != nil {
+			return false, nil, 0, err
+		}
+		if err := path.WriteFile([]byte(contents), 0644); err != nil {
+			return false, nil, 0, err
+		}
+	}
+	return true, nil, 0, nil
+}
+
+func (c *overwritingCache) Put(target string, hash string, duration int, files []string) error {
+	return nil
+}
+func (c *overwritingCache) Clean(target string) {}
+func (c *overwritingCache) CleanAll()           {}
+func (c *overwritingCache) Shutdown()           {}
+
+func TestRestoreOutputsPreservesOutputs(t *testing.T) {
+	for _, compression := range []cache.Compression{cache.CompressionNone, cache.CompressionGzip} {
+		repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+		for file, contents := range map[string]string{
+			"pkg/dist/index.js":      "cached",
+			"pkg/.cache/history.log": "cached history",
+			"dist/pkg/state.json":    "cached state",
+		} {
+			path := repoRoot.Join(filepath.FromSlash(file))
+			assert.NoError(t, path.EnsureDir(), "EnsureDir")
+			assert.NoError(t, path.WriteFile([]byte(contents), 0644), "WriteFile")
+		}
+		turboCache, err := cache.New(cache.Opts{
+			OverrideDir: t.TempDir(),
+			SkipRemote:  true,
+			Compression: compression,
+		}, repoRoot, nil, nullRecorder{}, nil)
+		assert.NoError(t, err, "cache.New")
+		outputMode := util.NoTaskOutput
+		rc := New(turboCache, repoRoot, Opts{TaskOutputModeOverride: &outputMode}, colorcache.New())
+		ui := &cli.PrefixedUi{Ui: cli.NewMockUi()}
+		pt := &nodes.PackageTask{
+			TaskID:      "pkg#build",
+			Task:        "build",
+			PackageName: "pkg",
+			Pkg:         &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("pkg")},
+			TaskDefinition: &fs.TaskDefinition{
+				Outputs:         []string{"dist/**", ".cache/**", "//dist/pkg/**"},
+				PreserveOutputs: []string{".cache/**", "//dist/pkg/state.json"},
+				ShouldCache:     true,
+			},
+		}
+		taskCache := rc.TaskCache(pt, "the-hash")
+		assert.NoError(t, taskCache.SaveOutputs(context.Background(), hclog.NewNullLogger(), ui, 0), "SaveOutputs")
+
+		for file, contents := range map[string]string{
+			"pkg/dist/index.js":      "stale",
+			"pkg/.cache/history.log": "local history",
+			"dist/pkg/state.json":    "local state",
+		} {
+			assert.NoError(t, repoRoot.Join(filepath.FromSlash(file)).WriteFile([]byte(contents), 0644), "WriteFile")
+		}
+		hit, err := taskCache.RestoreOutputs(context.Background(), ui, hclog.NewNullLogger())
+		assert.NoError(t, err, "RestoreOutputs")
+		assert.True(t, hit, "expected a cache hit")
+
+		for file, want := range map[string]string{
+			"pkg/dist/index.js":      "cached",
+			"pkg/.cache/history.log": "local history",
+			"dist/pkg/state.json":    "local state",
+		} {
+			contents, err := repoRoot.Join(filepath.FromSlash(file)).ReadFile()
+			assert.NoError(t, err, "ReadFile %v", file)
+			assert.Equal(t, want, string(contents), "%v with %v compression", file, compression)
+		}
+	}
+}
+
+type nullRecorder struct{}
+
+func (nullRecorder) LogEvent(analytics.EventPayload) {}
+
+func TestRestoreRepoRootOutputs(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	files := map[string]string{
+		"pkg/dist/index.js":       "package output",
+		"dist/pkg/bundle.js":      "root output",
+		"dist/pkg/bundle.js.map":  "excluded root output",
+		"dist/other/unrelated.js": "not an output",
+	}
+	for file, contents := range files {
+		path := repoRoot.Join(filepath.FromSlash(file))
+		assert.NoError(t, path.EnsureDir(), "EnsureDir")
+		assert.NoError(t, path.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	turboCache, err := cache.New(cache.Opts{
+		OverrideDir: t.TempDir(),
+		SkipRemote:  true,
+		Compression: cache.CompressionGzip,
+	}, repoRoot, nil, nullRecorder{}, nil)
+	assert.NoError(t, err, "cache.New")
+	outputMode := util.NoTaskOutput
+	rc := New(turboCache, repoRoot, Opts{TaskOutputModeOverride: &outputMode}, colorcache.New())
+	ui := &cli.PrefixedUi{Ui: cli.NewMockUi()}
+	pt := &nodes.PackageTask{
+		TaskID:      "pkg#build",
+		Task:        "build",
+		PackageName: "pkg",
+		Pkg:         &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("pkg")},
+		TaskDefinition: &fs.TaskDefinition{
+			Outputs:     []string{"dist/**", "//dist/pkg/**", "!//dist/pkg/*.map"},
+			ShouldCache: true,
+		},
+	}
+
+	taskCache := rc.TaskCache(pt, "the-hash")
+	assert.NoError(t, taskCache.SaveOutputs(context.Background(), hclog.NewNullLogger(), ui, 0), "SaveOutputs")
+	for _, dir := range []string{"pkg/dist", "dist"} {
+		assert.NoError(t, repoRoot.Join(filepath.FromSlash(dir)).RemoveAll(), "RemoveAll")
+	}
+
+	hit, err := taskCache.RestoreOutputs(context.Background(), ui, hclog.NewNullLogger())
+	assert.NoError(t, err, "RestoreOutputs")
+	assert.True(t, hit, "expected a cache hit")
+	for file, contents := range files {
+		restored, err := repoRoot.Join(filepath.FromSlash(file)).ReadFile()
+		switch file {
+		case "pkg/dist/index.js", "dist/pkg/bundle.js":
+			assert.NoError(t, err, "ReadFile %v", file)
+			assert.Equal(t, contents, string(restored), file)
+		default:
+			assert.Error(t, err, "expected %v not to be restored", file)
+		}
+	}
+}
+
+// recordingCache only hits for the hashes that have been put into it, and records them
+type recordingCache struct {
+	overwritingCache
+	puts []string
+}
+
+func (c *recordingCache) Fetch(target string, hash string, files []string) (bool, []string, int, error) {
+	for _, put := range c.puts {
+		if put == hash {
+			return c.overwritingCache.Fetch(target, hash, files)
+		}
+	}
+	return false, nil, 0, nil
+}
+
+func (c *recordingCache) Put(target string, hash string, duration int, files []string) error {
+	c.puts = append(c.puts, hash)
+	return nil
+}
+
+func TestSaveOutputsReadOnly(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	turboCache := &recordingCache{overwritingCache: overwritingCache{repoRoot: repoRoot}}
+	outputMode := util.NoTaskOutput
+	rc := New(turboCache, repoRoot, Opts{TaskOutputModeOverride: &outputMode}, colorcache.New())
+	ui := &cli.PrefixedUi{Ui: cli.NewMockUi()}
+	packageTask := func(scope fs.CacheScope) *nodes.PackageTask {
+		return &nodes.PackageTask{
+			TaskID:      "pkg#codegen",
+			Task:        "codegen",
+			PackageName: "pkg",
+			Pkg:         &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("pkg")},
+			TaskDefinition: &fs.TaskDefinition{
+				Outputs:     []string{"generated/**"},
+				CacheScope:  scope,
+				ShouldCache: true,
+			},
+		}
+	}
+	run := func(scope fs.CacheScope, hash string) bool {
+		t.Helper()
+		taskCache := rc.TaskCache(packageTask(scope), hash)
+		hit, err := taskCache.RestoreOutputs(context.Background(), ui, hclog.NewNullLogger())
+		assert.NoError(t, err, "RestoreOutputs")
+		if !hit {
+			assert.NoError(t, taskCache.SaveOutputs(context.Background(), hclog.NewNullLogger(), ui, 0), "SaveOutputs")
+		}
+		return hit
+	}
+
+	// A readonly task never stores what it produces
+	assert.False(t, run(fs.CacheScopeReadOnly, "unwritten-hash"), "expected a miss before anything was written")
+	assert.Empty(t, turboCache.puts)
+	// It restores what a read-write task stored under the same hash
+	assert.False(t, run(fs.CacheScopeBoth, "the-hash"), "expected the writer to miss")
+	assert.True(t, run(fs.CacheScopeReadOnly, "the-hash"), "expected readonly to restore the writer's outputs")
+	assert.Equal(t, []string{"the-hash"}, turboCache.puts)
+}
+
+// filesCache records the files that are put into it
+type filesCache struct {
+	overwritingCache
+	files []string
+}
+
+func (c *filesCache) Put(target string, hash string, duration int, files []string) error {
+	c.files = append(c.files, files...)
+	return nil
+}
+
+func TestSaveOutputsExclusions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		outputs []string
+		want    []string
+	}{
+		{
+			name:    "exclusions",
+			outputs: []string{"dist/**", "!dist/**/*.map"},
+			want:    []string{"pkg/.turbo/turbo-build.log", "pkg/dist/index.js", "pkg/dist/nested/util.js"},
+		},
+		{
+			name:    "only exclusions",
+			outputs: []string{"!dist/**/*.map"},
+			want:    []string{"pkg/.turbo/turbo-build.log"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+			// Files outside of the package match the globs relative to the repo root, and
+			// must not be cached
+			for _, file := range []string{
+				"pkg/.turbo/turbo-build.log",
+				"pkg/dist/index.js",
+				"pkg/dist/index.js.map",
+				"pkg/dist/nested/util.js",
+				"pkg/dist/nested/util.js.map",
+				"dist/root.js",
+				"other/dist/other.js",
+			} {
+				path := repoRoot.Join(filepath.FromSlash(file))
+				assert.NoError(t, path.EnsureDir(), "EnsureDir")
+				assert.NoError(t, path.WriteFile([]byte(file), 0644), "WriteFile")
+			}
+			turboCache := &filesCache{overwritingCache: overwritingCache{repoRoot: repoRoot}}
+			outputMode := util.NoTaskOutput
+			rc := New(turboCache, repoRoot, Opts{TaskOutputModeOverride: &outputMode}, colorcache.New())
+			pt := &nodes.PackageTask{
+				TaskID:      "pkg#build",
+				Task:        "build",
+				PackageName: "pkg",
+				Pkg:         &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("pkg")},
+				TaskDefinition: &fs.TaskDefinition{
+					Outputs:     tc.outputs,
+					CacheScope:  fs.CacheScopeBoth,
+					ShouldCache: true,
+				},
+			}
+			taskCache := rc.TaskCache(pt, "the-hash")
+			ui := &cli.PrefixedUi{Ui: cli.NewMockUi()}
+			assert.NoError(t, taskCache.SaveOutputs(context.Background(), hclog.NewNullLogger(), ui, 0), "SaveOutputs")
+
+			want := make([]string, len(tc.want))
+			for index, file := range tc.want {
+				want[index] = filepath.FromSlash(file)
+			}
+			sort.Strings(turboCache.files)
+			assert.Equal(t, want, turboCache.files)
+		})
+	}
+}
+
+func TestUnmatchedOutputs(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	pkgDir := repoRoot.Join("pkg")
+	assert.NoError(t, pkgDir.Join("dist").MkdirAll())
+	assert.NoError(t, pkgDir.Join("dist", "index.js").WriteFile([]byte("built"), 0644))
+	assert.NoError(t, pkgDir.Join(".turbo").MkdirAll())
+	assert.NoError(t, pkgDir.Join(".turbo", "turbo-build.log").WriteFile([]byte("log"), 0644))
+	rc := New(&overwritingCache{repoRoot: repoRoot}, repoRoot, Opts{}, colorcache.New())
+
+	testCases := []struct {
+		name        string
+		outputs     []string
+		hasOutputs  bool
+		shouldCache bool
+		want        []string
+	}{
+		{name: "matched", outputs: []string{"dist/**", "build/**"}, hasOutputs: true, shouldCache: true},
+		{name: "unmatched", outputs: []string{"build/**"}, hasOutputs: true, shouldCache: true, want: []string{"build/**"}},
+		{name: "all excluded", outputs: []string{"dist/**", "!dist/**"}, hasOutputs: true, shouldCache: true, want: []string{"dist/**", "!dist/**"}},
+		{name: "no outputs", outputs: []string{}, hasOutputs: true, shouldCache: true},
+		{name: "not cached", outputs: []string{"build/**"}, hasOutputs: true, shouldCache: false},
+		{name: "default outputs", outputs: []string{"build/**"}, hasOutputs: false, shouldCache: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pt := &nodes.PackageTask{
+				TaskID:      "pkg#build",
+				Task:        "build",
+				PackageName: "pkg",
+				Pkg:         &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("pkg")},
+				TaskDefinition: &fs.TaskDefinition{
+					Outputs:     tc.outputs,
+					HasOutputs:  tc.hasOutputs,
+					ShouldCache: tc.shouldCache,
+				},
+			}
+			unmatched, err := rc.TaskCache(pt, "the-hash").UnmatchedOutputs()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, unmatched)
+		})
+	}
+}
+
+func TestLogPrefix(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	pt := &nodes.PackageTask{TaskID: "web#build", Task: "build", PackageName: "web"}
+	for mode, want := range map[util.LogPrefixMode]string{
+		util.FullLogPrefix:    "web:build: ",
+		util.PackageLogPrefix: "web: ",
+		util.TaskLogPrefix:    "build: ",
+		util.NoLogPrefix:      "",
+	} {
+		rc := New(nil, fs.AbsolutePathFromUpstream(t.TempDir()), Opts{LogPrefix: mode}, colorcache.New())
+		assert.Equal(t, want, rc.LogPrefix(pt))
+	}
+}
+
+func TestOutputWriterStoresUnprefixedLogs(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	outputMode := util.HashTaskOutput
+	rc := New(&overwritingCache{repoRoot: repoRoot}, repoRoot, Opts{TaskOutputModeOverride: &outputMode}, colorcache.New())
+	pt := &nodes.PackageTask{
+		TaskID:         "web#build",
+		Task:           "build",
+		PackageName:    "web",
+		Pkg:            &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("web")},
+		TaskDefinition: &fs.TaskDefinition{ShouldCache: true},
+	}
+	taskCache := rc.TaskCache(pt, "the-hash")
+	writer, err := taskCache.OutputWriter()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("compiled\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	contents, err := taskCache.LogFileName.ReadFile()
+	assert.NoError(t, err)
+	assert.Equal(t, "cache hit, replaying output the-hash\ncompiled\n", string(contents))
+
+	mockUi := cli.NewMockUi()
+	defaultLogReplayer(hclog.NewNullLogger(), &cli.PrefixedUi{Ui: mockUi, OutputPrefix: rc.LogPrefix(pt)}, taskCache.LogFileName)
+	assert.Equal(t, "web:build: cache hit, replaying output the-hash\nweb:build: compiled\n", mockUi.OutputWriter.String())
+}
+
+func TestReplayPrefixedLogs(t *testing.T) {
+	logFile := fs.AbsolutePathFromUpstream(t.TempDir()).Join("turbo-build.log")
+	// Logs cached by older versions of turbo have the prefix on every line
+	assert.NoError(t, logFile.WriteFile([]byte("web:build: cache hit, replaying output the-hash\nweb:build: compiled\n"), 0644))
+
+	mockUi := cli.NewMockUi()
+	defaultLogReplayer(hclog.NewNullLogger(), &cli.PrefixedUi{Ui: mockUi, OutputPrefix: "web: "}, logFile)
+	assert.Equal(t, "web: cache hit, replaying output the-hash\nweb: compiled\n", mockUi.OutputWriter.String())
+}
@@ -44,6 +44,9 @@ func (g *git) ChangedFiles(fromCommit string, toCommit string, includeUntracked
 			// If we error on the check or can't find it, fall back to whatever error git
 			// reported.
 			if exists, err := commitExists(fromCommit); err == nil && !exists {
+				if shallow, err := isShallowRepository(); err == nil && shallow {
+					return nil, fmt.Errorf("commit %v does not exist, and %w", fromCommit, ErrShallowClone)
+				}
 				return nil, fmt.Errorf("commit %v does not exist", fromCommit)
 			}
 			return nil, errors.Wrapf(err, "git comparing with %v", fromCommit)
@@ -75,8 +78,51 @@ func (g *git) ChangedFiles(fromCommit string, toCommit string, includeUntracked
 	return normalized, nil
 }
 
+// _defaultBranchFallbacks are the branches tried, in order, when origin/HEAD isn't set. The
+// remote-tracking branches cover clones, such as those made in CI, that have no local branch.
+var _defaultBranchFallbacks = []string{"main", "origin/main", "master", "origin/master"}
+
+// DefaultBranchMergeBase returns the merge-base of HEAD and the default branch, which is the
+// branch origin/HEAD points to, or else the first of _defaultBranchFallbacks that exists.
+func (g *git) DefaultBranchMergeBase() (string, error) {
+	branch, err := g.defaultBranch()
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command("git", "merge-base", "HEAD", branch)
+	cmd.Dir = g.repoRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: HEAD has no common history with %v", ErrNoMergeBase, branch)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *git) defaultBranch() (string, error) {
+	cmd := exec.Command("git", "symbolic-ref", "--quiet", "refs/remotes/origin/HEAD")
+	cmd.Dir = g.repoRoot
+	out, err := cmd.Output()
+	if err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(string(out)), "refs/remotes/"), nil
+	}
+	for _, branch := range _defaultBranchFallbacks {
+		if exists, err := commitExistsIn(g.repoRoot, branch); err == nil && exists {
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("%w: origin/HEAD isn't set and there is no main or master branch", ErrNoMergeBase)
+}
+
 func commitExists(commit string) (bool, error) {
-	err := exec.Command("git", "cat-file", "-t", commit).Run()
+	return commitExistsIn("", commit)
+}
+
+// commitExistsIn is commitExists for the repository containing dir, or the working
+// directory if dir is empty
+func commitExistsIn(dir string, commit string) (bool, error) {
+	cmd := exec.Command("git", "cat-file", "-t", commit)
+	cmd.Dir = dir
+	err := cmd.Run()
 	if err != nil {
 		exitErr := &exec.ExitError{}
 		if errors.As(err, &exitErr) && exitErr.ExitCode() == 128 {
@@ -87,6 +133,14 @@ func commitExists(commit string) (bool, error) {
 	return true, nil
 }
 
+func isShallowRepository() (bool, error) {
+	out, err := exec.Command("git", "rev-parse", "--is-shallow-repository").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
+
 func (g *git) fixGitRelativePath(worktreePath, relativeTo string) (string, error) {
 	p, err := filepath.Rel(relativeTo, filepath.Join(g.repoRoot, worktreePath))
 	if err != nil {
@@ -0,0 +1,107 @@
+package scm
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a git repository with a single commit on branch, and returns it along
+// with a function that runs git commands in it
+func newTestRepo(t *testing.T, branch string) (*git, func(args ...string) string) {
+	t.Helper()
+	repoRoot := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoRoot
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_NOSYSTEM=1",
+			"HOME="+repoRoot,
+			"GIT_AUTHOR_NAME=test",
+			"GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test",
+			"GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet")
+	run("symbolic-ref", "HEAD", "refs/heads/"+branch)
+	run("commit", "--quiet", "--allow-empty", "-m", "initial")
+	return &git{repoRoot: repoRoot}, run
+}
+
+func TestDefaultBranchMergeBase(t *testing.T) {
+	g, run := newTestRepo(t, "main")
+	base := run("rev-parse", "HEAD")
+	run("checkout", "--quiet", "-b", "feature")
+	run("commit", "--quiet", "--allow-empty", "-m", "feature")
+
+	mergeBase, err := g.DefaultBranchMergeBase()
+	if err != nil {
+		t.Fatalf("DefaultBranchMergeBase: %v", err)
+	}
+	if mergeBase != base {
+		t.Errorf("got merge-base %v, want %v", mergeBase, base)
+	}
+}
+
+func TestDefaultBranchPrefersOriginHEAD(t *testing.T) {
+	g, run := newTestRepo(t, "main")
+	run("update-ref", "refs/remotes/origin/trunk", "HEAD")
+	run("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/trunk")
+
+	branch, err := g.defaultBranch()
+	if err != nil {
+		t.Fatalf("defaultBranch: %v", err)
+	}
+	if branch != "origin/trunk" {
+		t.Errorf("got default branch %v, want origin/trunk", branch)
+	}
+}
+
+func TestDefaultBranchFallbacks(t *testing.T) {
+	// Without origin/HEAD, the fallbacks are tried in order
+	g, run := newTestRepo(t, "master")
+	run("update-ref", "refs/remotes/origin/main", "HEAD")
+	branch, err := g.defaultBranch()
+	if err != nil {
+		t.Fatalf("defaultBranch: %v", err)
+	}
+	if branch != "origin/main" {
+		t.Errorf("got default branch %v, want origin/main, which comes before master", branch)
+	}
+
+	// A CI clone may only have the remote-tracking branch
+	g, run = newTestRepo(t, "feature")
+	run("update-ref", "refs/remotes/origin/master", "HEAD")
+	branch, err = g.defaultBranch()
+	if err != nil {
+		t.Fatalf("defaultBranch: %v", err)
+	}
+	if branch != "origin/master" {
+		t.Errorf("got default branch %v, want origin/master", branch)
+	}
+}
+
+func TestDefaultBranchMissing(t *testing.T) {
+	g, _ := newTestRepo(t, "feature")
+	if _, err := g.DefaultBranchMergeBase(); !errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("expected ErrNoMergeBase without a default branch, got %v", err)
+	}
+}
+
+func TestDefaultBranchMergeBaseUnrelatedHistory(t *testing.T) {
+	g, run := newTestRepo(t, "main")
+	run("checkout", "--quiet", "--orphan", "unrelated")
+	run("commit", "--quiet", "--allow-empty", "-m", "unrelated")
+	if _, err := g.DefaultBranchMergeBase(); !errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("expected ErrNoMergeBase without common history, got %v", err)
+	}
+}
@@ -16,10 +16,18 @@ import (
 
 var ErrFallback = errors.New("cannot find a .git folder. Falling back to manual file hashing (which may be slower). If you are running this build in a pruned directory, you can ignore this message. Otherwise, please initialize a git repository in the root of your monorepo")
 
+// ErrShallowClone is returned when a commit to compare against is missing from a shallow clone
+var ErrShallowClone = errors.New("the repository is a shallow clone")
+
+// ErrNoMergeBase is returned when the point HEAD branched off the default branch can't be found
+var ErrNoMergeBase = errors.New("cannot find where HEAD branched off the default branch")
+
 // An SCM represents an SCM implementation that we can ask for various things.
 type SCM interface {
 	// ChangedFiles returns a list of modified files since the given commit, optionally including untracked files.*/
 	ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error)
+	// DefaultBranchMergeBase returns the commit at which HEAD branched off the repository's default branch
+	DefaultBranchMergeBase() (string, error)
 }
 
 // newGitSCM returns a new SCM instance for this repo root.
@@ -8,3 +8,7 @@ type stub struct{}
 func (s *stub) ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error) {
 	return nil, nil
 }
+
+func (s *stub) DefaultBranchMergeBase() (string, error) {
+	return "", ErrFallback
+}
@@ -110,59 +110,76 @@ func (r *Resolver) filterGraph(selectors []*TargetSelector) (*SelectedPackages,
 
 func (r *Resolver) filterGraphWithSelectors(selectors []*TargetSelector) (*SelectedPackages, error) {
 	unmatchedSelectors := []*TargetSelector{}
+	allPkgs := make(util.Set)
+	for _, selector := range selectors {
+		pkgs, matched, err := r.selectPackages(selector)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			unmatchedSelectors = append(unmatchedSelectors, selector)
+		}
+		for pkg := range pkgs {
+			allPkgs.Add(pkg)
+		}
+	}
+	return &SelectedPackages{
+		pkgs:          allPkgs,
+		unusedFilters: unmatchedSelectors,
+	}, nil
+}
 
+// selectPackages returns the packages selected by a selector, including the dependencies and
+// dependents it walks, and whether it matched any packages. A selector intersected with others
+// selects the packages that all of them select, and has matched if there are any.
+func (r *Resolver) selectPackages(selector *TargetSelector) (util.Set, bool, error) {
 	cherryPickedPackages := make(dag.Set)
 	walkedDependencies := make(dag.Set)
 	walkedDependents := make(dag.Set)
 	walkedDependentsDependencies := make(dag.Set)
 
-	for _, selector := range selectors {
-		// TODO(gsoltis): this should be a list?
-		entryPackages, err := r.filterGraphWithSelector(selector)
-		if err != nil {
-			return nil, err
-		}
-		if entryPackages.Len() == 0 {
-			unmatchedSelectors = append(unmatchedSelectors, selector)
+	// TODO(gsoltis): this should be a list?
+	entryPackages, err := r.filterGraphWithSelector(selector)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, pkg := range entryPackages {
+		if selector.includeDependencies {
+			dependencies, err := r.Graph.Ancestors(pkg)
+			if err != nil {
+				return nil, false, errors.Wrapf(err, "failed to get dependencies of package %v", pkg)
+			}
+			for dep := range dependencies {
+				walkedDependencies.Add(dep)
+			}
+			if !selector.excludeSelf {
+				walkedDependencies.Add(pkg)
+			}
 		}
-		for _, pkg := range entryPackages {
-			if selector.includeDependencies {
-				dependencies, err := r.Graph.Ancestors(pkg)
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to get dependencies of package %v", pkg)
-				}
-				for dep := range dependencies {
-					walkedDependencies.Add(dep)
-				}
-				if !selector.excludeSelf {
-					walkedDependencies.Add(pkg)
-				}
+		if selector.includeDependents {
+			dependents, err := r.Graph.Descendents(pkg)
+			if err != nil {
+				return nil, false, errors.Wrapf(err, "failed to get dependents of package %v", pkg)
 			}
-			if selector.includeDependents {
-				dependents, err := r.Graph.Descendents(pkg)
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to get dependents of package %v", pkg)
-				}
-				for dep := range dependents {
-					walkedDependents.Add(dep)
-					if selector.includeDependencies {
-						dependentDeps, err := r.Graph.Ancestors(dep)
-						if err != nil {
-							return nil, errors.Wrapf(err, "failed to get dependencies of dependent %v", dep)
-						}
-						for dependentDep := range dependentDeps {
-							walkedDependentsDependencies.Add(dependentDep)
-						}
+			for dep := range dependents {
+				walkedDependents.Add(dep)
+				if selector.includeDependencies {
+					dependentDeps, err := r.Graph.Ancestors(dep)
+					if err != nil {
+						return nil, false, errors.Wrapf(err, "failed to get dependencies of dependent %v", dep)
+					}
+					for dependentDep := range dependentDeps {
+						walkedDependentsDependencies.Add(dependentDep)
 					}
-				}
-				if !selector.excludeSelf {
-					walkedDependents.Add(pkg)
 				}
 			}
-			if !selector.includeDependencies && !selector.includeDependents {
-				cherryPickedPackages.Add(pkg)
+			if !selector.excludeSelf {
+				walkedDependents.Add(pkg)
 			}
 		}
+		if !selector.includeDependencies && !selector.includeDependents {
+			cherryPickedPackages.Add(pkg)
+		}
 	}
 	allPkgs := make(util.Set)
 	for pkg := range cherryPickedPackages {
@@ -177,10 +194,16 @@ func (r *Resolver) filterGraphWithSelectors(selectors []*TargetSelector) (*Selec
 	for pkg := range walkedDependentsDependencies {
 		allPkgs.Add(pkg)
 	}
-	return &SelectedPackages{
-		pkgs:          allPkgs,
-		unusedFilters: unmatchedSelectors,
-	}, nil
+	matched := entryPackages.Len() > 0
+	for _, other := range selector.intersect {
+		otherPkgs, _, err := r.selectPackages(other)
+		if err != nil {
+			return nil, false, err
+		}
+		allPkgs = allPkgs.Intersection(otherPkgs)
+		matched = allPkgs.Len() > 0
+	}
+	return allPkgs, matched, nil
 }
 
 func (r *Resolver) filterGraphWithSelector(selector *TargetSelector) (util.Set, error) {
@@ -516,6 +516,70 @@ func Test_SCM(t *testing.T) {
 			},
 			[]string{"package-3"},
 		},
+		{
+			"changed packages intersected with directory",
+			[]*TargetSelector{
+				{
+					fromRef: "HEAD~2",
+					intersect: []*TargetSelector{
+						{
+							parentDir: filepath.Join(root, "package-2*"),
+						},
+					},
+				},
+			},
+			[]string{"package-2"},
+		},
+		{
+			"intersection is unioned with other selectors",
+			[]*TargetSelector{
+				{
+					fromRef: "HEAD~1",
+					intersect: []*TargetSelector{
+						{
+							namePattern: "package-2*",
+						},
+					},
+				},
+				{
+					namePattern: "package-3",
+				},
+			},
+			[]string{"package-2", "package-3"},
+		},
+		{
+			"intersection with dependents",
+			[]*TargetSelector{
+				{
+					namePattern:       "package-20",
+					includeDependents: true,
+					intersect: []*TargetSelector{
+						{
+							fromRef: "HEAD~2",
+						},
+					},
+				},
+			},
+			[]string{"package-3"},
+		},
+		{
+			"excluded intersection",
+			[]*TargetSelector{
+				{
+					fromRef: "HEAD~2",
+				},
+				{
+					fromRef: "HEAD~2",
+					exclude: true,
+					intersect: []*TargetSelector{
+						{
+							parentDir: filepath.Join(root, "package-*"),
+						},
+					},
+				},
+			},
+			[]string{util.RootPkgName},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -527,4 +591,12 @@ func Test_SCM(t *testing.T) {
 			setMatches(t, tc.Name, pkgs.pkgs, tc.Expected)
 		})
 	}
+
+	t.Run("parsed intersection", func(t *testing.T) {
+		pkgs, err := r.GetPackagesFromPatterns([]string{"[HEAD~2]&./package-2*", "package-1"})
+		if err != nil {
+			t.Fatalf("failed to filter packages: %v", err)
+		}
+		setMatches(t, "parsed intersection", pkgs, []string{"package-1", "package-2"})
+	})
 }
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"errors"
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -19,6 +20,9 @@ type TargetSelector struct {
 	fromRef             string
 	toRefOverride       string
 	raw                 string
+	// intersect holds the selectors joined to this one with &. Only the packages selected by
+	// all of them are selected.
+	intersect []*TargetSelector
 }
 
 func (ts *TargetSelector) IsValid() bool {
@@ -36,10 +40,20 @@ func (ts *TargetSelector) getToRef() string {
 
 var errCantMatchDependencies = errors.New("cannot use match dependencies without specifying either a directory or package")
 
+// _intersectionSeparator joins selectors whose packages are intersected, as in [main]&./apps/*
+const _intersectionSeparator = "&"
+
+// commitCountRefRegex matches the `@<n>` form of a git ref, meaning n commits before the
+// upper bound of the comparison
+var commitCountRefRegex = regexp.MustCompile(`^@(\d+)$`)
+
 var targetSelectorRegex = regexp.MustCompile(`^([^.](?:[^{}[\]]*[^{}[\].])?)?(\{[^}]+\})?((?:\.{3})?\[[^\]]+\])?$`)
 
 // ParseTargetSelector is a function that returns pnpm compatible --filter command line flags
 func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, error) {
+	if parts := strings.Split(rawSelector, _intersectionSeparator); len(parts) > 1 {
+		return parseIntersection(rawSelector, parts, prefix)
+	}
 	exclude := false
 	firstChar := rawSelector[0]
 	selector := rawSelector
@@ -116,6 +130,13 @@ func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, err
 				fromRef = refs[0]
 				toRefOverride = refs[1]
 			}
+			if countMatch := commitCountRefRegex.FindStringSubmatch(fromRef); countMatch != nil {
+				toRef := toRefOverride
+				if toRef == "" {
+					toRef = "HEAD"
+				}
+				fromRef = fmt.Sprintf("%v~%v", toRef, countMatch[1])
+			}
 		}
 	}
 
@@ -133,6 +154,36 @@ func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, err
 	}, nil
 }
 
+// parseIntersection parses selectors joined with &. A leading ! excludes the packages in the
+// intersection, so it can't be given for the other selectors.
+func parseIntersection(rawSelector string, parts []string, prefix string) (TargetSelector, error) {
+	exclude := strings.HasPrefix(rawSelector, "!")
+	if exclude {
+		parts[0] = parts[0][1:]
+	}
+	selectors := make([]TargetSelector, len(parts))
+	for i, part := range parts {
+		if part == "" {
+			return TargetSelector{}, fmt.Errorf("invalid selector %v: missing selector next to %v", rawSelector, _intersectionSeparator)
+		}
+		if strings.HasPrefix(part, "!") {
+			return TargetSelector{}, fmt.Errorf("invalid selector %v: only a whole intersection can be excluded, with a ! at its start", rawSelector)
+		}
+		selector, err := ParseTargetSelector(part, prefix)
+		if err != nil {
+			return TargetSelector{}, err
+		}
+		selectors[i] = selector
+	}
+	head := selectors[0]
+	head.exclude = exclude
+	head.raw = rawSelector
+	for i := range selectors[1:] {
+		head.intersect = append(head.intersect, &selectors[i+1])
+	}
+	return head, nil
+}
+
 // isSelectorByLocation returns true if the selector is by filesystem location
 func isSelectorByLocation(rawSelector string) bool {
 	if rawSelector[0:1] != "." {
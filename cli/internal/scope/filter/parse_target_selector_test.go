@@ -194,6 +194,24 @@ func TestParseTargetSelector(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"[@5]",
+			args{"[@5]", "."},
+			TargetSelector{
+				fromRef: "HEAD~5",
+			},
+			false,
+		},
+		{
+			"{foo}[@2...release]",
+			args{"{foo}[@2...release]", "."},
+			TargetSelector{
+				fromRef:       "release~2",
+				toRefOverride: "release",
+				parentDir:     "foo",
+			},
+			false,
+		},
 		{
 			"{foo}[master]",
 			args{"{foo}[master]", "."},
@@ -312,6 +330,48 @@ func TestParseTargetSelector(t *testing.T) {
 			TargetSelector{},
 			true,
 		},
+		{
+			"[master]&./apps/*",
+			args{"[master]&./apps/*", "."},
+			TargetSelector{
+				fromRef: "master",
+				intersect: []*TargetSelector{
+					{
+						parentDir: filepath.Join("apps", "*"),
+						raw:       "./apps/*",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"!foo...&[master]",
+			args{"!foo...&[master]", "."},
+			TargetSelector{
+				exclude:             true,
+				includeDependencies: true,
+				namePattern:         "foo",
+				intersect: []*TargetSelector{
+					{
+						fromRef: "master",
+						raw:     "[master]",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"foo&",
+			args{"foo&", "."},
+			TargetSelector{},
+			true,
+		},
+		{
+			"foo&!bar",
+			args{"foo&!bar", "."},
+			TargetSelector{},
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/hashicorp/go-hclog"
@@ -14,6 +15,7 @@ import (
 	"github.com/vercel/turborepo/cli/internal/fs"
 	"github.com/vercel/turborepo/cli/internal/scm"
 	scope_filter "github.com/vercel/turborepo/cli/internal/scope/filter"
+	"github.com/vercel/turborepo/cli/internal/ui"
 	"github.com/vercel/turborepo/cli/internal/util"
 	"github.com/vercel/turborepo/cli/internal/util/filter"
 )
@@ -51,6 +53,11 @@ type Opts struct {
 	GlobalDepPatterns []string
 	// Patterns are the filter patterns supplied to --filter on the commandline
 	FilterPatterns []string
+	// ErrorOnEmptyScope is whether it is an error for the filters to match no packages
+	ErrorOnEmptyScope bool
+	// Affected is whether to select the packages changed since HEAD branched off the default
+	// branch, along with their dependents
+	Affected bool
 }
 
 var (
@@ -60,8 +67,16 @@ additional documentation and examples can be found in
 turbo's documentation https://turborepo.org/docs/reference/command-line-reference#--filter
 --filter can be specified multiple times. Packages that
 match any filter will be included.`
-	_ignoreHelp    = `Files to ignore when calculating changed files (i.e. --since). Supports globs.`
-	_globalDepHelp = `Specify glob of global filesystem dependencies to be hashed. Useful for .env and files in the root directory.`
+	_ignoreHelp            = `Files to ignore when calculating changed files (i.e. --since). Supports globs.`
+	_globalDepHelp         = `Specify glob of global filesystem dependencies to be hashed. Useful for .env and files in the root directory.`
+	_errorOnEmptyScopeHelp = `Exit with an error if the given filters don't match any
+packages, rather than successfully running nothing.`
+	_affectedHelp = `Select the packages changed since HEAD branched off the
+default branch, and their dependents. The default branch
+is the one origin/HEAD points to, or else main or master.
+This adds a --filter=...[<merge-base>], so like any other
+filter it adds to the packages other filters select
+rather than narrowing them down.`
 )
 
 // AddFlags adds the flags relevant to this package to the given FlagSet
@@ -69,6 +84,8 @@ func AddFlags(opts *Opts, flags *pflag.FlagSet) {
 	flags.StringArrayVar(&opts.FilterPatterns, "filter", nil, _filterHelp)
 	flags.StringArrayVar(&opts.IgnorePatterns, "ignore", nil, _ignoreHelp)
 	flags.StringArrayVar(&opts.GlobalDepPatterns, "global-deps", nil, _globalDepHelp)
+	flags.BoolVar(&opts.ErrorOnEmptyScope, "error-on-empty-scope", false, _errorOnEmptyScopeHelp)
+	flags.BoolVar(&opts.Affected, "affected", false, _affectedHelp)
 	addLegacyFlags(&opts.LegacyFilter, flags)
 }
 
@@ -111,33 +128,61 @@ func (l *LegacyFilter) asFilterPatterns() []string {
 // ResolvePackages translates specified flags to a set of entry point packages for
 // the selected tasks. Returns the selected packages and whether or not the selected
 // packages represents a default "all packages".
-func ResolvePackages(opts *Opts, cwd string, scm scm.SCM, ctx *context.Context, tui cli.Ui, logger hclog.Logger) (util.Set, bool, error) {
+func ResolvePackages(opts *Opts, cwd string, repoSCM scm.SCM, ctx *context.Context, tui cli.Ui, logger hclog.Logger) (util.Set, bool, error) {
 	filterResolver := &scope_filter.Resolver{
 		Graph:                  &ctx.TopologicalGraph,
 		PackageInfos:           ctx.PackageInfos,
 		Cwd:                    cwd,
-		PackagesChangedInRange: opts.getPackageChangeFunc(scm, cwd, ctx.PackageInfos),
+		PackagesChangedInRange: opts.getPackageChangeFunc(repoSCM, cwd, ctx.PackageInfos, tui, logger),
 	}
 	filterPatterns := opts.FilterPatterns
 	legacyFilterPatterns := opts.LegacyFilter.asFilterPatterns()
 	filterPatterns = append(filterPatterns, legacyFilterPatterns...)
+	allAffected := false
+	if opts.Affected {
+		mergeBase, err := repoSCM.DefaultBranchMergeBase()
+		if errors.Is(err, scm.ErrNoMergeBase) || errors.Is(err, scm.ErrFallback) {
+			// Without a base to compare against, err on the side of considering everything affected
+			logger.Warn("falling back to all packages", "warning", err)
+			tui.Warn(fmt.Sprintf("%s %v. Treating every package as affected.", ui.WARNING_PREFIX, err))
+			allAffected = true
+		} else if err != nil {
+			return nil, false, err
+		} else {
+			filterPatterns = append(filterPatterns, fmt.Sprintf("...[%v]", mergeBase))
+		}
+	}
 	isAllPackages := len(filterPatterns) == 0
 	filteredPkgs, err := filterResolver.GetPackagesFromPatterns(filterPatterns)
 	if err != nil {
 		return nil, false, err
 	}
 
-	if isAllPackages {
+	if isAllPackages || allAffected {
 		// no filters specified, run every package
 		for _, f := range ctx.PackageNames {
 			filteredPkgs.Add(f)
 		}
 	}
 	filteredPkgs.Delete(ctx.RootNode)
+	if opts.ErrorOnEmptyScope && filteredPkgs.Len() == 0 {
+		return nil, false, fmt.Errorf("no packages matched the filters %v", strings.Join(filterPatterns, ", "))
+	}
 	return filteredPkgs, isAllPackages, nil
 }
 
-func (o *Opts) getPackageChangeFunc(scm scm.SCM, cwd string, packageInfos map[interface{}]*fs.PackageJSON) scope_filter.PackagesChangedInRange {
+// _ancestorRefRegex matches git refs that count back a number of commits from another ref,
+// such as the HEAD~5 that [@5] resolves to
+var _ancestorRefRegex = regexp.MustCompile(`~\d+$`)
+
+func (o *Opts) getPackageChangeFunc(repoSCM scm.SCM, cwd string, packageInfos map[interface{}]*fs.PackageJSON, tui cli.Ui, logger hclog.Logger) scope_filter.PackagesChangedInRange {
+	allPackages := func() util.Set {
+		allPkgs := make(util.Set)
+		for pkg := range packageInfos {
+			allPkgs.Add(pkg)
+		}
+		return allPkgs
+	}
 	return func(fromRef string, toRef string) (util.Set, error) {
 		// We could filter changed files at the git level, since it's possible
 		// that the changes we're interested in are scoped, but we need to handle
@@ -145,8 +190,14 @@ func (o *Opts) getPackageChangeFunc(scm scm.SCM, cwd string, packageInfos map[in
 		// scope changed files more deeply if we know there are no global dependencies.
 		var changedFiles []string
 		if fromRef != "" {
-			scmChangedFiles, err := scm.ChangedFiles(fromRef, toRef, true, cwd)
-			if err != nil {
+			scmChangedFiles, err := repoSCM.ChangedFiles(fromRef, toRef, true, cwd)
+			if errors.Is(err, scm.ErrShallowClone) && _ancestorRefRegex.MatchString(fromRef) {
+				// The history doesn't go back far enough to tell what changed, so
+				// err on the side of considering everything changed
+				logger.Warn("falling back to all packages", "warning", err)
+				tui.Warn(fmt.Sprintf("%s %v. Treating every package as changed. Fetch more history, e.g. with git fetch --deepen, to filter by changes.", ui.WARNING_PREFIX, err))
+				return allPackages(), nil
+			} else if err != nil {
 				return nil, err
 			}
 			changedFiles = scmChangedFiles
@@ -154,11 +205,7 @@ func (o *Opts) getPackageChangeFunc(scm scm.SCM, cwd string, packageInfos map[in
 		if hasRepoGlobalFileChanged, err := repoGlobalFileHasChanged(o, changedFiles); err != nil {
 			return nil, err
 		} else if hasRepoGlobalFileChanged {
-			allPkgs := make(util.Set)
-			for pkg := range packageInfos {
-				allPkgs.Add(pkg)
-			}
-			return allPkgs, nil
+			return allPackages(), nil
 		}
 		filteredChangedFiles, err := filterIgnoredFiles(o, changedFiles)
 		if err != nil {
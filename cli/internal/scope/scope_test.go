@@ -1,6 +1,7 @@
 package scope
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"reflect"
@@ -10,6 +11,7 @@ import (
 	"github.com/pyr-sh/dag"
 	"github.com/vercel/turborepo/cli/internal/context"
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/scm"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 	"github.com/vercel/turborepo/cli/internal/ui"
 	"github.com/vercel/turborepo/cli/internal/util"
@@ -17,10 +19,21 @@ import (
 
 type mockSCM struct {
 	changed []string
+	err     error
+	// mergeBase and mergeBaseErr are returned by DefaultBranchMergeBase
+	mergeBase    string
+	mergeBaseErr error
+	// fromCommits records the commits changes were requested since
+	fromCommits []string
 }
 
-func (m *mockSCM) ChangedFiles(_fromCommit string, _toCommit string, _includeUntracked bool, _relativeTo string) ([]string, error) {
-	return m.changed, nil
+func (m *mockSCM) ChangedFiles(fromCommit string, _toCommit string, _includeUntracked bool, _relativeTo string) ([]string, error) {
+	m.fromCommits = append(m.fromCommits, fromCommit)
+	return m.changed, m.err
+}
+
+func (m *mockSCM) DefaultBranchMergeBase() (string, error) {
+	return m.mergeBase, m.mergeBaseErr
 }
 
 func TestResolvePackages(t *testing.T) {
@@ -255,3 +268,215 @@ func TestResolvePackages(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvePackagesErrorOnEmptyScope(t *testing.T) {
+	graph := dag.AcyclicGraph{}
+	graph.Add("app0")
+	packagesInfos := map[interface{}]*fs.PackageJSON{
+		"app0": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app0")),
+		},
+	}
+	ctx := &context.Context{
+		PackageInfos:     packagesInfos,
+		PackageNames:     []string{"app0"},
+		TopologicalGraph: graph,
+	}
+	resolve := func(opts *Opts) (util.Set, error) {
+		pkgs, _, err := ResolvePackages(opts, filepath.FromSlash("/dummy/repo/root"), &mockSCM{}, ctx, ui.Default(), hclog.Default())
+		return pkgs, err
+	}
+
+	pkgs, err := resolve(&Opts{FilterPatterns: []string{"app1"}})
+	if err != nil {
+		t.Errorf("expected no error without --error-on-empty-scope, got %v", err)
+	}
+	if pkgs.Len() != 0 {
+		t.Errorf("ResolvePackages got %v, want no packages", pkgs)
+	}
+
+	_, err = resolve(&Opts{FilterPatterns: []string{"app1"}, ErrorOnEmptyScope: true})
+	if err == nil {
+		t.Error("expected an error for a filter that matches no packages")
+	}
+
+	pkgs, err = resolve(&Opts{FilterPatterns: []string{"app0"}, ErrorOnEmptyScope: true})
+	if err != nil {
+		t.Errorf("expected no error for a filter that matches a package, got %v", err)
+	}
+	if !pkgs.Includes("app0") {
+		t.Errorf("ResolvePackages got %v, want app0", pkgs)
+	}
+}
+
+func TestResolvePackagesShallowClone(t *testing.T) {
+	graph := dag.AcyclicGraph{}
+	graph.Add("app0")
+	graph.Add("app1")
+	packagesInfos := map[interface{}]*fs.PackageJSON{
+		"app0": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app0")),
+		},
+		"app1": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app1")),
+		},
+	}
+	ctx := &context.Context{
+		PackageInfos:     packagesInfos,
+		PackageNames:     []string{"app0", "app1"},
+		TopologicalGraph: graph,
+	}
+	shallowSCM := &mockSCM{err: fmt.Errorf("commit HEAD~5 does not exist, and %w", scm.ErrShallowClone)}
+	resolve := func(filter string) (util.Set, error) {
+		pkgs, _, err := ResolvePackages(&Opts{FilterPatterns: []string{filter}}, filepath.FromSlash("/dummy/repo/root"), shallowSCM, ctx, ui.Default(), hclog.Default())
+		return pkgs, err
+	}
+
+	pkgs, err := resolve("[@5]")
+	if err != nil {
+		t.Errorf("expected a fallback for a commit count in a shallow clone, got %v", err)
+	}
+	if pkgs.Len() != 2 {
+		t.Errorf("ResolvePackages got %v, want every package", pkgs)
+	}
+
+	_, err = resolve("[main]")
+	if !errors.Is(err, scm.ErrShallowClone) {
+		t.Errorf("expected the error for a missing branch to be reported, got %v", err)
+	}
+}
+
+func TestResolvePackagesSince(t *testing.T) {
+	// app0 -> libA, app1
+	graph := dag.AcyclicGraph{}
+	graph.Add("app0")
+	graph.Add("app1")
+	graph.Add("libA")
+	graph.Connect(dag.BasicEdge("app0", "libA"))
+	packagesInfos := map[interface{}]*fs.PackageJSON{
+		"app0": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app0")),
+		},
+		"app1": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app1")),
+		},
+		"libA": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("libs/libA")),
+		},
+	}
+	ctx := &context.Context{
+		PackageInfos:     packagesInfos,
+		PackageNames:     []string{"app0", "app1", "libA"},
+		TopologicalGraph: graph,
+	}
+	changedSCM := &mockSCM{changed: []string{filepath.FromSlash("libs/libA/src/index.ts")}}
+	resolve := func(opts *Opts) util.Set {
+		pkgs, isAllPackages, err := ResolvePackages(opts, filepath.FromSlash("/dummy/repo/root"), changedSCM, ctx, ui.Default(), hclog.Default())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if isAllPackages {
+			t.Errorf("expected %v to select a subset of packages", opts)
+		}
+		return pkgs
+	}
+
+	testCases := []struct {
+		name     string
+		legacy   LegacyFilter
+		filters  []string
+		expected []string
+	}{
+		{
+			name:     "--since includes dependents like the ... filter",
+			legacy:   LegacyFilter{Since: "main"},
+			filters:  []string{"...[main]"},
+			expected: []string{"app0", "libA"},
+		},
+		{
+			name:     "--since with --no-deps is the plain diff filter",
+			legacy:   LegacyFilter{Since: "main", SkipDependents: true},
+			filters:  []string{"[main]"},
+			expected: []string{"libA"},
+		},
+		{
+			name:     "--since combines with --filter",
+			legacy:   LegacyFilter{Since: "main", SkipDependents: true},
+			filters:  []string{"[main]", "app1"},
+			expected: []string{"app1", "libA"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var extraFilters []string
+			if len(tc.filters) > 1 {
+				extraFilters = tc.filters[1:]
+			}
+			expected := util.SetFromStrings(tc.expected)
+			withSince := resolve(&Opts{LegacyFilter: tc.legacy, FilterPatterns: extraFilters})
+			if !reflect.DeepEqual(withSince, expected) {
+				t.Errorf("ResolvePackages with --since got %v, want %v", withSince, expected)
+			}
+			withFilter := resolve(&Opts{FilterPatterns: tc.filters})
+			if !reflect.DeepEqual(withFilter, withSince) {
+				t.Errorf("ResolvePackages with --filter=%v got %v, want the same as --since: %v", tc.filters, withFilter, withSince)
+			}
+		})
+	}
+}
+
+func TestResolvePackagesAffected(t *testing.T) {
+	// app0 -> libA, app1
+	graph := dag.AcyclicGraph{}
+	graph.Add("app0")
+	graph.Add("app1")
+	graph.Add("libA")
+	graph.Connect(dag.BasicEdge("app0", "libA"))
+	packagesInfos := map[interface{}]*fs.PackageJSON{
+		"app0": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app0")),
+		},
+		"app1": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("app/app1")),
+		},
+		"libA": {
+			Dir: turbopath.AnchoredSystemPath(filepath.FromSlash("libs/libA")),
+		},
+	}
+	ctx := &context.Context{
+		PackageInfos:     packagesInfos,
+		PackageNames:     []string{"app0", "app1", "libA"},
+		TopologicalGraph: graph,
+	}
+
+	repoSCM := &mockSCM{changed: []string{filepath.FromSlash("libs/libA/src/index.ts")}, mergeBase: "abc123"}
+	pkgs, isAllPackages, err := ResolvePackages(&Opts{Affected: true}, filepath.FromSlash("/dummy/repo/root"), repoSCM, ctx, ui.Default(), hclog.Default())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if isAllPackages {
+		t.Error("expected --affected to select a subset of packages")
+	}
+	if !reflect.DeepEqual(pkgs, util.SetFromStrings([]string{"app0", "libA"})) {
+		t.Errorf("ResolvePackages got %v, want the changed package and its dependents", pkgs)
+	}
+	if !reflect.DeepEqual(repoSCM.fromCommits, []string{"abc123"}) {
+		t.Errorf("expected changes since the merge-base, got changes since %v", repoSCM.fromCommits)
+	}
+
+	for _, mergeBaseErr := range []error{fmt.Errorf("%w: no main branch", scm.ErrNoMergeBase), scm.ErrFallback} {
+		repoSCM := &mockSCM{mergeBaseErr: mergeBaseErr}
+		pkgs, _, err := ResolvePackages(&Opts{Affected: true}, filepath.FromSlash("/dummy/repo/root"), repoSCM, ctx, ui.Default(), hclog.Default())
+		if err != nil {
+			t.Errorf("expected a fallback for %v, got %v", mergeBaseErr, err)
+		}
+		if pkgs.Len() != 3 {
+			t.Errorf("ResolvePackages got %v, want every package when %v", pkgs, mergeBaseErr)
+		}
+	}
+
+	repoSCM = &mockSCM{mergeBaseErr: errors.New("git exploded")}
+	if _, _, err := ResolvePackages(&Opts{Affected: true}, filepath.FromSlash("/dummy/repo/root"), repoSCM, ctx, ui.Default(), hclog.Default()); err == nil {
+		t.Error("expected other errors finding the merge-base to be reported")
+	}
+}
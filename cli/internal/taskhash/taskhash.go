@@ -5,12 +5,13 @@ package taskhash
 
 import (
 	"fmt"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
 
 	"github.com/pyr-sh/dag"
-	gitignore "github.com/sabhiram/go-gitignore"
 	"github.com/vercel/turborepo/cli/internal/doublestar"
 	"github.com/vercel/turborepo/cli/internal/env"
 	"github.com/vercel/turborepo/cli/internal/fs"
@@ -35,19 +36,68 @@ type Tracker struct {
 	mu                  sync.RWMutex
 	packageInputsHashes packageFileHashes
 	packageTaskHashes   map[string]string // taskID -> hash
+	packageTaskInputs   map[string]*taskHashInputs
+	packageTaskFileKeys map[string]packageFileHashKey
+	packageTaskOutputs  map[string][]turbopath.AnchoredSystemPath
+	defaultInputs       hashing.DefaultInputs
+	// frameworkEnvPrefixes replaces the env prefixes of inferred frameworks, keyed by slug
+	frameworkEnvPrefixes map[string][]string
+	// useRepoTree lists the checked in files of every package from one `git ls-tree` of the repo
+	useRepoTree bool
+	// useTsconfigInputs adds globs from each package's tsconfig.json to the inputs of its tasks
+	useTsconfigInputs bool
+	tsconfigInputs    map[string][]string // package name -> input globs
+	// recordFileHashes keeps the hash of each file of each package-inputs combination
+	recordFileHashes   bool
+	packageInputsFiles map[packageFileHashKey]map[turbopath.AnchoredUnixPath]string
+	// repoRoot is where file hashes were calculated, so that VerifyTaskHash can rehash them
+	repoRoot turbopath.AbsolutePath
 }
 
 // NewTracker creates a tracker for package-inputs combinations and package-task combinations.
 func NewTracker(rootNode string, globalHash string, pipeline fs.Pipeline, packageInfos map[interface{}]*fs.PackageJSON) *Tracker {
 	return &Tracker{
-		rootNode:          rootNode,
-		globalHash:        globalHash,
-		pipeline:          pipeline,
-		packageInfos:      packageInfos,
-		packageTaskHashes: make(map[string]string),
+		rootNode:            rootNode,
+		globalHash:          globalHash,
+		pipeline:            pipeline,
+		packageInfos:        packageInfos,
+		packageTaskHashes:   make(map[string]string),
+		packageTaskInputs:   make(map[string]*taskHashInputs),
+		packageTaskFileKeys: make(map[string]packageFileHashKey),
+		packageTaskOutputs:  make(map[string][]turbopath.AnchoredSystemPath),
 	}
 }
 
+// SetDefaultInputs sets the policy for which files are hashed for tasks that don't declare inputs.
+// It must be called before CalculateFileHashes.
+func (th *Tracker) SetDefaultInputs(defaultInputs hashing.DefaultInputs) {
+	th.defaultInputs = defaultInputs
+}
+
+// SetFrameworkEnvPrefixes sets the prefixes of the env vars hashed for tasks of each inferred
+// framework, replacing the built-in ones of the frameworks it lists.
+func (th *Tracker) SetFrameworkEnvPrefixes(frameworkEnvPrefixes map[string][]string) {
+	th.frameworkEnvPrefixes = frameworkEnvPrefixes
+}
+
+// RecordFileHashes keeps the hash of each input file, so that the breakdown of a task's hash
+// can list them. Must be called before CalculateFileHashes.
+func (th *Tracker) RecordFileHashes() {
+	th.recordFileHashes = true
+}
+
+// UseRepoTree lists the files checked in to packages without inputs from a single
+// `git ls-tree` of the repository. It must be called before CalculateFileHashes.
+func (th *Tracker) UseRepoTree() {
+	th.useRepoTree = true
+}
+
+// UseTsconfigInputs adds input globs derived from each package's tsconfig.json to the
+// inputs of its tasks that declare inputs. It must be called before CalculateFileHashes.
+func (th *Tracker) UseTsconfigInputs() {
+	th.useTsconfigInputs = true
+}
+
 // packageFileSpec defines a combination of a package and optional set of input globs
 type packageFileSpec struct {
 	pkg    string
@@ -70,25 +120,29 @@ func (pfs packageFileSpec) ToKey() packageFileHashKey {
 	return packageFileHashKey(fmt.Sprintf("%v#%v", pfs.pkg, strings.Join(pfs.inputs, "!")))
 }
 
-func safeCompileIgnoreFile(filepath string) (*gitignore.GitIgnore, error) {
-	if fs.FileExists(filepath) {
-		return gitignore.CompileIgnoreFile(filepath)
+// _defaultInputsToken in a task's inputs stands for the files that would be hashed if the
+// task declared no inputs, so that inputs can add to the default rather than replace it
+const _defaultInputsToken = "$TURBO_DEFAULT$"
+
+// splitDefaultInputs separates the default inputs token from the rest of the inputs, and
+// returns whether the default files are hashed. That is the case when there are no inputs too.
+func splitDefaultInputs(inputs []string) ([]string, bool) {
+	extraInputs := make([]string, 0, len(inputs))
+	useDefault := len(inputs) == 0
+	for _, input := range inputs {
+		if input == _defaultInputsToken {
+			useDefault = true
+		} else {
+			extraInputs = append(extraInputs, input)
+		}
 	}
-	// no op
-	return gitignore.CompileIgnoreLines([]string{}...), nil
+	return extraInputs, useDefault
 }
 
-func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.AbsolutePath) (string, error) {
-	hashObject, pkgDepsErr := hashing.GetPackageDeps(repoRoot, &hashing.PackageDepsOptions{
-		PackagePath:   pkg.Dir,
-		InputPatterns: pfs.inputs,
-	})
-	if pkgDepsErr != nil {
-		manualHashObject, err := manuallyHashPackage(pkg, pfs.inputs, repoRoot)
-		if err != nil {
-			return "", err
-		}
-		hashObject = manualHashObject
+func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.AbsolutePath, depsOpts hashing.PackageDepsOptions) (string, error) {
+	hashObject, err := pfs.hashObject(pkg, repoRoot, depsOpts)
+	if err != nil {
+		return "", err
 	}
 	hashOfFiles, otherErr := fs.HashObject(hashObject)
 	if otherErr != nil {
@@ -97,56 +151,67 @@ func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.Absolut
 	return hashOfFiles, nil
 }
 
-func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath turbopath.AbsolutePath) (map[turbopath.AnchoredUnixPath]string, error) {
-	hashObject := make(map[turbopath.AnchoredUnixPath]string)
-	// Instead of implementing all gitignore properly, we hack it. We only respect .gitignore in the root and in
-	// the directory of a package.
-	ignore, err := safeCompileIgnoreFile(rootPath.Join(".gitignore").ToString())
-	if err != nil {
-		return nil, err
+// hashObject hashes each of the package files matched by the spec. depsOpts holds the options
+// shared by every package, the package path and inputs are filled in from the spec.
+func (pfs *packageFileSpec) hashObject(pkg *fs.PackageJSON, repoRoot turbopath.AbsolutePath, depsOpts hashing.PackageDepsOptions) (map[turbopath.AnchoredUnixPath]string, error) {
+	extraInputs, useDefault := splitDefaultInputs(pfs.inputs)
+	if !useDefault {
+		return hashPackageFiles(pkg, extraInputs, repoRoot, depsOpts)
 	}
-
-	ignorePkg, err := safeCompileIgnoreFile(rootPath.Join(pkg.Dir.ToStringDuringMigration(), ".gitignore").ToString())
+	hashObject, err := hashPackageFiles(pkg, nil, repoRoot, depsOpts)
 	if err != nil {
 		return nil, err
 	}
-
-	includePattern := ""
-	if len(inputs) > 0 {
-		includePattern = "{" + strings.Join(inputs, ",") + "}"
-	}
-
-	pathPrefix := rootPath.Join(pkg.Dir.ToStringDuringMigration()).ToString()
-	convertedPathPrefix := turbopath.AbsoluteSystemPathFromUpstream(pathPrefix)
-	fs.Walk(pathPrefix, func(name string, isDir bool) error {
-		convertedName := turbopath.AbsoluteSystemPathFromUpstream(name)
-		rootMatch := ignore.MatchesPath(convertedName.ToString())
-		otherMatch := ignorePkg.MatchesPath(convertedName.ToString())
-		if !rootMatch && !otherMatch {
-			if !isDir {
-				if includePattern != "" {
-					val, err := doublestar.PathMatch(includePattern, convertedName.ToString())
-					if err != nil {
-						return err
-					}
-					if !val {
-						return nil
-					}
-				}
-				hash, err := fs.GitLikeHashFile(convertedName.ToString())
-				if err != nil {
-					return fmt.Errorf("could not hash file %v. \n%w", convertedName.ToString(), err)
-				}
-
-				relativePath, err := convertedName.RelativeTo(convertedPathPrefix)
-				if err != nil {
-					return fmt.Errorf("File path cannot be made relative: %w", err)
-				}
-				hashObject[relativePath.ToUnixPath()] = hash
+	// Negated globs such as "!**/*.md" can only remove files once the default is expanded
+	includes, negations := splitNegatedInputs(extraInputs)
+	if len(includes) > 0 {
+		extraHashObject, err := hashPackageFiles(pkg, includes, repoRoot, depsOpts)
+		if err != nil {
+			return nil, err
+		}
+		for path, hash := range extraHashObject {
+			hashObject[path] = hash
+		}
+	}
+	for path := range hashObject {
+		for _, negation := range negations {
+			if matches, err := doublestar.Match(negation, path.ToString()); err != nil {
+				return nil, fmt.Errorf("invalid input glob !%v: %w", negation, err)
+			} else if matches {
+				delete(hashObject, path)
+				break
 			}
 		}
-		return nil
-	})
+	}
+	return hashObject, nil
+}
+
+// splitNegatedInputs separates globs prefixed with "!" from the rest of the inputs, and returns
+// them without the prefix
+func splitNegatedInputs(inputs []string) ([]string, []string) {
+	includes := make([]string, 0, len(inputs))
+	negations := []string{}
+	for _, input := range inputs {
+		if strings.HasPrefix(input, "!") {
+			negations = append(negations, filepath.ToSlash(strings.TrimPrefix(input, "!")))
+		} else {
+			includes = append(includes, input)
+		}
+	}
+	return includes, negations
+}
+
+// hashPackageFiles hashes the files of the package matching the given inputs, or the default
+// set of files if there are none
+func hashPackageFiles(pkg *fs.PackageJSON, inputs []string, repoRoot turbopath.AbsolutePath, depsOpts hashing.PackageDepsOptions) (map[turbopath.AnchoredUnixPath]string, error) {
+	depsOpts.PackagePath = pkg.Dir
+	depsOpts.InputPatterns = inputs
+	hashObject, pkgDepsErr := hashing.GetPackageDeps(repoRoot, &depsOpts)
+	if pkgDepsErr != nil {
+		// The repository may not be a git checkout, hash the package's files directly
+		depsOpts.NoGit = true
+		return hashing.GetPackageDeps(repoRoot, &depsOpts)
+	}
 	return hashObject, nil
 }
 
@@ -158,6 +223,7 @@ type packageFileHashes map[packageFileHashKey]string
 // in the task graph. Must be called before calculating task hashes.
 func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, repoRoot turbopath.AbsolutePath) error {
 	hashTasks := make(util.Set)
+	th.tsconfigInputs = make(map[string][]string)
 
 	for _, v := range allTasks {
 		taskID, ok := v.(string)
@@ -177,15 +243,30 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 			return fmt.Errorf("missing pipeline entry %v", taskID)
 		}
 
+		if _, ok := th.tsconfigInputs[pkgName]; th.useTsconfigInputs && !ok {
+			pkg, ok := th.packageInfos[pkgName]
+			if !ok {
+				return fmt.Errorf("cannot find package %v", pkgName)
+			}
+			inputs, err := readTsconfigInputs(repoRoot.Join(pkg.Dir.ToStringDuringMigration()))
+			if err != nil {
+				return err
+			}
+			th.tsconfigInputs[pkgName] = inputs
+		}
+
 		pfs := &packageFileSpec{
 			pkg:    pkgName,
-			inputs: taskDefinition.Inputs,
+			inputs: th.withTsconfigInputs(pkgName, taskDefinition.Inputs),
 		}
 
 		hashTasks.Add(pfs)
 	}
 
+	th.repoRoot = repoRoot
+	depsOpts := th.packageDepsOptions()
 	hashes := make(map[packageFileHashKey]string)
+	files := make(map[packageFileHashKey]map[turbopath.AnchoredUnixPath]string)
 	hashQueue := make(chan *packageFileSpec, workerCount)
 	hashErrs := &errgroup.Group{}
 
@@ -196,13 +277,20 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 				if !ok {
 					return fmt.Errorf("cannot find package %v", packageFileSpec.pkg)
 				}
-				hash, err := packageFileSpec.hash(pkg, repoRoot)
+				hashObject, err := packageFileSpec.hashObject(pkg, repoRoot, depsOpts)
+				if err != nil {
+					return err
+				}
+				hash, err := fs.HashObject(hashObject)
 				if err != nil {
 					return err
 				}
 				th.mu.Lock()
 				pfsKey := packageFileSpec.ToKey()
 				hashes[pfsKey] = hash
+				if th.recordFileHashes {
+					files[pfsKey] = hashObject
+				}
 				th.mu.Unlock()
 			}
 			return nil
@@ -217,9 +305,18 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 		return err
 	}
 	th.packageInputsHashes = hashes
+	th.packageInputsFiles = files
 	return nil
 }
 
+// packageDepsOptions returns the options shared by every package when hashing package files
+func (th *Tracker) packageDepsOptions() hashing.PackageDepsOptions {
+	return hashing.PackageDepsOptions{
+		DefaultInputs: th.defaultInputs,
+		UseRepoTree:   th.useRepoTree,
+	}
+}
+
 type taskHashInputs struct {
 	hashOfFiles          string
 	externalDepsHash     string
@@ -229,6 +326,37 @@ type taskHashInputs struct {
 	hashableEnvPairs     []string
 	globalHash           string
 	taskDependencyHashes []string
+	cacheScope           fs.CacheScope
+	defaultInputs        hashing.DefaultInputs
+}
+
+// hashable returns what is hashed for these inputs. defaultInputs is left out when it doesn't
+// apply, so that the hashes of those tasks are the same as before it was part of the hash.
+func (i *taskHashInputs) hashable() interface{} {
+	if i.defaultInputs != "" {
+		return i
+	}
+	return &struct {
+		hashOfFiles          string
+		externalDepsHash     string
+		task                 string
+		outputs              []string
+		passThruArgs         []string
+		hashableEnvPairs     []string
+		globalHash           string
+		taskDependencyHashes []string
+		cacheScope           fs.CacheScope
+	}{
+		hashOfFiles:          i.hashOfFiles,
+		externalDepsHash:     i.externalDepsHash,
+		task:                 i.task,
+		outputs:              i.outputs,
+		passThruArgs:         i.passThruArgs,
+		hashableEnvPairs:     i.hashableEnvPairs,
+		globalHash:           i.globalHash,
+		taskDependencyHashes: i.taskDependencyHashes,
+		cacheScope:           i.cacheScope,
+	}
 }
 
 func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, error) {
@@ -263,27 +391,164 @@ func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, e
 // that it has previously been called on its task-graph dependencies. File hashes must be calculated
 // first.
 func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencySet dag.Set, args []string) (string, error) {
+	inputs, err := th.calculateTaskHashInputs(packageTask, dependencySet, args)
+	if err != nil {
+		return "", err
+	}
+	hash, err := fs.HashObject(inputs.hashable())
+	if err != nil {
+		return "", fmt.Errorf("failed to hash task %v: %w", packageTask.TaskID, err)
+	}
+	th.mu.Lock()
+	th.packageTaskHashes[packageTask.TaskID] = hash
+	th.packageTaskInputs[packageTask.TaskID] = inputs
+	th.packageTaskFileKeys[packageTask.TaskID] = th.fileHashKey(packageTask)
+	th.mu.Unlock()
+	return hash, nil
+}
+
+// VerifyTaskHash recalculates the hash for a package-task, including rehashing its input files,
+// and returns an error listing the inputs that changed if it no longer matches the hash
+// previously returned by CalculateTaskHash.
+func (th *Tracker) VerifyTaskHash(packageTask *nodes.PackageTask, dependencySet dag.Set, args []string) error {
+	th.mu.RLock()
+	hash, hashOk := th.packageTaskHashes[packageTask.TaskID]
+	previous, inputsOk := th.packageTaskInputs[packageTask.TaskID]
+	th.mu.RUnlock()
+	if !hashOk || !inputsOk {
+		return fmt.Errorf("cannot verify hash for %v, it has not been calculated", packageTask.TaskID)
+	}
+	inputs, err := th.calculateTaskHashInputs(packageTask, dependencySet, args)
+	if err != nil {
+		return err
+	}
+	pkg, ok := th.packageInfos[packageTask.PackageName]
+	if !ok {
+		return fmt.Errorf("cannot find package %v", packageTask.PackageName)
+	}
 	pfs := specFromPackageTask(packageTask)
-	pkgFileHashKey := pfs.ToKey()
+	pfs.inputs = th.withTsconfigInputs(pfs.pkg, pfs.inputs)
+	inputs.hashOfFiles, err = pfs.hash(pkg, th.repoRoot, th.packageDepsOptions())
+	if err != nil {
+		return fmt.Errorf("failed to rehash files of %v: %w", packageTask.TaskID, err)
+	}
+	rehash, err := fs.HashObject(inputs.hashable())
+	if err != nil {
+		return fmt.Errorf("failed to hash task %v: %w", packageTask.TaskID, err)
+	}
+	if rehash == hash {
+		return nil
+	}
+	return fmt.Errorf("non-deterministic hash for %v: calculated %v, then %v. Differing inputs:\n%v", packageTask.TaskID, hash, rehash, strings.Join(diffTaskHashInputs(previous, inputs), "\n"))
+}
 
+// diffTaskHashInputs describes each field that differs between two sets of hash inputs
+func diffTaskHashInputs(before *taskHashInputs, after *taskHashInputs) []string {
+	beforeValue := reflect.ValueOf(*before)
+	afterValue := reflect.ValueOf(*after)
+	diffs := []string{}
+	for i := 0; i < beforeValue.NumField(); i++ {
+		beforeField := fmt.Sprintf("%v", beforeValue.Field(i))
+		afterField := fmt.Sprintf("%v", afterValue.Field(i))
+		if beforeField != afterField {
+			diffs = append(diffs, fmt.Sprintf("  %v: %v != %v", beforeValue.Type().Field(i).Name, beforeField, afterField))
+		}
+	}
+	return diffs
+}
+
+// TaskHashBreakdown is what went into the hash of a package-task, so that a later run can
+// explain why its hash is different. Env var values are hashed with a secret key so that
+// they aren't written to disk.
+type TaskHashBreakdown struct {
+	Hash        string `json:"hash"`
+	HashOfFiles string `json:"hashOfFiles"`
+	// FileHashes are the hashes of the package-relative input files. They are only recorded
+	// when RecordFileHashes was called.
+	FileHashes       map[string]string `json:"fileHashes,omitempty"`
+	ExternalDepsHash string            `json:"externalDepsHash"`
+	EnvVarHashes     map[string]string `json:"envVarHashes"`
+	DependencyHashes []string          `json:"dependencyHashes"`
+	GlobalHash       string            `json:"globalHash"`
+	Outputs          []string          `json:"outputs"`
+	PassThroughArgs  []string          `json:"passThroughArgs"`
+	// CacheScope is a plain string, since fs.CacheScope only unmarshals the values of "cache"
+	CacheScope    string                `json:"cacheScope"`
+	DefaultInputs hashing.DefaultInputs `json:"defaultInputs"`
+}
+
+// GetTaskHashBreakdown returns what went into the hash of the given package-task, if it has
+// been calculated. Env var values are hashed with envVarKey.
+func (th *Tracker) GetTaskHashBreakdown(taskID string, envVarKey []byte) (*TaskHashBreakdown, error) {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	hash, hashOk := th.packageTaskHashes[taskID]
+	inputs, inputsOk := th.packageTaskInputs[taskID]
+	if !hashOk || !inputsOk {
+		return nil, fmt.Errorf("cannot break down the hash of %v, it has not been calculated", taskID)
+	}
+	envVarHashes := make(map[string]string, len(inputs.hashableEnvPairs))
+	for _, pair := range inputs.hashableEnvPairs {
+		kv := strings.SplitN(pair, "=", 2)
+		envVarHashes[kv[0]] = fs.HashSecretValue(envVarKey, kv[1])
+	}
+	breakdown := &TaskHashBreakdown{
+		Hash:             hash,
+		HashOfFiles:      inputs.hashOfFiles,
+		ExternalDepsHash: inputs.externalDepsHash,
+		EnvVarHashes:     envVarHashes,
+		DependencyHashes: inputs.taskDependencyHashes,
+		GlobalHash:       inputs.globalHash,
+		Outputs:          inputs.outputs,
+		PassThroughArgs:  inputs.passThruArgs,
+		CacheScope:       string(inputs.cacheScope),
+		DefaultInputs:    inputs.defaultInputs,
+	}
+	if files, ok := th.packageInputsFiles[th.packageTaskFileKeys[taskID]]; ok {
+		breakdown.FileHashes = make(map[string]string, len(files))
+		for path, fileHash := range files {
+			breakdown.FileHashes[path.ToString()] = fileHash
+		}
+	}
+	return breakdown, nil
+}
+
+// fileHashKey returns the key of the package-inputs combination hashed for a package-task
+func (th *Tracker) fileHashKey(packageTask *nodes.PackageTask) packageFileHashKey {
+	pfs := specFromPackageTask(packageTask)
+	pfs.inputs = th.withTsconfigInputs(pfs.pkg, pfs.inputs)
+	return pfs.ToKey()
+}
+
+// calculateTaskHashInputs gathers everything that contributes to the hash of a package-task
+func (th *Tracker) calculateTaskHashInputs(packageTask *nodes.PackageTask, dependencySet dag.Set, args []string) (*taskHashInputs, error) {
+	pkgFileHashKey := th.fileHashKey(packageTask)
+
+	th.mu.RLock()
 	hashOfFiles, ok := th.packageInputsHashes[pkgFileHashKey]
+	th.mu.RUnlock()
 	if !ok {
-		return "", fmt.Errorf("cannot find package-file hash for %v", pkgFileHashKey)
+		return nil, fmt.Errorf("cannot find package-file hash for %v", pkgFileHashKey)
 	}
 
 	var envPrefixes []string
-	framework := inference.InferFramework(packageTask.Pkg)
-	if framework != nil && framework.EnvPrefix != "" {
-		envPrefixes = append(envPrefixes, framework.EnvPrefix)
+	if framework := inference.InferFramework(packageTask.Pkg); framework != nil {
+		envPrefixes = framework.EnvPrefixes(th.frameworkEnvPrefixes)
 	}
 
 	hashableEnvPairs := env.GetHashableEnvPairs(packageTask.TaskDefinition.EnvVarDependencies, envPrefixes)
 	outputs := packageTask.HashableOutputs()
 	taskDependencyHashes, err := th.calculateDependencyHashes(dependencySet)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	hash, err := fs.HashObject(&taskHashInputs{
+	// The default inputs policy only changes the hashed files of tasks that hash the default files,
+	// and hashing every file is what turbo did before the policy could be chosen
+	var defaultInputs hashing.DefaultInputs
+	if _, useDefault := splitDefaultInputs(packageTask.TaskDefinition.Inputs); useDefault && th.defaultInputs != hashing.DefaultInputsAll {
+		defaultInputs = th.defaultInputs
+	}
+	return &taskHashInputs{
 		hashOfFiles:          hashOfFiles,
 		externalDepsHash:     packageTask.Pkg.ExternalDepsHash,
 		task:                 packageTask.Task,
@@ -292,12 +557,26 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 		hashableEnvPairs:     hashableEnvPairs,
 		globalHash:           th.globalHash,
 		taskDependencyHashes: taskDependencyHashes,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to hash task %v: %v", packageTask.TaskID, hash)
-	}
+		cacheScope:           packageTask.TaskDefinition.CacheScope.Hashed(),
+		defaultInputs:        defaultInputs,
+	}, nil
+}
+
+// SetExpandedOutputs records the repo-relative files produced by the given package-task
+func (th *Tracker) SetExpandedOutputs(taskID string, outputs []turbopath.AnchoredSystemPath) {
 	th.mu.Lock()
-	th.packageTaskHashes[packageTask.TaskID] = hash
-	th.mu.Unlock()
-	return hash, nil
+	defer th.mu.Unlock()
+	th.packageTaskOutputs[taskID] = outputs
+}
+
+// GetExpandedOutputs returns the repo-relative files produced by the given package-task,
+// if they have been recorded
+func (th *Tracker) GetExpandedOutputs(taskID string) []turbopath.AnchoredSystemPath {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	outputs, ok := th.packageTaskOutputs[taskID]
+	if !ok {
+		return []turbopath.AnchoredSystemPath{}
+	}
+	return outputs
 }
@@ -1,138 +1,335 @@
 package taskhash
 
 import (
-	"os"
-	"path/filepath"
+	"os/exec"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
+	"github.com/pyr-sh/dag"
 	"github.com/vercel/turborepo/cli/internal/fs"
+	"github.com/vercel/turborepo/cli/internal/hashing"
+	"github.com/vercel/turborepo/cli/internal/nodes"
 	"github.com/vercel/turborepo/cli/internal/turbopath"
 )
 
-func Test_manuallyHashPackage(t *testing.T) {
-	rootIgnore := strings.Join([]string{
-		"ignoreme",
-		"ignorethisdir/",
-	}, "\n")
-	pkgIgnore := strings.Join([]string{
-		"pkgignoreme",
-		"pkgignorethisdir/",
-	}, "\n")
-	root, err := os.MkdirTemp("", "turbo-manual-file-hashing-")
-	if err != nil {
-		t.Fatalf("failed to create temp dir: %v", err)
-	}
-	repoRoot := turbopath.AbsoluteSystemPathFromUpstream(root)
-	pkgName := turbopath.AnchoredSystemPath("libA")
-	type fileHash struct {
-		contents string
-		hash     string
-	}
-	files := map[turbopath.AnchoredUnixPath]fileHash{
-		"top-level-file":              {"top-level-file-contents", ""},
-		"other-dir/other-dir-file":    {"other-dir-file-contents", ""},
-		"ignoreme":                    {"anything", ""},
-		"libA/some-file":              {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
-		"libA/some-dir/other-file":    {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
-		"libA/some-dir/another-one":   {"some-file-contents", "7e59c6a6ea9098c6d3beb00e753e2c54ea502311"},
-		"libA/ignoreme":               {"anything", ""},
-		"libA/ignorethisdir/anything": {"anything", ""},
-		"libA/pkgignoreme":            {"anything", ""},
-		"libA/pkgignorethisdir/file":  {"anything", ""},
-	}
-
-	rootIgnoreFile, err := os.Create(repoRoot.Join(".gitignore").ToString())
-	if err != nil {
-		t.Fatalf("failed to create .gitignore: %v", err)
+func Test_VerifyTaskHash(t *testing.T) {
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	pkg := &fs.PackageJSON{Name: "libA", Dir: turbopath.AnchoredSystemPath("libA")}
+	srcFile := repoRoot.Join("libA", "src.js")
+	if err := srcFile.EnsureDir(); err != nil {
+		t.Fatalf("EnsureDir: %v", err)
+	}
+	if err := srcFile.WriteFile([]byte("console.log(1)"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	taskDefinition := fs.TaskDefinition{
+		EnvVarDependencies: []string{"TURBO_TEST_BUILD_TIME"},
+	}
+	packageTask := &nodes.PackageTask{
+		TaskID:         "libA#build",
+		Task:           "build",
+		PackageName:    "libA",
+		Pkg:            pkg,
+		TaskDefinition: &taskDefinition,
+	}
+	pipeline := fs.Pipeline{"build": taskDefinition}
+	tracker := NewTracker("root", "global-hash", pipeline, map[interface{}]*fs.PackageJSON{"libA": pkg})
+	if err := tracker.CalculateFileHashes([]dag.Vertex{packageTask.TaskID}, 1, repoRoot); err != nil {
+		t.Fatalf("CalculateFileHashes: %v", err)
+	}
+
+	t.Setenv("TURBO_TEST_BUILD_TIME", "1")
+	if _, err := tracker.CalculateTaskHash(packageTask, nil, nil); err != nil {
+		t.Fatalf("CalculateTaskHash: %v", err)
+	}
+	if err := tracker.VerifyTaskHash(packageTask, nil, nil); err != nil {
+		t.Errorf("expected the hash to be stable, got %v", err)
 	}
-	_, err = rootIgnoreFile.WriteString(rootIgnore)
+
+	t.Setenv("TURBO_TEST_BUILD_TIME", "2")
+	err := tracker.VerifyTaskHash(packageTask, nil, nil)
+	if err == nil {
+		t.Fatal("expected a changed env var to be reported as a non-deterministic hash")
+	}
+	if !strings.Contains(err.Error(), "hashableEnvPairs: [TURBO_TEST_BUILD_TIME=1] != [TURBO_TEST_BUILD_TIME=2]") {
+		t.Errorf("expected the differing env var in the error, got %v", err)
+	}
+
+	t.Setenv("TURBO_TEST_BUILD_TIME", "1")
+	if err := srcFile.WriteFile([]byte("console.log(2)"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	err = tracker.VerifyTaskHash(packageTask, nil, nil)
+	if err == nil {
+		t.Fatal("expected a changed input file to be reported as a non-deterministic hash")
+	}
+	if !strings.Contains(err.Error(), "hashOfFiles:") {
+		t.Errorf("expected the differing file hash in the error, got %v", err)
+	}
+}
+
+func Test_GetTaskHashBreakdown(t *testing.T) {
+	packageTask := &nodes.PackageTask{
+		TaskID:      "libA#build",
+		Task:        "build",
+		PackageName: "libA",
+		Pkg:         &fs.PackageJSON{Name: "libA"},
+		TaskDefinition: &fs.TaskDefinition{
+			EnvVarDependencies: []string{"TURBO_TEST_API_URL"},
+		},
+	}
+	tracker := NewTracker("root", "global-hash", fs.Pipeline{}, nil)
+	key := specFromPackageTask(packageTask).ToKey()
+	tracker.packageInputsHashes = packageFileHashes{key: "file-hash"}
+	tracker.packageInputsFiles = map[packageFileHashKey]map[turbopath.AnchoredUnixPath]string{
+		key: {"src/index.ts": "index-hash"},
+	}
+
+	if _, err := tracker.GetTaskHashBreakdown(packageTask.TaskID, []byte("key")); err == nil {
+		t.Error("expected an error breaking down a hash that has not been calculated")
+	}
+	t.Setenv("TURBO_TEST_API_URL", "https://example.com")
+	hash, err := tracker.CalculateTaskHash(packageTask, nil, []string{"--verbose"})
 	if err != nil {
-		t.Fatalf("failed to write contents to .gitignore: %v", err)
+		t.Fatalf("CalculateTaskHash: %v", err)
 	}
-	rootIgnoreFile.Close()
-	pkgIgnoreFilename := pkgName.RestoreAnchor(repoRoot).Join(".gitignore")
-	err = fs.EnsureDir(pkgIgnoreFilename.ToString())
+	breakdown, err := tracker.GetTaskHashBreakdown(packageTask.TaskID, []byte("key"))
 	if err != nil {
-		t.Fatalf("failed to ensure directories for %v: %v", pkgIgnoreFilename, err)
+		t.Fatalf("GetTaskHashBreakdown: %v", err)
+	}
+	valueHash := fs.HashSecretValue([]byte("key"), "https://example.com")
+	want := &TaskHashBreakdown{
+		Hash:             hash,
+		HashOfFiles:      "file-hash",
+		FileHashes:       map[string]string{"src/index.ts": "index-hash"},
+		EnvVarHashes:     map[string]string{"TURBO_TEST_API_URL": valueHash},
+		DependencyHashes: []string{},
+		GlobalHash:       "global-hash",
+		Outputs:          packageTask.HashableOutputs(),
+		PassThroughArgs:  []string{"--verbose"},
 	}
-	pkgIgnoreFile, err := os.Create(pkgIgnoreFilename.ToString())
+	if !reflect.DeepEqual(breakdown, want) {
+		t.Errorf("GetTaskHashBreakdown() = %#v, want %#v", breakdown, want)
+	}
+}
+
+func Test_readTsconfigInputs(t *testing.T) {
+	pkgDir := fs.AbsolutePathFromUpstream(t.TempDir())
+	inputs, err := readTsconfigInputs(pkgDir)
 	if err != nil {
-		t.Fatalf("failed to create libA/.gitignore: %v", err)
+		t.Fatalf("failed to read missing tsconfig.json: %v", err)
+	}
+	if inputs != nil {
+		t.Errorf("expected no inputs without a tsconfig.json, got %v", inputs)
+	}
+
+	tsconfig := `{
+  // comments are allowed in tsconfig.json
+  "extends": "../tsconfig.base.json",
+  "include": ["src", "./types/**/*.d.ts", "../shared/**"],
+  "files": ["./global.d.ts"]
+}`
+	if err := pkgDir.Join("tsconfig.json").WriteFile([]byte(tsconfig), 0644); err != nil {
+		t.Fatalf("failed to write tsconfig.json: %v", err)
 	}
-	_, err = pkgIgnoreFile.WriteString(pkgIgnore)
+	inputs, err = readTsconfigInputs(pkgDir)
 	if err != nil {
-		t.Fatalf("failed to write contents to libA/.gitignore: %v", err)
+		t.Fatalf("failed to read tsconfig.json: %v", err)
 	}
-	pkgIgnoreFile.Close()
-	for path, spec := range files {
-		filename := path.ToSystemPath().RestoreAnchor(repoRoot)
-		err = fs.EnsureDir(filename.ToString())
-		if err != nil {
-			t.Fatalf("failed to ensure directories for %v: %v", filename, err)
+	expected := []string{"tsconfig.json", "src/**", "types/**/*.d.ts", "global.d.ts"}
+	if !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("readTsconfigInputs got %v, want %v", inputs, expected)
+	}
+
+	tracker := NewTracker("root", "global-hash", fs.Pipeline{}, nil)
+	tracker.tsconfigInputs = map[string][]string{"libA": expected}
+	if got := tracker.withTsconfigInputs("libA", nil); got != nil {
+		t.Errorf("expected tasks without inputs to be unchanged, got %v", got)
+	}
+	declared := []string{"README.md"}
+	got := tracker.withTsconfigInputs("libA", declared)
+	if want := append([]string{"README.md"}, expected...); !reflect.DeepEqual(got, want) {
+		t.Errorf("withTsconfigInputs got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(declared, []string{"README.md"}) {
+		t.Errorf("expected the declared inputs not to be modified, got %v", declared)
+	}
+}
+
+func Test_packageFileSpecDefaultInputsToken(t *testing.T) {
+	// <root>/
+	//   my-pkg/
+	//     .gitignore <- ignores .env
+	//     package.json
+	//     committed-file
+	//     uncommitted-file <- not added to git
+	//     .env <- ignored by git
+	repoRoot := fs.AbsolutePathFromUpstream(t.TempDir())
+	pkgDir := repoRoot.Join("my-pkg")
+	files := map[string]string{
+		".gitignore":     ".env\n",
+		"package.json":   "{}",
+		"committed-file": "committed bytes",
+	}
+	for name, contents := range files {
+		if err := pkgDir.Join(name).EnsureDir(); err != nil {
+			t.Fatalf("EnsureDir: %v", err)
 		}
-		f, err := os.Create(filename.ToString())
-		if err != nil {
-			t.Fatalf("failed to create file: %v: %v", filename, err)
+		if err := pkgDir.Join(name).WriteFile([]byte(contents), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "."},
+		{"config", "--local", "user.name", "test"},
+		{"config", "--local", "user.email", "test@example.com"},
+		{"add", "."},
+		{"commit", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoRoot.ToString()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v %v", args[0], err, string(out))
 		}
-		_, err = f.WriteString(spec.contents)
+	}
+	if err := pkgDir.Join("uncommitted-file").WriteFile([]byte("uncommitted bytes"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := pkgDir.Join(".env").WriteFile([]byte("SECRET=1"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	pkg := &fs.PackageJSON{Dir: turbopath.AnchoredSystemPath("my-pkg")}
+	testCases := []struct {
+		name          string
+		inputs        []string
+		defaultInputs hashing.DefaultInputs
+		want          []string
+	}{
+		{
+			name:   "no inputs hashes the default files",
+			inputs: []string{},
+			want:   []string{".gitignore", "committed-file", "package.json", "uncommitted-file"},
+		},
+		{
+			name:   "inputs replace the default files",
+			inputs: []string{".env"},
+			want:   []string{".env", "package.json"},
+		},
+		{
+			name:   "the token adds inputs to the default files",
+			inputs: []string{_defaultInputsToken, ".env"},
+			want:   []string{".env", ".gitignore", "committed-file", "package.json", "uncommitted-file"},
+		},
+		{
+			name:          "the token follows the default inputs policy",
+			inputs:        []string{_defaultInputsToken, ".env"},
+			defaultInputs: hashing.DefaultInputsTracked,
+			want:          []string{".env", ".gitignore", "committed-file", "package.json"},
+		},
+		{
+			name:   "negated globs remove files from the default",
+			inputs: []string{_defaultInputsToken, ".env", "!uncommitted-*", "!.gitignore"},
+			want:   []string{".env", "committed-file", "package.json"},
+		},
+		{
+			name:   "the token alone is the same as no inputs",
+			inputs: []string{_defaultInputsToken},
+			want:   []string{".gitignore", "committed-file", "package.json", "uncommitted-file"},
+		},
+	}
+	for _, tc := range testCases {
+		pfs := &packageFileSpec{pkg: "my-pkg", inputs: tc.inputs}
+		hashObject, err := pfs.hashObject(pkg, repoRoot, hashing.PackageDepsOptions{DefaultInputs: tc.defaultInputs})
 		if err != nil {
-			t.Fatalf("failed to write contents to %v: %v", filename, err)
+			t.Fatalf("%v: hashObject: %v", tc.name, err)
+		}
+		got := []string{}
+		for path := range hashObject {
+			got = append(got, path.ToString())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.name, got, tc.want)
 		}
-		f.Close()
 	}
-	// now that we've created the repo, expect our .gitignore file too
-	files[turbopath.AnchoredUnixPath("libA/.gitignore")] = fileHash{contents: "", hash: "3237694bc3312ded18386964a855074af7b066af"}
 
-	pkg := &fs.PackageJSON{
-		Dir: pkgName,
+	defaultHash, err := (&packageFileSpec{pkg: "my-pkg", inputs: []string{}}).hash(pkg, repoRoot, hashing.PackageDepsOptions{})
+	if err != nil {
+		t.Fatalf("hash: %v", err)
 	}
-	hashes, err := manuallyHashPackage(pkg, []string{}, turbopath.AbsolutePath(repoRoot.ToString()))
+	augmentedHash, err := (&packageFileSpec{pkg: "my-pkg", inputs: []string{_defaultInputsToken, ".env"}}).hash(pkg, repoRoot, hashing.PackageDepsOptions{})
 	if err != nil {
-		t.Fatalf("failed to calculate manual hashes: %v", err)
-	}
-	prefix := pkgName + "/"
-	prefixLen := len(prefix)
-	count := 0
-	for path, spec := range files {
-		if strings.HasPrefix(path.ToString(), prefix.ToString()) {
-			got, ok := hashes[turbopath.AnchoredUnixPath(path[prefixLen:])]
-			if !ok {
-				if spec.hash != "" {
-					t.Errorf("did not find hash for %v, but wanted one %v", path, prefixLen)
-				}
-			} else if got != spec.hash {
-				t.Errorf("hash of %v, got %v want %v", path, got, spec.hash)
-			} else {
-				count++
-			}
+		t.Fatalf("hash: %v", err)
+	}
+	if defaultHash == augmentedHash {
+		t.Error("expected adding .env to the default inputs to change the hash")
+	}
+}
+
+func Test_DefaultInputsOnlyHashedWhenApplicable(t *testing.T) {
+	taskHash := func(inputs []string, defaultInputs hashing.DefaultInputs) string {
+		t.Helper()
+		packageTask := &nodes.PackageTask{
+			TaskID:         "libA#build",
+			Task:           "build",
+			PackageName:    "libA",
+			Pkg:            &fs.PackageJSON{Name: "libA"},
+			TaskDefinition: &fs.TaskDefinition{Inputs: inputs},
+		}
+		tracker := NewTracker("root", "global-hash", fs.Pipeline{}, nil)
+		tracker.SetDefaultInputs(defaultInputs)
+		tracker.packageInputsHashes = packageFileHashes{
+			specFromPackageTask(packageTask).ToKey(): "file-hash",
 		}
+		hash, err := tracker.CalculateTaskHash(packageTask, nil, nil)
+		if err != nil {
+			t.Fatalf("CalculateTaskHash: %v", err)
+		}
+		return hash
+	}
+
+	unset := taskHash(nil, "")
+	if got := taskHash(nil, hashing.DefaultInputsAll); got != unset {
+		t.Errorf("expected hashing every file to keep the hash of tasks without inputs, got %v, want %v", got, unset)
 	}
-	if count != len(hashes) {
-		t.Errorf("found extra hashes in %v", hashes)
+	if got := taskHash(nil, hashing.DefaultInputsTracked); got == unset {
+		t.Error("expected hashing only tracked files to change the hash of tasks without inputs")
 	}
+	explicit := taskHash([]string{"src/**"}, "")
+	if got := taskHash([]string{"src/**"}, hashing.DefaultInputsTracked); got != explicit {
+		t.Errorf("expected the default inputs policy not to change the hash of tasks with inputs, got %v, want %v", got, explicit)
+	}
+}
 
-	count = 0
-	justFileHashes, err := manuallyHashPackage(pkg, []string{filepath.FromSlash("**/*file")}, turbopath.AbsolutePath(repoRoot.ToString()))
-	if err != nil {
-		t.Fatalf("failed to calculate manual hashes: %v", err)
-	}
-	for path, spec := range files {
-		if strings.HasPrefix(path.ToString(), prefix.ToString()) {
-			shouldInclude := strings.HasSuffix(path.ToString(), "file")
-			got, ok := justFileHashes[turbopath.AnchoredUnixPath(path[prefixLen:])]
-			if !ok && shouldInclude {
-				if spec.hash != "" {
-					t.Errorf("did not find hash for %v, but wanted one", path)
-				}
-			} else if shouldInclude && got != spec.hash {
-				t.Errorf("hash of %v, got %v want %v", path, got, spec.hash)
-			} else if shouldInclude {
-				count++
-			}
+func Test_ReadOnlyCacheScopeHashesLikeReadWrite(t *testing.T) {
+	taskHash := func(scope fs.CacheScope) string {
+		t.Helper()
+		packageTask := &nodes.PackageTask{
+			TaskID:         "libA#build",
+			Task:           "build",
+			PackageName:    "libA",
+			Pkg:            &fs.PackageJSON{Name: "libA"},
+			TaskDefinition: &fs.TaskDefinition{CacheScope: scope},
+		}
+		tracker := NewTracker("root", "global-hash", fs.Pipeline{}, nil)
+		tracker.packageInputsHashes = packageFileHashes{
+			specFromPackageTask(packageTask).ToKey(): "file-hash",
 		}
+		hash, err := tracker.CalculateTaskHash(packageTask, nil, nil)
+		if err != nil {
+			t.Fatalf("CalculateTaskHash: %v", err)
+		}
+		return hash
+	}
+
+	readWrite := taskHash(fs.CacheScopeBoth)
+	if got := taskHash(fs.CacheScopeReadOnly); got != readWrite {
+		t.Errorf("expected a readonly task to hash like a read-write one, got %v, want %v", got, readWrite)
 	}
-	if count != len(justFileHashes) {
-		t.Errorf("found extra hashes in %v", hashes)
+	if got := taskHash(fs.CacheScopeLocal); got == readWrite {
+		t.Error("expected a local-only task to hash differently from a read-write one")
 	}
 }
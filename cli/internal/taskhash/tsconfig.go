@@ -0,0 +1,73 @@
+package taskhash
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/vercel/turborepo/cli/internal/turbopath"
+	"muzzammil.xyz/jsonc"
+)
+
+const _tsconfigFile = "tsconfig.json"
+
+type tsconfigJSON struct {
+	Include []string `json:"include"`
+	Files   []string `json:"files"`
+}
+
+// readTsconfigInputs returns package-relative input globs for the files that the package's
+// tsconfig.json compiles, as listed in its "include" and "files" keys. The tsconfig.json itself
+// is always an input. It returns nil if the package has no tsconfig.json.
+func readTsconfigInputs(pkgDir turbopath.AbsolutePath) ([]string, error) {
+	tsconfigPath := pkgDir.Join(_tsconfigFile)
+	if !tsconfigPath.FileExists() {
+		return nil, nil
+	}
+	data, err := tsconfigPath.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	var tsconfig tsconfigJSON
+	if err := jsonc.Unmarshal(data, &tsconfig); err != nil {
+		return nil, fmt.Errorf("reading %v: %w", tsconfigPath, err)
+	}
+	inputs := []string{_tsconfigFile}
+	for _, include := range tsconfig.Include {
+		if glob, ok := tsconfigGlob(include); ok {
+			// TypeScript treats an include without wildcards or an extension as a directory
+			if !strings.ContainsAny(glob, "*?") && path.Ext(glob) == "" {
+				glob = path.Join(glob, "**")
+			}
+			inputs = append(inputs, glob)
+		}
+	}
+	for _, file := range tsconfig.Files {
+		if glob, ok := tsconfigGlob(file); ok {
+			inputs = append(inputs, glob)
+		}
+	}
+	return inputs, nil
+}
+
+// tsconfigGlob converts a path from tsconfig.json into a package-relative glob. Paths outside
+// of the package are skipped, since inputs can only match files in the package.
+func tsconfigGlob(p string) (string, bool) {
+	glob := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if glob == ".." || strings.HasPrefix(glob, "../") || path.IsAbs(glob) {
+		return "", false
+	}
+	return glob, true
+}
+
+// withTsconfigInputs adds the globs derived from the package's tsconfig.json to inputs.
+// Tasks without declared inputs already hash every file in the package, so they are left as they are.
+func (th *Tracker) withTsconfigInputs(pkgName string, inputs []string) []string {
+	tsconfigInputs := th.tsconfigInputs[pkgName]
+	if len(inputs) == 0 || len(tsconfigInputs) == 0 {
+		return inputs
+	}
+	merged := make([]string, 0, len(inputs)+len(tsconfigInputs))
+	merged = append(merged, inputs...)
+	return append(merged, tsconfigInputs...)
+}
@@ -18,8 +18,11 @@ const ansiEscapeStr = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-
 // IsTTY is true when stdout appears to be a tty
 var IsTTY = isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
 
+// IsCIEnvironment is true when the environment identifies itself as a CI provider.
+var IsCIEnvironment = os.Getenv("CI") != "" || os.Getenv("BUILD_NUMBER") != "" || os.Getenv("TEAMCITY_VERSION") != ""
+
 // IsCI is true when we appear to be running in a non-interactive context.
-var IsCI = !IsTTY || os.Getenv("CI") != "" || os.Getenv("BUILD_NUMBER") != "" || os.Getenv("TEAMCITY_VERSION") != ""
+var IsCI = !IsTTY || IsCIEnvironment
 var gray = color.New(color.Faint)
 var bold = color.New(color.Bold)
 var ERROR_PREFIX = color.New(color.Bold, color.FgRed, color.ReverseVideo).Sprint(" ERROR ")
@@ -91,15 +94,21 @@ func Default() *cli.ColoredUi {
 }
 
 func BuildColoredUi(colorMode ColorMode) *cli.ColoredUi {
+	return BuildColoredUiWithOutput(colorMode, os.Stdout)
+}
+
+// BuildColoredUiWithOutput is like BuildColoredUi, but writes regular output to out
+// rather than stdout
+func BuildColoredUiWithOutput(colorMode ColorMode, out io.Writer) *cli.ColoredUi {
 	colorMode = applyColorMode(colorMode)
 
 	var outWriter, errWriter io.Writer
 
 	if colorMode == ColorModeSuppressed {
-		outWriter = &stripAnsiWriter{wrappedWriter: os.Stdout}
+		outWriter = &stripAnsiWriter{wrappedWriter: out}
 		errWriter = &stripAnsiWriter{wrappedWriter: os.Stderr}
 	} else {
-		outWriter = os.Stdout
+		outWriter = out
 		errWriter = os.Stderr
 	}
 
@@ -16,17 +16,33 @@ func IsYarn(backendName string) bool {
 	return backendName == "nodejs-yarn" || backendName == "nodejs-berry"
 }
 
-func IsNMLinker(cwd string) (bool, error) {
+// PnPLinker is the nodeLinker berry uses when none is configured
+const PnPLinker = "pnp"
+
+// GetNodeLinker returns the nodeLinker configured in .yarnrc.yml, defaulting
+// to Plug'n'Play when the setting is absent.
+func GetNodeLinker(cwd string) (string, error) {
 	yarnRC := &YarnRC{}
 
 	bytes, err := ioutil.ReadFile(filepath.Join(cwd, ".yarnrc.yml"))
 	if err != nil {
-		return false, fmt.Errorf(".yarnrc.yml: %w", err)
+		return "", fmt.Errorf(".yarnrc.yml: %w", err)
+	}
+
+	if err := yaml.Unmarshal(bytes, yarnRC); err != nil {
+		return "", fmt.Errorf(".yarnrc.yml: %w", err)
 	}
 
-	if yaml.Unmarshal(bytes, yarnRC) != nil {
-		return false, fmt.Errorf(".yarnrc.yml: %w", err)
+	if yarnRC.NodeLinker == "" {
+		return PnPLinker, nil
 	}
+	return yarnRC.NodeLinker, nil
+}
 
-	return yarnRC.NodeLinker == "node-modules", nil
+func IsNMLinker(cwd string) (bool, error) {
+	nodeLinker, err := GetNodeLinker(cwd)
+	if err != nil {
+		return false, err
+	}
+	return nodeLinker == "node-modules", nil
 }
@@ -0,0 +1,65 @@
+package util
+
+import "sync"
+
+// DynamicSemaphore is a semaphore whose limit can be changed while it is in use.
+// Lowering the limit does not interrupt current holders, it only delays
+// further acquisitions until enough slots have been released.
+type DynamicSemaphore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	inUse int
+}
+
+// NewDynamicSemaphore creates a semaphore that initially allows up
+// to a given limit of simultaneous acquisitions
+func NewDynamicSemaphore(n int) *DynamicSemaphore {
+	if n <= 0 {
+		panic("semaphore with limit <=0")
+	}
+	s := &DynamicSemaphore{limit: n}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Acquire is used to acquire an available slot.
+// Blocks until available.
+func (s *DynamicSemaphore) Acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.inUse >= s.limit {
+		s.cond.Wait()
+	}
+	s.inUse++
+}
+
+// Release is used to return a slot. Acquire must
+// be called as a pre-condition.
+func (s *DynamicSemaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inUse == 0 {
+		panic("release without an acquire")
+	}
+	s.inUse--
+	s.cond.Signal()
+}
+
+// Limit returns the current limit of simultaneous acquisitions
+func (s *DynamicSemaphore) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// SetLimit changes the number of simultaneous acquisitions allowed
+func (s *DynamicSemaphore) SetLimit(n int) {
+	if n <= 0 {
+		panic("semaphore with limit <=0")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = n
+	s.cond.Broadcast()
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDynamicSemaphoreSetLimit(t *testing.T) {
+	s := NewDynamicSemaphore(1)
+	s.Acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		s.Acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected Acquire to block while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.SetLimit(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected Acquire to proceed after raising the limit")
+	}
+
+	s.SetLimit(1)
+	s.Release()
+	if s.Limit() != 1 {
+		t.Errorf("Limit() = %v, want 1", s.Limit())
+	}
+	s.Release()
+}
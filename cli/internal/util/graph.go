@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pyr-sh/dag"
@@ -17,12 +18,9 @@ func ValidateGraph(graph *dag.AcyclicGraph) error {
 	if len(cycles) > 0 {
 		cycleLines := make([]string, len(cycles))
 		for i, cycle := range cycles {
-			vertices := make([]string, len(cycle))
-			for j, vertex := range cycle {
-				vertices[j] = vertex.(string)
-			}
-			cycleLines[i] = "\t" + strings.Join(vertices, ",")
+			cycleLines[i] = "\t" + strings.Join(cyclePath(graph, cycle), " -> ")
 		}
+		sort.Strings(cycleLines)
 		return fmt.Errorf("cyclic dependency detected:\n%s", strings.Join(cycleLines, "\n"))
 	}
 
@@ -33,3 +31,69 @@ func ValidateGraph(graph *dag.AcyclicGraph) error {
 	}
 	return nil
 }
+
+// cyclePath returns a cycle through the vertices of a strongly connected component, e.g.
+// a#build -> b#build -> a#build, in which each vertex depends on the one after it
+func cyclePath(graph *dag.AcyclicGraph, cycle []dag.Vertex) []string {
+	members := make(map[string]bool, len(cycle))
+	names := make([]string, 0, len(cycle))
+	for _, vertex := range cycle {
+		name := vertex.(string)
+		members[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return FindCycle(names, func(name string) []string {
+		next := []string{}
+		for _, v := range graph.DownEdges(name).List() {
+			if members[v.(string)] {
+				next = append(next, v.(string))
+			}
+		}
+		sort.Strings(next)
+		return next
+	})
+}
+
+// FindCycle returns a chain of nodes, starting and ending with the same node, in which each
+// node depends on the one after it, or nil if there is no such cycle. The search starts from
+// each node in the given order, and follows dependencies in the order they are returned.
+func FindCycle(nodes []string, dependencies func(node string) []string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	stack := []string{}
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, next := range dependencies(node) {
+			switch state[next] {
+			case visiting:
+				for i, n := range stack {
+					if n == next {
+						return append(append([]string{}, stack[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = visited
+		return nil
+	}
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
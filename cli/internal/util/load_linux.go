@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// LoadAverage returns the system load average over the last minute
+func LoadAverage() (float64, error) {
+	contents, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg contents: %q", contents)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
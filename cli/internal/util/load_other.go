@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import "errors"
+
+// LoadAverage returns the system load average over the last minute
+func LoadAverage() (float64, error) {
+	return 0, errors.New("reading the load average is not supported on this platform")
+}
@@ -0,0 +1,64 @@
+package util
+
+import "fmt"
+
+// LogPrefixMode defines which parts of a task's name prefix its lines of output
+type LogPrefixMode int
+
+const (
+	// FullLogPrefix prefixes output with the package and task, as in web:build
+	FullLogPrefix LogPrefixMode = iota
+	// PackageLogPrefix prefixes output with only the package name
+	PackageLogPrefix
+	// TaskLogPrefix prefixes output with only the task name
+	TaskLogPrefix
+	// NoLogPrefix leaves output unprefixed
+	NoLogPrefix
+)
+
+const (
+	fullLogPrefixString    = "full"
+	packageLogPrefixString = "package"
+	taskLogPrefixString    = "task"
+	noLogPrefixString      = "none"
+)
+
+// LogPrefixModeStrings is an array containing the string representations for log prefix modes
+var LogPrefixModeStrings = []string{
+	fullLogPrefixString,
+	packageLogPrefixString,
+	taskLogPrefixString,
+	noLogPrefixString,
+}
+
+// FromLogPrefixModeString converts a log prefix mode's string representation into the enum value
+func FromLogPrefixModeString(value string) (LogPrefixMode, error) {
+	switch value {
+	case fullLogPrefixString:
+		return FullLogPrefix, nil
+	case packageLogPrefixString:
+		return PackageLogPrefix, nil
+	case taskLogPrefixString:
+		return TaskLogPrefix, nil
+	case noLogPrefixString:
+		return NoLogPrefix, nil
+	}
+
+	return FullLogPrefix, fmt.Errorf("invalid log prefix mode: %v", value)
+}
+
+// ToLogPrefixModeString converts a log prefix mode enum value into the string representation
+func ToLogPrefixModeString(value LogPrefixMode) (string, error) {
+	switch value {
+	case FullLogPrefix:
+		return fullLogPrefixString, nil
+	case PackageLogPrefix:
+		return packageLogPrefixString, nil
+	case TaskLogPrefix:
+		return taskLogPrefixString, nil
+	case NoLogPrefix:
+		return noLogPrefixString, nil
+	}
+
+	return "", fmt.Errorf("invalid log prefix mode: %v", value)
+}
@@ -13,8 +13,6 @@ import (
 var (
 	// alias so we can mock in tests
 	runtimeNumCPU = runtime.NumCPU
-	// positive values check for +Inf
-	_positiveInfinity = 1
 )
 
 func parseConcurrency(concurrencyRaw string) (int, error) {
@@ -22,10 +20,10 @@ func parseConcurrency(concurrencyRaw string) (int, error) {
 		if percent, err := strconv.ParseFloat(concurrencyRaw[:len(concurrencyRaw)-1], 64); err != nil {
 			return 0, fmt.Errorf("invalid value for --concurrency CLI flag. This should be a number --concurrency=4 or percentage of CPU cores --concurrency=50%% : %w", err)
 		} else {
-			if percent > 0 && !math.IsInf(percent, _positiveInfinity) {
+			if percent > 0 && percent <= 100 {
 				return int(math.Max(1, float64(runtimeNumCPU())*percent/100)), nil
 			} else {
-				return 0, fmt.Errorf("invalid percentage value for --concurrency CLI flag. This should be a percentage of CPU cores, between 1%% and 100%% : %w", err)
+				return 0, fmt.Errorf("invalid percentage value %v for --concurrency CLI flag. This should be a percentage of CPU cores, between 1%% and 100%%", concurrencyRaw)
 			}
 		}
 	} else if i, err := strconv.Atoi(concurrencyRaw); err != nil {
@@ -13,12 +13,12 @@ func TestParseConcurrency(t *testing.T) {
 		Expected int
 	}{
 		{
-			"12",
-			12,
+			"1",
+			1,
 		},
 		{
-			"200%",
-			20,
+			"12",
+			12,
 		},
 		{
 			"100%",
@@ -62,6 +62,10 @@ func TestInvalidPercents(t *testing.T) {
 	inputs := []string{
 		"asdf",
 		"-1",
+		"0",
+		"0%",
+		"101%",
+		"200%",
 		"-l%",
 		"infinity%",
 		"-infinity%",
@@ -17,13 +17,16 @@ const (
 	HashTaskOutput
 	// NewTaskOutput will show all new task output and turbo-computed task hashes for cached output
 	NewTaskOutput
+	// ErrorsOnlyTaskOutput will only show the output of tasks that fail, once they have exited
+	ErrorsOnlyTaskOutput
 )
 
 const (
-	fullTaskOutputString = "full"
-	noTaskOutputString   = "none"
-	hashTaskOutputString = "hash-only"
-	newTaskOutputString  = "new-only"
+	fullTaskOutputString       = "full"
+	noTaskOutputString         = "none"
+	hashTaskOutputString       = "hash-only"
+	newTaskOutputString        = "new-only"
+	errorsOnlyTaskOutputString = "errors-only"
 )
 
 // TaskOutputModeStrings is an array containing the string representations for task output modes
@@ -32,6 +35,7 @@ var TaskOutputModeStrings = []string{
 	noTaskOutputString,
 	hashTaskOutputString,
 	newTaskOutputString,
+	errorsOnlyTaskOutputString,
 }
 
 // FromTaskOutputModeString converts a task output mode's string representation into the enum value
@@ -45,6 +49,8 @@ func FromTaskOutputModeString(value string) (TaskOutputMode, error) {
 		return HashTaskOutput, nil
 	case newTaskOutputString:
 		return NewTaskOutput, nil
+	case errorsOnlyTaskOutputString:
+		return ErrorsOnlyTaskOutput, nil
 	}
 
 	return FullTaskOutput, fmt.Errorf("invalid task output mode: %v", value)
@@ -61,6 +67,8 @@ func ToTaskOutputModeString(value TaskOutputMode) (string, error) {
 		return hashTaskOutputString, nil
 	case NewTaskOutput:
 		return newTaskOutputString, nil
+	case ErrorsOnlyTaskOutput:
+		return errorsOnlyTaskOutputString, nil
 	}
 
 	return "", fmt.Errorf("invalid task output mode: %v", value)
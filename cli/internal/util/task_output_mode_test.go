@@ -0,0 +1,38 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskOutputModeStrings(t *testing.T) {
+	for _, value := range TaskOutputModeStrings {
+		mode, err := FromTaskOutputModeString(value)
+		assert.NoError(t, err, value)
+		roundTripped, err := ToTaskOutputModeString(mode)
+		assert.NoError(t, err, value)
+		assert.Equal(t, value, roundTripped)
+	}
+
+	var mode TaskOutputMode
+	assert.NoError(t, json.Unmarshal([]byte(`"errors-only"`), &mode))
+	assert.Equal(t, ErrorsOnlyTaskOutput, mode)
+
+	_, err := FromTaskOutputModeString("errors")
+	assert.EqualError(t, err, "invalid task output mode: errors")
+}
+
+func TestLogPrefixModeStrings(t *testing.T) {
+	for _, value := range LogPrefixModeStrings {
+		mode, err := FromLogPrefixModeString(value)
+		assert.NoError(t, err, value)
+		roundTripped, err := ToLogPrefixModeString(mode)
+		assert.NoError(t, err, value)
+		assert.Equal(t, value, roundTripped)
+	}
+
+	_, err := FromLogPrefixModeString("package-only")
+	assert.EqualError(t, err, "invalid log prefix mode: package-only")
+}
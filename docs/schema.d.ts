@@ -10,7 +10,8 @@ export interface Schema {
    *
    * Any other entry without this prefix, will be considered filesystem glob. The
    * contents of these files will be included in the global hashing algorithm and affect
-   * the hashes of all tasks.
+   * the hashes of all tasks. Globs can reference environment variables with ${VAR}
+   * (e.g. ${CONFIG_DIR}/shared.json), which must be set when turbo runs.
    *
    * This is useful for busting the cache based on .env files (not in Git), environment
    * variables, or any root level file that impacts package tasks (but are not represented
@@ -43,6 +44,37 @@ export interface Schema {
    * @default {}
    */
   remoteCache?: RemoteCache;
+  /**
+   * Named sets of tasks and flags for turbo run, selected with --config-profile.
+   * Flags given on the command line take precedence over the profile.
+   *
+   * @default {}
+   */
+  profiles?: {
+    [name: string]: Profile;
+  };
+  /**
+   * Replaces the prefixes of the environment variables that are hashed for tasks in
+   * packages of an inferred framework, keyed by framework slug (e.g. "nextjs"). Use
+   * "$TURBO_DEFAULT$" in the list to keep the framework's built-in prefix.
+   *
+   * @default {}
+   */
+  frameworkEnvPrefixes?: {
+    [framework: string]: string[];
+  };
+}
+
+export interface Profile {
+  /**
+   * The tasks to run when none are given on the command line.
+   */
+  tasks?: string[];
+  /**
+   * Any other key is the name of a turbo run flag, without its leading --, such as
+   * "filter" or "concurrency".
+   */
+  [flag: string]: string | number | boolean | Array<string | number | boolean> | undefined;
 }
 
 export interface Pipeline {
@@ -75,6 +107,10 @@ export interface Pipeline {
    * thus doesn't emit any filesystem artifacts (e.g. like a linter), but you still want
    * to cache its logs (and treat them like an artifact).
    *
+   * Globs are relative to the package. Globs prefixed with ! exclude the files they match
+   * from the other globs (e.g. ["dist/**", "!dist/*.map"]). Globs prefixed with // are
+   * relative to the repository root instead, and must stay within it (e.g. ["//dist/web/**"]).
+   *
    * @default ["dist/**", "build/**"]
    */
   outputs?: string[];
@@ -83,9 +119,14 @@ export interface Pipeline {
    * Whether or not to cache the task outputs. Setting cache to false is useful for daemon
    * or long-running "watch" or development mode tasks that you don't want to cache.
    *
+   * Use "local" to only cache the task in the local filesystem cache, e.g. for tasks that
+   * produce machine-specific artifacts, or "remote" to only use Remote Caching. Use
+   * "readonly" to restore outputs from the cache without ever caching new ones. true is
+   * equivalent to "both" and false to "none".
+   *
    * @default true
    */
-  cache?: boolean;
+  cache?: boolean | "local" | "remote" | "both" | "readonly" | "none";
 
   /**
    * The set of glob patterns to consider as inputs to this task.
@@ -95,6 +136,11 @@ export interface Pipeline {
    * will not cause a cache miss.
    *
    * If omitted or empty, all files in the package are considered as inputs.
+   * Otherwise the globs replace that default, unless they include the
+   * `$TURBO_DEFAULT$` token, which adds the default files back in. For example,
+   * `["$TURBO_DEFAULT$", ".env"]` also considers `.env` alongside the usual files.
+   * Alongside the token, globs prefixed with `!` remove files from the default, such as
+   * `["$TURBO_DEFAULT$", "!README.md"]`.
    * @default []
    */
   inputs?: string[];
@@ -103,11 +149,55 @@ export interface Pipeline {
    * The style of output for this task. Use "full" to display the entire output of
    * the task. Use "hash-only" to show only the computed task hashes. Use "new-only" to
    * show the full output of cache misses and the computed hashes for cache hits. Use
-   * "none" to hide task output.
+   * "errors-only" to show only the output of tasks that fail. Use "none" to hide task
+   * output. The --output-logs flag of `turbo run` overrides this for every task.
    *
    * @default full
    */
   outputMode?: string;
+
+  /**
+   * The set of glob patterns of files among the task's outputs that restoring them from
+   * the cache leaves as they are, such as an append-only log or a cache directory the
+   * task's tool manages. Like outputs, globs are relative to the package unless prefixed
+   * with //.
+   *
+   * @default []
+   */
+  preserveOutputs?: string[];
+
+  /**
+   * Whether the task is mostly bound by CPU, like a build, or by I/O, like a download.
+   * With `--experimental-concurrency-io-vs-cpu`, "io" tasks run under their own
+   * concurrency limit rather than `--concurrency`.
+   *
+   * @default "cpu"
+   */
+  resourceClass?: "cpu" | "io";
+
+  /**
+   * The set of glob patterns matching the SARIF reports among the task's outputs.
+   * With `--experimental-summary-sarif`, the reports of every task in the run,
+   * including those restored from cache, are merged into a single report.
+   *
+   * @default []
+   */
+  sarifOutputs?: string[];
+
+  /**
+   * How long the task may run for before it is killed and fails, as a duration
+   * such as "10m". Takes precedence over `--task-timeout`, so tasks that are
+   * meant to keep running, such as dev servers, can set it to "0" to never be killed.
+   */
+  timeout?: string;
+
+  /**
+   * Whether the `^` items in `dependsOn` only follow the workspace's `dependencies` and
+   * `optionalDependencies`, leaving out its `devDependencies`.
+   *
+   * @default false
+   */
+  prodDependenciesOnly?: boolean;
 }
 
 export interface RemoteCache {